@@ -4,7 +4,9 @@ import (
 	"flag"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -17,6 +19,18 @@ const (
 	ENV_STORAGE_PATH      = "BEMIDB_STORAGE_PATH"
 	ENV_LOG_LEVEL         = "BEMIDB_LOG_LEVEL"
 	ENV_STORAGE_TYPE      = "BEMIDB_STORAGE_TYPE"
+	ENV_MAX_RESULT_ROWS   = "BEMIDB_MAX_RESULT_ROWS"
+	ENV_MAX_RESULT_BYTES  = "BEMIDB_MAX_RESULT_BYTES"
+	ENV_STATEMENT_TIMEOUT = "BEMIDB_STATEMENT_TIMEOUT"
+	ENV_SHUTDOWN_TIMEOUT  = "BEMIDB_SHUTDOWN_TIMEOUT"
+	ENV_MAX_CONNECTIONS   = "BEMIDB_MAX_CONNECTIONS"
+	ENV_MAX_USER_QUERIES  = "BEMIDB_MAX_USER_QUERIES"
+	ENV_ADMIN_USER        = "BEMIDB_ADMIN_USER"
+	ENV_DISABLE_TCP       = "BEMIDB_DISABLE_TCP"
+	ENV_UNIX_SOCKET_DIR   = "BEMIDB_UNIX_SOCKET_DIR"
+	ENV_UNIX_SOCKET_PERMS = "BEMIDB_UNIX_SOCKET_PERMISSIONS"
+	ENV_KEEP_VERSIONS     = "BEMIDB_KEEP_TABLE_VERSIONS"
+	ENV_REFRESH_INTERVAL  = "BEMIDB_REFRESH_INTERVAL"
 
 	ENV_AWS_REGION            = "AWS_REGION"
 	ENV_AWS_S3_ENDPOINT       = "AWS_S3_ENDPOINT"
@@ -24,13 +38,14 @@ const (
 	ENV_AWS_ACCESS_KEY_ID     = "AWS_ACCESS_KEY_ID"
 	ENV_AWS_SECRET_ACCESS_KEY = "AWS_SECRET_ACCESS_KEY"
 
-	ENV_PG_DATABASE_URL    = "PG_DATABASE_URL"
-	ENV_PG_SYNC_INTERVAL   = "PG_SYNC_INTERVAL"
-	ENV_PG_SCHEMA_PREFIX   = "PG_SCHEMA_PREFIX"
-	ENV_PG_INCLUDE_SCHEMAS = "PG_INCLUDE_SCHEMAS"
-	ENV_PG_EXCLUDE_SCHEMAS = "PG_EXCLUDE_SCHEMAS"
-	ENV_PG_INCLUDE_TABLES  = "PG_INCLUDE_TABLES"
-	ENV_PG_EXCLUDE_TABLES  = "PG_EXCLUDE_TABLES"
+	ENV_PG_DATABASE_URL               = "PG_DATABASE_URL"
+	ENV_PG_SYNC_INTERVAL              = "PG_SYNC_INTERVAL"
+	ENV_PG_SCHEMA_PREFIX              = "PG_SCHEMA_PREFIX"
+	ENV_PG_INCLUDE_SCHEMAS            = "PG_INCLUDE_SCHEMAS"
+	ENV_PG_EXCLUDE_SCHEMAS            = "PG_EXCLUDE_SCHEMAS"
+	ENV_PG_INCLUDE_TABLES             = "PG_INCLUDE_TABLES"
+	ENV_PG_EXCLUDE_TABLES             = "PG_EXCLUDE_TABLES"
+	ENV_PG_REFRESH_MATERIALIZED_VIEWS = "PG_REFRESH_MATERIALIZED_VIEWS"
 
 	DEFAULT_PORT              = "54321"
 	DEFAULT_DATABASE          = "bemidb"
@@ -41,6 +56,15 @@ const (
 	DEFAULT_STORAGE_PATH      = "iceberg"
 	DEFAULT_LOG_LEVEL         = "INFO"
 	DEFAULT_DB_STORAGE_TYPE   = "LOCAL"
+	DEFAULT_MAX_RESULT_ROWS   = "0"
+	DEFAULT_MAX_RESULT_BYTES  = "0"
+	DEFAULT_STATEMENT_TIMEOUT = "0"
+	DEFAULT_SHUTDOWN_TIMEOUT  = "30s"
+	DEFAULT_MAX_CONNECTIONS   = "0"
+	DEFAULT_MAX_USER_QUERIES  = "0"
+	DEFAULT_UNIX_SOCKET_PERMS = "0777"
+	DEFAULT_KEEP_VERSIONS     = "3"
+	DEFAULT_REFRESH_INTERVAL  = "10s"
 
 	DEFAULT_AWS_S3_ENDPOINT = "s3.amazonaws.com"
 
@@ -57,31 +81,53 @@ type AwsConfig struct {
 }
 
 type PgConfig struct {
-	DatabaseUrl    string
-	SyncInterval   string // optional
-	SchemaPrefix   string // optional
-	IncludeSchemas *Set   // optional
-	ExcludeSchemas *Set   // optional
-	IncludeTables  *Set   // optional
-	ExcludeTables  *Set   // optional
+	DatabaseUrl              string
+	SyncInterval             string // optional
+	SchemaPrefix             string // optional
+	IncludeSchemas           *Set   // optional
+	ExcludeSchemas           *Set   // optional
+	IncludeTables            *Set   // optional
+	ExcludeTables            *Set   // optional
+	RefreshMaterializedViews bool   // optional, refresh materialized views after each sync
 }
 
 type Config struct {
 	Host              string
 	Port              string
+	DisableTcp        bool        // optional, only listen on the Unix socket
+	UnixSocketDir     string      // optional, directory of the .s.PGSQL.<port> socket file
+	UnixSocketPerms   os.FileMode // optional, permissions of the socket file
 	Database          string
 	User              string
+	AdminUser         string // optional, has a reserved connection slot and no query limit
 	EncryptedPassword string
 	InitSqlFilepath   string
 	LogLevel          string
 	StorageType       string
 	StoragePath       string
+	MaxResultRows     int64         // optional, 0 means unlimited
+	MaxResultBytes    int64         // optional, 0 means unlimited
+	StatementTimeout  time.Duration // optional, 0 means no timeout
+	ShutdownTimeout   time.Duration // grace period for running queries on shutdown
+	MaxConnections    int64         // optional, 0 means unlimited
+	MaxUserQueries    int64         // optional, concurrent queries per user, 0 means unlimited
+	KeepTableVersions int64         // versions of each Iceberg table kept for open transactions, including the current one
+	RefreshInterval   time.Duration // how often the server reloads synced tables and views from the storage
 	Aws               AwsConfig
 	Pg                PgConfig
 }
 
 type configParseValues struct {
 	password         string
+	maxResultRows    string
+	maxResultBytes   string
+	statementTimeout string
+	shutdownTimeout  string
+	maxConnections   string
+	maxUserQueries   string
+	keepVersions     string
+	refreshInterval  string
+	unixSocketPerms  string
 	pgIncludeSchemas string
 	pgExcludeSchemas string
 	pgIncludeTables  string
@@ -98,19 +144,32 @@ func init() {
 func registerFlags() {
 	flag.StringVar(&_config.Host, "host", os.Getenv(ENV_HOST), "Database host. Default: \""+DEFAULT_HOST+"\"")
 	flag.StringVar(&_config.Port, "port", os.Getenv(ENV_PORT), "Port for BemiDB to listen on. Default: \""+DEFAULT_PORT+"\"")
+	flag.BoolVar(&_config.DisableTcp, "disable-tcp", os.Getenv(ENV_DISABLE_TCP) == "true", "(Optional) Don't listen on TCP, only on the Unix socket")
+	flag.StringVar(&_config.UnixSocketDir, "unix-socket-dir", os.Getenv(ENV_UNIX_SOCKET_DIR), "(Optional) Directory for the Unix socket file .s.PGSQL.<port>, e.g., \"/var/run/bemidb\"")
+	flag.StringVar(&_configParseValues.unixSocketPerms, "unix-socket-permissions", os.Getenv(ENV_UNIX_SOCKET_PERMS), "(Optional) Permissions of the Unix socket file in octal. Default: \""+DEFAULT_UNIX_SOCKET_PERMS+"\"")
 	flag.StringVar(&_config.Database, "database", os.Getenv(ENV_DATABASE), "Database name. Default: \""+DEFAULT_DATABASE+"\"")
 	flag.StringVar(&_config.User, "user", os.Getenv(ENV_USER), "Database user. Default: \""+DEFAULT_USER+"\"")
+	flag.StringVar(&_config.AdminUser, "admin-user", os.Getenv(ENV_ADMIN_USER), "(Optional) Admin user with a reserved connection slot and no limit on concurrent queries")
 	flag.StringVar(&_configParseValues.password, "password", os.Getenv(ENV_PASSWORD), "Database password. Default: \""+DEFAULT_PASSWORD+"\"")
 	flag.StringVar(&_config.StoragePath, "storage-path", os.Getenv(ENV_STORAGE_PATH), "Path to the storage folder. Default: \""+DEFAULT_STORAGE_PATH+"\"")
 	flag.StringVar(&_config.InitSqlFilepath, "init-sql", os.Getenv(ENV_INIT_SQL_FILEPATH), "Path to the initialization SQL file. Default: \""+DEFAULT_INIT_SQL_FILEPATH+"\"")
 	flag.StringVar(&_config.LogLevel, "log-level", os.Getenv(ENV_LOG_LEVEL), "Log level: \"ERROR\", \"WARN\", \"INFO\", \"DEBUG\", \"TRACE\". Default: \""+DEFAULT_LOG_LEVEL+"\"")
 	flag.StringVar(&_config.StorageType, "storage-type", os.Getenv(ENV_STORAGE_TYPE), "Storage type: \"LOCAL\", \"S3\". Default: \""+DEFAULT_DB_STORAGE_TYPE+"\"")
+	flag.StringVar(&_configParseValues.maxResultRows, "max-result-rows", os.Getenv(ENV_MAX_RESULT_ROWS), "(Optional) Maximum number of rows returned by a query. Default: \""+DEFAULT_MAX_RESULT_ROWS+"\" (unlimited)")
+	flag.StringVar(&_configParseValues.maxResultBytes, "max-result-bytes", os.Getenv(ENV_MAX_RESULT_BYTES), "(Optional) Maximum size of data returned by a query in bytes. Default: \""+DEFAULT_MAX_RESULT_BYTES+"\" (unlimited)")
+	flag.StringVar(&_configParseValues.statementTimeout, "statement-timeout", os.Getenv(ENV_STATEMENT_TIMEOUT), "(Optional) Default timeout for queries in milliseconds or with a unit: \"ms\", \"s\", \"min\", \"h\". Default: \""+DEFAULT_STATEMENT_TIMEOUT+"\" (no timeout)")
+	flag.StringVar(&_configParseValues.shutdownTimeout, "shutdown-timeout", os.Getenv(ENV_SHUTDOWN_TIMEOUT), "(Optional) Time to let running queries finish on shutdown. Valid units: \"ns\", \"us\" (or \"µs\"), \"ms\", \"s\", \"m\", \"h\". Default: \""+DEFAULT_SHUTDOWN_TIMEOUT+"\"")
+	flag.StringVar(&_configParseValues.refreshInterval, "refresh-interval", os.Getenv(ENV_REFRESH_INTERVAL), "(Optional) How often to reload synced tables and views from the storage. Valid units: \"ns\", \"us\" (or \"µs\"), \"ms\", \"s\", \"m\", \"h\". Default: \""+DEFAULT_REFRESH_INTERVAL+"\"")
+	flag.StringVar(&_configParseValues.maxConnections, "max-connections", os.Getenv(ENV_MAX_CONNECTIONS), "(Optional) Maximum number of client connections. Default: \""+DEFAULT_MAX_CONNECTIONS+"\" (unlimited)")
+	flag.StringVar(&_configParseValues.maxUserQueries, "max-user-queries", os.Getenv(ENV_MAX_USER_QUERIES), "(Optional) Maximum number of concurrent queries per user, other queries wait. Default: \""+DEFAULT_MAX_USER_QUERIES+"\" (unlimited)")
+	flag.StringVar(&_configParseValues.keepVersions, "keep-table-versions", os.Getenv(ENV_KEEP_VERSIONS), "(Optional) Number of versions of each table to keep in storage for transactions that are still reading older versions. Default: \""+DEFAULT_KEEP_VERSIONS+"\"")
 	flag.StringVar(&_config.Pg.SchemaPrefix, "pg-schema-prefix", os.Getenv(ENV_PG_SCHEMA_PREFIX), "(Optional) Prefix for PostgreSQL schema names")
 	flag.StringVar(&_config.Pg.SyncInterval, "pg-sync-interval", os.Getenv(ENV_PG_SYNC_INTERVAL), "(Optional) Interval between syncs. Valid units: \"ns\", \"us\" (or \"µs\"), \"ms\", \"s\", \"m\", \"h\"")
 	flag.StringVar(&_configParseValues.pgIncludeSchemas, "pg-include-schemas", os.Getenv(ENV_PG_INCLUDE_SCHEMAS), "(Optional) Comma-separated list of schemas to include in sync")
 	flag.StringVar(&_configParseValues.pgExcludeSchemas, "pg-exclude-schemas", os.Getenv(ENV_PG_EXCLUDE_SCHEMAS), "(Optional) Comma-separated list of schemas to exclude from sync")
 	flag.StringVar(&_configParseValues.pgIncludeTables, "pg-include-tables", os.Getenv(ENV_PG_INCLUDE_TABLES), "(Optional) Comma-separated list of tables to include in sync (format: schema.table)")
 	flag.StringVar(&_configParseValues.pgExcludeTables, "pg-exclude-tables", os.Getenv(ENV_PG_EXCLUDE_TABLES), "(Optional) Comma-separated list of tables to exclude from sync (format: schema.table)")
+	flag.BoolVar(&_config.Pg.RefreshMaterializedViews, "pg-refresh-materialized-views", os.Getenv(ENV_PG_REFRESH_MATERIALIZED_VIEWS) == "true", "(Optional) Refresh materialized views after each sync")
 	flag.StringVar(&_config.Pg.DatabaseUrl, "pg-database-url", os.Getenv(ENV_PG_DATABASE_URL), "PostgreSQL database URL to sync")
 	flag.StringVar(&_config.Aws.Region, "aws-region", os.Getenv(ENV_AWS_REGION), "AWS region")
 	flag.StringVar(&_config.Aws.S3Endpoint, "aws-s3-endpoint", os.Getenv(ENV_AWS_S3_ENDPOINT), "AWS S3 endpoint. Default: \""+DEFAULT_AWS_S3_ENDPOINT+"\"")
@@ -131,6 +190,17 @@ func parseFlags() {
 	if _config.Database == "" {
 		_config.Database = DEFAULT_DATABASE
 	}
+	if _config.DisableTcp && _config.UnixSocketDir == "" {
+		panic("Unix socket directory is required when TCP is disabled")
+	}
+	if _configParseValues.unixSocketPerms == "" {
+		_configParseValues.unixSocketPerms = DEFAULT_UNIX_SOCKET_PERMS
+	}
+	unixSocketPerms, err := strconv.ParseUint(_configParseValues.unixSocketPerms, 8, 32)
+	if err != nil || unixSocketPerms > 0777 {
+		panic("Invalid Unix socket permissions " + _configParseValues.unixSocketPerms + ". Must be an octal number like \"0770\"")
+	}
+	_config.UnixSocketPerms = os.FileMode(unixSocketPerms)
 	if _config.User == "" {
 		_config.User = DEFAULT_USER
 	}
@@ -159,6 +229,70 @@ func parseFlags() {
 	} else if !slices.Contains(STORAGE_TYPES, _config.StorageType) {
 		panic("Invalid storage type " + _config.StorageType + ". Must be one of " + strings.Join(STORAGE_TYPES, ", "))
 	}
+	if _configParseValues.maxResultRows == "" {
+		_configParseValues.maxResultRows = DEFAULT_MAX_RESULT_ROWS
+	}
+	maxResultRows, err := strconv.ParseInt(_configParseValues.maxResultRows, 10, 64)
+	if err != nil || maxResultRows < 0 {
+		panic("Invalid max result rows " + _configParseValues.maxResultRows + ". Must be a non-negative integer")
+	}
+	_config.MaxResultRows = maxResultRows
+	if _configParseValues.maxResultBytes == "" {
+		_configParseValues.maxResultBytes = DEFAULT_MAX_RESULT_BYTES
+	}
+	maxResultBytes, err := strconv.ParseInt(_configParseValues.maxResultBytes, 10, 64)
+	if err != nil || maxResultBytes < 0 {
+		panic("Invalid max result bytes " + _configParseValues.maxResultBytes + ". Must be a non-negative integer")
+	}
+	_config.MaxResultBytes = maxResultBytes
+	if _configParseValues.statementTimeout == "" {
+		_configParseValues.statementTimeout = DEFAULT_STATEMENT_TIMEOUT
+	}
+	statementTimeout, err := ParseStatementTimeout(_configParseValues.statementTimeout)
+	if err != nil {
+		panic("Invalid statement timeout " + _configParseValues.statementTimeout + ". Must be a non-negative number of milliseconds or a duration like \"30s\"")
+	}
+	_config.StatementTimeout = statementTimeout
+	if _configParseValues.shutdownTimeout == "" {
+		_configParseValues.shutdownTimeout = DEFAULT_SHUTDOWN_TIMEOUT
+	}
+	shutdownTimeout, err := time.ParseDuration(_configParseValues.shutdownTimeout)
+	if err != nil || shutdownTimeout < 0 {
+		panic("Invalid shutdown timeout " + _configParseValues.shutdownTimeout + ". Must be a non-negative duration like \"30s\"")
+	}
+	_config.ShutdownTimeout = shutdownTimeout
+	if _configParseValues.refreshInterval == "" {
+		_configParseValues.refreshInterval = DEFAULT_REFRESH_INTERVAL
+	}
+	refreshInterval, err := time.ParseDuration(_configParseValues.refreshInterval)
+	if err != nil || refreshInterval <= 0 {
+		panic("Invalid refresh interval " + _configParseValues.refreshInterval + ". Must be a positive duration like \"10s\"")
+	}
+	_config.RefreshInterval = refreshInterval
+	if _configParseValues.maxConnections == "" {
+		_configParseValues.maxConnections = DEFAULT_MAX_CONNECTIONS
+	}
+	maxConnections, err := strconv.ParseInt(_configParseValues.maxConnections, 10, 64)
+	if err != nil || maxConnections < 0 {
+		panic("Invalid max connections " + _configParseValues.maxConnections + ". Must be a non-negative integer")
+	}
+	_config.MaxConnections = maxConnections
+	if _configParseValues.maxUserQueries == "" {
+		_configParseValues.maxUserQueries = DEFAULT_MAX_USER_QUERIES
+	}
+	maxUserQueries, err := strconv.ParseInt(_configParseValues.maxUserQueries, 10, 64)
+	if err != nil || maxUserQueries < 0 {
+		panic("Invalid max user queries " + _configParseValues.maxUserQueries + ". Must be a non-negative integer")
+	}
+	_config.MaxUserQueries = maxUserQueries
+	if _configParseValues.keepVersions == "" {
+		_configParseValues.keepVersions = DEFAULT_KEEP_VERSIONS
+	}
+	keepVersions, err := strconv.ParseInt(_configParseValues.keepVersions, 10, 64)
+	if err != nil || keepVersions < 1 {
+		panic("Invalid keep table versions " + _configParseValues.keepVersions + ". Must be a positive integer")
+	}
+	_config.KeepTableVersions = keepVersions
 	if _config.StorageType == STORAGE_TYPE_S3 {
 		if _config.Aws.Region == "" {
 			panic("AWS region is required")
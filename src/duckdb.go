@@ -4,11 +4,12 @@ import (
 	"bufio"
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"os"
 	"regexp"
 	"strings"
 
-	_ "github.com/marcboeker/go-duckdb"
+	duckDb "github.com/marcboeker/go-duckdb"
 )
 
 var DEFAULT_BOOT_QUERIES = []string{
@@ -21,18 +22,22 @@ var DEFAULT_BOOT_QUERIES = []string{
 }
 
 type Duckdb struct {
-	db     *sql.DB
-	config *Config
+	db                *sql.DB
+	conn              *sql.Conn // Dedicated connection of a client session, nil for the shared database
+	connector         *duckDb.Connector
+	connectionQueries []string // SET and USE boot queries, which only apply to the connection they run on
+	config            *Config
 }
 
 func NewDuckdb(config *Config) *Duckdb {
 	ctx := context.Background()
-	db, err := sql.Open("duckdb", "")
+	connector, err := duckDb.NewConnector("", nil)
 	PanicIfError(err)
 
 	duckdb := &Duckdb{
-		db:     db,
-		config: config,
+		db:        sql.OpenDB(connector),
+		connector: connector,
+		config:    config,
 	}
 
 	bootQueries := readDuckdbInitFile(config)
@@ -42,6 +47,10 @@ func NewDuckdb(config *Config) *Duckdb {
 	for _, query := range bootQueries {
 		_, err := duckdb.ExecContext(ctx, query, nil)
 		PanicIfError(err)
+
+		if isConnectionQuery(query) {
+			duckdb.connectionQueries = append(duckdb.connectionQueries, query)
+		}
 	}
 
 	switch config.StorageType {
@@ -59,31 +68,73 @@ func NewDuckdb(config *Config) *Duckdb {
 		if config.LogLevel == LOG_LEVEL_TRACE {
 			_, err = duckdb.ExecContext(ctx, "SET enable_http_logging=true", nil)
 			PanicIfError(err)
+			duckdb.connectionQueries = append(duckdb.connectionQueries, "SET enable_http_logging=true")
 		}
 	}
 
 	return duckdb
 }
 
+// Opens a dedicated connection to the same database for a client session, so that settings
+// and temporary objects aren't shared with other sessions. DuckDB materializes query results,
+// so the connection can run other queries while the rows of cursors and suspended portals are open.
+func (duckdb *Duckdb) Connect(ctx context.Context) (*Duckdb, error) {
+	db := sql.OpenDB(&sessionConnector{connector: duckdb.connector})
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	sessionDuckdb := &Duckdb{db: db, conn: conn, config: duckdb.config}
+	for _, query := range duckdb.connectionQueries {
+		_, err := sessionDuckdb.ExecContext(ctx, query, nil)
+		if err != nil {
+			sessionDuckdb.Close()
+			return nil, err
+		}
+	}
+
+	return sessionDuckdb, nil
+}
+
 func (duckdb *Duckdb) ExecContext(ctx context.Context, query string, args map[string]string) (sql.Result, error) {
 	LogDebug(duckdb.config, "Querying DuckDB:", query, args)
-	return duckdb.db.ExecContext(ctx, replaceNamedStringArgs(query, args))
+	return duckdb.queryer().ExecContext(ctx, replaceNamedStringArgs(query, args))
 }
 
 func (duckdb *Duckdb) QueryContext(ctx context.Context, query string) (*sql.Rows, error) {
 	LogDebug(duckdb.config, "Querying DuckDB:", query)
-	return duckdb.db.QueryContext(ctx, query)
+	return duckdb.queryer().QueryContext(ctx, query)
 }
 
 func (duckdb *Duckdb) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	LogDebug(duckdb.config, "Preparing DuckDB statement:", query)
-	return duckdb.db.PrepareContext(ctx, query)
+	return duckdb.queryer().PrepareContext(ctx, query)
 }
 
 func (duckdb *Duckdb) Close() {
+	if duckdb.conn != nil {
+		duckdb.conn.Close()
+	}
 	duckdb.db.Close()
 }
 
+func (duckdb *Duckdb) queryer() queryer {
+	if duckdb.conn != nil {
+		return duckdb.conn
+	}
+	return duckdb.db
+}
+
+func isConnectionQuery(query string) bool {
+	upperQuery := strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(upperQuery, "USE ") ||
+		(strings.HasPrefix(upperQuery, "SET ") && !strings.HasPrefix(upperQuery, "SET GLOBAL "))
+}
+
 func replaceNamedStringArgs(query string, args map[string]string) string {
 	re := regexp.MustCompile(`['";]`) // Escape single quotes, double quotes, and semicolons from args
 
@@ -116,3 +167,25 @@ func readDuckdbInitFile(config *Config) []string {
 	PanicIfError(scanner.Err())
 	return lines
 }
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Implemented by *sql.DB and *sql.Conn
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Connects to the shared database without closing it when a session's connection is closed
+type sessionConnector struct {
+	connector *duckDb.Connector
+}
+
+func (connector *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return connector.connector.Connect(ctx)
+}
+
+func (connector *sessionConnector) Driver() driver.Driver {
+	return connector.connector.Driver()
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"testing"
+	"time"
 )
 
 func TestNewDuckdb(t *testing.T) {
@@ -30,3 +31,37 @@ func TestNewDuckdb(t *testing.T) {
 		}
 	})
 }
+
+func TestDuckdbConnect(t *testing.T) {
+	t.Run("Runs queries while the rows of another query are open", func(t *testing.T) {
+		config := loadTestConfig()
+		duckdb := NewDuckdb(config)
+		defer duckdb.Close()
+		sessionDuckdb, err := duckdb.Connect(context.Background())
+		if err != nil {
+			t.Fatalf("Expected connecting to succeed, got %v", err)
+		}
+		defer sessionDuckdb.Close()
+
+		rows, err := sessionDuckdb.QueryContext(context.Background(), "SELECT x FROM range(100000) t(x)")
+		if err != nil {
+			t.Fatalf("Expected query to succeed, got %v", err)
+		}
+		defer rows.Close()
+		rows.Next()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		otherRows, err := sessionDuckdb.QueryContext(ctx, "SELECT 1")
+		if err != nil {
+			t.Fatalf("Expected the second query to succeed, got %v", err)
+		}
+		otherRows.Close()
+
+		var x int
+		err = rows.Scan(&x)
+		if err != nil || x != 0 {
+			t.Errorf("Expected the first query to return 0, got %d (%v)", x, err)
+		}
+	})
+}
@@ -14,6 +14,7 @@ require (
 	github.com/marcboeker/go-duckdb v1.8.3
 	github.com/pganalyze/pg_query_go/v5 v5.1.0
 	github.com/xitongsys/parquet-go v1.6.3-0.20240813051905-693d3323dee0
+	google.golang.org/protobuf v1.35.1
 )
 
 require (
@@ -61,6 +62,5 @@ require (
 	golang.org/x/text v0.21.0 // indirect
 	golang.org/x/tools v0.26.0 // indirect
 	golang.org/x/xerrors v0.0.0-20231012003039-104605ab7028 // indirect
-	google.golang.org/protobuf v1.35.1 // indirect
 	gopkg.in/linkedin/goavro.v1 v1.0.5 // indirect
 )
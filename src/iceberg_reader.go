@@ -1,13 +1,20 @@
 package main
 
+import (
+	"sync"
+)
+
 type IcebergReader struct {
 	config  *Config
 	storage Storage
+
+	schemaFieldsMutex sync.Mutex
+	schemaFields      map[string][]IcebergSchemaField // Metadata files are immutable, so they're cached by path
 }
 
 func NewIcebergReader(config *Config) *IcebergReader {
 	storage := NewStorage(config)
-	return &IcebergReader{config: config, storage: storage}
+	return &IcebergReader{config: config, storage: storage, schemaFields: make(map[string][]IcebergSchemaField)}
 }
 
 func (reader *IcebergReader) Schemas() (icebergSchemas []string, err error) {
@@ -23,3 +30,35 @@ func (reader *IcebergReader) SchemaTables() (icebergSchemaTables []IcebergSchema
 func (reader *IcebergReader) MetadataFilePath(icebergSchemaTable IcebergSchemaTable) string {
 	return reader.storage.IcebergMetadataFilePath(icebergSchemaTable)
 }
+
+func (reader *IcebergReader) SnapshotSummary(metadataFilePath string) (snapshot IcebergSnapshot, err error) {
+	LogDebug(reader.config, "Reading Iceberg snapshot summary...")
+	return reader.storage.IcebergSnapshotSummary(metadataFilePath)
+}
+
+func (reader *IcebergReader) ViewDefinitions() (viewDefinitions []ViewDefinition, err error) {
+	LogDebug(reader.config, "Reading view definitions...")
+	return reader.storage.ViewDefinitions()
+}
+
+func (reader *IcebergReader) NativeTables() (nativeTables []NativeTable, err error) {
+	LogDebug(reader.config, "Reading native tables...")
+	return reader.storage.NativeTables()
+}
+
+func (reader *IcebergReader) SchemaFields(metadataFilePath string) (icebergSchemaFields []IcebergSchemaField, err error) {
+	reader.schemaFieldsMutex.Lock()
+	defer reader.schemaFieldsMutex.Unlock()
+
+	if icebergSchemaFields, ok := reader.schemaFields[metadataFilePath]; ok {
+		return icebergSchemaFields, nil
+	}
+
+	LogDebug(reader.config, "Reading Iceberg schema fields...")
+	icebergSchemaFields, err = reader.storage.IcebergSchemaFields(metadataFilePath)
+	if err != nil {
+		return nil, err
+	}
+	reader.schemaFields[metadataFilePath] = icebergSchemaFields
+	return icebergSchemaFields, nil
+}
@@ -329,28 +329,58 @@ const (
 	}`
 )
 
+// Writes a new version of the table. The version hint is updated last, so that readers switch to the new version at once.
 func (icebergWriter *IcebergWriter) Write(schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) {
-	err := icebergWriter.storage.DeleteSchemaTable(schemaTable)
+	previousVersion, _ := icebergWriter.writeVersion(schemaTable, pgSchemaColumns, loadRows, false)
+
+	// Keep the latest versions for transactions that started reading them before this write.
+	// Each version is written from scratch, so older versions aren't referenced by the kept ones.
+	minVersion := previousVersion + 2 - icebergWriter.config.KeepTableVersions
+	if minVersion <= 1 {
+		return
+	}
+	err := icebergWriter.storage.DeleteOldVersions(schemaTable, minVersion)
+	PanicIfError(err)
+}
+
+// Writes a new version of the table with an append snapshot, which keeps the data files of the previous versions.
+// Returns the number of appended rows.
+func (icebergWriter *IcebergWriter) Append(schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) int64 {
+	_, recordCount := icebergWriter.writeVersion(schemaTable, pgSchemaColumns, loadRows, true)
+	return recordCount
+}
+
+func (icebergWriter *IcebergWriter) writeVersion(schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string, isAppend bool) (previousVersion int64, recordCount int64) {
+	previousVersion, err := icebergWriter.storage.MetadataVersion(schemaTable)
 	PanicIfError(err)
+	version := previousVersion + 1
 
-	dataDirPath := icebergWriter.storage.CreateDataDir(schemaTable)
+	var previousSnapshot IcebergSnapshot
+	if isAppend && previousVersion > 0 {
+		previousSnapshot, err = icebergWriter.storage.CurrentSnapshot(schemaTable, previousVersion)
+		PanicIfError(err)
+	}
+
+	dataDirPath := icebergWriter.storage.CreateDataDir(schemaTable, version)
 
 	parquetFile, err := icebergWriter.storage.CreateParquet(dataDirPath, pgSchemaColumns, loadRows)
 	PanicIfError(err)
 
-	metadataDirPath := icebergWriter.storage.CreateMetadataDir(schemaTable)
+	metadataDirPath := icebergWriter.storage.CreateMetadataDir(schemaTable, version)
 
 	manifestFile, err := icebergWriter.storage.CreateManifest(metadataDirPath, parquetFile)
 	PanicIfError(err)
 
-	manifestListFile, err := icebergWriter.storage.CreateManifestList(metadataDirPath, parquetFile, manifestFile)
+	manifestListFile, err := icebergWriter.storage.CreateManifestList(metadataDirPath, parquetFile, manifestFile, previousSnapshot)
 	PanicIfError(err)
 
-	metadataFile, err := icebergWriter.storage.CreateMetadata(metadataDirPath, pgSchemaColumns, parquetFile, manifestFile, manifestListFile)
+	metadataFile, err := icebergWriter.storage.CreateMetadata(schemaTable, version, pgSchemaColumns, parquetFile, manifestFile, manifestListFile, previousSnapshot)
 	PanicIfError(err)
 
-	err = icebergWriter.storage.CreateVersionHint(metadataDirPath, metadataFile)
+	err = icebergWriter.storage.CreateVersionHint(schemaTable, metadataFile)
 	PanicIfError(err)
+
+	return previousVersion, parquetFile.RecordCount
 }
 
 func (icebergWriter *IcebergWriter) DeleteSchemaTable(schemaTable IcebergSchemaTable) {
@@ -362,3 +392,12 @@ func (icebergWriter *IcebergWriter) DeleteSchema(schema string) {
 	err := icebergWriter.storage.DeleteSchema(schema)
 	PanicIfError(err)
 }
+
+// Called while handling queries, so the error is returned to the client instead of panicking
+func (icebergWriter *IcebergWriter) WriteViewDefinitions(viewDefinitions []ViewDefinition) error {
+	return icebergWriter.storage.WriteViewDefinitions(viewDefinitions)
+}
+
+func (icebergWriter *IcebergWriter) WriteNativeTables(nativeTables []NativeTable) error {
+	return icebergWriter.storage.WriteNativeTables(nativeTables)
+}
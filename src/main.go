@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -11,8 +17,16 @@ const VERSION = "0.31.4"
 func main() {
 	config := LoadConfig()
 
+	// Canceled on SIGTERM/SIGINT. A second signal terminates the process right away.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	if len(flag.Args()) == 0 {
-		start(config)
+		start(ctx, config)
 		return
 	}
 
@@ -20,7 +34,7 @@ func main() {
 
 	switch command {
 	case "start":
-		start(config)
+		start(ctx, config)
 	case "sync":
 		if config.Pg.SyncInterval != "" {
 			duration, err := time.ParseDuration(config.Pg.SyncInterval)
@@ -28,13 +42,17 @@ func main() {
 				panic("Invalid interval format: " + config.Pg.SyncInterval)
 			}
 			LogInfo(config, "Starting sync loop with interval:", config.Pg.SyncInterval)
-			for {
-				syncFromPg(config)
+			for ctx.Err() == nil {
+				syncFromPg(ctx, config)
 				LogInfo(config, "Sleeping for", config.Pg.SyncInterval)
-				time.Sleep(duration)
+				select {
+				case <-ctx.Done():
+				case <-time.After(duration):
+				}
 			}
+			LogInfo(config, "Sync loop stopped")
 		} else {
-			syncFromPg(config)
+			syncFromPg(ctx, config)
 		}
 	case "version":
 		fmt.Println("BemiDB version:", VERSION)
@@ -43,32 +61,82 @@ func main() {
 	}
 }
 
-func start(config *Config) {
-	tcpListener := NewTcpListener(config)
-	LogInfo(config, "BemiDB: Listening on", tcpListener.Addr())
+func start(ctx context.Context, config *Config) {
+	var listeners []net.Listener
+	if !config.DisableTcp {
+		tcpListener := NewTcpListener(config)
+		LogInfo(config, "BemiDB: Listening on", tcpListener.Addr())
+		listeners = append(listeners, tcpListener)
+	}
+	if config.UnixSocketDir != "" {
+		unixListener := NewUnixListener(config)
+		LogInfo(config, "BemiDB: Listening on", unixListener.Addr())
+		listeners = append(listeners, unixListener)
+	}
 
 	duckdb := NewDuckdb(config)
 	LogInfo(config, "DuckDB: Connected")
+	defer LogInfo(config, "DuckDB: Closed")
 	defer duckdb.Close()
 
 	icebergReader := NewIcebergReader(config)
 	queryHandler := NewQueryHandler(config, duckdb, icebergReader)
+	go queryHandler.ReloadCatalogPeriodically(ctx)
+	sessionRegistry := NewSessionRegistry(config)
+	connectionRegistry := NewConnectionRegistry()
+
+	var acceptWaitGroup sync.WaitGroup
+	for _, listener := range listeners {
+		acceptWaitGroup.Add(1)
+		go func() {
+			defer acceptWaitGroup.Done()
+			acceptConnections(ctx, config, listener, queryHandler, sessionRegistry, connectionRegistry)
+		}()
+	}
+
+	<-ctx.Done()
+	LogInfo(config, "BemiDB: Shutting down, waiting up to", config.ShutdownTimeout, "for running queries")
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	acceptWaitGroup.Wait()
 
+	connectionRegistry.Shutdown(config.ShutdownTimeout)
+	LogInfo(config, "BemiDB: All connections closed")
+}
+
+func acceptConnections(ctx context.Context, config *Config, listener net.Listener, queryHandler *QueryHandler, sessionRegistry *SessionRegistry, connectionRegistry *ConnectionRegistry) {
 	for {
-		conn := AcceptConnection(tcpListener)
-		LogInfo(config, "BemiDB: Accepted connection from", conn.RemoteAddr())
-		postgres := NewPostgres(config, &conn)
+		conn, err := AcceptConnection(listener)
+		if errors.Is(err, net.ErrClosed) && ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			LogError(config, "BemiDB: Couldn't accept connection:", err)
+			time.Sleep(ACCEPT_RETRY_DELAY) // E.g., too many open files
+			continue
+		}
+		clientAddr := ClientAddr(conn)
+		LogInfo(config, "BemiDB: Accepted connection from", clientAddr)
+		postgres := NewPostgres(config, &conn, sessionRegistry)
+		if !connectionRegistry.Register(postgres) {
+			conn.Close()
+			continue
+		}
 
 		go func() {
-			postgres.Run(queryHandler)
+			defer connectionRegistry.Unregister(postgres)
+			defer LogInfo(config, "BemiDB: Closed connection from", clientAddr)
 			defer postgres.Close()
-			LogInfo(config, "BemiDB: Closed connection from", conn.RemoteAddr())
+			postgres.Run(queryHandler)
 		}()
 	}
 }
 
-func syncFromPg(config *Config) {
+func syncFromPg(ctx context.Context, config *Config) {
 	syncer := NewSyncer(config)
-	syncer.SyncFromPostgres()
-	LogInfo(config, "Sync from PostgreSQL completed successfully.")
+	syncer.SyncFromPostgres(ctx)
+	if ctx.Err() == nil {
+		LogInfo(config, "Sync from PostgreSQL completed successfully.")
+	}
 }
@@ -57,16 +57,6 @@ func (parser *ParserFunction) InderectionColumnName(targetNode *pgQuery.Node) st
 	return targetNode.GetResTarget().Val.GetAIndirection().Indirection[0].GetString_().Sval
 }
 
-func (parser *ParserFunction) NestedFunctionCalls(functionCall *pgQuery.FuncCall) []*pgQuery.FuncCall {
-	nestedFunctionCalls := []*pgQuery.FuncCall{}
-
-	for _, arg := range functionCall.Args {
-		nestedFunctionCalls = append(nestedFunctionCalls, arg.GetFuncCall())
-	}
-
-	return nestedFunctionCalls
-}
-
 func (parser *ParserFunction) SchemaFunction(functionCall *pgQuery.FuncCall) PgSchemaFunction {
 	return parser.utils.SchemaFunction(functionCall)
 }
@@ -136,12 +126,17 @@ func (parser *ParserFunction) RemapArrayToString(functionCall *pgQuery.FuncCall)
 	return functionCall
 }
 
+// pg_get_viewdef(view_oid, pretty_bool) -> main.bemidb_pg_get_viewdef(view_oid), which returns the original definition
+func (parser *ParserFunction) RemapPgGetViewdef(functionCall *pgQuery.FuncCall) *pgQuery.FuncCall {
+	functionCall.Funcname = []*pgQuery.Node{
+		pgQuery.MakeStrNode("main"),
+		pgQuery.MakeStrNode("bemidb_pg_get_viewdef"),
+	}
+	return parser.RemoveSecondArgument(functionCall)
+}
+
 // aclexplode() -> json()
 func (parser *ParserFunction) RemapAclExplode(functionCall *pgQuery.FuncCall) *pgQuery.FuncCall {
 	functionCall.Funcname = []*pgQuery.Node{pgQuery.MakeStrNode("json")}
 	return functionCall
 }
-
-func (parser *ParserFunction) OverrideFunctionCallArg(functionCall *pgQuery.FuncCall, index int, node *pgQuery.Node) {
-	functionCall.Args[index] = node
-}
@@ -28,6 +28,14 @@ func (parser *ParserTable) NodeToQuerySchemaTable(node *pgQuery.Node) QuerySchem
 	}
 }
 
+// pg_temp.table -> temp.main.table, where DuckDB keeps the temporary tables of the current connection
+func (parser *ParserTable) RemapTempTable(node *pgQuery.Node) *pgQuery.Node {
+	rangeVar := node.GetRangeVar()
+	rangeVar.Catalogname = "temp"
+	rangeVar.Schemaname = "main"
+	return node
+}
+
 func (parser *ParserTable) MakeEmptyTableNode(tableName string, tableDef TableDefinition, alias string) *pgQuery.Node {
 	return parser.utils.MakeSubselectWithoutRowsNode(tableName, tableDef, alias)
 }
@@ -128,6 +136,40 @@ func (parser *ParserTable) MakePgStatUserTablesNode(schemaTables []IcebergSchema
 	return parser.utils.MakeSubselectWithRowsNode(PG_TABLE_PG_STAT_USER_TABLES, tableDef, rowsValues, alias)
 }
 
+// SELECT * FROM (VALUES(schemaname, viewname, viewowner, definition)...) pg_views
+func (parser *ParserTable) MakePgViewsSelectNode(viewDefinitions []ViewDefinition, user string) *pgQuery.Node {
+	var rowsValues [][]string
+	for _, viewDefinition := range viewDefinitions {
+		if !viewDefinition.Materialized {
+			rowsValues = append(rowsValues, []string{viewDefinition.Schema, viewDefinition.Name, user, viewDefinition.Query})
+		}
+	}
+
+	return parser.makeSelectAllNode(PG_TABLE_PG_VIEWS, PG_VIEWS_DEFINITION, rowsValues)
+}
+
+// SELECT * FROM (VALUES(schemaname, matviewname, matviewowner, tablespace, hasindexes, ispopulated, definition)...) pg_matviews
+func (parser *ParserTable) MakePgMatviewsSelectNode(viewDefinitions []ViewDefinition, user string) *pgQuery.Node {
+	var rowsValues [][]string
+	for _, viewDefinition := range viewDefinitions {
+		if viewDefinition.Materialized {
+			rowsValues = append(rowsValues, []string{viewDefinition.Schema, viewDefinition.Name, user, "NULL", "false", "true", viewDefinition.Query})
+		}
+	}
+
+	return parser.makeSelectAllNode(PG_TABLE_PG_MATVIEWS, PG_MATVIEWS_DEFINITION, rowsValues)
+}
+
+// SELECT * FROM (VALUES(schemaname, tablename)...) iceberg_tables
+func (parser *ParserTable) MakeIcebergTablesSelectNode(icebergSchemaTables []IcebergSchemaTable) *pgQuery.Node {
+	var rowsValues [][]string
+	for _, icebergSchemaTable := range icebergSchemaTables {
+		rowsValues = append(rowsValues, []string{icebergSchemaTable.Schema, icebergSchemaTable.Table})
+	}
+
+	return parser.makeSelectAllNode("iceberg_tables", ICEBERG_TABLES_DEFINITION, rowsValues)
+}
+
 // pg_index -> returns (SELECT *, FALSE AS indnullsnotdistinct FROM pg_index)
 func (parser *ParserTable) MakePgIndexNode(qSchemaTable QuerySchemaTable) *pgQuery.Node {
 	targetList := []*pgQuery.Node{
@@ -150,46 +192,70 @@ func (parser *ParserTable) MakePgIndexNode(qSchemaTable QuerySchemaTable) *pgQue
 	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, targetList, fromNode, qSchemaTable.Alias)
 }
 
-// Other information_schema.* tables
-func (parser *ParserTable) IsTableFromInformationSchema(qSchemaTable QuerySchemaTable) bool {
-	return qSchemaTable.Schema == PG_SCHEMA_INFORMATION_SCHEMA
-}
-
-// iceberg.table -> FROM iceberg_scan('path', skip_schema_inference = true)
-func (parser *ParserTable) MakeIcebergTableNode(tablePath string, qSchemaTable QuerySchemaTable) *pgQuery.Node {
-	node := pgQuery.MakeSimpleRangeFunctionNode([]*pgQuery.Node{
+// pg_catalog.pg_class -> (SELECT * FROM main.bemidb_pg_class()) pg_class, which shows Iceberg views as tables
+func (parser *ParserTable) MakeIcebergCatalogNode(qSchemaTable QuerySchemaTable, macroName string) *pgQuery.Node {
+	targetList := []*pgQuery.Node{
+		pgQuery.MakeResTargetNodeWithVal(
+			pgQuery.MakeColumnRefNode(
+				[]*pgQuery.Node{pgQuery.MakeAStarNode()},
+				0,
+			),
+			0,
+		),
+	}
+	fromNode := pgQuery.MakeSimpleRangeFunctionNode([]*pgQuery.Node{
 		pgQuery.MakeListNode([]*pgQuery.Node{
 			pgQuery.MakeFuncCallNode(
 				[]*pgQuery.Node{
-					pgQuery.MakeStrNode("iceberg_scan"),
-				},
-				[]*pgQuery.Node{
-					pgQuery.MakeAConstStrNode(
-						tablePath,
-						0,
-					),
-					pgQuery.MakeAExprNode(
-						pgQuery.A_Expr_Kind_AEXPR_OP,
-						[]*pgQuery.Node{pgQuery.MakeStrNode("=")},
-						pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeStrNode("skip_schema_inference")}, 0),
-						parser.utils.MakeAConstBoolNode(true),
-						0,
-					),
+					pgQuery.MakeStrNode("main"),
+					pgQuery.MakeStrNode(macroName),
 				},
+				nil,
 				0,
 			),
 		}),
 	})
 
-	// DuckDB doesn't support aliases on iceberg_scan() functions, so we need to wrap it in a nested select that can have an alias
-	selectStarNode := pgQuery.MakeResTargetNodeWithVal(
-		pgQuery.MakeColumnRefNode(
-			[]*pgQuery.Node{pgQuery.MakeAStarNode()},
+	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, targetList, fromNode, qSchemaTable.Alias)
+}
+
+// pg_catalog.pg_prepared_statements -> (SELECT * FROM temp.main.bemidb_pg_prepared_statements()) pg_prepared_statements,
+// which is a temporary macro on the session's DuckDB connection
+func (parser *ParserTable) MakeSessionCatalogNode(qSchemaTable QuerySchemaTable, macroName string) *pgQuery.Node {
+	targetList := []*pgQuery.Node{
+		pgQuery.MakeResTargetNodeWithVal(
+			pgQuery.MakeColumnRefNode(
+				[]*pgQuery.Node{pgQuery.MakeAStarNode()},
+				0,
+			),
 			0,
 		),
-		0,
-	)
-	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, []*pgQuery.Node{selectStarNode}, node, qSchemaTable.Alias)
+	}
+	fromNode := pgQuery.MakeSimpleRangeFunctionNode([]*pgQuery.Node{
+		pgQuery.MakeListNode([]*pgQuery.Node{
+			pgQuery.MakeFuncCallNode(
+				[]*pgQuery.Node{
+					pgQuery.MakeStrNode("temp"),
+					pgQuery.MakeStrNode("main"),
+					pgQuery.MakeStrNode(macroName),
+				},
+				nil,
+				0,
+			),
+		}),
+	})
+
+	return parser.utils.MakeSubselectFromNode(qSchemaTable.Table, targetList, fromNode, qSchemaTable.Alias)
+}
+
+// SELECT * FROM (VALUES(name, statement, prepare_time, parameter_types, result_types, from_sql, generic_plans, custom_plans)...) pg_prepared_statements
+func (parser *ParserTable) MakePgPreparedStatementsSelectNode(rowsValues [][]string) *pgQuery.Node {
+	return parser.makeSelectAllNode(PG_TABLE_PG_PREPARED_STATEMENTS, PG_PREPARED_STATEMENTS_DEFINITION, rowsValues)
+}
+
+// Other information_schema.* tables
+func (parser *ParserTable) IsTableFromInformationSchema(qSchemaTable QuerySchemaTable) bool {
+	return qSchemaTable.Schema == PG_SCHEMA_INFORMATION_SCHEMA
 }
 
 func (parser *ParserTable) SchemaFunction(node *pgQuery.Node) PgSchemaFunction {
@@ -406,6 +472,31 @@ func (parser *ParserTable) RemoveOrderBy(selectStatement *pgQuery.SelectStmt) *p
 	return selectStatement
 }
 
+// SELECT * FROM (VALUES(...)...) table, or a subselect without rows if there are no values
+func (parser *ParserTable) makeSelectAllNode(tableName string, tableDef TableDefinition, rowsValues [][]string) *pgQuery.Node {
+	fromNode := parser.utils.MakeSubselectWithoutRowsNode(tableName, tableDef, "")
+	if len(rowsValues) > 0 {
+		fromNode = parser.utils.MakeSubselectWithRowsNode(tableName, tableDef, rowsValues, "")
+	}
+
+	return &pgQuery.Node{
+		Node: &pgQuery.Node_SelectStmt{
+			SelectStmt: &pgQuery.SelectStmt{
+				TargetList: []*pgQuery.Node{
+					pgQuery.MakeResTargetNodeWithVal(
+						pgQuery.MakeColumnRefNode(
+							[]*pgQuery.Node{pgQuery.MakeAStarNode()},
+							0,
+						),
+						0,
+					),
+				},
+				FromClause: []*pgQuery.Node{fromNode},
+			},
+		},
+	}
+}
+
 type DuckDBKeyword struct {
 	word     string
 	category string
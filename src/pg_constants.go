@@ -3,6 +3,7 @@ package main
 const (
 	PG_SCHEMA_INFORMATION_SCHEMA = "information_schema"
 	PG_SCHEMA_PG_CATALOG         = "pg_catalog"
+	PG_SCHEMA_PG_TEMP            = "pg_temp"
 	PG_SCHEMA_PUBLIC             = "public"
 
 	PG_FUNCTION_ARRAY_TO_STRING      = "array_to_string"
@@ -18,30 +19,36 @@ const (
 	PG_FUNCTION_ACLEXPLODE           = "aclexplode"
 	PG_FUNCTION_PG_GET_VIEWDEF       = "pg_get_viewdef"
 
-	PG_TABLE_PG_ATTRIBUTE          = "pg_attribute"
-	PG_TABLE_PG_AUTH_MEMBERS       = "pg_auth_members"
-	PG_TABLE_PG_CLASS              = "pg_class"
-	PG_TABLE_PG_COLLATION          = "pg_collation"
-	PG_TABLE_PG_DATABASE           = "pg_database"
-	PG_TABLE_PG_EXTENSION          = "pg_extension"
-	PG_TABLE_PG_INDEX              = "pg_index"
-	PG_TABLE_PG_INHERITS           = "pg_inherits"
-	PG_TABLE_PG_MATVIEWS           = "pg_matviews"
-	PG_TABLE_PG_NAMESPACE          = "pg_namespace"
-	PG_TABLE_PG_OPCLASS            = "pg_opclass"
-	PG_TABLE_PG_REPLICATION_SLOTS  = "pg_replication_slots"
-	PG_TABLE_PG_ROLES              = "pg_roles"
-	PG_TABLE_PG_SHADOW             = "pg_shadow"
-	PG_TABLE_PG_SHDESCRIPTION      = "pg_shdescription"
-	PG_TABLE_PG_STATIO_USER_TABLES = "pg_statio_user_tables"
-	PG_TABLE_PG_STAT_ACTIVITY      = "pg_stat_activity"
-	PG_TABLE_PG_STAT_GSSAPI        = "pg_stat_gssapi"
-	PG_TABLE_PG_STAT_USER_TABLES   = "pg_stat_user_tables"
-	PG_TABLE_PG_USER               = "pg_user"
-	PG_TABLE_PG_VIEWS              = "pg_views"
-	PG_TABLE_TABLES                = "tables"
+	PG_TABLE_PG_ATTRIBUTE           = "pg_attribute"
+	PG_TABLE_PG_AUTH_MEMBERS        = "pg_auth_members"
+	PG_TABLE_PG_CLASS               = "pg_class"
+	PG_TABLE_PG_COLLATION           = "pg_collation"
+	PG_TABLE_PG_DATABASE            = "pg_database"
+	PG_TABLE_PG_EXTENSION           = "pg_extension"
+	PG_TABLE_PG_INDEX               = "pg_index"
+	PG_TABLE_PG_INHERITS            = "pg_inherits"
+	PG_TABLE_PG_MATVIEWS            = "pg_matviews"
+	PG_TABLE_PG_NAMESPACE           = "pg_namespace"
+	PG_TABLE_PG_OPCLASS             = "pg_opclass"
+	PG_TABLE_PG_PREPARED_STATEMENTS = "pg_prepared_statements"
+	PG_TABLE_PG_REPLICATION_SLOTS   = "pg_replication_slots"
+	PG_TABLE_PG_ROLES               = "pg_roles"
+	PG_TABLE_PG_SHADOW              = "pg_shadow"
+	PG_TABLE_PG_SHDESCRIPTION       = "pg_shdescription"
+	PG_TABLE_PG_STATIO_USER_TABLES  = "pg_statio_user_tables"
+	PG_TABLE_PG_STAT_ACTIVITY       = "pg_stat_activity"
+	PG_TABLE_PG_STAT_GSSAPI         = "pg_stat_gssapi"
+	PG_TABLE_PG_STAT_USER_TABLES    = "pg_stat_user_tables"
+	PG_TABLE_PG_USER                = "pg_user"
+	PG_TABLE_PG_VIEWS               = "pg_views"
+	PG_TABLE_TABLES                 = "tables"
+	PG_TABLE_VIEWS                  = "views"
 
-	PG_VAR_SEARCH_PATH = "search_path"
+	PG_VAR_SEARCH_PATH       = "search_path"
+	PG_VAR_STATEMENT_TIMEOUT = "statement_timeout"
+	PG_VAR_TIMEZONE          = "timezone"
+
+	PG_RELPERSISTENCE_TEMP = "t" // CREATE TEMPORARY ...
 )
 
 type ColumnDefinition struct {
@@ -413,6 +420,28 @@ var PG_MATVIEWS_DEFINITION = TableDefinition{
 	},
 }
 
+// Iceberg tables with DuckDB views, which the catalog shows as tables
+var ICEBERG_TABLES_DEFINITION = TableDefinition{
+	Columns: []ColumnDefinition{
+		{"schemaname", "text"},
+		{"tablename", "text"},
+	},
+}
+
+// parameter_types and result_types are regtype[] in PostgreSQL
+var PG_PREPARED_STATEMENTS_DEFINITION = TableDefinition{
+	Columns: []ColumnDefinition{
+		{"name", "text"},
+		{"statement", "text"},
+		{"prepare_time", "timestamptz"},
+		{"parameter_types", "text"},
+		{"result_types", "text"},
+		{"from_sql", "bool"},
+		{"generic_plans", "int8"},
+		{"custom_plans", "int8"},
+	},
+}
+
 var PG_OPCLASS_DEFINITION = TableDefinition{
 	Columns: []ColumnDefinition{
 		{"oid", "oid"},
@@ -466,6 +495,7 @@ var PG_SYSTEM_TABLES = NewSet([]string{
 	"pg_parameter_acl",
 	"pg_partitioned_table",
 	"pg_policy",
+	"pg_prepared_statements",
 	"pg_proc",
 	"pg_publication",
 	"pg_publication_namespace",
@@ -2,30 +2,93 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgproto3"
 )
 
 const (
-	PG_VERSION        = "17.0"
-	PG_ENCODING       = "UTF8"
-	PG_TX_STATUS_IDLE = 'I'
+	PG_VERSION                  = "17.0"
+	PG_ENCODING                 = "UTF8"
+	PG_TX_STATUS_IDLE           = 'I'
+	PG_TX_STATUS_IN_TRANSACTION = 'T'
+	PG_TX_STATUS_FAILED         = 'E'
 
 	SYSTEM_AUTH_USER = "bemidb"
+
+	PG_ERROR_CODE_SUCCESSFUL_COMPLETION           = "00000"
+	PG_ERROR_CODE_PROTOCOL_VIOLATION              = "08P01"
+	PG_ERROR_CODE_ACTIVE_SQL_TRANSACTION          = "25001"
+	PG_ERROR_CODE_NO_ACTIVE_SQL_TRANSACTION       = "25P01"
+	PG_ERROR_CODE_IN_FAILED_SQL_TRANSACTION       = "25P02"
+	PG_ERROR_CODE_INVALID_SAVEPOINT_SPECIFICATION = "3B001"
+	PG_ERROR_CODE_INVALID_BINARY_REPRESENTATION   = "22P03"
+	PG_ERROR_CODE_NOT_NULL_VIOLATION              = "23502"
+	PG_ERROR_CODE_SYNTAX_ERROR                    = "42601"
+	PG_ERROR_CODE_INDETERMINATE_DATATYPE          = "42P18"
+	PG_ERROR_CODE_DUPLICATE_TABLE                 = "42P07"
+	PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT    = "42P05"
+	PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME      = "26000"
+	PG_ERROR_CODE_UNDEFINED_TABLE                 = "42P01"
+	PG_ERROR_CODE_UNDEFINED_OBJECT                = "42704"
+	PG_ERROR_CODE_DUPLICATE_COLUMN                = "42701"
+	PG_ERROR_CODE_WRONG_OBJECT_TYPE               = "42809"
+	PG_ERROR_CODE_FEATURE_NOT_SUPPORTED           = "0A000"
+	PG_ERROR_CODE_INVALID_PARAMETER_VALUE         = "22023"
+	PG_ERROR_CODE_PROGRAM_LIMIT_EXCEEDED          = "54000"
+	PG_ERROR_CODE_TOO_MANY_CONNECTIONS            = "53300"
+	PG_ERROR_CODE_QUERY_CANCELED                  = "57014"
+	PG_ERROR_CODE_ADMIN_SHUTDOWN                  = "57P01"
+	PG_ERROR_CODE_INTERNAL_ERROR                  = "XX000"
+
+	ACCEPT_RETRY_DELAY      = 100 * time.Millisecond
+	TERMINATE_WRITE_TIMEOUT = time.Second // Clients that don't read don't hold up the shutdown
 )
 
+// Error with a Postgres SQLSTATE code that is passed to the client
+type PgError struct {
+	Code    string
+	Message string
+}
+
+func (pgError *PgError) Error() string {
+	return pgError.Message
+}
+
+var errCancelRequest = errors.New("cancel request")
+
 type Postgres struct {
-	backend *pgproto3.Backend
-	conn    *net.Conn
-	config  *Config
+	backend            *pgproto3.Backend
+	conn               *net.Conn
+	config             *Config
+	session            *Session
+	sessionRegistry    *SessionRegistry
+	extendedQueryError bool // Skip extended query messages until Sync after an error
+	stateMutex         sync.Mutex
+	busy               bool // Between receiving a query and sending ReadyForQuery, including startup
+	terminating        bool // Set on shutdown, the connection is closed once it's idle
 }
 
-func NewPostgres(config *Config, conn *net.Conn) *Postgres {
+func NewPostgres(config *Config, conn *net.Conn, sessionRegistry *SessionRegistry) *Postgres {
+	session := NewSession()
+	session.statementTimeout = config.StatementTimeout
+	session.defaultStatementTimeout = config.StatementTimeout
+	backend := pgproto3.NewBackend(*conn, *conn)
+	session.receive = backend.Receive
+
 	return &Postgres{
-		conn:    conn,
-		backend: pgproto3.NewBackend(*conn, *conn),
-		config:  config,
+		conn:            conn,
+		backend:         backend,
+		config:          config,
+		session:         session,
+		sessionRegistry: sessionRegistry,
+		busy:            true,
 	}
 }
 
@@ -49,127 +112,396 @@ func NewTcpListener(config *Config) net.Listener {
 	return tcpListener
 }
 
-func AcceptConnection(listener net.Listener) net.Conn {
-	conn, err := listener.Accept()
+// Listens on <dir>/.s.PGSQL.<port> like PostgreSQL, so that clients can connect with, e.g., psql -h <dir> -p <port>
+func NewUnixListener(config *Config) net.Listener {
+	socketPath := filepath.Join(config.UnixSocketDir, ".s.PGSQL."+config.Port)
+	removeStaleUnixSocket(socketPath)
+
+	unixListener, err := net.Listen("unix", socketPath)
+	PanicIfError(err)
+
+	err = os.Chmod(socketPath, config.UnixSocketPerms)
+	PanicIfError(err)
+	return unixListener
+}
+
+// Removes the socket file left after a crash, unless another server is still listening on it
+func removeStaleUnixSocket(socketPath string) {
+	fileInfo, err := os.Lstat(socketPath)
+	if err != nil || fileInfo.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	conn, err := net.Dial("unix", socketPath)
+	if err == nil {
+		conn.Close()
+		panic("Another server is already listening on " + socketPath)
+	}
+	err = os.Remove(socketPath)
 	PanicIfError(err)
-	return conn
+}
+
+// Unix socket clients are unnamed, so the socket path is used instead
+func ClientAddr(conn net.Conn) string {
+	if conn.RemoteAddr().Network() == "unix" {
+		return "unix socket " + conn.LocalAddr().String()
+	}
+	return conn.RemoteAddr().String()
+}
+
+func AcceptConnection(listener net.Listener) (net.Conn, error) {
+	return listener.Accept()
 }
 
 func (postgres *Postgres) Run(queryHandler *QueryHandler) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			postgres.handlePanic(recovered, nil)
+		}
+	}()
+
 	err := postgres.handleStartup()
+	if err == errCancelRequest {
+		return // Terminate connection
+	}
 	if err != nil {
 		LogError(postgres.config, "Error handling startup:", err)
 		return // Terminate connection
 	}
+	if postgres.finishMessage(nil) {
+		postgres.sendMessages(adminShutdownErrorResponse())
+		return
+	}
 
 	for {
 		message, err := postgres.backend.Receive()
 		if err != nil {
 			return // Terminate connection
 		}
+		if !postgres.startMessage() {
+			return // Terminated while idle
+		}
 
-		switch message := message.(type) {
-		case *pgproto3.Query:
-			postgres.handleSimpleQuery(queryHandler, message)
-		case *pgproto3.Parse:
-			err = postgres.handleExtendedQuery(queryHandler, message)
-			if err != nil {
-				return // Terminate connection
-			}
-		case *pgproto3.Terminate:
-			LogDebug(postgres.config, "Client terminated connection")
+		terminate := postgres.handleMessage(queryHandler, message)
+		if terminate {
 			return
-		default:
-			LogError(postgres.config, "Received message other than Query from client:", message)
-			return // Terminate connection
 		}
+		if postgres.finishMessage(message) {
+			postgres.sendMessages(adminShutdownErrorResponse())
+			return
+		}
+	}
+}
+
+// Returns false if the connection was terminated while waiting for the message
+func (postgres *Postgres) startMessage() bool {
+	postgres.stateMutex.Lock()
+	defer postgres.stateMutex.Unlock()
+
+	if postgres.terminating && !postgres.busy {
+		return false
+	}
+	postgres.busy = true
+	return true
+}
+
+// The connection becomes idle after ReadyForQuery, i.e., after startup, a simple query, or Sync.
+// Returns true if the connection should be terminated now that it's idle.
+func (postgres *Postgres) finishMessage(message pgproto3.FrontendMessage) bool {
+	postgres.stateMutex.Lock()
+	defer postgres.stateMutex.Unlock()
+
+	switch message.(type) {
+	case nil, *pgproto3.Query, *pgproto3.Sync:
+		postgres.busy = false
+	}
+	return postgres.terminating && !postgres.busy
+}
+
+// Shutdown: closes the connection right away if it's idle, otherwise after the current query
+func (postgres *Postgres) Terminate() {
+	postgres.stateMutex.Lock()
+	postgres.terminating = true
+	idle := !postgres.busy
+	postgres.stateMutex.Unlock()
+
+	// The connection doesn't start handling new messages once it's terminating, so nothing else writes to it
+	if idle {
+		(*postgres.conn).SetWriteDeadline(time.Now().Add(TERMINATE_WRITE_TIMEOUT))
+		postgres.sendMessages(adminShutdownErrorResponse())
+		(*postgres.conn).Close()
+	}
+}
+
+// Shutdown after the grace period: cancels the running query and closes the connection
+func (postgres *Postgres) ForceTerminate() {
+	postgres.session.Terminate()
+	(*postgres.conn).Close()
+}
+
+// A panic while handling a message fails only that query, so that the connection can be used for other queries
+func (postgres *Postgres) handleMessage(queryHandler *QueryHandler, message pgproto3.FrontendMessage) (terminate bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			terminate = postgres.handlePanic(recovered, message)
+		}
+	}()
+
+	switch message := message.(type) {
+	case *pgproto3.Query:
+		postgres.handleSimpleQuery(queryHandler, message)
+	case *pgproto3.Parse, *pgproto3.Bind, *pgproto3.Describe, *pgproto3.Execute, *pgproto3.Close, *pgproto3.Flush:
+		if postgres.extendedQueryError {
+			return false
+		}
+		err := postgres.handleExtendedQuery(queryHandler, message)
+		if err != nil {
+			postgres.extendedQueryError = true
+			postgres.session.FailTransaction()
+			postgres.writeMessages(errorResponse(err))
+		}
+	case *pgproto3.Sync:
+		LogDebug(postgres.config, "Syncing query")
+		postgres.extendedQueryError = false
+		if postgres.session.transaction == nil {
+			postgres.session.closePortals() // Portals only live until the end of the (implicit) transaction
+		}
+		postgres.writeMessages(&pgproto3.ReadyForQuery{TxStatus: postgres.session.TxStatus()})
+	case *pgproto3.Terminate:
+		LogDebug(postgres.config, "Client terminated connection")
+		return true
+	case *pgproto3.CopyData, *pgproto3.CopyDone, *pgproto3.CopyFail:
+		LogDebug(postgres.config, "Ignoring COPY FROM STDIN data after an error")
+	default:
+		LogError(postgres.config, "Received message other than Query from client:", message)
+		return true // Terminate connection
+	}
+	return false
+}
+
+// Logs the panic with the query and sends an internal error to the client.
+// Returns whether the connection should be terminated, e.g., if the client can't be written to.
+func (postgres *Postgres) handlePanic(recovered interface{}, message pgproto3.FrontendMessage) (terminate bool) {
+	LogError(postgres.config, "Recovered from panic:", recovered, "\nQuery:", postgres.messageQuery(message), "\n"+string(debug.Stack()))
+
+	errorMessage := errorResponse(&PgError{Code: PG_ERROR_CODE_INTERNAL_ERROR, Message: fmt.Sprintf("internal error: %v", recovered)})
+	if message == nil { // Outside of query handling, e.g., during startup
+		postgres.sendMessages(errorMessage)
+		return true
+	}
+
+	postgres.session.FailTransaction()
+	if _, ok := message.(*pgproto3.Query); ok {
+		return postgres.sendMessages(errorMessage, &pgproto3.ReadyForQuery{TxStatus: postgres.session.TxStatus()}) != nil
 	}
+	postgres.extendedQueryError = true // ReadyForQuery is sent on Sync
+	return postgres.sendMessages(errorMessage) != nil
+}
+
+func (postgres *Postgres) messageQuery(message pgproto3.FrontendMessage) string {
+	switch message := message.(type) {
+	case *pgproto3.Query:
+		return message.String
+	case *pgproto3.Parse:
+		return message.Query
+	case *pgproto3.Bind:
+		if preparedStatement, ok := postgres.session.preparedStatements[message.PreparedStatement]; ok {
+			return preparedStatement.OriginalQuery
+		}
+	case *pgproto3.Describe:
+		if portal, ok := postgres.session.portals[message.Name]; ok && message.ObjectType == 'P' {
+			return portal.PreparedStatement.OriginalQuery
+		}
+		if preparedStatement, ok := postgres.session.preparedStatements[message.Name]; ok && message.ObjectType == 'S' {
+			return preparedStatement.OriginalQuery
+		}
+	case *pgproto3.Execute:
+		if portal, ok := postgres.session.portals[message.Portal]; ok {
+			return portal.PreparedStatement.OriginalQuery
+		}
+	}
+	return ""
 }
 
 func (postgres *Postgres) Close() error {
+	postgres.sessionRegistry.Unregister(postgres.session)
+	postgres.session.Close()
 	return (*postgres.conn).Close()
 }
 
 func (postgres *Postgres) handleSimpleQuery(queryHandler *QueryHandler, queryMessage *pgproto3.Query) {
 	LogDebug(postgres.config, "Received query:", queryMessage.String)
-	messages, err := queryHandler.HandleQuery(queryMessage.String)
+	releaseQuerySlot, err := postgres.sessionRegistry.AcquireQuerySlot(postgres.session)
 	if err != nil {
-		postgres.writeError(err.Error())
+		postgres.session.FailTransaction()
+		postgres.writeError(err)
 		return
 	}
-	messages = append(messages, &pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE})
-	postgres.writeMessages(messages...)
-}
+	defer releaseQuerySlot()
 
-func (postgres *Postgres) handleExtendedQuery(queryHandler *QueryHandler, parseMessage *pgproto3.Parse) error {
-	LogDebug(postgres.config, "Parsing query", parseMessage.Query)
-	messages, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
+	err = queryHandler.HandleQuery(postgres.session, queryMessage.String, postgres.sendMessages)
 	if err != nil {
-		postgres.writeError("Failed to parse query")
-		return nil
+		postgres.session.FailTransaction()
+		postgres.writeError(err)
+		return
 	}
-	postgres.writeMessages(messages...)
+	postgres.writeMessages(&pgproto3.ReadyForQuery{TxStatus: postgres.session.TxStatus()})
+}
 
-	for {
-		message, err := postgres.backend.Receive()
+func (postgres *Postgres) handleExtendedQuery(queryHandler *QueryHandler, message pgproto3.FrontendMessage) error {
+	switch message.(type) {
+	case *pgproto3.Parse, *pgproto3.Describe, *pgproto3.Execute: // Prepare or run queries via DuckDB
+		releaseQuerySlot, err := postgres.sessionRegistry.AcquireQuerySlot(postgres.session)
 		if err != nil {
 			return err
 		}
+		defer releaseQuerySlot()
+	}
 
-		switch message := message.(type) {
-		case *pgproto3.Bind:
-			LogDebug(postgres.config, "Binding query", message.PreparedStatement)
-			messages, preparedStatement, err = queryHandler.HandleBindQuery(message, preparedStatement)
-			if err != nil {
-				postgres.writeError("Failed to bind query")
-				continue
+	switch message := message.(type) {
+	case *pgproto3.Parse:
+		LogDebug(postgres.config, "Parsing query", message.Query)
+		if _, ok := postgres.session.preparedStatements[message.Name]; ok && message.Name != "" {
+			return errors.New("prepared statement \"" + message.Name + "\" already exists")
+		}
+		messages, preparedStatement, err := queryHandler.HandleParseQuery(postgres.session, message)
+		if err != nil {
+			return errors.New("Failed to parse query")
+		}
+		if existingPreparedStatement, ok := postgres.session.preparedStatements[message.Name]; ok { // Unnamed statement gets replaced
+			existingPreparedStatement.Close()
+		}
+		postgres.session.preparedStatements[message.Name] = preparedStatement
+		postgres.writeMessages(messages...)
+	case *pgproto3.Bind:
+		LogDebug(postgres.config, "Binding query", message.PreparedStatement)
+		preparedStatement, ok := postgres.session.preparedStatements[message.PreparedStatement]
+		if !ok {
+			return errors.New("prepared statement \"" + message.PreparedStatement + "\" does not exist")
+		}
+		if _, ok := postgres.session.portals[message.DestinationPortal]; ok && message.DestinationPortal != "" {
+			return errors.New("portal \"" + message.DestinationPortal + "\" already exists")
+		}
+		messages, portal, err := queryHandler.HandleBindQuery(postgres.session, message, preparedStatement)
+		if err != nil {
+			var pgError *PgError
+			if errors.As(err, &pgError) {
+				return err
+			}
+			return errors.New("Failed to bind query")
+		}
+		if existingPortal, ok := postgres.session.portals[message.DestinationPortal]; ok { // Unnamed portal gets replaced
+			existingPortal.Close()
+		}
+		postgres.session.portals[message.DestinationPortal] = portal
+		postgres.writeMessages(messages...)
+	case *pgproto3.Describe:
+		LogDebug(postgres.config, "Describing query", message.Name, "("+string(message.ObjectType)+")")
+		var messages []pgproto3.Message
+		var err error
+		switch message.ObjectType {
+		case 'S': // Statement
+			preparedStatement, ok := postgres.session.preparedStatements[message.Name]
+			if !ok {
+				return errors.New("prepared statement \"" + message.Name + "\" does not exist")
+			}
+			messages, err = queryHandler.HandleDescribeStatementQuery(postgres.session, preparedStatement)
+		case 'P': // Portal
+			portal, ok := postgres.session.portals[message.Name]
+			if !ok {
+				return errors.New("portal \"" + message.Name + "\" does not exist")
+			}
+			messages, _, err = queryHandler.HandleDescribePortalQuery(postgres.session, portal)
+		}
+		if err != nil {
+			var pgError *PgError
+			if errors.As(err, &pgError) {
+				return err
 			}
-			postgres.writeMessages(messages...)
-		case *pgproto3.Describe:
-			LogDebug(postgres.config, "Describing query", message.Name, "("+string(message.ObjectType)+")")
-			var messages []pgproto3.Message
-			messages, preparedStatement, err = queryHandler.HandleDescribeQuery(message, preparedStatement)
-			if err != nil {
-				postgres.writeError("Failed to describe query")
-				continue
+			return errors.New("Failed to describe query")
+		}
+		postgres.writeMessages(messages...)
+	case *pgproto3.Execute:
+		LogDebug(postgres.config, "Executing query", message.Portal)
+		portal, ok := postgres.session.portals[message.Portal]
+		if !ok {
+			return errors.New("portal \"" + message.Portal + "\" does not exist")
+		}
+		err := queryHandler.HandleExecuteQuery(postgres.session, message, portal, postgres.sendMessages)
+		if err != nil {
+			var pgError *PgError
+			if errors.As(err, &pgError) {
+				return err
 			}
-			postgres.writeMessages(messages...)
-		case *pgproto3.Execute:
-			LogDebug(postgres.config, "Executing query", message.Portal)
-			messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
-			if err != nil {
-				postgres.writeError("Failed to execute query")
-				continue
+			return errors.New("Failed to execute query")
+		}
+	case *pgproto3.Close:
+		LogDebug(postgres.config, "Closing", message.Name, "("+string(message.ObjectType)+")")
+		switch message.ObjectType {
+		case 'S': // Statement
+			if preparedStatement, ok := postgres.session.preparedStatements[message.Name]; ok {
+				preparedStatement.Close()
+				delete(postgres.session.preparedStatements, message.Name)
+			}
+		case 'P': // Portal
+			if portal, ok := postgres.session.portals[message.Name]; ok {
+				portal.Close()
+				delete(postgres.session.portals, message.Name)
 			}
-			postgres.writeMessages(messages...)
-		case *pgproto3.Sync:
-			LogDebug(postgres.config, "Syncing query")
-			postgres.writeMessages(
-				&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
-			)
-			return nil
 		}
+		postgres.writeMessages(&pgproto3.CloseComplete{})
+	case *pgproto3.Flush:
+		LogDebug(postgres.config, "Flushing")
+		// Messages are written to the connection right away, so there is nothing buffered to flush
 	}
+	return nil
 }
 
 func (postgres *Postgres) writeMessages(messages ...pgproto3.Message) {
+	err := postgres.sendMessages(messages...)
+	PanicIfError(err, "Error writing messages")
+}
+
+// Blocks until the messages are written, which slows down streaming if the client reads slowly
+func (postgres *Postgres) sendMessages(messages ...pgproto3.Message) error {
 	var buf []byte
 	var err error
 	for _, message := range messages {
 		buf, err = message.Encode(buf)
-		PanicIfError(err, "Error encoding messages")
+		if err != nil {
+			return err
+		}
 	}
 	_, err = (*postgres.conn).Write(buf)
-	PanicIfError(err, "Error writing messages")
+	return err
 }
 
-func (postgres *Postgres) writeError(message string) {
+func (postgres *Postgres) writeError(err error) {
 	postgres.writeMessages(
-		&pgproto3.ErrorResponse{Message: message},
-		&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
+		errorResponse(err),
+		&pgproto3.ReadyForQuery{TxStatus: postgres.session.TxStatus()},
 	)
 }
 
+func errorResponse(err error) *pgproto3.ErrorResponse {
+	var pgError *PgError
+	if errors.As(err, &pgError) {
+		return &pgproto3.ErrorResponse{Severity: "ERROR", Code: pgError.Code, Message: pgError.Message}
+	}
+	return &pgproto3.ErrorResponse{Severity: "ERROR", Message: err.Error()}
+}
+
+func adminShutdownErrorResponse() *pgproto3.ErrorResponse {
+	return fatalErrorResponse(&PgError{Code: PG_ERROR_CODE_ADMIN_SHUTDOWN, Message: errAdminShutdown.Error()})
+}
+
+// Sent before closing the connection, without ReadyForQuery
+func fatalErrorResponse(err error) *pgproto3.ErrorResponse {
+	errorMessage := errorResponse(err)
+	errorMessage.Severity = "FATAL"
+	return errorMessage
+}
+
 func (postgres *Postgres) handleStartup() error {
 	startupMessage, err := postgres.backend.ReceiveStartupMessage()
 	if err != nil {
@@ -182,17 +514,24 @@ func (postgres *Postgres) handleStartup() error {
 		LogDebug(postgres.config, "BemiDB: startup message", params)
 
 		if params["database"] != postgres.config.Database {
-			postgres.writeError("database " + params["database"] + " does not exist")
+			postgres.writeError(errors.New("database " + params["database"] + " does not exist"))
 			return errors.New("database does not exist")
 		}
 
-		if postgres.config.User != "" && params["user"] != postgres.config.User && params["user"] != SYSTEM_AUTH_USER {
-			postgres.writeError("role \"" + params["user"] + "\" does not exist")
+		if postgres.config.User != "" && params["user"] != postgres.config.User && params["user"] != SYSTEM_AUTH_USER && params["user"] != postgres.config.AdminUser {
+			postgres.writeError(errors.New("role \"" + params["user"] + "\" does not exist"))
 			return errors.New("role does not exist")
 		}
 
+		postgres.session.user = params["user"]
+		err = postgres.sessionRegistry.Register(postgres.session)
+		if err != nil {
+			postgres.sendMessages(fatalErrorResponse(err))
+			return err
+		}
 		postgres.writeMessages(
 			&pgproto3.AuthenticationOk{},
+			&pgproto3.BackendKeyData{ProcessID: postgres.session.processId, SecretKey: postgres.session.secretKey},
 			&pgproto3.ParameterStatus{Name: "client_encoding", Value: PG_ENCODING},
 			&pgproto3.ParameterStatus{Name: "server_version", Value: PG_VERSION},
 			&pgproto3.ReadyForQuery{TxStatus: PG_TX_STATUS_IDLE},
@@ -203,9 +542,93 @@ func (postgres *Postgres) handleStartup() error {
 		if err != nil {
 			return err
 		}
-		postgres.handleStartup()
-		return nil
+		return postgres.handleStartup()
+	case *pgproto3.CancelRequest:
+		// Sent via a separate connection, which is closed without a response
+		LogDebug(postgres.config, "BemiDB: cancel request for process", startupMessage.ProcessID)
+		if !postgres.sessionRegistry.CancelQuery(startupMessage.ProcessID, startupMessage.SecretKey) {
+			LogWarn(postgres.config, "BemiDB: couldn't find a session to cancel for process", startupMessage.ProcessID)
+		}
+		return errCancelRequest
 	default:
 		return errors.New("unknown startup message")
 	}
 }
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Open connections, which are drained on shutdown
+type ConnectionRegistry struct {
+	mutex        sync.Mutex
+	waitGroup    sync.WaitGroup
+	connections  map[*Postgres]struct{}
+	shuttingDown bool
+}
+
+func NewConnectionRegistry() *ConnectionRegistry {
+	return &ConnectionRegistry{connections: make(map[*Postgres]struct{})}
+}
+
+// Returns false if the server is shutting down
+func (registry *ConnectionRegistry) Register(postgres *Postgres) bool {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.shuttingDown {
+		return false
+	}
+	registry.connections[postgres] = struct{}{}
+	registry.waitGroup.Add(1)
+	return true
+}
+
+func (registry *ConnectionRegistry) Unregister(postgres *Postgres) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if _, ok := registry.connections[postgres]; ok {
+		delete(registry.connections, postgres)
+		registry.waitGroup.Done()
+	}
+}
+
+// Terminates idle connections and waits for running queries to finish within the timeout.
+// Queries that are still running after the timeout are canceled.
+func (registry *ConnectionRegistry) Shutdown(timeout time.Duration) {
+	registry.mutex.Lock()
+	registry.shuttingDown = true
+	registry.mutex.Unlock()
+
+	for _, postgres := range registry.openConnections() {
+		postgres.Terminate()
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		registry.waitGroup.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		return
+	case <-time.After(timeout):
+	}
+
+	for _, postgres := range registry.openConnections() {
+		postgres.ForceTerminate()
+	}
+	<-closed
+}
+
+// Copied under the lock, so that connections are terminated without holding it while writing to them
+func (registry *ConnectionRegistry) openConnections() []*Postgres {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	connections := make([]*Postgres, 0, len(registry.connections))
+	for postgres := range registry.connections {
+		connections = append(connections, postgres)
+	}
+	return connections
+}
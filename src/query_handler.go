@@ -6,16 +6,21 @@ import (
 	"database/sql"
 	"encoding/binary"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/jackc/pgx/v5/pgtype"
 	duckDb "github.com/marcboeker/go-duckdb"
 	pgQuery "github.com/pganalyze/pg_query_go/v5"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -23,6 +28,70 @@ const (
 	INSPECT_SQL_COMMENT = " --INSPECT"
 )
 
+const (
+	STREAM_BATCH_MAX_ROWS  = 1000
+	STREAM_BATCH_MAX_BYTES = 1024 * 1024
+)
+
+var DUCKDB_TYPE_OIDS = map[string]uint32{
+	"BOOLEAN":      pgtype.BoolOID,
+	"TINYINT":      pgtype.Int2OID,
+	"UTINYINT":     pgtype.Int2OID,
+	"SMALLINT":     pgtype.Int2OID,
+	"USMALLINT":    pgtype.Int4OID,
+	"INTEGER":      pgtype.Int4OID,
+	"UINTEGER":     pgtype.XIDOID,
+	"BIGINT":       pgtype.Int8OID,
+	"UBIGINT":      pgtype.XID8OID,
+	"HUGEINT":      pgtype.NumericOID,
+	"FLOAT":        pgtype.Float4OID,
+	"DOUBLE":       pgtype.Float8OID,
+	"VARCHAR":      pgtype.TextOID,
+	"ENUM":         pgtype.TextOID,
+	"BLOB":         pgtype.ByteaOID,
+	"UUID":         pgtype.UUIDOID,
+	"DATE":         pgtype.DateOID,
+	"TIME":         pgtype.TimeOID,
+	"TIMETZ":       pgtype.TimetzOID,
+	"TIMESTAMP":    pgtype.TimestampOID,
+	"TIMESTAMP_S":  pgtype.TimestampOID,
+	"TIMESTAMP_MS": pgtype.TimestampOID,
+	"TIMESTAMP_NS": pgtype.TimestampOID,
+	"TIMESTAMPTZ":  pgtype.TimestamptzOID,
+	"INTERVAL":     pgtype.IntervalOID,
+}
+
+var DUCKDB_ARRAY_TYPE_OIDS = map[string]uint32{
+	"BOOLEAN":      pgtype.BoolArrayOID,
+	"TINYINT":      pgtype.Int2ArrayOID,
+	"UTINYINT":     pgtype.Int2ArrayOID,
+	"SMALLINT":     pgtype.Int2ArrayOID,
+	"USMALLINT":    pgtype.Int4ArrayOID,
+	"INTEGER":      pgtype.Int4ArrayOID,
+	"UINTEGER":     pgtype.XIDArrayOID,
+	"BIGINT":       pgtype.Int8ArrayOID,
+	"UBIGINT":      pgtype.XID8ArrayOID,
+	"HUGEINT":      pgtype.NumericArrayOID,
+	"FLOAT":        pgtype.Float4ArrayOID,
+	"DOUBLE":       pgtype.Float8ArrayOID,
+	"VARCHAR":      pgtype.TextArrayOID,
+	"ENUM":         pgtype.TextArrayOID,
+	"BLOB":         pgtype.ByteaArrayOID,
+	"UUID":         pgtype.UUIDArrayOID,
+	"DATE":         pgtype.DateArrayOID,
+	"TIME":         pgtype.TimeArrayOID,
+	"TIMETZ":       pgtype.TimetzArrayOID,
+	"TIMESTAMP":    pgtype.TimestampArrayOID,
+	"TIMESTAMP_S":  pgtype.TimestampArrayOID,
+	"TIMESTAMP_MS": pgtype.TimestampArrayOID,
+	"TIMESTAMP_NS": pgtype.TimestampArrayOID,
+	"TIMESTAMPTZ":  pgtype.TimestamptzArrayOID,
+	"INTERVAL":     pgtype.IntervalArrayOID,
+}
+
+// Receives result messages in batches as they are produced
+type MessageWriter func(messages ...pgproto3.Message) error
+
 type QueryHandler struct {
 	duckdb        *Duckdb
 	icebergReader *IcebergReader
@@ -33,14 +102,349 @@ type QueryHandler struct {
 ////////////////////////////////////////////////////////////////////////////////////////////////////
 
 type PreparedStatement struct {
-	Name          string
-	OriginalQuery string
-	Query         string
-	Statement     *sql.Stmt
-	ParameterOIDs []uint32
-	Variables     []interface{}
-	Portal        string
-	Rows          *sql.Rows
+	Name             string
+	OriginalQuery    string
+	Query            string
+	Statement        *sql.Stmt
+	ParameterOIDs    []uint32
+	CommandTag       string // Without the row count
+	ColumnOrigins    []ColumnOrigin
+	SessionStatement string        // BEGIN, COMMIT, DISCARD ALL, CREATE TABLE, etc. are handled by the session instead of DuckDB
+	ParsedStatement  *pgQuery.Node // Parsed before remapping to dispatch the statement, nil for an empty query
+	RowCount         bool          // CREATE TEMPORARY TABLE, INSERT, etc. return the row count in the command tag instead of rows
+	PrepareTime      time.Time
+	FromSql          bool                // PREPARE name AS ... instead of a Parse message
+	ArgumentTypes    []*pgQuery.TypeName // PREPARE name(types): EXECUTE casts the arguments to these types
+}
+
+func (preparedStatement *PreparedStatement) Close() error {
+	if preparedStatement.Statement == nil {
+		return nil
+	}
+	return preparedStatement.Statement.Close()
+}
+
+// Returns nil for NULL values
+func (queryHandler *QueryHandler) encodeBinaryValue(typeMap *pgtype.Map, col *sql.ColumnType, oid uint32, valuePtr interface{}) ([]byte, error) {
+	var value interface{}
+	switch valuePtr := valuePtr.(type) {
+	case *sql.NullInt16:
+		if !valuePtr.Valid {
+			return nil, nil
+		}
+		value = valuePtr.Int16
+	case *sql.NullInt32:
+		if !valuePtr.Valid {
+			return nil, nil
+		}
+		value = valuePtr.Int32
+	case *sql.NullInt64:
+		if !valuePtr.Valid {
+			return nil, nil
+		}
+		value = valuePtr.Int64
+	case *NullUint32:
+		if !valuePtr.Present {
+			return nil, nil
+		}
+		value = valuePtr.Value
+	case *NullUint64:
+		if !valuePtr.Present {
+			return nil, nil
+		}
+		value = valuePtr.Value
+	case *sql.NullFloat64:
+		if !valuePtr.Valid {
+			return nil, nil
+		}
+		value = valuePtr.Float64
+	case *sql.NullString:
+		if !valuePtr.Valid {
+			return nil, nil
+		}
+		if oid == pgtype.UUIDOID && len(valuePtr.String) != 16 { // Text representation instead of raw bytes
+			uuid := pgtype.UUID{}
+			err := uuid.Scan(valuePtr.String)
+			if err != nil {
+				return nil, err
+			}
+			value = uuid
+		} else if oid == pgtype.UUIDOID || oid == pgtype.ByteaOID {
+			value = []byte(valuePtr.String)
+		} else {
+			value = valuePtr.String
+		}
+	case *sql.NullBool:
+		if !valuePtr.Valid {
+			return nil, nil
+		}
+		value = valuePtr.Bool
+	case *sql.NullTime:
+		if !valuePtr.Valid {
+			return nil, nil
+		}
+		switch oid {
+		case pgtype.TimeOID:
+			value = timeOfDay(valuePtr.Time)
+		case pgtype.TimetzOID: // No pgtype codec: microseconds and the UTC offset (DuckDB returns times in UTC)
+			return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint64(nil, uint64(timeOfDay(valuePtr.Time).Microseconds)), 0), nil
+		default:
+			value = valuePtr.Time
+		}
+	case *NullInterval:
+		if !valuePtr.Present {
+			return nil, nil
+		}
+		value = pgtype.Interval{Microseconds: valuePtr.Value.Micros, Days: valuePtr.Value.Days, Months: valuePtr.Value.Months, Valid: true}
+	case *NullJson:
+		if !valuePtr.Present {
+			return nil, nil
+		}
+		value = []byte(valuePtr.String())
+	case *NullBigInt:
+		if !valuePtr.Present {
+			return nil, nil
+		}
+		value = pgtype.Numeric{Int: valuePtr.Value, Valid: true}
+	case *NullDecimal:
+		if !valuePtr.Present {
+			return nil, nil
+		}
+		value = decimalToNumeric(valuePtr.Value)
+	case *NullArray:
+		if !valuePtr.Present {
+			return nil, nil
+		}
+		if oid == pgtype.JSONOID {
+			value = []byte(NullJson{Present: true, Value: valuePtr.Value}.String())
+			break
+		}
+		elements := make([]interface{}, len(valuePtr.Value))
+		for i, element := range valuePtr.Value {
+			switch element := element.(type) {
+			case duckDb.Decimal:
+				elements[i] = decimalToNumeric(element)
+			case *big.Int:
+				elements[i] = pgtype.Numeric{Int: element, Valid: true}
+			case time.Time:
+				if oid == pgtype.TimeArrayOID {
+					elements[i] = timeOfDay(element)
+				} else {
+					elements[i] = element
+				}
+			case duckDb.Interval:
+				elements[i] = pgtype.Interval{Microseconds: element.Micros, Days: element.Days, Months: element.Months, Valid: true}
+			default:
+				elements[i] = element
+			}
+		}
+		value = elements
+	case *interface{}:
+		if *valuePtr == nil {
+			return nil, nil
+		}
+		if oid != pgtype.TextOID {
+			return nil, errors.New("unsupported binary type: " + col.DatabaseTypeName())
+		}
+		value = fmt.Sprintf("%v", *valuePtr) // Text fallback
+	default:
+		return nil, errors.New("unsupported binary type: " + col.DatabaseTypeName())
+	}
+
+	encodedValue, err := typeMap.Encode(oid, pgtype.BinaryFormatCode, value, nil)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't encode binary value for column", col.Name()+":", err.Error())
+		return nil, err
+	}
+	return encodedValue, nil
+}
+
+func decimalToNumeric(decimal duckDb.Decimal) pgtype.Numeric {
+	return pgtype.Numeric{Int: decimal.Value, Exp: -int32(decimal.Scale), Valid: true}
+}
+
+func timeOfDay(value time.Time) pgtype.Time {
+	microseconds := int64(value.Hour())*3600_000_000 + int64(value.Minute())*60_000_000 + int64(value.Second())*1_000_000 + int64(value.Nanosecond())/1000
+	return pgtype.Time{Microseconds: microseconds, Valid: true}
+}
+
+// 2024-01-01 12:00:00.123456+02, 2024-01-01 12:00:00+05:30
+func formatTimestamptz(value time.Time, timeZone *time.Location) string {
+	value = value.In(timeZone)
+	return value.Format("2006-01-02 15:04:05.999999") + formatUtcOffset(value)
+}
+
+func formatUtcOffset(value time.Time) string {
+	_, offset := value.Zone()
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+
+	formattedOffset := fmt.Sprintf("%s%02d", sign, offset/3600)
+	if offset%3600 != 0 {
+		formattedOffset += fmt.Sprintf(":%02d", offset%3600/60)
+	}
+	if offset%60 != 0 {
+		formattedOffset += fmt.Sprintf(":%02d", offset%60)
+	}
+	return formattedOffset
+}
+
+// Postgres interval style: 1 year 2 mons 3 days 04:05:06.7
+func formatInterval(interval duckDb.Interval) string {
+	var parts []string
+	isNegativeBefore := false
+	addPart := func(value int64, unit string) {
+		if value == 0 {
+			return
+		}
+		part := strconv.FormatInt(value, 10) + " " + unit
+		if value != 1 {
+			part += "s"
+		}
+		if isNegativeBefore && value > 0 {
+			part = "+" + part
+		}
+		parts = append(parts, part)
+		isNegativeBefore = value < 0
+	}
+	addPart(int64(interval.Months/12), "year")
+	addPart(int64(interval.Months%12), "mon")
+	addPart(int64(interval.Days), "day")
+
+	if interval.Micros != 0 || len(parts) == 0 {
+		micros := interval.Micros
+		sign := ""
+		if micros < 0 {
+			sign = "-"
+			micros = -micros
+		} else if isNegativeBefore {
+			sign = "+"
+		}
+		formattedTime := fmt.Sprintf("%s%02d:%02d:%02d", sign, micros/3600_000_000, micros/60_000_000%60, micros/1_000_000%60)
+		if micros%1_000_000 != 0 {
+			formattedTime += strings.TrimRight(fmt.Sprintf(".%06d", micros%1_000_000), "0")
+		}
+		parts = append(parts, formattedTime)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Converts DuckDB STRUCT, MAP and LIST values to values that can be marshaled to JSON
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(value))
+		for key, element := range value {
+			object[key] = jsonValue(element)
+		}
+		return object
+	case duckDb.Map:
+		object := make(map[string]interface{}, len(value))
+		for key, element := range value {
+			object[fmt.Sprintf("%v", key)] = jsonValue(element)
+		}
+		return object
+	case []interface{}:
+		elements := make([]interface{}, len(value))
+		for i, element := range value {
+			elements[i] = jsonValue(element)
+		}
+		return elements
+	case duckDb.Decimal:
+		return json.Number(NullDecimal{Present: true, Value: value}.String())
+	case *big.Int:
+		return json.Number(value.String())
+	case time.Time:
+		return value.Format("2006-01-02 15:04:05.999999")
+	case duckDb.Interval:
+		return formatInterval(value)
+	case []byte:
+		return "\\x" + hex.EncodeToString(value)
+	default:
+		return value
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type Portal struct {
+	Name              string
+	PreparedStatement *PreparedStatement
+	Variables         []interface{}
+	ResultFormatCodes []int16 // None (all text), one for all columns, or one per column
+	Rows              *sql.Rows
+	typeMap           *pgtype.Map
+	columnTypes       []*sql.ColumnType
+	nextRowFetched    bool // Rows.Next() was already called while looking ahead
+	resultRows        int64
+	resultBytes       int64
+	timeZone          *time.Location  // Session time zone for timestamptz values, UTC if nil
+	ctx               context.Context // Canceled by CancelRequest or statement_timeout
+	cancel            context.CancelCauseFunc
+	releaseQuerySlot  func() // The query counts against max-user-queries until the portal is closed
+}
+
+func (portal *Portal) ColumnTypes() ([]*sql.ColumnType, error) {
+	if portal.columnTypes == nil {
+		cols, err := portal.Rows.ColumnTypes()
+		if err != nil {
+			return nil, err
+		}
+		portal.columnTypes = cols
+	}
+	return portal.columnTypes, nil
+}
+
+// Used for binary encoding, which isn't safe to share between connections
+func (portal *Portal) TypeMap() *pgtype.Map {
+	if portal.typeMap == nil {
+		portal.typeMap = pgtype.NewMap()
+	}
+	return portal.typeMap
+}
+
+// Keeps Rows, so that executing a completed portal again returns no rows instead of re-running the query
+func (portal *Portal) Close() error {
+	if portal.cancel != nil {
+		defer portal.cancel(nil)
+	}
+	if portal.releaseQuerySlot != nil {
+		portal.releaseQuerySlot()
+	}
+	if portal.Rows == nil {
+		return nil
+	}
+	return portal.Rows.Close()
+}
+
+// Holds the session's query slot while the portal's rows are open, also after the current message
+func (portal *Portal) holdQuerySlot(session *Session) error {
+	release, err := session.acquireQuerySlot()
+	if err != nil {
+		return err
+	}
+	if portal.releaseQuerySlot != nil {
+		portal.releaseQuerySlot()
+	}
+	portal.releaseQuerySlot = release
+	return nil
+}
+
+func (portal *Portal) TimeZone() *time.Location {
+	if portal.timeZone == nil {
+		return time.UTC
+	}
+	return portal.timeZone
+}
+
+func (portal *Portal) Context() context.Context {
+	if portal.ctx == nil {
+		return context.Background()
+	}
+	return portal.ctx
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -61,9 +465,14 @@ func (nullDecimal *NullDecimal) Scan(value interface{}) error {
 	return nil
 }
 
+// Formatted from the unscaled value like the numeric encoders, since float64 only keeps 15-17 significant digits
 func (nullDecimal NullDecimal) String() string {
 	if nullDecimal.Present {
-		return fmt.Sprintf("%v", nullDecimal.Value.Float64())
+		value, err := decimalToNumeric(nullDecimal.Value).Value()
+		if err != nil {
+			return ""
+		}
+		return value.(string)
 	}
 	return ""
 }
@@ -145,6 +554,61 @@ func (nullBigInt NullBigInt) String() string {
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////
 
+type NullInterval struct {
+	Present bool
+	Value   duckDb.Interval
+}
+
+func (nullInterval *NullInterval) Scan(value interface{}) error {
+	if value == nil {
+		nullInterval.Present = false
+		return nil
+	}
+
+	nullInterval.Present = true
+	nullInterval.Value = value.(duckDb.Interval)
+	return nil
+}
+
+func (nullInterval NullInterval) String() string {
+	if nullInterval.Present {
+		return formatInterval(nullInterval.Value)
+	}
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// STRUCT and MAP values (and LISTs of them) are returned as JSON
+type NullJson struct {
+	Present bool
+	Value   interface{}
+}
+
+func (nullJson *NullJson) Scan(value interface{}) error {
+	if value == nil {
+		nullJson.Present = false
+		return nil
+	}
+
+	nullJson.Present = true
+	nullJson.Value = value
+	return nil
+}
+
+func (nullJson NullJson) String() string {
+	if nullJson.Present {
+		marshaledValue, err := json.Marshal(jsonValue(nullJson.Value))
+		if err != nil {
+			return ""
+		}
+		return string(marshaledValue)
+	}
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
 type NullArray struct {
 	Present bool
 	Value   []interface{}
@@ -165,9 +629,11 @@ func (nullArray NullArray) String() string {
 	if nullArray.Present {
 		var stringVals []string
 		for _, v := range nullArray.Value {
-			switch v.(type) {
+			switch v := v.(type) {
 			case []uint8:
 				stringVals = append(stringVals, fmt.Sprintf("%s", v))
+			case duckDb.Interval:
+				stringVals = append(stringVals, formatInterval(v))
 			default:
 				stringVals = append(stringVals, fmt.Sprintf("%v", v))
 			}
@@ -199,60 +665,172 @@ func NewQueryHandler(config *Config, duckdb *Duckdb, icebergReader *IcebergReade
 	return queryHandler
 }
 
-func (queryHandler *QueryHandler) HandleQuery(originalQuery string) ([]pgproto3.Message, error) {
-	queryStatements, originalQueryStatements, err := queryHandler.parseAndRemapQuery(originalQuery)
+// Reloads the Iceberg tables and view definitions every refresh interval until the server shuts down
+func (queryHandler *QueryHandler) ReloadCatalogPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(queryHandler.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			queryHandler.reloadCatalog()
+		}
+	}
+}
+
+// Storage errors are logged, so that they're retried on the next tick instead of stopping the server
+func (queryHandler *QueryHandler) reloadCatalog() {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			LogError(queryHandler.config, "Couldn't reload the catalog:", recovered)
+		}
+	}()
+	err := queryHandler.queryRemapper.ReloadCatalog()
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't reload the catalog:", err)
+	}
+}
+
+// Streams the results to the writer, so that large results don't have to be held in memory
+func (queryHandler *QueryHandler) HandleQuery(session *Session, originalQuery string, writer MessageWriter) error {
+	queryStatements, originalQueryStatements, originalStatements, err := queryHandler.parseAndRemapQuery(originalQuery)
 	if err != nil {
 		LogError(queryHandler.config, "Couldn't map query:", originalQuery+"\n"+err.Error())
-		return nil, err
+		return err
 	}
 	if len(queryStatements) == 0 {
-		return []pgproto3.Message{&pgproto3.EmptyQueryResponse{}}, nil
+		return writer(&pgproto3.EmptyQueryResponse{})
 	}
 
-	var queriesMessages []pgproto3.Message
-
 	for i, queryStatement := range queryStatements {
-		rows, err := queryHandler.duckdb.QueryContext(context.Background(), queryStatement)
+		err := checkFailedTransaction(session, originalStatements[i])
 		if err != nil {
+			return err
+		}
+
+		if isSessionStatement(originalStatements[i]) {
+			err := queryHandler.handleSessionStatement(session, originalStatements[i], writer)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = queryHandler.snapshotTransaction(session)
+		if err != nil {
+			return err
+		}
+
+		if queryHandler.isNativeTableStatement(originalQueryStatements[i]) {
+			err := queryHandler.handleNativeTableQuery(session, originalQueryStatements[i], nil, writer)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isCopyToStatement(originalQueryStatements[i]) {
+			err := queryHandler.handleCopyToQuery(session, queryStatement, writer)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isExplainStatement(originalQueryStatements[i]) {
+			err := queryHandler.handleExplainQuery(session, queryStatement, originalQueryStatements[i], nil, true, writer)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isCursorStatement(originalStatements[i]) {
+			err := queryHandler.handleCursorQuery(session, queryStatement, originalQueryStatements[i], writer)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isPreparedStatementStatement(originalQueryStatements[i]) {
+			err := queryHandler.handlePreparedStatementQuery(session, queryStatement, originalQueryStatements[i], writer)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = queryHandler.handleSessionSetting(session, originalStatements[i])
+		if err != nil {
+			return err
+		}
+
+		queryStatement = queryHandler.sessionSettingQuery(session, originalQueryStatements[i], queryStatement)
+
+		duckdb, err := queryHandler.sessionDuckdb(session)
+		if err != nil {
+			return err
+		}
+		err = queryHandler.refreshPreparedStatementsMacro(session, queryStatement)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := session.queryContext()
+		stopStatementTimer := session.startStatementTimer(cancel)
+		rows, err := duckdb.QueryContext(ctx, queryStatement)
+		if err != nil {
+			stopStatementTimer()
+			cancel(nil)
+			if canceledErr := queryCanceledError(ctx, err); canceledErr != err {
+				return canceledErr
+			}
 			errorMessage := err.Error()
 			if errorMessage == "Binder Error: UNNEST requires a single list as input" {
 				// https://github.com/duckdb/duckdb/issues/11693
 				LogWarn(queryHandler.config, "Couldn't handle query via DuckDB:", queryStatement+"\n"+err.Error())
-				queriesMsgs, err := queryHandler.HandleQuery(FALLBACK_SQL_QUERY) // self-recursion
+				err := queryHandler.HandleQuery(session, FALLBACK_SQL_QUERY, writer) // self-recursion
 				if err != nil {
-					return nil, err
+					return err
 				}
-				queriesMessages = append(queriesMessages, queriesMsgs...)
 				continue
 			} else {
 				LogError(queryHandler.config, "Couldn't handle query via DuckDB:", queryStatement+"\n"+err.Error())
-				return nil, err
+				return err
 			}
 		}
-		defer rows.Close()
 
-		var queryMessages []pgproto3.Message
-		descriptionMessages, err := queryHandler.rowsToDescriptionMessages(rows, queryStatement)
-		if err != nil {
-			return nil, err
+		portal := &Portal{
+			PreparedStatement: &PreparedStatement{
+				OriginalQuery: originalQueryStatements[i],
+				Query:         queryStatement,
+				CommandTag:    commandTag(originalStatements[i]),
+				ColumnOrigins: queryHandler.columnOrigins(queryStatement),
+				RowCount:      isRowCountStatement(originalQueryStatements[i]),
+			},
+			Rows:     rows,
+			ctx:      ctx,
+			cancel:   cancel,
+			timeZone: session.timeZone,
 		}
-		queryMessages = append(queryMessages, descriptionMessages...)
-		dataMessages, err := queryHandler.rowsToDataMessages(rows, originalQueryStatements[i])
+		err = queryHandler.streamQueryResult(portal, writer)
+		stopStatementTimer()
+		portal.Close()
 		if err != nil {
-			return nil, err
+			return queryCanceledError(ctx, err)
 		}
-		queryMessages = append(queryMessages, dataMessages...)
-
-		queriesMessages = append(queriesMessages, queryMessages...)
 	}
 
-	return queriesMessages, nil
+	return nil
 }
 
-func (queryHandler *QueryHandler) HandleParseQuery(message *pgproto3.Parse) ([]pgproto3.Message, *PreparedStatement, error) {
+func (queryHandler *QueryHandler) HandleParseQuery(session *Session, message *pgproto3.Parse) ([]pgproto3.Message, *PreparedStatement, error) {
 	ctx := context.Background()
 	originalQuery := string(message.Query)
-	queryStatements, _, err := queryHandler.parseAndRemapQuery(originalQuery)
+	queryStatements, originalQueryStatements, originalStatements, err := queryHandler.parseAndRemapQuery(originalQuery)
 	if err != nil {
 		LogError(queryHandler.config, "Couldn't map query:", originalQuery+"\n"+err.Error())
 		return nil, nil, err
@@ -264,15 +842,41 @@ func (queryHandler *QueryHandler) HandleParseQuery(message *pgproto3.Parse) ([]p
 	preparedStatement := &PreparedStatement{
 		Name:          message.Name,
 		OriginalQuery: originalQuery,
-		ParameterOIDs: message.ParameterOIDs,
+		ParameterOIDs: queryHandler.parameterOids(originalQuery, message.ParameterOIDs),
+		PrepareTime:   time.Now(),
 	}
 	if len(queryStatements) == 0 {
-		return []pgproto3.Message{&pgproto3.EmptyQueryResponse{}}, preparedStatement, nil
+		return []pgproto3.Message{&pgproto3.ParseComplete{}}, preparedStatement, nil
+	}
+
+	preparedStatement.ParsedStatement = originalStatements[0]
+	preparedStatement.CommandTag = commandTag(originalStatements[0])
+	preparedStatement.RowCount = isRowCountStatement(originalQueryStatements[0])
+	if isSessionStatement(originalStatements[0]) || queryHandler.isNativeTableStatement(originalQueryStatements[0]) || isCopyToStatement(originalQueryStatements[0]) || isExplainStatement(originalQueryStatements[0]) || isPreparedStatementStatement(originalQueryStatements[0]) {
+		preparedStatement.SessionStatement = originalQueryStatements[0]
+		preparedStatement.Query = queryStatements[0]
+		if originalStatements[0].GetPrepareStmt() != nil {
+			preparedStatement.ParameterOIDs = nil // $n are the parameters of the statement prepared via PREPARE
+		}
+		return []pgproto3.Message{&pgproto3.ParseComplete{}}, preparedStatement, nil
 	}
 
+	err = queryHandler.snapshotTransaction(session)
+	if err != nil {
+		return nil, nil, err
+	}
 	query := queryStatements[0]
 	preparedStatement.Query = query
-	statement, err := queryHandler.duckdb.PrepareContext(ctx, query)
+	preparedStatement.ColumnOrigins = queryHandler.columnOrigins(query)
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = queryHandler.refreshPreparedStatementsMacro(session, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	statement, err := duckdb.PrepareContext(ctx, query)
 	preparedStatement.Statement = statement
 	if err != nil {
 		LogError(queryHandler.config, "Couldn't prepare query via DuckDB:", query+"\n"+err.Error())
@@ -282,103 +886,248 @@ func (queryHandler *QueryHandler) HandleParseQuery(message *pgproto3.Parse) ([]p
 	return []pgproto3.Message{&pgproto3.ParseComplete{}}, preparedStatement, nil
 }
 
-func (queryHandler *QueryHandler) HandleBindQuery(message *pgproto3.Bind, preparedStatement *PreparedStatement) ([]pgproto3.Message, *PreparedStatement, error) {
-	if message.PreparedStatement != preparedStatement.Name {
-		LogError(queryHandler.config, "Prepared statement mismatch:", message.PreparedStatement, "instead of", preparedStatement.Name)
-		return nil, nil, errors.New("prepared statement mismatch")
+func (queryHandler *QueryHandler) HandleBindQuery(session *Session, message *pgproto3.Bind, preparedStatement *PreparedStatement) ([]pgproto3.Message, *Portal, error) {
+	variables, err := queryHandler.decodeParameters(message, preparedStatement)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't decode parameters:", err.Error())
+		return nil, nil, err
 	}
 
-	var variables []interface{}
-	paramFormatCodes := message.ParameterFormatCodes
+	LogDebug(queryHandler.config, "Bound variables:", variables)
+	portal := &Portal{
+		Name:              message.DestinationPortal,
+		PreparedStatement: preparedStatement,
+		Variables:         variables,
+		ResultFormatCodes: message.ResultFormatCodes,
+		timeZone:          session.timeZone,
+	}
+	portal.ctx, portal.cancel = session.queryContext()
 
-	for i, param := range message.Parameters {
-		if param == nil {
-			continue
-		}
+	messages := []pgproto3.Message{&pgproto3.BindComplete{}}
 
-		textFormat := true
-		if len(paramFormatCodes) == 1 {
-			textFormat = paramFormatCodes[0] == 0
-		} else if len(paramFormatCodes) > 1 {
-			textFormat = paramFormatCodes[i] == 0
-		}
+	return messages, portal, nil
+}
+
+// Describe (Statement): parameter types and the shape of the rows the statement would return
+func (queryHandler *QueryHandler) HandleDescribeStatementQuery(session *Session, preparedStatement *PreparedStatement) ([]pgproto3.Message, error) {
+	messages := []pgproto3.Message{&pgproto3.ParameterDescription{ParameterOIDs: describedParameterOids(preparedStatement.ParameterOIDs)}}
 
-		if textFormat {
-			variables = append(variables, string(param))
-		} else if len(param) == 4 {
-			variables = append(variables, int32(binary.BigEndian.Uint32(param)))
-		} else if len(param) == 8 {
-			variables = append(variables, int64(binary.BigEndian.Uint64(param)))
+	if isExplainStatement(preparedStatement.SessionStatement) {
+		return append(messages, explainRowDescription()), nil
+	}
+	if isExecuteStatement(preparedStatement.SessionStatement) {
+		descriptionMessages, err := queryHandler.describeExecuteStatement(session, preparedStatement)
+		if err != nil {
+			return nil, err
 		}
+		return append(messages, descriptionMessages...), nil
+	}
+	if preparedStatement.Query == "" || preparedStatement.SessionStatement != "" || preparedStatement.RowCount {
+		return append(messages, &pgproto3.NoData{}), nil
 	}
 
-	LogDebug(queryHandler.config, "Bound variables:", variables)
-	preparedStatement.Variables = variables
-	preparedStatement.Portal = message.DestinationPortal
+	// Parameters aren't bound yet, so describe the result by running the statement with NULLs and without any rows
+	query, err := limitZeroQuery(preparedStatement.Query)
+	if err != nil {
+		return nil, err
+	}
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := session.queryContext()
+	defer cancel(nil)
+	defer session.startStatementTimer(cancel)()
+	statement, err := duckdb.PrepareContext(ctx, query)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't prepare statement via DuckDB:", query+"\n"+err.Error())
+		return nil, queryCanceledError(ctx, err)
+	}
+	defer statement.Close()
 
-	messages := []pgproto3.Message{&pgproto3.BindComplete{}}
+	variables := make([]interface{}, countQueryParameters(preparedStatement.Query))
+	rows, err := statement.QueryContext(ctx, variables...)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't execute prepared statement via DuckDB:", query+"\n"+err.Error())
+		return nil, queryCanceledError(ctx, err)
+	}
+	defer rows.Close()
+
+	descriptionMessages, err := queryHandler.rowsToDescriptionMessages(rows, preparedStatement, nil) // Result formats are unknown before Bind
+	if err != nil {
+		return nil, err
+	}
+	if len(descriptionMessages) == 0 {
+		return append(messages, &pgproto3.NoData{}), nil
+	}
+	return append(messages, descriptionMessages...), nil
+}
+
+// SELECT ... -> SELECT ... LIMIT 0, which has the same result columns without scanning the tables
+func limitZeroQuery(query string) (string, error) {
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil {
+		return "", err
+	}
+	if len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetSelectStmt() == nil {
+		return query, nil
+	}
 
-	return messages, preparedStatement, nil
+	selectStatement := queryTree.Stmts[0].Stmt.GetSelectStmt()
+	selectStatement.LimitCount = pgQuery.MakeAConstIntNode(0, 0)
+	selectStatement.LimitOption = pgQuery.LimitOption_LIMIT_OPTION_COUNT
+	return pgQuery.Deparse(queryTree)
 }
 
-func (queryHandler *QueryHandler) HandleDescribeQuery(message *pgproto3.Describe, preparedStatement *PreparedStatement) ([]pgproto3.Message, *PreparedStatement, error) {
-	switch message.ObjectType {
-	case 'S': // Statement
-		if message.Name != preparedStatement.Name {
-			LogError(queryHandler.config, "Statement mismatch:", message.Name, "instead of", preparedStatement.Name)
-			return nil, nil, errors.New("statement mismatch")
-		}
-	case 'P': // Portal
-		if message.Name != preparedStatement.Portal {
-			LogError(queryHandler.config, "Portal mismatch:", message.Name, "instead of", preparedStatement.Portal)
-			return nil, nil, errors.New("portal mismatch")
+// Describe (Portal): the shape of the rows the bound portal will return
+func (queryHandler *QueryHandler) HandleDescribePortalQuery(session *Session, portal *Portal) ([]pgproto3.Message, *Portal, error) {
+	if isExecuteStatement(portal.PreparedStatement.SessionStatement) {
+		err := queryHandler.queryExecutePortal(session, portal)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
-	if preparedStatement.Query == "" {
-		return []pgproto3.Message{&pgproto3.NoData{}}, preparedStatement, nil
+	preparedStatement := portal.PreparedStatement
+	if isExplainStatement(preparedStatement.SessionStatement) {
+		return []pgproto3.Message{explainRowDescription()}, portal, nil
 	}
-
-	if len(preparedStatement.ParameterOIDs) > 0 && len(preparedStatement.ParameterOIDs) != len(preparedStatement.Variables) { // Parse passed the parameters, but Bind didn't happen after
-		return []pgproto3.Message{&pgproto3.NoData{}}, preparedStatement, nil
+	if preparedStatement.Query == "" || preparedStatement.SessionStatement != "" || preparedStatement.RowCount {
+		return []pgproto3.Message{&pgproto3.NoData{}}, portal, nil
 	}
 
-	rows, err := preparedStatement.Statement.QueryContext(context.Background(), preparedStatement.Variables...)
-	if err != nil {
-		LogError(queryHandler.config, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
-		return nil, nil, err
+	if portal.Rows == nil {
+		err := queryHandler.queryPortal(session, portal)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	preparedStatement.Rows = rows
 
-	messages, err := queryHandler.rowsToDescriptionMessages(preparedStatement.Rows, preparedStatement.Query)
+	messages, err := queryHandler.rowsToDescriptionMessages(portal.Rows, preparedStatement, portal.ResultFormatCodes)
 	if err != nil {
 		return nil, nil, err
 	}
-	return messages, preparedStatement, nil
+	if len(messages) == 0 {
+		return []pgproto3.Message{&pgproto3.NoData{}}, portal, nil
+	}
+	return messages, portal, nil
 }
 
-func (queryHandler *QueryHandler) HandleExecuteQuery(message *pgproto3.Execute, preparedStatement *PreparedStatement) ([]pgproto3.Message, error) {
-	if message.Portal != preparedStatement.Portal {
-		LogError(queryHandler.config, "Portal mismatch:", message.Portal, "instead of", preparedStatement.Portal)
-		return nil, errors.New("portal mismatch")
+func (queryHandler *QueryHandler) HandleExecuteQuery(session *Session, message *pgproto3.Execute, portal *Portal, writer MessageWriter) error {
+	if isExecuteStatement(portal.PreparedStatement.SessionStatement) { // If there was no Describe step before
+		err := checkFailedTransaction(session, portal.PreparedStatement.ParsedStatement)
+		if err != nil {
+			return err
+		}
+		err = queryHandler.queryExecutePortal(session, portal)
+		if err != nil {
+			return err
+		}
 	}
 
+	preparedStatement := portal.PreparedStatement
+	if preparedStatement.SessionStatement != "" {
+		if isSessionStatement(preparedStatement.ParsedStatement) {
+			return queryHandler.handleSessionStatement(session, preparedStatement.ParsedStatement, writer)
+		}
+
+		err := checkFailedTransaction(session, preparedStatement.ParsedStatement)
+		if err != nil {
+			return err
+		}
+		err = queryHandler.snapshotTransaction(session)
+		if err != nil {
+			return err
+		}
+		if isCopyToStatement(preparedStatement.SessionStatement) {
+			return queryHandler.handleCopyToQuery(session, preparedStatement.Query, writer)
+		}
+		if isExplainStatement(preparedStatement.SessionStatement) {
+			return queryHandler.handleExplainQuery(session, preparedStatement.Query, preparedStatement.SessionStatement, portal.Variables, false, writer)
+		}
+		if isPreparedStatementStatement(preparedStatement.SessionStatement) {
+			return queryHandler.handlePreparedStatementQuery(session, preparedStatement.Query, preparedStatement.SessionStatement, writer)
+		}
+		return queryHandler.handleNativeTableQuery(session, preparedStatement.SessionStatement, portal.Variables, writer)
+	}
 	if preparedStatement.Query == "" {
-		return []pgproto3.Message{&pgproto3.EmptyQueryResponse{}}, nil
+		return writer(&pgproto3.EmptyQueryResponse{})
+	}
+
+	err := checkFailedTransaction(session, preparedStatement.ParsedStatement)
+	if err != nil {
+		return err
 	}
 
-	if preparedStatement.Rows == nil { // If Describe step didn't have Bind step before
-		rows, err := preparedStatement.Statement.QueryContext(context.Background(), preparedStatement.Variables...)
+	if portal.Rows == nil { // If there was no Describe step before
+		err = queryHandler.handleSessionSetting(session, preparedStatement.ParsedStatement)
 		if err != nil {
-			LogError(queryHandler.config, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
-			return nil, err
+			return err
+		}
+
+		err = queryHandler.queryPortal(session, portal)
+		if err != nil {
+			return err
 		}
-		preparedStatement.Rows = rows
 	}
 
-	defer preparedStatement.Rows.Close()
+	if portal.cancel != nil {
+		defer session.startStatementTimer(portal.cancel)()
+	}
+	if preparedStatement.RowCount {
+		rowCount, err := queryHandler.readRowCount(portal)
+		portal.Close()
+		if err != nil {
+			return queryCanceledError(portal.Context(), err)
+		}
+		return writer(commandComplete(preparedStatement.CommandTag, rowCount))
+	}
+	rowCount, suspended, err := queryHandler.streamPortalRows(portal, int64(message.MaxRows), writer)
+	if err != nil {
+		portal.Close()
+		return queryCanceledError(portal.Context(), err)
+	}
+
+	if suspended {
+		return writer(&pgproto3.PortalSuspended{})
+	}
 
-	return queryHandler.rowsToDataMessages(preparedStatement.Rows, preparedStatement.OriginalQuery)
+	portal.Close()
+	return writer(commandComplete(preparedStatement.CommandTag, rowCount))
+}
+
+// Runs the bound prepared statement, which can be canceled by CancelRequest or statement_timeout
+func (queryHandler *QueryHandler) queryPortal(session *Session, portal *Portal) error {
+	if portal.cancel != nil {
+		defer session.startStatementTimer(portal.cancel)()
+	}
+
+	preparedStatement := portal.PreparedStatement
+	err := queryHandler.refreshPreparedStatementsStatement(session, preparedStatement)
+	if err != nil {
+		return err
+	}
+	rows, err := preparedStatement.Statement.QueryContext(portal.Context(), portal.Variables...)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
+		return queryCanceledError(portal.Context(), err)
+	}
+	portal.Rows = rows
+	return portal.holdQuerySlot(session)
+}
+
+// Replaces the error caused by CancelRequest, statement_timeout, or shutdown with a query_canceled or admin_shutdown error
+func queryCanceledError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch cause := context.Cause(ctx); cause {
+	case errQueryCanceled, errStatementTimeout:
+		return &PgError{Code: PG_ERROR_CODE_QUERY_CANCELED, Message: cause.Error()}
+	case errAdminShutdown:
+		return &PgError{Code: PG_ERROR_CODE_ADMIN_SHUTDOWN, Message: cause.Error()}
+	}
+	return err
 }
 
 func (queryHandler *QueryHandler) createSchemas() {
@@ -396,16 +1145,16 @@ func (queryHandler *QueryHandler) createSchemas() {
 	}
 }
 
-func (queryHandler *QueryHandler) rowsToDescriptionMessages(rows *sql.Rows, query string) ([]pgproto3.Message, error) {
+func (queryHandler *QueryHandler) rowsToDescriptionMessages(rows *sql.Rows, preparedStatement *PreparedStatement, resultFormatCodes []int16) ([]pgproto3.Message, error) {
 	cols, err := rows.ColumnTypes()
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't get column types", query+"\n"+err.Error())
+		LogError(queryHandler.config, "Couldn't get column types", preparedStatement.Query+"\n"+err.Error())
 		return nil, err
 	}
 
 	var messages []pgproto3.Message
 
-	rowDescription := queryHandler.generateRowDescription(cols)
+	rowDescription := queryHandler.generateRowDescription(cols, resultFormatCodes, preparedStatement.ColumnOrigins)
 	if rowDescription != nil {
 		messages = append(messages, rowDescription)
 	}
@@ -413,42 +1162,126 @@ func (queryHandler *QueryHandler) rowsToDescriptionMessages(rows *sql.Rows, quer
 	return messages, nil
 }
 
-func (queryHandler *QueryHandler) rowsToDataMessages(rows *sql.Rows, originalQueryStatement string) ([]pgproto3.Message, error) {
-	cols, err := rows.ColumnTypes()
+func (queryHandler *QueryHandler) streamQueryResult(portal *Portal, writer MessageWriter) error {
+	if portal.PreparedStatement.RowCount {
+		rowCount, err := queryHandler.readRowCount(portal)
+		if err != nil {
+			return err
+		}
+		return writer(commandComplete(portal.PreparedStatement.CommandTag, rowCount))
+	}
+
+	cols, err := portal.ColumnTypes()
 	if err != nil {
-		LogError(queryHandler.config, "Couldn't get column types", originalQueryStatement+"\n"+err.Error())
-		return nil, err
+		LogError(queryHandler.config, "Couldn't get column types", portal.PreparedStatement.Query+"\n"+err.Error())
+		return err
 	}
 
-	var messages []pgproto3.Message
-	for rows.Next() {
-		dataRow, err := queryHandler.generateDataRow(rows, cols)
+	rowDescription := queryHandler.generateRowDescription(cols, portal.ResultFormatCodes, portal.PreparedStatement.ColumnOrigins)
+	if rowDescription != nil {
+		err = writer(rowDescription)
 		if err != nil {
-			LogError(queryHandler.config, "Couldn't get data row", originalQueryStatement+"\n"+err.Error())
-			return nil, err
+			return err
 		}
-		messages = append(messages, dataRow)
 	}
 
-	commandTag := FALLBACK_SQL_QUERY
-	switch {
-	case strings.HasPrefix(originalQueryStatement, "SET "):
-		commandTag = "SET"
-	case strings.HasPrefix(originalQueryStatement, "SHOW "):
-		commandTag = "SHOW"
-	case strings.HasPrefix(originalQueryStatement, "DISCARD ALL"):
-		commandTag = "DISCARD ALL"
+	rowCount, _, err := queryHandler.streamPortalRows(portal, 0, writer)
+	if err != nil {
+		return err
 	}
 
-	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte(commandTag)})
-	return messages, nil
+	return writer(commandComplete(portal.PreparedStatement.CommandTag, rowCount))
+}
+
+// Streams up to maxRows rows (all rows if maxRows is 0) from the portal in batches.
+// Returns the number of streamed rows and whether there are rows left.
+func (queryHandler *QueryHandler) streamPortalRows(portal *Portal, maxRows int64, writer MessageWriter) (int64, bool, error) {
+	cols, err := portal.ColumnTypes()
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't get column types", portal.PreparedStatement.OriginalQuery+"\n"+err.Error())
+		return 0, false, err
+	}
+	typeOids := queryHandler.columnTypeOids(cols, portal.PreparedStatement.ColumnOrigins)
+
+	var rowCount int64
+	var batch []pgproto3.Message
+	var batchSize int
+
+	for maxRows == 0 || rowCount < maxRows {
+		if !portal.nextRowFetched && !portal.Rows.Next() {
+			if err := portal.Rows.Err(); err != nil {
+				return rowCount, false, err
+			}
+			return rowCount, false, writeBatch(writer, batch)
+		}
+		portal.nextRowFetched = false
+
+		dataRow, err := queryHandler.generateDataRow(portal, cols, typeOids)
+		if err != nil {
+			LogError(queryHandler.config, "Couldn't get data row", portal.PreparedStatement.OriginalQuery+"\n"+err.Error())
+			return rowCount, false, err
+		}
+
+		dataRowSize := dataRowSize(dataRow)
+		err = queryHandler.checkResultLimits(portal, dataRowSize)
+		if err != nil {
+			return rowCount, false, err
+		}
+
+		batch = append(batch, dataRow)
+		batchSize += dataRowSize
+		rowCount++
+
+		// Writing blocks while the client is reading slower than rows are produced
+		if len(batch) >= STREAM_BATCH_MAX_ROWS || batchSize >= STREAM_BATCH_MAX_BYTES {
+			err = writeBatch(writer, batch)
+			if err != nil {
+				return rowCount, false, err
+			}
+			batch = nil
+			batchSize = 0
+		}
+	}
+
+	err = writeBatch(writer, batch)
+	if err != nil {
+		return rowCount, false, err
+	}
+
+	// Look ahead to tell a suspended portal from a completed one
+	if portal.Rows.Next() {
+		portal.nextRowFetched = true
+		return rowCount, true, nil
+	}
+	return rowCount, false, portal.Rows.Err()
 }
 
-func (queryHandler *QueryHandler) parseAndRemapQuery(query string) ([]string, []string, error) {
+func (queryHandler *QueryHandler) checkResultLimits(portal *Portal, dataRowSize int) error {
+	portal.resultRows++
+	portal.resultBytes += int64(dataRowSize)
+
+	if queryHandler.config.MaxResultRows > 0 && portal.resultRows > queryHandler.config.MaxResultRows {
+		return &PgError{
+			Code:    PG_ERROR_CODE_PROGRAM_LIMIT_EXCEEDED,
+			Message: "query result exceeds the maximum of " + strconv.FormatInt(queryHandler.config.MaxResultRows, 10) + " rows",
+		}
+	}
+	if queryHandler.config.MaxResultBytes > 0 && portal.resultBytes > queryHandler.config.MaxResultBytes {
+		return &PgError{
+			Code:    PG_ERROR_CODE_PROGRAM_LIMIT_EXCEEDED,
+			Message: "query result exceeds the maximum size of " + strconv.FormatInt(queryHandler.config.MaxResultBytes, 10) + " bytes",
+		}
+	}
+	return nil
+}
+
+// Returns the remapped statements, the original statements, and their command tags
+// Returns the remapped and the original statements, and the original statements parsed before remapping to dispatch them
+func (queryHandler *QueryHandler) parseAndRemapQuery(query string) ([]string, []string, []*pgQuery.Node, error) {
 	queryTree, err := pgQuery.Parse(query)
 	if err != nil {
 		LogError(queryHandler.config, "Error parsing query:", query+"\n"+err.Error())
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if strings.HasSuffix(query, INSPECT_SQL_COMMENT) {
@@ -456,50 +1289,59 @@ func (queryHandler *QueryHandler) parseAndRemapQuery(query string) ([]string, []
 	}
 
 	var originalQueryStatements []string
+	var originalStatements []*pgQuery.Node
 	for _, stmt := range queryTree.Stmts {
 		originalQueryStatement, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{stmt}})
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		originalQueryStatements = append(originalQueryStatements, originalQueryStatement)
+		originalStatements = append(originalStatements, proto.Clone(stmt.Stmt).(*pgQuery.Node)) // Remapping changes the statements in place
 	}
 
 	remappedStatements, err := queryHandler.queryRemapper.RemapStatements(queryTree.Stmts)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	var queryStatements []string
 	for _, remappedStatement := range remappedStatements {
 		queryStatement, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{remappedStatement}})
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		queryStatements = append(queryStatements, queryStatement)
 	}
 
-	return queryStatements, originalQueryStatements, nil
+	return queryStatements, originalQueryStatements, originalStatements, nil
 }
 
-func (queryHandler *QueryHandler) generateRowDescription(cols []*sql.ColumnType) *pgproto3.RowDescription {
+// Column origins describe the source table columns, if they're known
+func (queryHandler *QueryHandler) generateRowDescription(cols []*sql.ColumnType, resultFormatCodes []int16, columnOrigins []ColumnOrigin) *pgproto3.RowDescription {
 	description := pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{}}
+	typeOids := queryHandler.columnTypeOids(cols, columnOrigins)
 
-	for _, col := range cols {
-		typeIod := queryHandler.columnTypeOid(col)
+	for i, col := range cols {
+		typeIod := typeOids[i]
 
 		if col.Name() == "Success" && typeIod == pgtype.BoolOID && len(cols) == 1 {
 			// Skip the "Success" DuckDB column returned from SET ... commands
 			return nil
 		}
 
+		columnOrigin := ColumnOrigin{TypeModifier: columnTypeModifier(col)}
+		if len(columnOrigins) == len(cols) && columnOrigins[i].TableOid != 0 {
+			columnOrigin = columnOrigins[i]
+		}
+
 		description.Fields = append(description.Fields, pgproto3.FieldDescription{
 			Name:                 []byte(col.Name()),
-			TableOID:             0,
-			TableAttributeNumber: 0,
+			TableOID:             columnOrigin.TableOid,
+			TableAttributeNumber: columnOrigin.AttributeNumber,
 			DataTypeOID:          typeIod,
-			DataTypeSize:         -1,
-			TypeModifier:         -1,
-			Format:               0,
+			DataTypeSize:         dataTypeSize(typeIod),
+			TypeModifier:         columnOrigin.TypeModifier,
+			Format:               resultFormatCode(resultFormatCodes, i),
 		})
 	}
 	return &description
@@ -507,77 +1349,174 @@ func (queryHandler *QueryHandler) generateRowDescription(cols []*sql.ColumnType)
 
 // https://pkg.go.dev/github.com/jackc/pgx/v5/pgtype#pkg-constants
 func (queryHandler *QueryHandler) columnTypeOid(col *sql.ColumnType) uint32 {
-	switch col.DatabaseTypeName() {
-	case "BOOLEAN":
-		return pgtype.BoolOID
-	case "BOOLEAN[]":
-		return pgtype.BoolArrayOID
-	case "SMALLINT":
-		return pgtype.Int2OID
-	case "SMALLINT[]":
-		return pgtype.Int2ArrayOID
-	case "INTEGER":
-		return pgtype.Int4OID
-	case "INTEGER[]":
-		return pgtype.Int4ArrayOID
-	case "UINTEGER":
-		return pgtype.XIDOID
-	case "UINTEGER[]":
-		return pgtype.XIDArrayOID
-	case "BIGINT":
-		if isSystemTableOidColumn(col.Name()) {
-			return pgtype.OIDOID
-		}
-		return pgtype.Int8OID
-	case "BIGINT[]":
-		return pgtype.Int8ArrayOID
-	case "UBIGINT":
-		return pgtype.XID8OID
-	case "UBIGINT[]":
-		return pgtype.XID8ArrayOID
-	case "HUGEINT":
-		return pgtype.NumericOID
-	case "HUGEINT[]":
-		return pgtype.NumericArrayOID
-	case "FLOAT":
-		return pgtype.Float4OID
-	case "FLOAT[]":
-		return pgtype.Float4ArrayOID
-	case "DOUBLE":
-		return pgtype.Float8OID
-	case "DOUBLE[]":
-		return pgtype.Float8ArrayOID
-	case "VARCHAR":
-		return pgtype.TextOID
-	case "VARCHAR[]":
+	databaseTypeName := col.DatabaseTypeName()
+
+	if strings.HasSuffix(databaseTypeName, "[]") {
+		elementTypeName := strings.TrimSuffix(databaseTypeName, "[]")
+		if strings.HasPrefix(elementTypeName, "STRUCT") || strings.HasPrefix(elementTypeName, "MAP") {
+			return pgtype.JSONOID // The whole list as a JSON array
+		}
+		if strings.HasPrefix(elementTypeName, "DECIMAL") {
+			return pgtype.NumericArrayOID
+		}
+		if oid, ok := DUCKDB_ARRAY_TYPE_OIDS[elementTypeName]; ok {
+			return oid
+		}
+		LogWarn(queryHandler.config, "Unsupported column type, falling back to text:", databaseTypeName)
 		return pgtype.TextArrayOID
-	case "TIME":
-		return pgtype.TimeOID
-	case "TIME[]":
-		return pgtype.TimeArrayOID
-	case "DATE":
-		return pgtype.DateOID
-	case "DATE[]":
-		return pgtype.DateArrayOID
-	case "TIMESTAMP":
-		return pgtype.TimestampOID
-	case "TIMESTAMP[]":
-		return pgtype.TimestampArrayOID
-	case "BLOB":
-		return pgtype.UUIDOID
-	case "BLOB[]":
-		return pgtype.UUIDArrayOID
+	}
+
+	switch {
+	case databaseTypeName == "BIGINT" && isSystemTableOidColumn(col.Name()):
+		return pgtype.OIDOID
+	case strings.HasPrefix(databaseTypeName, "DECIMAL"):
+		return pgtype.NumericOID
+	case strings.HasPrefix(databaseTypeName, "STRUCT"), strings.HasPrefix(databaseTypeName, "MAP"):
+		return pgtype.JSONOID
+	}
+	if oid, ok := DUCKDB_TYPE_OIDS[databaseTypeName]; ok {
+		return oid
+	}
+	LogWarn(queryHandler.config, "Unsupported column type, falling back to text:", databaseTypeName)
+	return pgtype.TextOID
+}
+
+// Column type OIDs, with the Iceberg types of the source table columns where DuckDB types are ambiguous
+func (queryHandler *QueryHandler) columnTypeOids(cols []*sql.ColumnType, columnOrigins []ColumnOrigin) []uint32 {
+	typeOids := make([]uint32, len(cols))
+	for i, col := range cols {
+		if len(columnOrigins) == len(cols) && columnOrigins[i].DataTypeOid != 0 {
+			typeOids[i] = columnOrigins[i].DataTypeOid
+		} else {
+			typeOids[i] = queryHandler.columnTypeOid(col)
+		}
+	}
+	return typeOids
+}
+
+// Command tag by the type of the original (not remapped) statement, without the row count
+func commandTag(statement *pgQuery.Node) string {
+	switch {
+	case statement.GetSelectStmt() != nil:
+		return "SELECT"
+	case statement.GetVariableSetStmt() != nil:
+		switch statement.GetVariableSetStmt().Kind {
+		case pgQuery.VariableSetKind_VAR_RESET, pgQuery.VariableSetKind_VAR_RESET_ALL:
+			return "RESET"
+		}
+		return "SET"
+	case statement.GetVariableShowStmt() != nil:
+		return "SHOW"
+	case statement.GetDiscardStmt() != nil:
+		switch statement.GetDiscardStmt().Target {
+		case pgQuery.DiscardMode_DISCARD_PLANS:
+			return "DISCARD PLANS"
+		case pgQuery.DiscardMode_DISCARD_SEQUENCES:
+			return "DISCARD SEQUENCES"
+		case pgQuery.DiscardMode_DISCARD_TEMP:
+			return "DISCARD TEMP"
+		}
+		return "DISCARD ALL"
+	case statement.GetDeclareCursorStmt() != nil:
+		return "DECLARE CURSOR"
+	case statement.GetFetchStmt() != nil:
+		if statement.GetFetchStmt().Ismove {
+			return "MOVE"
+		}
+		return "FETCH"
+	case statement.GetClosePortalStmt() != nil:
+		if statement.GetClosePortalStmt().Portalname == "" {
+			return "CLOSE CURSOR ALL"
+		}
+		return "CLOSE CURSOR"
+	case statement.GetViewStmt() != nil:
+		return "CREATE VIEW"
+	case statement.GetDropStmt() != nil && statement.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_VIEW:
+		return "DROP VIEW"
+	case statement.GetCreateTableAsStmt() != nil && statement.GetCreateTableAsStmt().Objtype == pgQuery.ObjectType_OBJECT_MATVIEW:
+		return "SELECT"
+	case statement.GetRefreshMatViewStmt() != nil:
+		return "REFRESH MATERIALIZED VIEW"
+	case statement.GetDropStmt() != nil && statement.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_MATVIEW:
+		return "DROP MATERIALIZED VIEW"
+	case statement.GetCreateStmt() != nil:
+		return "CREATE TABLE"
+	case statement.GetCreateTableAsStmt() != nil && statement.GetCreateTableAsStmt().Objtype == pgQuery.ObjectType_OBJECT_TABLE:
+		return "SELECT"
+	case statement.GetInsertStmt() != nil:
+		return "INSERT"
+	case statement.GetDropStmt() != nil && statement.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_TABLE:
+		return "DROP TABLE"
+	case statement.GetCopyStmt() != nil:
+		return "COPY"
+	case statement.GetExplainStmt() != nil:
+		return "EXPLAIN"
+	case statement.GetPrepareStmt() != nil:
+		return "PREPARE"
+	case statement.GetExecuteStmt() != nil:
+		return "SELECT" // The command tag of the executed statement
+	case statement.GetDeallocateStmt() != nil:
+		if statement.GetDeallocateStmt().Name == "" {
+			return "DEALLOCATE ALL"
+		}
+		return "DEALLOCATE"
+	case statement.GetTransactionStmt() != nil:
+		switch statement.GetTransactionStmt().Kind {
+		case pgQuery.TransactionStmtKind_TRANS_STMT_BEGIN:
+			return "BEGIN"
+		case pgQuery.TransactionStmtKind_TRANS_STMT_START:
+			return "START TRANSACTION"
+		case pgQuery.TransactionStmtKind_TRANS_STMT_COMMIT:
+			return "COMMIT"
+		case pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK, pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK_TO:
+			return "ROLLBACK"
+		case pgQuery.TransactionStmtKind_TRANS_STMT_SAVEPOINT:
+			return "SAVEPOINT"
+		case pgQuery.TransactionStmtKind_TRANS_STMT_RELEASE:
+			return "RELEASE"
+		}
+	}
+	return ""
+}
+
+// SELECT 3, FETCH 3, MOVE 3, COPY 3, INSERT 0 3, SET, SHOW, etc.
+func commandComplete(commandTag string, rowCount int64) *pgproto3.CommandComplete {
+	switch commandTag {
+	case "SELECT", "FETCH", "MOVE", "COPY":
+		commandTag += " " + strconv.FormatInt(rowCount, 10)
+	case "INSERT":
+		commandTag += " 0 " + strconv.FormatInt(rowCount, 10) // The OID is always 0
+	}
+	return &pgproto3.CommandComplete{CommandTag: []byte(commandTag)}
+}
+
+func resultFormatCode(resultFormatCodes []int16, columnIndex int) int16 {
+	switch len(resultFormatCodes) {
+	case 0:
+		return pgtype.TextFormatCode
+	case 1:
+		return resultFormatCodes[0]
 	default:
-		if strings.HasPrefix(col.DatabaseTypeName(), "DECIMAL") {
-			if strings.HasSuffix(col.DatabaseTypeName(), "[]") {
-				return pgtype.NumericArrayOID
-			} else {
-				return pgtype.NumericOID
-			}
+		if columnIndex < len(resultFormatCodes) {
+			return resultFormatCodes[columnIndex]
 		}
+		return pgtype.TextFormatCode
+	}
+}
 
-		panic("Unsupported column type: " + col.DatabaseTypeName())
+func writeBatch(writer MessageWriter, batch []pgproto3.Message) error {
+	if len(batch) == 0 {
+		return nil
 	}
+	return writer(batch...)
+}
+
+func dataRowSize(dataRow *pgproto3.DataRow) int {
+	size := 0
+	for _, value := range dataRow.Values {
+		size += 4 + len(value) // Length prefix + value
+	}
+	return size
 }
 
 func isSystemTableOidColumn(colName string) bool {
@@ -595,14 +1534,20 @@ func isSystemTableOidColumn(colName string) bool {
 	return oidColumns[colName]
 }
 
-func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.ColumnType) (*pgproto3.DataRow, error) {
+func (queryHandler *QueryHandler) generateDataRow(portal *Portal, cols []*sql.ColumnType, typeOids []uint32) (*pgproto3.DataRow, error) {
 	valuePtrs := make([]interface{}, len(cols))
 	for i, col := range cols {
+		if col.ScanType() == nil { // Unsupported by the DuckDB driver
+			var value interface{}
+			valuePtrs[i] = &value
+			continue
+		}
+
 		switch col.ScanType().String() {
-		case "int16":
+		case "int8", "uint8", "int16":
 			var value sql.NullInt16
 			valuePtrs[i] = &value
-		case "int32":
+		case "uint16", "int32":
 			var value sql.NullInt32
 			valuePtrs[i] = &value
 		case "int64":
@@ -632,21 +1577,37 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 		case "duckdb.Decimal":
 			var value NullDecimal
 			valuePtrs[i] = &value
+		case "duckdb.Interval":
+			var value NullInterval
+			valuePtrs[i] = &value
+		case "map[string]interface {}", "duckdb.Map":
+			var value NullJson
+			valuePtrs[i] = &value
 		case "[]interface {}":
 			var value NullArray
 			valuePtrs[i] = &value
 		default:
-			panic("Unsupported queried type: " + col.ScanType().String())
+			var value interface{}
+			valuePtrs[i] = &value
 		}
 	}
 
-	err := rows.Scan(valuePtrs...)
+	err := portal.Rows.Scan(valuePtrs...)
 	if err != nil {
 		return nil, err
 	}
 
 	var values [][]byte
 	for i, valuePtr := range valuePtrs {
+		if resultFormatCode(portal.ResultFormatCodes, i) == pgtype.BinaryFormatCode {
+			value, err := queryHandler.encodeBinaryValue(portal.TypeMap(), cols[i], typeOids[i], valuePtr)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			continue
+		}
+
 		switch value := valuePtr.(type) {
 		case *sql.NullInt16:
 			if value.Valid {
@@ -685,10 +1646,14 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 				values = append(values, nil)
 			}
 		case *sql.NullString:
-			if value.Valid {
-				values = append(values, []byte(value.String))
-			} else {
+			if !value.Valid {
 				values = append(values, nil)
+			} else if typeOids[i] == pgtype.ByteaOID {
+				values = append(values, []byte("\\x"+hex.EncodeToString([]byte(value.String))))
+			} else if typeOids[i] == pgtype.UUIDOID && len(value.String) == 16 { // Raw bytes instead of the text representation
+				values = append(values, []byte(uuid.UUID([]byte(value.String)).String()))
+			} else {
+				values = append(values, []byte(value.String))
 			}
 		case *sql.NullBool:
 			if value.Valid {
@@ -698,15 +1663,17 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 			}
 		case *sql.NullTime:
 			if value.Valid {
-				switch cols[i].DatabaseTypeName() {
-				case "DATE":
+				switch typeOids[i] {
+				case pgtype.DateOID:
 					values = append(values, []byte(value.Time.Format("2006-01-02")))
-				case "TIME":
+				case pgtype.TimeOID:
 					values = append(values, []byte(value.Time.Format("15:04:05.999999")))
-				case "TIMESTAMP":
-					values = append(values, []byte(value.Time.Format("2006-01-02 15:04:05.999999")))
+				case pgtype.TimetzOID:
+					values = append(values, []byte(value.Time.Format("15:04:05.999999")+formatUtcOffset(value.Time)))
+				case pgtype.TimestamptzOID:
+					values = append(values, []byte(formatTimestamptz(value.Time, portal.TimeZone())))
 				default:
-					panic("Unsupported type: " + cols[i].DatabaseTypeName())
+					values = append(values, []byte(value.Time.Format("2006-01-02 15:04:05.999999")))
 				}
 			} else {
 				values = append(values, nil)
@@ -723,16 +1690,32 @@ func (queryHandler *QueryHandler) generateDataRow(rows *sql.Rows, cols []*sql.Co
 			} else {
 				values = append(values, nil)
 			}
-		case *NullArray:
+		case *NullInterval:
 			if value.Present {
 				values = append(values, []byte(value.String()))
 			} else {
 				values = append(values, nil)
 			}
-		case *string:
-			values = append(values, []byte(*value))
-		default:
-			panic("Unsupported type: " + cols[i].ScanType().Name())
+		case *NullJson:
+			if value.Present {
+				values = append(values, []byte(value.String()))
+			} else {
+				values = append(values, nil)
+			}
+		case *NullArray:
+			if !value.Present {
+				values = append(values, nil)
+			} else if typeOids[i] == pgtype.JSONOID {
+				values = append(values, []byte(NullJson{Present: true, Value: value.Value}.String()))
+			} else {
+				values = append(values, []byte(value.String()))
+			}
+		case *interface{}: // Text fallback
+			if *value != nil {
+				values = append(values, []byte(fmt.Sprintf("%v", *value)))
+			} else {
+				values = append(values, nil)
+			}
 		}
 	}
 	dataRow := pgproto3.DataRow{Values: values}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	TIMESTAMP_PRECISION_TYPE_MOD = 6 // Iceberg timestamps and times have microsecond precision
+)
+
+var ICEBERG_DECIMAL_TYPE_REGEXP = regexp.MustCompile(`^decimal\((\d+),\s*(\d+)\)$`)
+var DUCKDB_DECIMAL_TYPE_REGEXP = regexp.MustCompile(`^DECIMAL\((\d+),(\d+)\)$`)
+
+// Source table column of a result column, described in RowDescription
+type ColumnOrigin struct {
+	TableOid        uint32
+	AttributeNumber uint16
+	TypeModifier    int32
+	DataTypeOid     uint32 // 0 if the type is determined by the DuckDB column type
+}
+
+type icebergFromTable struct {
+	alias            string
+	tableOid         uint32
+	attributeNumbers map[string]uint16
+	schemaFields     []IcebergSchemaField // nil if the table isn't an Iceberg table
+}
+
+// The oid and attnum values of the DuckDB view of an Iceberg table, which pg_class and pg_attribute return for the table
+const ICEBERG_VIEW_ATTRIBUTES_QUERY = `SELECT views.view_oid, pg_attribute.attname, pg_attribute.attnum
+	FROM duckdb_views() views
+	JOIN pg_catalog.pg_attribute pg_attribute ON pg_attribute.attrelid = views.view_oid
+	WHERE NOT views.temporary AND views.schema_name = $1 AND views.view_name = $2`
+
+// Origins of the result columns selected directly from Iceberg tables in the query.
+// Returns nil if the result columns can't be matched, e.g., * from a subquery.
+func (queryHandler *QueryHandler) columnOrigins(queryStatement string) []ColumnOrigin {
+	queryTree, err := pgQuery.Parse(queryStatement)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return nil
+	}
+	selectStatement := queryTree.Stmts[0].Stmt.GetSelectStmt()
+	if selectStatement == nil || selectStatement.Op != pgQuery.SetOperation_SETOP_NONE {
+		return nil
+	}
+
+	var fromTables []icebergFromTable
+	for _, fromNode := range selectStatement.FromClause {
+		fromTables = append(fromTables, queryHandler.icebergFromTables(fromNode)...)
+	}
+
+	var columnOrigins []ColumnOrigin
+	for _, targetNode := range selectStatement.TargetList {
+		columnRef := targetNode.GetResTarget().GetVal().GetColumnRef()
+		if columnRef == nil {
+			columnOrigins = append(columnOrigins, ColumnOrigin{})
+			continue
+		}
+
+		fields := columnRef.Fields
+		if fields[len(fields)-1].GetAStar() != nil {
+			starTables := fromTables
+			if len(fields) == 2 {
+				starTables = findIcebergFromTables(fromTables, fields[0].GetString_().GetSval(), "")
+			}
+			if len(starTables) == 0 {
+				return nil
+			}
+			for _, fromTable := range starTables {
+				if fromTable.schemaFields == nil {
+					return nil
+				}
+				for _, schemaField := range fromTable.schemaFields {
+					columnOrigins = append(columnOrigins, icebergColumnOrigin(fromTable, schemaField))
+				}
+			}
+			continue
+		}
+
+		columnOrigin := ColumnOrigin{}
+		columnName := fields[len(fields)-1].GetString_().GetSval()
+		alias := ""
+		if len(fields) == 2 {
+			alias = fields[0].GetString_().GetSval()
+		}
+		if len(fields) <= 2 {
+			matchingTables := findIcebergFromTables(fromTables, alias, columnName)
+			if len(matchingTables) == 1 && matchingTables[0].schemaFields != nil {
+				for _, schemaField := range matchingTables[0].schemaFields {
+					if schemaField.Name == columnName {
+						columnOrigin = icebergColumnOrigin(matchingTables[0], schemaField)
+					}
+				}
+			}
+		}
+		columnOrigins = append(columnOrigins, columnOrigin)
+	}
+
+	return columnOrigins
+}
+
+// FROM schema.table alias of Iceberg tables (DuckDB views), including joined tables
+func (queryHandler *QueryHandler) icebergFromTables(fromNode *pgQuery.Node) []icebergFromTable {
+	if joinExpr := fromNode.GetJoinExpr(); joinExpr != nil {
+		return append(queryHandler.icebergFromTables(joinExpr.Larg), queryHandler.icebergFromTables(joinExpr.Rarg)...)
+	}
+
+	fromTable := icebergFromTable{}
+	rangeVar := fromNode.GetRangeVar()
+	if rangeVar == nil {
+		if rangeSubselect := fromNode.GetRangeSubselect(); rangeSubselect != nil && rangeSubselect.Alias != nil {
+			fromTable.alias = rangeSubselect.Alias.Aliasname
+		}
+		return []icebergFromTable{fromTable}
+	}
+	fromTable.alias = rangeVar.Relname
+	if rangeVar.Alias != nil {
+		fromTable.alias = rangeVar.Alias.Aliasname
+	}
+
+	schemaTable := IcebergSchemaTable{Schema: rangeVar.Schemaname, Table: rangeVar.Relname}
+	if schemaTable.Schema == "" {
+		schemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+	metadataFilePath := queryHandler.queryRemapper.remapperTable.IcebergViewMetadataFilePath(schemaTable)
+	if metadataFilePath == "" {
+		return []icebergFromTable{fromTable}
+	}
+	schemaFields, err := queryHandler.icebergReader.SchemaFields(metadataFilePath)
+	if err != nil {
+		LogWarn(queryHandler.config, "Couldn't read Iceberg schema fields:", err.Error())
+		return []icebergFromTable{fromTable}
+	}
+
+	tableOid, attributeNumbers, err := queryHandler.icebergViewAttributes(schemaTable)
+	if err != nil {
+		LogWarn(queryHandler.config, "Couldn't read Iceberg table attributes:", err.Error())
+		return []icebergFromTable{fromTable}
+	}
+
+	fromTable.tableOid = tableOid
+	fromTable.attributeNumbers = attributeNumbers
+	fromTable.schemaFields = schemaFields
+	return []icebergFromTable{fromTable}
+}
+
+func (queryHandler *QueryHandler) icebergViewAttributes(schemaTable IcebergSchemaTable) (tableOid uint32, attributeNumbers map[string]uint16, err error) {
+	ctx := context.Background()
+	statement, err := queryHandler.duckdb.PrepareContext(ctx, ICEBERG_VIEW_ATTRIBUTES_QUERY)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer statement.Close()
+
+	rows, err := statement.QueryContext(ctx, schemaTable.Schema, schemaTable.Table)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	attributeNumbers = make(map[string]uint16)
+	for rows.Next() {
+		var attributeName string
+		var attributeNumber int64
+		err = rows.Scan(&tableOid, &attributeName, &attributeNumber)
+		if err != nil {
+			return 0, nil, err
+		}
+		attributeNumbers[attributeName] = uint16(attributeNumber)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	if tableOid == 0 {
+		return 0, nil, errors.New("view of " + schemaTable.String() + " not found")
+	}
+
+	return tableOid, attributeNumbers, nil
+}
+
+// Tables with the alias, or all tables with the column (and tables with unknown columns) if there's no alias
+func findIcebergFromTables(fromTables []icebergFromTable, alias string, columnName string) []icebergFromTable {
+	var matchingTables []icebergFromTable
+	for _, fromTable := range fromTables {
+		if alias != "" {
+			if fromTable.alias == alias {
+				matchingTables = append(matchingTables, fromTable)
+			}
+			continue
+		}
+
+		if fromTable.schemaFields == nil {
+			matchingTables = append(matchingTables, fromTable)
+			continue
+		}
+		for _, schemaField := range fromTable.schemaFields {
+			if schemaField.Name == columnName {
+				matchingTables = append(matchingTables, fromTable)
+				break
+			}
+		}
+	}
+	return matchingTables
+}
+
+func icebergColumnOrigin(fromTable icebergFromTable, schemaField IcebergSchemaField) ColumnOrigin {
+	return ColumnOrigin{
+		TableOid:        fromTable.tableOid,
+		AttributeNumber: fromTable.attributeNumbers[schemaField.Name],
+		TypeModifier:    icebergTypeModifier(schemaField.Type),
+		DataTypeOid:     icebergDataTypeOid(schemaField.Type),
+	}
+}
+
+// Iceberg uuid columns are read as BLOB, which would otherwise be described as bytea
+func icebergDataTypeOid(icebergType interface{}) uint32 {
+	if listType, ok := icebergType.(map[string]interface{}); ok {
+		if listType["element"] == "uuid" {
+			return pgtype.UUIDArrayOID
+		}
+		return 0
+	}
+	if icebergType == "uuid" {
+		return pgtype.UUIDOID
+	}
+	return 0
+}
+
+// decimal(P, S) -> ((P << 16) | S) + 4 like PostgreSQL numeric(P, S), timestamp/time -> precision
+func icebergTypeModifier(icebergType interface{}) int32 {
+	if listType, ok := icebergType.(map[string]interface{}); ok {
+		icebergType = listType["element"]
+	}
+	primitiveType, ok := icebergType.(string)
+	if !ok {
+		return -1
+	}
+
+	switch primitiveType {
+	case "timestamp", "timestamptz", "timestamp_ns", "time":
+		return TIMESTAMP_PRECISION_TYPE_MOD
+	}
+	if match := ICEBERG_DECIMAL_TYPE_REGEXP.FindStringSubmatch(primitiveType); match != nil {
+		return decimalTypeModifier(match[1], match[2])
+	}
+	return -1
+}
+
+// DECIMAL(P,S) columns, e.g., computed from Iceberg decimal columns, keep the precision and scale
+func columnTypeModifier(col *sql.ColumnType) int32 {
+	if match := DUCKDB_DECIMAL_TYPE_REGEXP.FindStringSubmatch(strings.TrimSuffix(col.DatabaseTypeName(), "[]")); match != nil {
+		return decimalTypeModifier(match[1], match[2])
+	}
+	return -1
+}
+
+func decimalTypeModifier(precision string, scale string) int32 {
+	precisionInt, err := strconv.ParseInt(precision, 10, 32)
+	if err != nil {
+		return -1
+	}
+	scaleInt, err := strconv.ParseInt(scale, 10, 32)
+	if err != nil {
+		return -1
+	}
+	return int32((precisionInt<<16)|scaleInt) + 4
+}
+
+// pg_type.typlen, -1 for variable-length types
+func dataTypeSize(typeOid uint32) int16 {
+	switch typeOid {
+	case pgtype.BoolOID:
+		return 1
+	case pgtype.Int2OID:
+		return 2
+	case pgtype.Int4OID, pgtype.Float4OID, pgtype.DateOID, pgtype.OIDOID, pgtype.XIDOID:
+		return 4
+	case pgtype.Int8OID, pgtype.Float8OID, pgtype.TimestampOID, pgtype.TimestamptzOID, pgtype.TimeOID, pgtype.XID8OID:
+		return 8
+	case pgtype.TimetzOID:
+		return 12
+	case pgtype.UUIDOID, pgtype.IntervalOID:
+		return 16
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+const (
+	COPY_FORMAT_TEXT   = "text"
+	COPY_FORMAT_CSV    = "csv"
+	COPY_FORMAT_BINARY = "binary"
+)
+
+// COPY ... WITH (FORMAT, HEADER, DELIMITER, NULL, QUOTE, ESCAPE) with the PostgreSQL defaults of the format
+type CopyOptions struct {
+	Format    string
+	Header    bool
+	Delimiter string
+	Null      string
+	Quote     string
+	Escape    string
+}
+
+func parseCopyOptions(optionNodes []*pgQuery.Node) (CopyOptions, error) {
+	copyOptions := CopyOptions{Format: COPY_FORMAT_TEXT}
+	var delimiter, null, quote, escape *string
+	var header bool
+	for _, optionNode := range optionNodes {
+		defElem := optionNode.GetDefElem()
+		value := defElemValue(defElem)
+		switch defElem.Defname {
+		case "format":
+			copyOptions.Format = strings.ToLower(value)
+		case "header":
+			header = true
+			switch strings.ToLower(value) {
+			case "true", "on", "1", "match":
+				copyOptions.Header = true
+			case "false", "off", "0":
+				copyOptions.Header = false
+			default:
+				return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_INVALID_PARAMETER_VALUE, Message: "header requires a Boolean value or \"match\""}
+			}
+		case "delimiter":
+			delimiter = &value
+		case "null":
+			null = &value
+		case "quote":
+			quote = &value
+		case "escape":
+			escape = &value
+		default:
+			return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY option \"" + defElem.Defname + "\" is not supported"}
+		}
+	}
+
+	switch copyOptions.Format {
+	case COPY_FORMAT_TEXT:
+		copyOptions.Delimiter, copyOptions.Null = "\t", `\N`
+		if quote != nil || escape != nil {
+			return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY quote and escape are available only in CSV mode"}
+		}
+	case COPY_FORMAT_CSV:
+		copyOptions.Delimiter, copyOptions.Null, copyOptions.Quote = ",", "", `"`
+	case COPY_FORMAT_BINARY:
+		switch {
+		case delimiter != nil:
+			return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_SYNTAX_ERROR, Message: "cannot specify DELIMITER in BINARY mode"}
+		case null != nil:
+			return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_SYNTAX_ERROR, Message: "cannot specify NULL in BINARY mode"}
+		case header:
+			return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_SYNTAX_ERROR, Message: "cannot specify HEADER in BINARY mode"}
+		case quote != nil || escape != nil:
+			return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY quote and escape are available only in CSV mode"}
+		}
+		return copyOptions, nil
+	default:
+		return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_INVALID_PARAMETER_VALUE, Message: "COPY format \"" + copyOptions.Format + "\" not recognized"}
+	}
+	if delimiter != nil {
+		copyOptions.Delimiter = *delimiter
+	}
+	if null != nil {
+		copyOptions.Null = *null
+	}
+	if quote != nil {
+		copyOptions.Quote = *quote
+	}
+	copyOptions.Escape = copyOptions.Quote
+	if escape != nil {
+		copyOptions.Escape = *escape
+	}
+
+	if len(copyOptions.Delimiter) != 1 {
+		return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY delimiter must be a single one-byte character"}
+	}
+	if copyOptions.Format == COPY_FORMAT_CSV && (len(copyOptions.Quote) != 1 || len(copyOptions.Escape) != 1) {
+		return CopyOptions{}, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY quote and escape must be a single one-byte character"}
+	}
+	return copyOptions, nil
+}
+
+// HEADER without a value, HEADER true, DELIMITER ',', ANALYZE, etc.
+func defElemValue(defElem *pgQuery.DefElem) string {
+	switch {
+	case defElem.Arg == nil:
+		return "true"
+	case defElem.Arg.GetBoolean() != nil:
+		return strconv.FormatBool(defElem.Arg.GetBoolean().Boolval)
+	case defElem.Arg.GetInteger() != nil:
+		return strconv.Itoa(int(defElem.Arg.GetInteger().Ival))
+	default:
+		return defElem.Arg.GetString_().GetSval()
+	}
+}
+
+// COPY schema.table [(columns)] FROM STDIN [WITH (...)]: the data sent by the client is written to a temporary file,
+// loaded into the staging table by DuckDB, and appended to the Iceberg table
+func (queryHandler *QueryHandler) copyIntoNativeTable(ctx context.Context, session *Session, duckdb *Duckdb, copyStatement *pgQuery.CopyStmt, writer MessageWriter) ([]pgproto3.Message, error) {
+	if copyStatement.Relation == nil || isTempTableRelation(copyStatement.Relation) {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY FROM STDIN is only supported for tables created with CREATE TABLE"}
+	}
+	schemaTable := relationSchemaTable(copyStatement.Relation)
+	if _, ok := queryHandler.queryRemapper.remapperNativeTable.NativeTable(schemaTable); !ok && queryHandler.queryRemapper.remapperTable.icebergSchemaTableExists(schemaTable) {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY FROM STDIN is only supported for tables created with CREATE TABLE"}
+	}
+	if copyStatement.WhereClause != nil {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY FROM with WHERE is not supported"}
+	}
+	if session.receive == nil {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY FROM STDIN is not supported by this connection"}
+	}
+
+	copyOptions, err := parseCopyOptions(copyStatement.Options)
+	if err != nil {
+		return nil, err
+	}
+	if copyOptions.Format == COPY_FORMAT_BINARY {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY FROM STDIN in the binary format is not supported"}
+	}
+	nativeTable, err := queryHandler.createNativeStagingTable(ctx, duckdb, schemaTable)
+	if err != nil {
+		return nil, err
+	}
+	var columnNames []string
+	for _, columnNameNode := range copyStatement.Attlist {
+		columnNames = append(columnNames, `"`+strings.ReplaceAll(columnNameNode.GetString_().Sval, `"`, `""`)+`"`)
+	}
+	columnCount := len(columnNames)
+	if columnCount == 0 {
+		columnCount = len(nativeTable.Columns)
+	}
+
+	dataFile, err := CreateTemporaryFile("copy")
+	if err != nil {
+		return nil, err
+	}
+	defer DeleteTemporaryFile(dataFile)
+	defer dataFile.Close()
+
+	err = writer(&pgproto3.CopyInResponse{OverallFormat: 0, ColumnFormatCodes: make([]uint16, columnCount)})
+	if err != nil {
+		return nil, err
+	}
+	err = receiveCopyData(session, dataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	csvFile := dataFile
+	if copyOptions.Format == COPY_FORMAT_TEXT {
+		csvFile, err = CreateTemporaryFile("copy")
+		if err != nil {
+			return nil, err
+		}
+		defer DeleteTemporaryFile(csvFile)
+		defer csvFile.Close()
+
+		err = convertCopyTextToCsv(dataFile, csvFile, copyOptions)
+		if err != nil {
+			return nil, err
+		}
+		copyOptions = CopyOptions{Format: COPY_FORMAT_CSV, Delimiter: ",", Quote: `"`, Escape: `"`} // Written by convertCopyTextToCsv
+	}
+
+	csvFileInfo, err := csvFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if csvFileInfo.Size() == 0 { // DuckDB can't sniff an empty file
+		return []pgproto3.Message{commandComplete("COPY", 0)}, nil
+	}
+
+	query := "COPY temp.main." + NATIVE_TABLE_STAGING_TABLE
+	if len(columnNames) > 0 {
+		query += " (" + strings.Join(columnNames, ", ") + ")"
+	}
+	query += " FROM " + quoteDuckdbString(csvFile.Name()) +
+		" (FORMAT csv, HEADER " + strconv.FormatBool(copyOptions.Header) +
+		", DELIMITER " + quoteDuckdbString(copyOptions.Delimiter) +
+		", NULL " + quoteDuckdbString(copyOptions.Null) +
+		", QUOTE " + quoteDuckdbString(copyOptions.Quote) +
+		", ESCAPE " + quoteDuckdbString(copyOptions.Escape) +
+		", allow_quoted_nulls false)" // Quoted empty strings aren't NULL, like in PostgreSQL
+	_, err = duckdb.ExecContext(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rowCount, err := queryHandler.appendStagingRows(ctx, duckdb, nativeTable)
+	if err != nil {
+		return nil, err
+	}
+
+	return []pgproto3.Message{commandComplete("COPY", rowCount)}, nil
+}
+
+// Writes the CopyData messages to the file until CopyDone
+func receiveCopyData(session *Session, file *os.File) error {
+	for {
+		message, err := session.receive()
+		if err != nil {
+			return err
+		}
+
+		switch message := message.(type) {
+		case *pgproto3.CopyData:
+			_, err = file.Write(message.Data)
+			if err != nil {
+				return err
+			}
+		case *pgproto3.CopyDone:
+			_, err = file.Seek(0, io.SeekStart)
+			return err
+		case *pgproto3.CopyFail:
+			return &PgError{Code: PG_ERROR_CODE_QUERY_CANCELED, Message: "COPY from stdin failed: " + message.Message}
+		case *pgproto3.Flush, *pgproto3.Sync:
+			// Ignored until the end of the data, like in PostgreSQL
+		default:
+			return &PgError{Code: PG_ERROR_CODE_PROTOCOL_VIOLATION, Message: fmt.Sprintf("unexpected message type %T during COPY from stdin", message)}
+		}
+	}
+}
+
+// PostgreSQL's text format -> CSV with quoted values and unquoted empty NULLs.
+// Values in the text format are separated by the delimiter, and special characters are escaped with backslashes.
+func convertCopyTextToCsv(textFile *os.File, csvFile *os.File, copyOptions CopyOptions) error {
+	reader := bufio.NewReader(textFile)
+	writer := bufio.NewWriter(csvFile)
+
+	header := copyOptions.Header
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == `\.` || (line == "" && err == io.EOF) {
+			break
+		}
+
+		if header {
+			header = false
+		} else {
+			for i, value := range splitCopyTextLine(line, copyOptions.Delimiter[0]) {
+				if i > 0 {
+					writer.WriteByte(',')
+				}
+				if value != copyOptions.Null {
+					writer.WriteString(`"` + strings.ReplaceAll(unescapeCopyTextValue(value), `"`, `""`) + `"`)
+				}
+			}
+			writer.WriteByte('\n')
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = csvFile.Seek(0, io.SeekStart)
+	return err
+}
+
+// Splits the line on the delimiters that aren't escaped with a backslash, without unescaping the values
+func splitCopyTextLine(line string, delimiter byte) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case delimiter:
+			values = append(values, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, line[start:])
+}
+
+// \b, \f, \n, \r, \t, \v, octal \123 and hex \x4F escapes, other escaped characters are taken literally
+func unescapeCopyTextValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			builder.WriteByte(value[i])
+			continue
+		}
+
+		i++
+		switch value[i] {
+		case 'b':
+			builder.WriteByte('\b')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'v':
+			builder.WriteByte('\v')
+		case 'x':
+			end := i + 1
+			for end < len(value) && end < i+3 && isHexDigit(value[end]) {
+				end++
+			}
+			if end == i+1 {
+				builder.WriteByte('x')
+				continue
+			}
+			code, _ := strconv.ParseUint(value[i+1:end], 16, 8)
+			builder.WriteByte(byte(code))
+			i = end - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			end := i
+			for end < len(value) && end < i+3 && value[end] >= '0' && value[end] <= '7' {
+				end++
+			}
+			code, _ := strconv.ParseUint(value[i:end], 8, 8)
+			builder.WriteByte(byte(code))
+			i = end - 1
+		default:
+			builder.WriteByte(value[i])
+		}
+	}
+	return builder.String()
+}
+
+// Signature, flags and header extension length of the binary format
+var COPY_BINARY_HEADER = []byte("PGCOPY\n\377\r\n\000\000\000\000\000\000\000\000\000")
+
+func isCopyToStatement(originalQueryStatement string) bool {
+	if !strings.HasPrefix(originalQueryStatement, "COPY ") {
+		return false
+	}
+
+	queryTree, err := pgQuery.Parse(originalQueryStatement)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return false
+	}
+	copyStatement := queryTree.Stmts[0].Stmt.GetCopyStmt()
+	return copyStatement != nil && !copyStatement.IsFrom
+}
+
+// COPY (SELECT ...) TO STDOUT [WITH (...)], remapped to a query by the query remapper: the rows are streamed from
+// DuckDB as CopyData messages, one per row, without reading the whole result first
+func (queryHandler *QueryHandler) handleCopyToQuery(session *Session, queryStatement string, writer MessageWriter) error {
+	queryTree, err := pgQuery.Parse(queryStatement)
+	if err != nil {
+		return err
+	}
+	copyStatement := queryTree.Stmts[0].Stmt.GetCopyStmt()
+	copyOptions, err := parseCopyOptions(copyStatement.Options)
+	if err != nil {
+		return err
+	}
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: copyStatement.Query}}})
+	if err != nil {
+		return err
+	}
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := session.queryContext()
+	defer session.startStatementTimer(cancel)()
+	rows, err := duckdb.QueryContext(ctx, query)
+	if err != nil {
+		cancel(nil)
+		LogError(queryHandler.config, "Couldn't handle query via DuckDB:", query+"\n"+err.Error())
+		return queryCanceledError(ctx, err)
+	}
+
+	portal := &Portal{
+		PreparedStatement: &PreparedStatement{OriginalQuery: queryStatement, Query: query},
+		Rows:              rows,
+		ctx:               ctx,
+		cancel:            cancel,
+		timeZone:          session.timeZone,
+	}
+	if copyOptions.Format == COPY_FORMAT_BINARY {
+		portal.ResultFormatCodes = []int16{pgtype.BinaryFormatCode}
+	}
+	defer portal.Close()
+
+	rowCount, err := queryHandler.streamCopyRows(portal, copyOptions, writer)
+	if err != nil {
+		return queryCanceledError(ctx, err)
+	}
+	return writer(&pgproto3.CopyDone{}, commandComplete("COPY", rowCount))
+}
+
+// CopyOutResponse, the header, a CopyData message per row, and the binary trailer. Returns the number of rows.
+func (queryHandler *QueryHandler) streamCopyRows(portal *Portal, copyOptions CopyOptions, writer MessageWriter) (int64, error) {
+	cols, err := portal.ColumnTypes()
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't get column types", portal.PreparedStatement.Query+"\n"+err.Error())
+		return 0, err
+	}
+	typeOids := queryHandler.columnTypeOids(cols, nil)
+
+	copyOutResponse := &pgproto3.CopyOutResponse{ColumnFormatCodes: make([]uint16, len(cols))}
+	if copyOptions.Format == COPY_FORMAT_BINARY {
+		copyOutResponse.OverallFormat = 1
+		for i := range copyOutResponse.ColumnFormatCodes {
+			copyOutResponse.ColumnFormatCodes[i] = pgtype.BinaryFormatCode
+		}
+	}
+	batch := []pgproto3.Message{copyOutResponse}
+	batchSize := 0
+
+	switch {
+	case copyOptions.Format == COPY_FORMAT_BINARY:
+		batch = append(batch, &pgproto3.CopyData{Data: COPY_BINARY_HEADER})
+	case copyOptions.Header:
+		columnNames := make([][]byte, len(cols))
+		for i, col := range cols {
+			columnNames[i] = []byte(col.Name())
+		}
+		batch = append(batch, &pgproto3.CopyData{Data: appendCopyRow(nil, columnNames, copyOptions)})
+	}
+
+	var rowCount int64
+	for portal.Rows.Next() {
+		dataRow, err := queryHandler.generateDataRow(portal, cols, typeOids)
+		if err != nil {
+			LogError(queryHandler.config, "Couldn't get data row", portal.PreparedStatement.Query+"\n"+err.Error())
+			return rowCount, err
+		}
+		copyData := &pgproto3.CopyData{Data: appendCopyRow(nil, dataRow.Values, copyOptions)}
+
+		err = queryHandler.checkResultLimits(portal, len(copyData.Data))
+		if err != nil {
+			return rowCount, err
+		}
+
+		batch = append(batch, copyData)
+		batchSize += len(copyData.Data)
+		rowCount++
+
+		// Writing blocks while the client is reading slower than rows are produced
+		if len(batch) >= STREAM_BATCH_MAX_ROWS || batchSize >= STREAM_BATCH_MAX_BYTES {
+			err = writeBatch(writer, batch)
+			if err != nil {
+				return rowCount, err
+			}
+			batch = nil
+			batchSize = 0
+		}
+	}
+	if err := portal.Rows.Err(); err != nil {
+		return rowCount, err
+	}
+
+	if copyOptions.Format == COPY_FORMAT_BINARY {
+		batch = append(batch, &pgproto3.CopyData{Data: []byte{0xff, 0xff}}) // -1 field count
+	}
+	return rowCount, writeBatch(writer, batch)
+}
+
+// Values are in the text or binary result format, nil for NULL
+func appendCopyRow(data []byte, values [][]byte, copyOptions CopyOptions) []byte {
+	if copyOptions.Format == COPY_FORMAT_BINARY {
+		data = binary.BigEndian.AppendUint16(data, uint16(len(values)))
+		for _, value := range values {
+			if value == nil {
+				data = binary.BigEndian.AppendUint32(data, 0xffffffff) // -1 length
+				continue
+			}
+			data = binary.BigEndian.AppendUint32(data, uint32(len(value)))
+			data = append(data, value...)
+		}
+		return data
+	}
+
+	for i, value := range values {
+		if i > 0 {
+			data = append(data, copyOptions.Delimiter...)
+		}
+		switch {
+		case value == nil:
+			data = append(data, copyOptions.Null...)
+		case copyOptions.Format == COPY_FORMAT_CSV:
+			data = appendCopyCsvValue(data, value, copyOptions)
+		default:
+			data = appendCopyTextValue(data, value, copyOptions)
+		}
+	}
+	return append(data, '\n')
+}
+
+// Quoted if the value contains the delimiter, quote, carriage return or line feed, or matches the NULL string
+func appendCopyCsvValue(data []byte, value []byte, copyOptions CopyOptions) []byte {
+	if string(value) != copyOptions.Null && !bytes.ContainsAny(value, copyOptions.Delimiter+copyOptions.Quote+"\r\n") {
+		return append(data, value...)
+	}
+
+	quote, escape := copyOptions.Quote[0], copyOptions.Escape[0]
+	data = append(data, quote)
+	for _, char := range value {
+		if char == quote || char == escape {
+			data = append(data, escape)
+		}
+		data = append(data, char)
+	}
+	return append(data, quote)
+}
+
+// Backslashes, the delimiter and control characters are escaped with backslashes
+func appendCopyTextValue(data []byte, value []byte, copyOptions CopyOptions) []byte {
+	for _, char := range value {
+		switch char {
+		case '\\':
+			data = append(data, '\\', '\\')
+		case '\b':
+			data = append(data, '\\', 'b')
+		case '\f':
+			data = append(data, '\\', 'f')
+		case '\n':
+			data = append(data, '\\', 'n')
+		case '\r':
+			data = append(data, '\\', 'r')
+		case '\t':
+			data = append(data, '\\', 't')
+		case '\v':
+			data = append(data, '\\', 'v')
+		case copyOptions.Delimiter[0]:
+			data = append(data, '\\', char)
+		default:
+			data = append(data, char)
+		}
+	}
+	return data
+}
+
+func isHexDigit(char byte) bool {
+	return (char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
+}
+
+func quoteDuckdbString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
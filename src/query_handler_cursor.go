@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"math"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+const CURSOR_OPT_BINARY = 0x0001 // DECLARE ... BINARY CURSOR
+
+// DECLARE ... CURSOR, FETCH and MOVE (FetchStmt), CLOSE (ClosePortalStmt)
+func isCursorStatement(node *pgQuery.Node) bool {
+	return node.GetDeclareCursorStmt() != nil || node.GetFetchStmt() != nil || node.GetClosePortalStmt() != nil
+}
+
+// DECLARE ... CURSOR FOR, FETCH, MOVE, CLOSE
+func (queryHandler *QueryHandler) handleCursorQuery(session *Session, queryStatement string, originalQueryStatement string, writer MessageWriter) error {
+	queryTree, err := pgQuery.Parse(queryStatement)
+	if err != nil {
+		return err
+	}
+	node := queryTree.Stmts[0].Stmt
+
+	var messages []pgproto3.Message
+	switch {
+	case node.GetDeclareCursorStmt() != nil:
+		messages, err = queryHandler.handleDeclareCursor(session, node.GetDeclareCursorStmt(), originalQueryStatement)
+	case node.GetFetchStmt() != nil:
+		return queryHandler.handleFetchCursor(session, node.GetFetchStmt(), writer)
+	case node.GetClosePortalStmt() != nil:
+		messages, err = queryHandler.handleCloseCursor(session, node.GetClosePortalStmt())
+	default:
+		return errors.New("unsupported cursor query: " + originalQueryStatement)
+	}
+	if err != nil {
+		return err
+	}
+	return writer(messages...)
+}
+
+func (queryHandler *QueryHandler) handleDeclareCursor(session *Session, declareCursorStatement *pgQuery.DeclareCursorStmt, originalQueryStatement string) ([]pgproto3.Message, error) {
+	name := declareCursorStatement.Portalname
+	if _, ok := session.cursors[name]; ok {
+		return nil, errors.New("cursor \"" + name + "\" already exists")
+	}
+
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: declareCursorStatement.Query}}})
+	if err != nil {
+		return nil, err
+	}
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := session.queryContext()
+	stopStatementTimer := session.startStatementTimer(cancel)
+	defer stopStatementTimer()
+	rows, err := duckdb.QueryContext(ctx, query)
+	if err != nil {
+		cancel(nil)
+		LogError(queryHandler.config, "Couldn't handle query via DuckDB:", query+"\n"+err.Error())
+		return nil, queryCanceledError(ctx, err)
+	}
+
+	portal := &Portal{
+		Name: name,
+		PreparedStatement: &PreparedStatement{
+			OriginalQuery: originalQueryStatement,
+			Query:         query,
+			CommandTag:    "SELECT",
+			ColumnOrigins: queryHandler.columnOrigins(query),
+		},
+		Rows:     rows,
+		ctx:      ctx,
+		cancel:   cancel,
+		timeZone: session.timeZone,
+	}
+	if declareCursorStatement.Options&CURSOR_OPT_BINARY != 0 {
+		portal.ResultFormatCodes = []int16{pgtype.BinaryFormatCode}
+	}
+	_, err = portal.ColumnTypes() // Keep the column types to describe FETCH results after the rows are exhausted
+	if err != nil {
+		portal.Close()
+		return nil, err
+	}
+	err = portal.holdQuerySlot(session)
+	if err != nil {
+		portal.Close()
+		return nil, err
+	}
+	session.cursors[name] = portal
+
+	return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte("DECLARE CURSOR")}}, nil
+}
+
+func (queryHandler *QueryHandler) handleFetchCursor(session *Session, fetchStatement *pgQuery.FetchStmt, writer MessageWriter) error {
+	name := fetchStatement.Portalname
+	portal, ok := session.cursors[name]
+	if !ok {
+		return errors.New("cursor \"" + name + "\" does not exist")
+	}
+	if fetchStatement.Direction != pgQuery.FetchDirection_FETCH_FORWARD {
+		return errors.New("cursor can only scan forward")
+	}
+
+	command := "FETCH"
+	if fetchStatement.Ismove {
+		command = "MOVE"
+	} else {
+		cols, err := portal.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		err = writer(queryHandler.generateRowDescription(cols, portal.ResultFormatCodes, portal.PreparedStatement.ColumnOrigins))
+		if err != nil {
+			return err
+		}
+	}
+
+	var rowCount int64
+	if fetchStatement.HowMany > 0 {
+		maxRows := fetchStatement.HowMany
+		if maxRows == math.MaxInt64 { // FETCH ALL
+			maxRows = 0
+		}
+
+		var err error
+		if portal.cancel != nil {
+			defer session.startStatementTimer(portal.cancel)()
+		}
+		var exhausted bool
+		if fetchStatement.Ismove {
+			rowCount, err = skipPortalRows(portal, maxRows)
+			exhausted = maxRows == 0 || rowCount < maxRows
+		} else {
+			var suspended bool
+			rowCount, suspended, err = queryHandler.streamPortalRows(portal, maxRows, writer)
+			exhausted = !suspended
+		}
+		if err != nil {
+			return queryCanceledError(portal.Context(), err)
+		}
+		if exhausted {
+			portal.Close() // Frees the DuckDB result, the cursor returns no rows until it's closed
+		}
+	}
+
+	return writer(commandComplete(command, rowCount))
+}
+
+// MOVE: advances the cursor without reading the row values, so skipped rows don't count against the result limits
+func skipPortalRows(portal *Portal, maxRows int64) (int64, error) {
+	var rowCount int64
+	for maxRows == 0 || rowCount < maxRows {
+		if !portal.nextRowFetched && !portal.Rows.Next() {
+			return rowCount, portal.Rows.Err()
+		}
+		portal.nextRowFetched = false
+		rowCount++
+	}
+	return rowCount, nil
+}
+
+func (queryHandler *QueryHandler) handleCloseCursor(session *Session, closePortalStatement *pgQuery.ClosePortalStmt) ([]pgproto3.Message, error) {
+	name := closePortalStatement.Portalname
+
+	tag := "CLOSE CURSOR"
+	if name == "" { // CLOSE ALL
+		session.closeCursors()
+		tag = "CLOSE CURSOR ALL"
+	} else {
+		portal, ok := session.cursors[name]
+		if !ok {
+			return nil, errors.New("cursor \"" + name + "\" does not exist")
+		}
+		portal.Close()
+		delete(session.cursors, name)
+	}
+
+	return []pgproto3.Message{&pgproto3.CommandComplete{CommandTag: []byte(tag)}}, nil
+}
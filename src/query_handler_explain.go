@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+const EXPLAIN_COLUMN_NAME = "QUERY PLAN"
+
+// Options that only change the details of PostgreSQL's plans, which DuckDB's plans don't have
+var IGNORED_EXPLAIN_OPTIONS = []string{"verbose", "costs", "settings", "generic_plan", "buffers", "serialize", "wal", "timing", "summary", "memory"}
+
+func isExplainStatement(originalQueryStatement string) bool {
+	return strings.HasPrefix(originalQueryStatement, "EXPLAIN ")
+}
+
+// EXPLAIN [ANALYZE] SELECT ..., remapped by the query remapper: DuckDB's plan, with the profiling information for
+// ANALYZE, and the Iceberg data files read for each table, as a single text column with a row per line
+func (queryHandler *QueryHandler) handleExplainQuery(session *Session, queryStatement string, originalQueryStatement string, variables []interface{}, withRowDescription bool, writer MessageWriter) error {
+	queryTree, err := pgQuery.Parse(queryStatement)
+	if err != nil {
+		return err
+	}
+	explainStatement := queryTree.Stmts[0].Stmt.GetExplainStmt()
+	analyze, err := parseExplainOptions(explainStatement.Options)
+	if err != nil {
+		return err
+	}
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: explainStatement.Query}}})
+	if err != nil {
+		return err
+	}
+	if analyze {
+		query = "EXPLAIN ANALYZE " + query
+	} else {
+		query = "EXPLAIN " + query
+	}
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := session.queryContext()
+	defer cancel(nil)
+	defer session.startStatementTimer(cancel)()
+
+	startTime := time.Now()
+	statement, err := duckdb.PrepareContext(ctx, query)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't prepare query via DuckDB:", query+"\n"+err.Error())
+		return queryCanceledError(ctx, err)
+	}
+	defer statement.Close()
+	rows, err := statement.QueryContext(ctx, variables...)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't handle query via DuckDB:", query+"\n"+err.Error())
+		return queryCanceledError(ctx, err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var explainKey, explainValue string
+		err = rows.Scan(&explainKey, &explainValue)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, strings.Split(strings.TrimRight(explainValue, "\n"), "\n")...)
+	}
+	if err = rows.Err(); err != nil {
+		return queryCanceledError(ctx, err)
+	}
+	executionTime := time.Since(startTime)
+
+	lines = append(lines, queryHandler.icebergScanLines(originalQueryStatement)...)
+	if analyze {
+		lines = append(lines, "Execution Time: "+strconv.FormatFloat(float64(executionTime.Microseconds())/1000, 'f', 3, 64)+" ms")
+	}
+
+	var messages []pgproto3.Message
+	if withRowDescription {
+		messages = append(messages, explainRowDescription())
+	}
+	for _, line := range lines {
+		messages = append(messages, &pgproto3.DataRow{Values: [][]byte{[]byte(line)}})
+	}
+	return writer(append(messages, commandComplete("EXPLAIN", int64(len(lines))))...)
+}
+
+// ANALYZE, FORMAT TEXT and the options that don't apply to DuckDB's plans. Returns whether ANALYZE is set.
+func parseExplainOptions(optionNodes []*pgQuery.Node) (analyze bool, err error) {
+	for _, optionNode := range optionNodes {
+		defElem := optionNode.GetDefElem()
+		value := strings.ToLower(defElemValue(defElem))
+		switch {
+		case defElem.Defname == "analyze":
+			switch value {
+			case "true", "on", "1":
+				analyze = true
+			case "false", "off", "0":
+				analyze = false
+			default:
+				return false, &PgError{Code: PG_ERROR_CODE_SYNTAX_ERROR, Message: "analyze requires a Boolean value"}
+			}
+		case defElem.Defname == "format":
+			if value != "text" {
+				return false, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "EXPLAIN format \"" + value + "\" is not supported"}
+			}
+		case slices.Contains(IGNORED_EXPLAIN_OPTIONS, defElem.Defname):
+		default:
+			return false, &PgError{Code: PG_ERROR_CODE_SYNTAX_ERROR, Message: "unrecognized EXPLAIN option \"" + defElem.Defname + "\""}
+		}
+	}
+	return analyze, nil
+}
+
+// The data files of the Iceberg snapshot read by each table's DuckDB view. iceberg_scan() reads every data file
+// listed in the snapshot and skips row groups by their statistics within the files, so no files are pruned.
+func (queryHandler *QueryHandler) icebergScanLines(originalQueryStatement string) []string {
+	queryTree, err := pgQuery.Parse(originalQueryStatement)
+	if err != nil {
+		return nil
+	}
+
+	remapperTable := queryHandler.queryRemapper.remapperTable
+	var lines []string
+	for _, icebergSchemaTable := range remapperTable.QueryIcebergSchemaTables(queryTree.Stmts[0]) {
+		metadataFilePath := remapperTable.IcebergViewMetadataFilePath(icebergSchemaTable)
+		if metadataFilePath == "" {
+			continue
+		}
+		snapshot, err := queryHandler.icebergReader.SnapshotSummary(metadataFilePath)
+		if err != nil {
+			LogWarn(queryHandler.config, "Couldn't read Iceberg snapshot of", icebergSchemaTable.String()+":", err)
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf(
+			"Iceberg Scan on %s.%s: %d of %d data files scanned, %d pruned (%d records)",
+			icebergSchemaTable.Schema,
+			icebergSchemaTable.Table,
+			snapshot.TotalDataFiles,
+			snapshot.TotalDataFiles,
+			0,
+			snapshot.TotalRecords,
+		))
+	}
+	return lines
+}
+
+func explainRowDescription() *pgproto3.RowDescription {
+	return &pgproto3.RowDescription{Fields: []pgproto3.FieldDescription{{
+		Name:         []byte(EXPLAIN_COLUMN_NAME),
+		DataTypeOID:  pgtype.TextOID,
+		DataTypeSize: -1,
+		TypeModifier: -1,
+		Format:       pgtype.TextFormatCode,
+	}}}
+}
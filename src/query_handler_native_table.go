@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+// Temporary table on the session's DuckDB connection, which holds the rows before they're appended to the Iceberg table
+const NATIVE_TABLE_STAGING_TABLE = "bemidb_staging"
+
+// PostgreSQL types without DuckDB equivalents, which are staged as VARCHAR and stored as strings like synced columns
+var NATIVE_TABLE_STRING_TYPES = []string{
+	"json", "jsonb", "xml", "tsvector",
+	"cidr", "inet", "macaddr", "macaddr8",
+	"point", "line", "lseg", "box", "path", "polygon", "circle",
+}
+
+// CREATE TABLE outside of pg_temp, INSERT INTO and DROP TABLE of the tables created with CREATE TABLE,
+// and COPY FROM STDIN, which are written as Iceberg tables instead of DuckDB tables
+func (queryHandler *QueryHandler) isNativeTableStatement(originalQueryStatement string) bool {
+	if !strings.HasPrefix(originalQueryStatement, "CREATE TABLE ") &&
+		!strings.HasPrefix(originalQueryStatement, "INSERT INTO ") &&
+		!strings.HasPrefix(originalQueryStatement, "DROP TABLE ") &&
+		!strings.HasPrefix(originalQueryStatement, "COPY ") {
+		return false
+	}
+
+	queryTree, err := pgQuery.Parse(originalQueryStatement)
+	if err != nil || len(queryTree.Stmts) != 1 {
+		return false
+	}
+	node := queryTree.Stmts[0].Stmt
+	remapperNativeTable := queryHandler.queryRemapper.remapperNativeTable
+
+	switch {
+	case node.GetCreateStmt() != nil:
+		return !isTempTableRelation(node.GetCreateStmt().Relation)
+	case node.GetCreateTableAsStmt() != nil && node.GetCreateTableAsStmt().Objtype == pgQuery.ObjectType_OBJECT_TABLE:
+		return !isTempTableRelation(node.GetCreateTableAsStmt().Into.Rel)
+	case node.GetInsertStmt() != nil:
+		_, ok := remapperNativeTable.NativeTable(relationSchemaTable(node.GetInsertStmt().Relation))
+		return ok
+	case node.GetDropStmt() != nil && node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_TABLE:
+		for _, objectNode := range node.GetDropStmt().Objects {
+			if _, ok := remapperNativeTable.NativeTable(dropObjectSchemaTable(objectNode)); ok {
+				return true
+			}
+		}
+	case node.GetCopyStmt() != nil:
+		return node.GetCopyStmt().IsFrom && node.GetCopyStmt().Filename == ""
+	}
+	return false
+}
+
+// CREATE TABLE [IF NOT EXISTS] ... [AS SELECT ...], INSERT INTO ... VALUES / SELECT ..., DROP TABLE [IF EXISTS] and
+// COPY ... FROM STDIN. The rows are staged in a temporary DuckDB table, so that DuckDB converts the values to the
+// column types, and then appended to the Iceberg table as a new snapshot. Like views, the tables are shared by
+// all sessions and instances, so the changes are applied immediately, even within a transaction block.
+func (queryHandler *QueryHandler) handleNativeTableQuery(session *Session, originalQueryStatement string, variables []interface{}, writer MessageWriter) error {
+	queryTree, err := pgQuery.Parse(originalQueryStatement)
+	if err != nil {
+		return err
+	}
+	node := queryTree.Stmts[0].Stmt
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := session.queryContext()
+	defer cancel(nil)
+	stopStatementTimer := session.startStatementTimer(cancel)
+	defer stopStatementTimer()
+	defer duckdb.ExecContext(context.Background(), "DROP TABLE IF EXISTS temp.main."+NATIVE_TABLE_STAGING_TABLE, nil)
+
+	var messages []pgproto3.Message
+	switch {
+	case node.GetCreateStmt() != nil:
+		messages, err = queryHandler.createNativeTable(ctx, duckdb, node)
+	case node.GetCreateTableAsStmt() != nil:
+		messages, err = queryHandler.createNativeTableAs(ctx, duckdb, node)
+	case node.GetInsertStmt() != nil:
+		messages, err = queryHandler.insertIntoNativeTable(ctx, duckdb, node, variables)
+	case node.GetDropStmt() != nil:
+		messages, err = queryHandler.dropNativeTables(node.GetDropStmt())
+	case node.GetCopyStmt() != nil:
+		messages, err = queryHandler.copyIntoNativeTable(ctx, session, duckdb, node.GetCopyStmt(), writer)
+	default:
+		return errors.New("unsupported table query: " + originalQueryStatement)
+	}
+	if err != nil {
+		return queryCanceledError(ctx, err)
+	}
+
+	return writer(messages...)
+}
+
+// CREATE TABLE schema.table (columns) -> an empty Iceberg table with the column types of the staging table
+func (queryHandler *QueryHandler) createNativeTable(ctx context.Context, duckdb *Duckdb, node *pgQuery.Node) ([]pgproto3.Message, error) {
+	createStatement := node.GetCreateStmt()
+	stringTypeNames := make(map[string]string) // column name -> PostgreSQL type staged as VARCHAR
+	for _, tableElement := range createStatement.TableElts {
+		columnDef := tableElement.GetColumnDef()
+		if columnDef == nil {
+			return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "table constraints are not supported, only NOT NULL column constraints"}
+		}
+		typeNameNodes := columnDef.TypeName.Names
+		typeName := typeNameNodes[len(typeNameNodes)-1].GetString_().Sval
+		if slices.Contains(NATIVE_TABLE_STRING_TYPES, typeName) {
+			stringTypeNames[columnDef.Colname] = typeName
+			columnDef.TypeName.Names = []*pgQuery.Node{pgQuery.MakeStrNode("varchar")}
+		}
+		for _, constraintNode := range columnDef.Constraints {
+			switch constraintNode.GetConstraint().Contype {
+			case pgQuery.ConstrType_CONSTR_NOTNULL, pgQuery.ConstrType_CONSTR_NULL:
+			default:
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "column constraints are not supported, only NOT NULL"}
+			}
+		}
+	}
+	if len(createStatement.InhRelations) > 0 || createStatement.Partspec != nil {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "inherited and partitioned tables are not supported"}
+	}
+
+	schemaTable := relationSchemaTable(createStatement.Relation)
+	ifNotExists := createStatement.IfNotExists
+	createStatement.Relation = makeStagingTableRangeVar()
+	createStatement.IfNotExists = false
+	err := queryHandler.createStagingTable(ctx, duckdb, node)
+	if err != nil {
+		return nil, err
+	}
+
+	pgSchemaColumns, err := queryHandler.stagingTableColumns(ctx, duckdb, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		typeName, ok := stringTypeNames[pgSchemaColumn.ColumnName]
+		if !ok {
+			continue
+		}
+		if pgSchemaColumn.DataType == "ARRAY" {
+			pgSchemaColumns[i].UdtName = "_" + typeName
+		} else {
+			pgSchemaColumns[i].DataType = typeName
+			pgSchemaColumns[i].UdtName = typeName
+		}
+	}
+
+	nativeTable := NativeTable{Schema: schemaTable.Schema, Name: schemaTable.Table, Columns: pgSchemaColumns}
+	_, created, err := queryHandler.queryRemapper.remapperNativeTable.CreateTable(nativeTable, ifNotExists, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return nativeTableCreatedMessages(schemaTable, created, "CREATE TABLE"), nil
+}
+
+// CREATE TABLE schema.table [(columns)] AS query [WITH NO DATA] -> an Iceberg table with the query's rows
+func (queryHandler *QueryHandler) createNativeTableAs(ctx context.Context, duckdb *Duckdb, node *pgQuery.Node) ([]pgproto3.Message, error) {
+	createStatement := node.GetCreateTableAsStmt()
+	schemaTable := relationSchemaTable(createStatement.Into.Rel)
+	ifNotExists := createStatement.IfNotExists
+	skipData := createStatement.Into.SkipData
+	var columnNames []string
+	for _, columnNameNode := range createStatement.Into.ColNames {
+		columnNames = append(columnNames, columnNameNode.GetString_().Sval)
+	}
+
+	// DuckDB doesn't support column names in CREATE TABLE AS, so the columns are renamed in the Iceberg table
+	createStatement.Into = &pgQuery.IntoClause{Rel: makeStagingTableRangeVar(), OnCommit: pgQuery.OnCommitAction_ONCOMMIT_NOOP}
+	createStatement.IfNotExists = false
+	err := queryHandler.createStagingTable(ctx, duckdb, node)
+	if err != nil {
+		return nil, err
+	}
+
+	pgSchemaColumns, err := queryHandler.stagingTableColumns(ctx, duckdb, columnNames)
+	if err != nil {
+		return nil, err
+	}
+
+	var rowCount int64
+	var created bool
+	nativeTable := NativeTable{Schema: schemaTable.Schema, Name: schemaTable.Table, Columns: pgSchemaColumns}
+	if skipData {
+		_, created, err = queryHandler.queryRemapper.remapperNativeTable.CreateTable(nativeTable, ifNotExists, nil)
+	} else {
+		err = queryHandler.withStagingRows(ctx, duckdb, nativeTable, func(loadRows func() [][]string) (err error) {
+			rowCount, created, err = queryHandler.queryRemapper.remapperNativeTable.CreateTable(nativeTable, ifNotExists, loadRows)
+			return err
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tag := "CREATE TABLE AS"
+	if created && !skipData {
+		tag = "SELECT " + strconv.FormatInt(rowCount, 10)
+	}
+	return nativeTableCreatedMessages(schemaTable, created, tag), nil
+}
+
+// INSERT INTO schema.table [(columns)] VALUES ... / SELECT ... -> a new snapshot with the inserted rows
+func (queryHandler *QueryHandler) insertIntoNativeTable(ctx context.Context, duckdb *Duckdb, node *pgQuery.Node, variables []interface{}) ([]pgproto3.Message, error) {
+	insertStatement := node.GetInsertStmt()
+	if len(insertStatement.ReturningList) > 0 {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "INSERT ... RETURNING is not supported for Iceberg tables"}
+	}
+	if insertStatement.OnConflictClause != nil {
+		return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "INSERT ... ON CONFLICT is not supported for Iceberg tables"}
+	}
+
+	schemaTable := relationSchemaTable(insertStatement.Relation)
+	nativeTable, err := queryHandler.createNativeStagingTable(ctx, duckdb, schemaTable)
+	if err != nil {
+		return nil, err
+	}
+
+	stagingRelation := makeStagingTableRangeVar()
+	stagingRelation.Alias = insertStatement.Relation.Alias
+	insertStatement.Relation = stagingRelation
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: queryHandler.queryRemapper.remapQueryTree(node)}}})
+	if err != nil {
+		return nil, err
+	}
+	statement, err := duckdb.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	_, err = statement.ExecContext(ctx, variables...)
+	statement.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rowCount, err := queryHandler.appendStagingRows(ctx, duckdb, nativeTable)
+	if err != nil {
+		return nil, err
+	}
+
+	return []pgproto3.Message{commandComplete("INSERT", rowCount)}, nil
+}
+
+// DROP TABLE [IF EXISTS] schema.table, ...
+func (queryHandler *QueryHandler) dropNativeTables(dropStatement *pgQuery.DropStmt) ([]pgproto3.Message, error) {
+	var messages []pgproto3.Message
+	for _, objectNode := range dropStatement.Objects {
+		schemaTable := dropObjectSchemaTable(objectNode)
+		dropped, err := queryHandler.queryRemapper.remapperNativeTable.DropTable(schemaTable, dropStatement.MissingOk)
+		if err != nil {
+			return nil, err
+		}
+		if !dropped {
+			messages = append(messages, &pgproto3.NoticeResponse{
+				Severity: "NOTICE",
+				Code:     PG_ERROR_CODE_SUCCESSFUL_COMPLETION,
+				Message:  "table \"" + schemaTable.Table + "\" does not exist, skipping",
+			})
+		}
+	}
+
+	return append(messages, &pgproto3.CommandComplete{CommandTag: []byte("DROP TABLE")}), nil
+}
+
+// CREATE TEMPORARY TABLE bemidb_staging ... with the column types and the query remapped for DuckDB
+func (queryHandler *QueryHandler) createStagingTable(ctx context.Context, duckdb *Duckdb, node *pgQuery.Node) error {
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: queryHandler.queryRemapper.remapQueryTree(node)}}})
+	if err != nil {
+		return err
+	}
+	_, err = duckdb.ExecContext(ctx, query, nil)
+	return err
+}
+
+// Empty staging table with the columns of the Iceberg table, which is read through its DuckDB view
+func (queryHandler *QueryHandler) createNativeStagingTable(ctx context.Context, duckdb *Duckdb, schemaTable IcebergSchemaTable) (NativeTable, error) {
+	nativeTable, ok := queryHandler.queryRemapper.remapperNativeTable.NativeTable(schemaTable)
+	if !ok {
+		return NativeTable{}, &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + schemaTable.Table + "\" does not exist"}
+	}
+
+	_, err := duckdb.ExecContext(ctx, "CREATE TEMPORARY TABLE "+NATIVE_TABLE_STAGING_TABLE+" AS SELECT * FROM "+schemaTable.String()+" LIMIT 0", nil)
+	if err != nil {
+		return NativeTable{}, err
+	}
+
+	// Parquet timestamps can be read without the time zone, which the writer requires for timestamptz values
+	for _, pgSchemaColumn := range nativeTable.Columns {
+		duckdbType := "TIMESTAMPTZ"
+		switch pgSchemaColumn.UdtName {
+		case "timestamptz":
+		case "_timestamptz":
+			duckdbType += "[]"
+		default:
+			continue
+		}
+		_, err = duckdb.ExecContext(ctx, "ALTER TABLE temp.main."+NATIVE_TABLE_STAGING_TABLE+" ALTER COLUMN \""+pgSchemaColumn.ColumnName+"\" SET DATA TYPE "+duckdbType, nil)
+		if err != nil {
+			return NativeTable{}, err
+		}
+	}
+	return nativeTable, nil
+}
+
+func (queryHandler *QueryHandler) stagingTableColumns(ctx context.Context, duckdb *Duckdb, columnNames []string) ([]PgSchemaColumn, error) {
+	rows, err := duckdb.QueryContext(ctx, "SELECT column_name, column_type, \"null\" FROM (DESCRIBE temp.main."+NATIVE_TABLE_STAGING_TABLE+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return describedColumns(rows, columnNames)
+}
+
+func (queryHandler *QueryHandler) appendStagingRows(ctx context.Context, duckdb *Duckdb, nativeTable NativeTable) (rowCount int64, err error) {
+	err = queryHandler.withStagingRows(ctx, duckdb, nativeTable, func(loadRows func() [][]string) (err error) {
+		rowCount, err = queryHandler.queryRemapper.remapperNativeTable.AppendRows(nativeTable.SchemaTable(), loadRows)
+		return err
+	})
+	return rowCount, err
+}
+
+// Values are converted to text by DuckDB in the formats the Parquet writer parses, e.g., 2024-01-02 03:04:05.123456
+func (queryHandler *QueryHandler) withStagingRows(ctx context.Context, duckdb *Duckdb, nativeTable NativeTable, write func(loadRows func() [][]string) error) error {
+	rows, err := duckdb.QueryContext(ctx, "SELECT COLUMNS(*)::VARCHAR FROM temp.main."+NATIVE_TABLE_STAGING_TABLE)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return write(textRowsLoader(rows, nativeTable.SchemaTable(), nativeTable.Columns))
+}
+
+// CommandComplete, preceded by a notice if the table already exists and IF NOT EXISTS is set
+func nativeTableCreatedMessages(schemaTable IcebergSchemaTable, created bool, tag string) []pgproto3.Message {
+	commandComplete := &pgproto3.CommandComplete{CommandTag: []byte(tag)}
+	if created {
+		return []pgproto3.Message{commandComplete}
+	}
+	return []pgproto3.Message{
+		&pgproto3.NoticeResponse{
+			Severity: "NOTICE",
+			Code:     PG_ERROR_CODE_DUPLICATE_TABLE,
+			Message:  "relation \"" + schemaTable.Table + "\" already exists, skipping",
+		},
+		commandComplete,
+	}
+}
+
+func makeStagingTableRangeVar() *pgQuery.RangeVar {
+	return &pgQuery.RangeVar{Relname: NATIVE_TABLE_STAGING_TABLE, Inh: true, Relpersistence: PG_RELPERSISTENCE_TEMP}
+}
+
+func isTempTableRelation(relation *pgQuery.RangeVar) bool {
+	return relation.Relpersistence == PG_RELPERSISTENCE_TEMP || relation.Schemaname == PG_SCHEMA_PG_TEMP
+}
+
+// schema.table, public.table by default
+func relationSchemaTable(relation *pgQuery.RangeVar) IcebergSchemaTable {
+	schemaTable := IcebergSchemaTable{Schema: relation.Schemaname, Table: relation.Relname}
+	if schemaTable.Schema == "" {
+		schemaTable.Schema = PG_SCHEMA_PUBLIC
+	}
+	return schemaTable
+}
+
+// DROP ... schema.table, public.table by default
+func dropObjectSchemaTable(objectNode *pgQuery.Node) IcebergSchemaTable {
+	schemaTable := IcebergSchemaTable{Schema: PG_SCHEMA_PUBLIC}
+	nameNodes := objectNode.GetList().Items
+	schemaTable.Table = nameNodes[len(nameNodes)-1].GetString_().Sval
+	if len(nameNodes) > 1 {
+		schemaTable.Schema = nameNodes[len(nameNodes)-2].GetString_().Sval
+	}
+	return schemaTable
+}
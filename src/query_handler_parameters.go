@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+	duckDb "github.com/marcboeker/go-duckdb"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Parameter types passed via Parse, or inferred from $n::type casts in the query. 0 means unknown.
+func (queryHandler *QueryHandler) parameterOids(query string, parseParameterOids []uint32) []uint32 {
+	count, castOids := queryParameterTypes(query)
+	oids := make([]uint32, max(count, len(parseParameterOids)))
+
+	for i := range oids {
+		if i < len(parseParameterOids) && parseParameterOids[i] != 0 {
+			oids[i] = parseParameterOids[i]
+		} else {
+			oids[i] = castOids[i+1]
+		}
+	}
+	return oids
+}
+
+// Unknown parameter types are described as text, so that clients send them in the text format
+func describedParameterOids(parameterOids []uint32) []uint32 {
+	oids := make([]uint32, len(parameterOids))
+	for i, oid := range parameterOids {
+		if oid == 0 {
+			oids[i] = pgtype.TextOID
+		} else {
+			oids[i] = oid
+		}
+	}
+	return oids
+}
+
+// Keeps NULLs in their positions, so that $n placeholders stay aligned
+func (queryHandler *QueryHandler) decodeParameters(message *pgproto3.Bind, preparedStatement *PreparedStatement) ([]interface{}, error) {
+	parameterOids := preparedStatement.ParameterOIDs
+	if len(message.Parameters) != len(parameterOids) {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_PROTOCOL_VIOLATION,
+			Message: fmt.Sprintf("bind message supplies %d parameters, but prepared statement \"%s\" requires %d", len(message.Parameters), preparedStatement.Name, len(parameterOids)),
+		}
+	}
+
+	paramFormatCodes := message.ParameterFormatCodes
+	if len(paramFormatCodes) > 1 && len(paramFormatCodes) != len(message.Parameters) {
+		return nil, &PgError{
+			Code:    PG_ERROR_CODE_PROTOCOL_VIOLATION,
+			Message: fmt.Sprintf("bind message has %d parameter formats but %d parameters", len(paramFormatCodes), len(message.Parameters)),
+		}
+	}
+
+	typeMap := pgtype.NewMap()
+	variables := make([]interface{}, len(message.Parameters))
+	for i, param := range message.Parameters {
+		if param == nil {
+			variables[i] = nil
+			continue
+		}
+
+		format := resultFormatCode(paramFormatCodes, i)
+		if format == pgtype.TextFormatCode {
+			variables[i] = string(param)
+			continue
+		}
+
+		// Binary values can't be decoded without knowing their type, clients have to specify it in Parse or with a cast
+		if parameterOids[i] == 0 {
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_INDETERMINATE_DATATYPE,
+				Message: fmt.Sprintf("could not determine data type of parameter $%d", i+1),
+			}
+		}
+
+		variable, err := decodeBinaryParameter(typeMap, parameterOids[i], param)
+		if err != nil {
+			return nil, &PgError{
+				Code:    PG_ERROR_CODE_INVALID_BINARY_REPRESENTATION,
+				Message: fmt.Sprintf("invalid binary value for parameter $%d: %s", i+1, err.Error()),
+			}
+		}
+		variables[i] = variable
+	}
+
+	return variables, nil
+}
+
+// Converts a binary parameter to a value that can be bound to a DuckDB prepared statement
+func decodeBinaryParameter(typeMap *pgtype.Map, oid uint32, param []byte) (interface{}, error) {
+	pgType, ok := typeMap.TypeForOID(oid)
+	if !ok {
+		return nil, errors.New("unsupported data type with OID " + strconv.FormatUint(uint64(oid), 10))
+	}
+
+	switch oid {
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		var value string
+		err := typeMap.Scan(oid, pgtype.BinaryFormatCode, param, &value)
+		if err != nil {
+			return nil, errors.New("expected " + pgType.Name + ": " + err.Error())
+		}
+		return value, nil
+	}
+
+	value, err := pgType.Codec.DecodeValue(typeMap, oid, pgtype.BinaryFormatCode, param)
+	if err != nil {
+		return nil, errors.New("expected " + pgType.Name + ": " + err.Error())
+	}
+	return duckdbParameterValue(value), nil
+}
+
+func duckdbParameterValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case pgtype.Numeric:
+		numericValue, _ := value.Value()
+		return numericValue // Text representation to keep the precision
+	case [16]byte:
+		return pgtype.UUID{Bytes: value, Valid: true}.String()
+	case pgtype.Time:
+		return time.UnixMicro(value.Microseconds).UTC().Format("15:04:05.999999")
+	case pgtype.Interval:
+		return duckDb.Interval{Months: value.Months, Days: value.Days, Micros: value.Microseconds}
+	case []interface{}:
+		// Nested types can't be bound, so pass a list literal that DuckDB casts implicitly
+		elements := make([]string, len(value))
+		for i, element := range value {
+			switch element := duckdbParameterValue(element).(type) {
+			case nil:
+				elements[i] = "NULL"
+			case string:
+				elements[i] = "\"" + strings.ReplaceAll(element, "\"", "\\\"") + "\""
+			case time.Time:
+				elements[i] = element.Format("2006-01-02 15:04:05.999999")
+			default:
+				elements[i] = fmt.Sprintf("%v", element)
+			}
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	}
+	return value
+}
+
+// Returns the number of $n placeholders and the types of the ones that are cast explicitly
+func queryParameterTypes(query string) (int, map[int]uint32) {
+	castOids := make(map[int]uint32)
+
+	queryTree, err := pgQuery.Parse(query)
+	if err != nil {
+		return 0, castOids
+	}
+
+	typeMap := pgtype.NewMap()
+	count := 0
+	walkQueryTree(queryTree.ProtoReflect(), func(node protoreflect.Message) {
+		switch node := node.Interface().(type) {
+		case *pgQuery.ParamRef:
+			count = max(count, int(node.Number))
+		case *pgQuery.TypeCast:
+			paramRef := node.Arg.GetParamRef()
+			if paramRef == nil {
+				return
+			}
+			if oid, ok := typeNameOid(typeMap, node.TypeName); ok {
+				castOids[int(paramRef.Number)] = oid
+			}
+		}
+	})
+
+	return count, castOids
+}
+
+// int -> pg_catalog.int4 -> 23, text[] -> _text -> 1009
+func typeNameOid(typeMap *pgtype.Map, typeName *pgQuery.TypeName) (uint32, bool) {
+	if typeName == nil || len(typeName.Names) == 0 {
+		return 0, false
+	}
+	name := typeName.Names[len(typeName.Names)-1].GetString_().Sval
+	if len(typeName.ArrayBounds) > 0 {
+		name = "_" + name
+	}
+	pgType, ok := typeMap.TypeForName(name)
+	if !ok {
+		return 0, false
+	}
+	return pgType.OID, true
+}
+
+func countQueryParameters(query string) int {
+	count, _ := queryParameterTypes(query)
+	return count
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+func isPreparedStatementStatement(originalQueryStatement string) bool {
+	return strings.HasPrefix(originalQueryStatement, "PREPARE ") ||
+		isExecuteStatement(originalQueryStatement) ||
+		strings.HasPrefix(originalQueryStatement, "DEALLOCATE ")
+}
+
+func isExecuteStatement(originalQueryStatement string) bool {
+	return strings.HasPrefix(originalQueryStatement, "EXECUTE ")
+}
+
+// PREPARE name AS SELECT ..., EXECUTE name(args), DEALLOCATE [PREPARE] name, DEALLOCATE ALL.
+// SQL prepared statements are DuckDB prepared statements on the session's connection, which share the names
+// of the statements prepared via Parse messages.
+func (queryHandler *QueryHandler) handlePreparedStatementQuery(session *Session, queryStatement string, originalQueryStatement string, writer MessageWriter) error {
+	queryTree, err := pgQuery.Parse(queryStatement)
+	if err != nil {
+		return err
+	}
+	node := queryTree.Stmts[0].Stmt
+
+	switch {
+	case node.GetPrepareStmt() != nil:
+		err = queryHandler.handlePrepare(session, node.GetPrepareStmt(), originalQueryStatement)
+		if err != nil {
+			return err
+		}
+		return writer(&pgproto3.CommandComplete{CommandTag: []byte("PREPARE")})
+	case node.GetExecuteStmt() != nil:
+		portal := &Portal{PreparedStatement: &PreparedStatement{Query: queryStatement}, timeZone: session.timeZone}
+		portal.ctx, portal.cancel = session.queryContext()
+		defer portal.Close()
+		defer session.startStatementTimer(portal.cancel)()
+
+		err = queryHandler.queryExecutePortal(session, portal)
+		if err != nil {
+			return err
+		}
+		return queryCanceledError(portal.Context(), queryHandler.streamQueryResult(portal, writer))
+	case node.GetDeallocateStmt() != nil:
+		tag, err := handleDeallocate(session, node.GetDeallocateStmt())
+		if err != nil {
+			return err
+		}
+		return writer(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+	}
+	return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "unsupported prepared statement query: " + originalQueryStatement}
+}
+
+// The query is remapped once here, EXECUTE only evaluates the arguments
+func (queryHandler *QueryHandler) handlePrepare(session *Session, prepareStatement *pgQuery.PrepareStmt, originalQueryStatement string) error {
+	name := prepareStatement.Name
+	if _, ok := session.preparedStatements[name]; ok {
+		return &PgError{Code: PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT, Message: "prepared statement \"" + name + "\" already exists"}
+	}
+
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: prepareStatement.Query}}})
+	if err != nil {
+		return err
+	}
+
+	typeMap := pgtype.NewMap()
+	var argumentTypes []*pgQuery.TypeName
+	var argumentOids []uint32
+	for _, argumentTypeNode := range prepareStatement.Argtypes {
+		argumentType := argumentTypeNode.GetTypeName()
+		oid, ok := typeNameOid(typeMap, argumentType)
+		if !ok {
+			return &PgError{Code: PG_ERROR_CODE_UNDEFINED_OBJECT, Message: "type \"" + typeNameString(argumentType) + "\" does not exist"}
+		}
+		argumentTypes = append(argumentTypes, argumentType)
+		argumentOids = append(argumentOids, oid)
+	}
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return err
+	}
+	err = queryHandler.refreshPreparedStatementsMacro(session, query)
+	if err != nil {
+		return err
+	}
+	statement, err := duckdb.PrepareContext(context.Background(), query)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't prepare query via DuckDB:", query+"\n"+err.Error())
+		return err
+	}
+
+	session.preparedStatements[name] = &PreparedStatement{
+		Name:          name,
+		OriginalQuery: originalQueryStatement,
+		Query:         query,
+		Statement:     statement,
+		ParameterOIDs: queryHandler.parameterOids(query, argumentOids),
+		CommandTag:    "SELECT", // Other queries are rejected by the query remapper
+		ColumnOrigins: queryHandler.columnOrigins(query),
+		PrepareTime:   time.Now(),
+		FromSql:       true,
+		ArgumentTypes: argumentTypes,
+	}
+	return nil
+}
+
+// EXECUTE name(args): replaces the portal's statement with the prepared statement and runs it with the arguments,
+// so that the rows are described and streamed like the rows of a bound Parse statement
+func (queryHandler *QueryHandler) queryExecutePortal(session *Session, portal *Portal) error {
+	queryTree, err := pgQuery.Parse(portal.PreparedStatement.Query)
+	if err != nil {
+		return err
+	}
+	executeStatement := queryTree.Stmts[0].Stmt.GetExecuteStmt()
+
+	name := executeStatement.Name
+	preparedStatement, ok := session.preparedStatements[name]
+	if !ok || name == "" {
+		return &PgError{Code: PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME, Message: "prepared statement \"" + name + "\" does not exist"}
+	}
+	if preparedStatement.Statement == nil { // Prepared via a Parse message, e.g. Parse of BEGIN, which isn't prepared via DuckDB
+		return &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "EXECUTE only supports prepared SELECT queries"}
+	}
+	if len(executeStatement.Params) != len(preparedStatement.ParameterOIDs) {
+		return &PgError{Code: PG_ERROR_CODE_SYNTAX_ERROR, Message: "wrong number of parameters for prepared statement \"" + name + "\""}
+	}
+
+	err = queryHandler.snapshotTransaction(session)
+	if err != nil {
+		return err
+	}
+	variables, err := queryHandler.executeArguments(session, portal, executeStatement.Params, preparedStatement.ArgumentTypes)
+	if err != nil {
+		return err
+	}
+	err = queryHandler.refreshPreparedStatementsStatement(session, preparedStatement)
+	if err != nil {
+		return err
+	}
+
+	rows, err := preparedStatement.Statement.QueryContext(portal.Context(), variables...)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't execute prepared statement via DuckDB:", preparedStatement.Query+"\n"+err.Error())
+		return queryCanceledError(portal.Context(), err)
+	}
+	portal.PreparedStatement = preparedStatement
+	portal.Variables = variables
+	portal.Rows = rows
+	return portal.holdQuerySlot(session)
+}
+
+// Describe (Statement) of EXECUTE name(args): the rows of the prepared statement, run with NULL parameters
+func (queryHandler *QueryHandler) describeExecuteStatement(session *Session, preparedStatement *PreparedStatement) ([]pgproto3.Message, error) {
+	portal := &Portal{PreparedStatement: preparedStatement, Variables: make([]interface{}, len(preparedStatement.ParameterOIDs))}
+	portal.ctx, portal.cancel = session.queryContext()
+	defer portal.Close()
+	defer session.startStatementTimer(portal.cancel)()
+
+	err := queryHandler.queryExecutePortal(session, portal)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := queryHandler.rowsToDescriptionMessages(portal.Rows, portal.PreparedStatement, nil) // Result formats are unknown before Bind
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return []pgproto3.Message{&pgproto3.NoData{}}, nil
+	}
+	return messages, nil
+}
+
+// EXECUTE name(1, 'a') -> SELECT 1::int, 'a'::text evaluated via DuckDB with the types from PREPARE name(int, text).
+// The arguments can reference the parameters bound to the EXECUTE statement via the extended query protocol.
+func (queryHandler *QueryHandler) executeArguments(session *Session, portal *Portal, paramNodes []*pgQuery.Node, argumentTypes []*pgQuery.TypeName) ([]interface{}, error) {
+	if len(paramNodes) == 0 {
+		return nil, nil
+	}
+
+	var targetList []*pgQuery.Node
+	for i, paramNode := range paramNodes {
+		if i < len(argumentTypes) {
+			paramNode = &pgQuery.Node{Node: &pgQuery.Node_TypeCast{TypeCast: &pgQuery.TypeCast{Arg: paramNode, TypeName: argumentTypes[i]}}}
+		}
+		targetList = append(targetList, pgQuery.MakeResTargetNodeWithVal(paramNode, 0))
+	}
+	selectNode := &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: &pgQuery.SelectStmt{TargetList: targetList}}}
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: selectNode}}})
+	if err != nil {
+		return nil, err
+	}
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return nil, err
+	}
+	statement, err := duckdb.PrepareContext(portal.Context(), query)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't prepare EXECUTE arguments via DuckDB:", query+"\n"+err.Error())
+		return nil, queryCanceledError(portal.Context(), err)
+	}
+	defer statement.Close()
+	rows, err := statement.QueryContext(portal.Context(), portal.Variables...)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't evaluate EXECUTE arguments via DuckDB:", query+"\n"+err.Error())
+		return nil, queryCanceledError(portal.Context(), err)
+	}
+	defer rows.Close()
+
+	variables := make([]interface{}, len(paramNodes))
+	valuePtrs := make([]interface{}, len(paramNodes))
+	for i := range variables {
+		valuePtrs[i] = &variables[i]
+	}
+	if rows.Next() {
+		err = rows.Scan(valuePtrs...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return variables, queryCanceledError(portal.Context(), rows.Err())
+}
+
+// custom_type -> custom_type, schema.custom_type[] -> schema.custom_type[]
+func typeNameString(typeName *pgQuery.TypeName) string {
+	var names []string
+	for _, nameNode := range typeName.Names {
+		names = append(names, nameNode.GetString_().Sval)
+	}
+	name := strings.Join(names, ".")
+	if len(typeName.ArrayBounds) > 0 {
+		name += "[]"
+	}
+	return name
+}
+
+func handleDeallocate(session *Session, deallocateStatement *pgQuery.DeallocateStmt) (string, error) {
+	name := deallocateStatement.Name
+	if name == "" { // DEALLOCATE ALL
+		session.closePreparedStatements()
+		return "DEALLOCATE ALL", nil
+	}
+
+	preparedStatement, ok := session.preparedStatements[name]
+	if !ok {
+		return "", &PgError{Code: PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME, Message: "prepared statement \"" + name + "\" does not exist"}
+	}
+	preparedStatement.Close()
+	delete(session.preparedStatements, name)
+	return "DEALLOCATE", nil
+}
+
+// pg_prepared_statements: replaces the temporary macro on the session's connection with the named prepared statements
+// before a query that reads it. result_types is NULL, and there are no plan counts since plans are cached by DuckDB.
+func (queryHandler *QueryHandler) refreshPreparedStatementsMacro(session *Session, query string) error {
+	if !strings.Contains(query, PG_PREPARED_STATEMENTS_MACRO) {
+		return nil
+	}
+
+	var preparedStatements []*PreparedStatement
+	for name, preparedStatement := range session.preparedStatements {
+		if name != "" {
+			preparedStatements = append(preparedStatements, preparedStatement)
+		}
+	}
+	slices.SortFunc(preparedStatements, func(a, b *PreparedStatement) int {
+		return a.PrepareTime.Compare(b.PrepareTime)
+	})
+
+	typeMap := pgtype.NewMap()
+	var rowsValues [][]string
+	for _, preparedStatement := range preparedStatements {
+		var parameterTypes []string
+		for _, oid := range describedParameterOids(preparedStatement.ParameterOIDs) {
+			if pgType, ok := typeMap.TypeForOID(oid); ok {
+				parameterTypes = append(parameterTypes, parameterTypeName(pgType.Name))
+			}
+		}
+		rowsValues = append(rowsValues, []string{
+			preparedStatement.Name,
+			preparedStatement.OriginalQuery,
+			preparedStatement.PrepareTime.UTC().Format("2006-01-02 15:04:05.999999Z07:00"),
+			"{" + strings.Join(parameterTypes, ",") + "}",
+			"NULL",
+			fmt.Sprintf("%t", preparedStatement.FromSql),
+			"0",
+			"0",
+		})
+	}
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return err
+	}
+	_, err = duckdb.ExecContext(context.Background(), queryHandler.queryRemapper.remapperTable.PgPreparedStatementsMacroQuery(rowsValues), nil)
+	return err
+}
+
+// int4 -> int4, _text -> text[]
+func parameterTypeName(pgTypeName string) string {
+	if strings.HasPrefix(pgTypeName, "_") {
+		return pgTypeName[1:] + "[]"
+	}
+	return pgTypeName
+}
+
+// DuckDB inlines the macro when preparing a statement, so a prepared statement that reads pg_prepared_statements
+// is prepared again to read the current prepared statements
+func (queryHandler *QueryHandler) refreshPreparedStatementsStatement(session *Session, preparedStatement *PreparedStatement) error {
+	if !strings.Contains(preparedStatement.Query, PG_PREPARED_STATEMENTS_MACRO) {
+		return nil
+	}
+
+	err := queryHandler.refreshPreparedStatementsMacro(session, preparedStatement.Query)
+	if err != nil {
+		return err
+	}
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return err
+	}
+	statement, err := duckdb.PrepareContext(context.Background(), preparedStatement.Query)
+	if err != nil {
+		LogError(queryHandler.config, "Couldn't prepare query via DuckDB:", preparedStatement.Query+"\n"+err.Error())
+		return err
+	}
+	preparedStatement.Close()
+	preparedStatement.Statement = statement
+	return nil
+}
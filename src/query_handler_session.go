@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+var STATEMENT_TIMEOUT_UNITS = map[string]time.Duration{
+	"us":  time.Microsecond,
+	"ms":  time.Millisecond,
+	"s":   time.Second,
+	"min": time.Minute,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+}
+
+// Each session runs queries on its own DuckDB connection, so that SET, temporary objects, etc. don't leak into other sessions
+func (queryHandler *QueryHandler) sessionDuckdb(session *Session) (*Duckdb, error) {
+	if session.duckdb == nil {
+		duckdb, err := queryHandler.duckdb.Connect(context.Background())
+		if err != nil {
+			LogError(queryHandler.config, "Couldn't open a DuckDB connection for the session:", err.Error())
+			return nil, err
+		}
+		session.duckdb = duckdb
+	}
+	return session.duckdb, nil
+}
+
+// Statements that change the session or catalog state without running a query: transaction blocks, DISCARD ALL,
+// DISCARD TEMP, views and ignored SET statements
+func isSessionStatement(node *pgQuery.Node) bool {
+	return isTransactionStatement(node) ||
+		isViewStatement(node) ||
+		isDiscardTempStatement(node) ||
+		isDiscardAllStatement(node) ||
+		isIgnoredSetNode(node)
+}
+
+func (queryHandler *QueryHandler) handleSessionStatement(session *Session, node *pgQuery.Node, writer MessageWriter) error {
+	if isViewStatement(node) {
+		return queryHandler.handleViewQuery(node, writer)
+	}
+	if isDiscardTempStatement(node) {
+		return queryHandler.handleDiscardTemp(session, writer)
+	}
+	if isIgnoredSetNode(node) {
+		return queryHandler.handleIgnoredSet(session, node, writer)
+	}
+	if !isDiscardAllStatement(node) {
+		return queryHandler.handleTransactionQuery(session, node, writer)
+	}
+
+	if session.transaction != nil {
+		return &PgError{Code: PG_ERROR_CODE_ACTIVE_SQL_TRANSACTION, Message: "DISCARD ALL cannot run inside a transaction block"}
+	}
+	session.Discard()
+	return writer(&pgproto3.CommandComplete{CommandTag: []byte("DISCARD ALL")})
+}
+
+func isDiscardAllStatement(node *pgQuery.Node) bool {
+	return node.GetDiscardStmt().GetTarget() == pgQuery.DiscardMode_DISCARD_ALL
+}
+
+// SET client_encoding TO 'UTF8', SET statement_timeout = 5000, etc. that DuckDB doesn't have.
+// They're not run via DuckDB, so they can't overwrite DuckDB settings such as the session search_path.
+func isIgnoredSetNode(node *pgQuery.Node) bool {
+	setStatement := node.GetVariableSetStmt()
+	return setStatement != nil && isIgnoredSetStatement(setStatement)
+}
+
+func (queryHandler *QueryHandler) handleIgnoredSet(session *Session, node *pgQuery.Node, writer MessageWriter) error {
+	err := checkFailedTransaction(session, node)
+	if err != nil {
+		return err
+	}
+	err = queryHandler.handleSessionSetting(session, node)
+	if err != nil {
+		return err
+	}
+	return writer(&pgproto3.CommandComplete{CommandTag: []byte(commandTag(node))})
+}
+
+// SET statement_timeout, SET timezone, RESET statement_timeout, RESET timezone, RESET ALL
+func (queryHandler *QueryHandler) handleSessionSetting(session *Session, node *pgQuery.Node) error {
+	setStatement := node.GetVariableSetStmt()
+	if setStatement == nil {
+		return nil
+	}
+
+	switch setStatement.Kind {
+	case pgQuery.VariableSetKind_VAR_RESET_ALL:
+		session.statementTimeout = session.defaultStatementTimeout
+		session.timeZone = nil
+	case pgQuery.VariableSetKind_VAR_SET_DEFAULT, pgQuery.VariableSetKind_VAR_RESET:
+		switch strings.ToLower(setStatement.Name) {
+		case PG_VAR_STATEMENT_TIMEOUT:
+			session.statementTimeout = session.defaultStatementTimeout
+		case PG_VAR_TIMEZONE:
+			session.timeZone = nil
+		}
+	case pgQuery.VariableSetKind_VAR_SET_VALUE:
+		if len(setStatement.Args) != 1 {
+			return nil
+		}
+		if strings.ToLower(setStatement.Name) == PG_VAR_TIMEZONE {
+			return setSessionTimeZone(session, setStatement.Args[0])
+		}
+		if strings.ToLower(setStatement.Name) != PG_VAR_STATEMENT_TIMEOUT {
+			return nil
+		}
+
+		value := setStatement.Args[0].GetAConst()
+		var stringValue string
+		switch {
+		case value.GetIval() != nil:
+			stringValue = IntToString(int(value.GetIval().Ival))
+		case value.GetFval() != nil:
+			stringValue = value.GetFval().Fval
+		case value.GetSval() != nil:
+			stringValue = value.GetSval().Sval
+		}
+
+		statementTimeout, err := ParseStatementTimeout(stringValue)
+		if err != nil {
+			return err
+		}
+		session.statementTimeout = statementTimeout
+	}
+
+	return nil
+}
+
+// SET timezone = 'Europe/Berlin', SET TIME ZONE -5 (hours from UTC)
+func setSessionTimeZone(session *Session, valueNode *pgQuery.Node) error {
+	value := valueNode.GetAConst()
+	switch {
+	case value.GetIval() != nil:
+		offsetHours := int(value.GetIval().Ival)
+		session.timeZone = time.FixedZone(fmt.Sprintf("UTC%+d", offsetHours), offsetHours*3600)
+	case value.GetSval() != nil:
+		timeZone, err := time.LoadLocation(value.GetSval().Sval)
+		if err != nil {
+			return &PgError{
+				Code:    PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+				Message: "invalid value for parameter \"TimeZone\": \"" + value.GetSval().Sval + "\"",
+			}
+		}
+		session.timeZone = timeZone
+	}
+	return nil
+}
+
+// SHOW statement_timeout -> SELECT '5s' AS statement_timeout
+func (queryHandler *QueryHandler) sessionSettingQuery(session *Session, originalQueryStatement string, queryStatement string) string {
+	normalizedQueryStatement := strings.TrimRight(strings.ToLower(strings.TrimSpace(originalQueryStatement)), ";")
+	if normalizedQueryStatement != "show "+PG_VAR_STATEMENT_TIMEOUT {
+		return queryStatement
+	}
+	return "SELECT '" + FormatStatementTimeout(session.statementTimeout) + "' AS " + PG_VAR_STATEMENT_TIMEOUT
+}
+
+// Parses a Postgres duration in milliseconds ("5000") or with a unit ("5s", "1min", "100 ms")
+func ParseStatementTimeout(value string) (time.Duration, error) {
+	invalidValueErr := &PgError{
+		Code:    PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+		Message: "invalid value for parameter \"" + PG_VAR_STATEMENT_TIMEOUT + "\": \"" + value + "\"",
+	}
+
+	trimmedValue := strings.TrimSpace(value)
+	numberEnd := strings.IndexFunc(trimmedValue, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if numberEnd == -1 {
+		numberEnd = len(trimmedValue)
+	}
+
+	number, err := strconv.ParseFloat(trimmedValue[:numberEnd], 64)
+	if err != nil {
+		return 0, invalidValueErr
+	}
+
+	unit := time.Millisecond
+	if unitName := strings.TrimSpace(trimmedValue[numberEnd:]); unitName != "" {
+		var ok bool
+		unit, ok = STATEMENT_TIMEOUT_UNITS[unitName]
+		if !ok {
+			return 0, invalidValueErr
+		}
+	}
+
+	milliseconds := math.Round(number * float64(unit) / float64(time.Millisecond))
+	if milliseconds < 0 || milliseconds > math.MaxInt32 {
+		return 0, &PgError{
+			Code:    PG_ERROR_CODE_INVALID_PARAMETER_VALUE,
+			Message: strconv.FormatFloat(milliseconds, 'f', -1, 64) + " ms is outside the valid range for parameter \"" + PG_VAR_STATEMENT_TIMEOUT + "\" (0 .. " + IntToString(math.MaxInt32) + ")",
+		}
+	}
+	return time.Duration(milliseconds) * time.Millisecond, nil
+}
+
+// Formats a duration the way Postgres shows it: "0", "100ms", "5s", "1min", "2h", "1d"
+func FormatStatementTimeout(statementTimeout time.Duration) string {
+	if statementTimeout == 0 {
+		return "0"
+	}
+
+	for _, unitName := range []string{"d", "h", "min", "s"} {
+		unit := STATEMENT_TIMEOUT_UNITS[unitName]
+		if statementTimeout%unit == 0 {
+			return strconv.FormatInt(int64(statementTimeout/unit), 10) + unitName
+		}
+	}
+	return strconv.FormatInt(statementTimeout.Milliseconds(), 10) + "ms"
+}
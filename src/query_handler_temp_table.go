@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+// CREATE TEMPORARY TABLE [AS] and INSERT INTO without RETURNING return the number of rows in a DuckDB "Count" column,
+// which is sent as the row count of the command tag instead of a result row
+func isRowCountStatement(originalQueryStatement string) bool {
+	return strings.HasPrefix(originalQueryStatement, "CREATE TEMPORARY TABLE ") ||
+		strings.HasPrefix(originalQueryStatement, "CREATE TABLE "+PG_SCHEMA_PG_TEMP+".") ||
+		(strings.HasPrefix(originalQueryStatement, "INSERT INTO ") && !strings.Contains(originalQueryStatement, " RETURNING "))
+}
+
+func isDiscardTempStatement(node *pgQuery.Node) bool {
+	return node.GetDiscardStmt().GetTarget() == pgQuery.DiscardMode_DISCARD_TEMP
+}
+
+// Reads the row count from the DuckDB "Count" column, which is empty for CREATE TEMPORARY TABLE without AS
+func (queryHandler *QueryHandler) readRowCount(portal *Portal) (int64, error) {
+	var rowCount sql.NullInt64
+	if portal.Rows.Next() {
+		err := portal.Rows.Scan(&rowCount)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return rowCount.Int64, portal.Rows.Err()
+}
+
+// DISCARD TEMP: drops the session's temporary tables, which are otherwise dropped with its DuckDB connection
+func (queryHandler *QueryHandler) handleDiscardTemp(session *Session, writer MessageWriter) error {
+	if session.duckdb != nil {
+		ctx := context.Background()
+		rows, err := session.duckdb.QueryContext(ctx, "SELECT table_name FROM duckdb_tables() WHERE temporary")
+		if err != nil {
+			return err
+		}
+		var tableNames []string
+		for rows.Next() {
+			var tableName string
+			err := rows.Scan(&tableName)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			tableNames = append(tableNames, tableName)
+		}
+		rows.Close()
+
+		for _, tableName := range tableNames {
+			_, err := session.duckdb.ExecContext(ctx, "DROP TABLE IF EXISTS temp.main.\"$table\"", map[string]string{"table": tableName})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return writer(&pgproto3.CommandComplete{CommandTag: []byte("DISCARD TEMP")})
+}
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgproto3"
 	"github.com/jackc/pgx/v5/pgtype"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 func TestHandleQuery(t *testing.T) {
@@ -266,13 +274,6 @@ func TestHandleQuery(t *testing.T) {
 			"values":      {"memory", "public", "test_table"},
 		},
 
-		// DISCARD
-		"DISCARD ALL": {
-			"description": {"1"},
-			"types":       {Uint32ToString(pgtype.Int4OID)},
-			"values":      {"1"},
-		},
-
 		// SHOW
 		"SHOW search_path": {
 			"description": {"search_path"},
@@ -295,6 +296,26 @@ func TestHandleQuery(t *testing.T) {
 			"types":       {Uint32ToString(pgtype.Int8OID)},
 			"values":      {"2"},
 		},
+		"SELECT COUNT(*) AS count FROM (SELECT 1) t HAVING 0 < (SELECT COUNT(*) FROM test_table)": {
+			"description": {"count"},
+			"types":       {Uint32ToString(pgtype.Int8OID)},
+			"values":      {"1"},
+		},
+		"SELECT s.count FROM (SELECT 1) t, LATERAL (WITH c AS (SELECT COUNT(*) AS count FROM public.test_table) SELECT count FROM c) s": {
+			"description": {"count"},
+			"types":       {Uint32ToString(pgtype.Int8OID)},
+			"values":      {"2"},
+		},
+		"SELECT relkind FROM pg_class WHERE relname = 'test_table'": {
+			"description": {"relkind"},
+			"types":       {Uint32ToString(pgtype.TextOID)},
+			"values":      {"r"},
+		},
+		"SELECT COUNT(*) AS count FROM information_schema.views WHERE table_name = 'test_table'": {
+			"description": {"count"},
+			"types":       {Uint32ToString(pgtype.Int8OID)},
+			"values":      {"0"},
+		},
 		"SELECT x.bit_column FROM public.test_table x WHERE x.bit_column IS NOT NULL": {
 			"description": {"bit_column"},
 			"types":       {Uint32ToString(pgtype.TextOID)},
@@ -388,7 +409,7 @@ func TestHandleQuery(t *testing.T) {
 		"SELECT hugeint_column FROM public.test_table WHERE hugeint_column IS NOT NULL": {
 			"description": {"hugeint_column"},
 			"types":       {Uint32ToString(pgtype.NumericOID)},
-			"values":      {"1e+19"},
+			"values":      {"10000000000000000000"},
 		},
 		"SELECT hugeint_column FROM public.test_table WHERE hugeint_column IS NULL": {
 			"description": {"hugeint_column"},
@@ -443,7 +464,7 @@ func TestHandleQuery(t *testing.T) {
 		"SELECT numeric_column FROM public.test_table WHERE bool_column = FALSE": {
 			"description": {"numeric_column"},
 			"types":       {Uint32ToString(pgtype.NumericOID)},
-			"values":      {"-12345"},
+			"values":      {"-12345.00"},
 		},
 		"SELECT date_column FROM public.test_table WHERE date_column IS NOT NULL": {
 			"description": {"date_column"},
@@ -675,12 +696,17 @@ func TestHandleQuery(t *testing.T) {
 		"SELECT '\"public\".\"test_table\"'::regclass::oid AS oid": {
 			"description": {"oid"},
 			"types":       {Uint32ToString(pgtype.OIDOID)},
-			"values":      {"1270"},
+			"values":      {"1271"},
 		},
-		"SELECT attrelid FROM pg_attribute WHERE attrelid = '\"public\".\"test_table\"'::regclass": {
-			"description": {"attrelid"},
-			"types":       {Uint32ToString(pgtype.Int8OID)},
-			"values":      {"1270"},
+		"SELECT attrelid, attname FROM pg_attribute WHERE attrelid = '\"public\".\"test_table\"'::regclass AND attnum = 2": {
+			"description": {"attrelid", "attname"},
+			"types":       {Uint32ToString(pgtype.Int8OID), Uint32ToString(pgtype.TextOID)},
+			"values":      {"1271", "bool_column"},
+		},
+		"SELECT column_name, data_type, is_nullable, ordinal_position FROM information_schema.columns WHERE table_name = 'test_table' AND column_name = 'numeric_column'": {
+			"description": {"column_name", "data_type", "is_nullable", "ordinal_position"},
+			"types":       {Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.Int4OID)},
+			"values":      {"numeric_column", "DECIMAL(38,2)", "YES", "14"},
 		},
 		"SELECT objoid, classoid, objsubid, description FROM pg_description WHERE classoid = 'pg_class'::regclass": {
 			"description": {"objoid", "classoid", "objsubid", "description"},
@@ -733,6 +759,53 @@ func TestHandleQuery(t *testing.T) {
 			"values":      {"array_in"},
 		},
 
+		// DuckDB result types
+		"SELECT '2024-01-01 10:00:00+02'::timestamptz AS timestamptz": {
+			"description": {"timestamptz"},
+			"types":       {Uint32ToString(pgtype.TimestamptzOID)},
+			"values":      {"2024-01-01 08:00:00+00"},
+		},
+		"SELECT '1 year 2 months 3 days 04:05:06.7'::interval AS interval": {
+			"description": {"interval"},
+			"types":       {Uint32ToString(pgtype.IntervalOID)},
+			"values":      {"1 year 2 mons 3 days 04:05:06.7"},
+		},
+		"SELECT '-1 day 02:00:00'::interval AS interval": {
+			"description": {"interval"},
+			"types":       {Uint32ToString(pgtype.IntervalOID)},
+			"values":      {"-1 days +02:00:00"},
+		},
+		"SELECT '58a7c845-af77-44b2-8664-7ca613d92f04'::uuid AS uuid": {
+			"description": {"uuid"},
+			"types":       {Uint32ToString(pgtype.UUIDOID)},
+			"values":      {"58a7c845-af77-44b2-8664-7ca613d92f04"},
+		},
+		"SELECT '\\xAA\\x01'::bytea AS bytea": {
+			"description": {"bytea"},
+			"types":       {Uint32ToString(pgtype.ByteaOID)},
+			"values":      {"\\xaa01"},
+		},
+		"SELECT 1::tinyint AS tinyint": {
+			"description": {"tinyint"},
+			"types":       {Uint32ToString(pgtype.Int2OID)},
+			"values":      {"1"},
+		},
+		"SELECT struct_pack(a := 1, b := 'x') AS struct": {
+			"description": {"struct"},
+			"types":       {Uint32ToString(pgtype.JSONOID)},
+			"values":      {"{\"a\":1,\"b\":\"x\"}"},
+		},
+		"SELECT map(ARRAY['k'], ARRAY[1]) AS map": {
+			"description": {"map"},
+			"types":       {Uint32ToString(pgtype.JSONOID)},
+			"values":      {"{\"k\":1}"},
+		},
+		"SELECT struct_pack(amount := 12345678901234567890.12::numeric(38, 2)) AS struct": {
+			"description": {"struct"},
+			"types":       {Uint32ToString(pgtype.JSONOID)},
+			"values":      {"{\"amount\":12345678901234567890.12}"},
+		},
+
 		// SELECT * FROM function()
 		"SELECT * FROM pg_catalog.pg_get_keywords() LIMIT 1": {
 			"description": {"word", "catcode", "barelabel", "catdesc", "baredesc"},
@@ -931,7 +1004,7 @@ func TestHandleQuery(t *testing.T) {
 		t.Run(query, func(t *testing.T) {
 			queryHandler := initQueryHandler()
 
-			messages, err := queryHandler.HandleQuery(query)
+			messages, err := handleQuery(queryHandler, NewSession(), query)
 
 			testNoError(t, err)
 			testRowDescription(t, messages[0], responses["description"], responses["types"])
@@ -956,7 +1029,7 @@ func TestHandleQuery(t *testing.T) {
 	t.Run("Returns an error if a table does not exist", func(t *testing.T) {
 		queryHandler := initQueryHandler()
 
-		_, err := queryHandler.HandleQuery("SELECT * FROM non_existent_table")
+		_, err := handleQuery(queryHandler, NewSession(), "SELECT * FROM non_existent_table")
 
 		if err == nil {
 			t.Errorf("Expected an error, got nil")
@@ -976,7 +1049,7 @@ func TestHandleQuery(t *testing.T) {
 	t.Run("Returns a result without a row description for SET queries", func(t *testing.T) {
 		queryHandler := initQueryHandler()
 
-		messages, err := queryHandler.HandleQuery("SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
+		messages, err := handleQuery(queryHandler, NewSession(), "SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -987,9 +1060,10 @@ func TestHandleQuery(t *testing.T) {
 
 	t.Run("Allows setting and querying timezone", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		queryHandler.HandleQuery("SET timezone = 'UTC'")
+		session := NewSession()
+		handleQuery(queryHandler, session, "SET timezone = 'UTC'")
 
-		messages, err := queryHandler.HandleQuery("SHOW timezone")
+		messages, err := handleQuery(queryHandler, session, "SHOW timezone")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1002,218 +1076,220 @@ func TestHandleQuery(t *testing.T) {
 		testCommandCompleteTag(t, messages[2], "SHOW")
 	})
 
-	t.Run("Handles an empty query", func(t *testing.T) {
+	t.Run("Returns timestamptz values in the session time zone", func(t *testing.T) {
 		queryHandler := initQueryHandler()
+		session := NewSession()
+		handleQuery(queryHandler, session, "SET TIME ZONE 'Asia/Kolkata'")
 
-		messages, err := queryHandler.HandleQuery("-- ping")
+		messages, err := handleQuery(queryHandler, session, "SELECT '2024-01-01 10:00:00+02'::timestamptz AS timestamptz")
 
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.EmptyQueryResponse{},
-		})
+		testRowDescription(t, messages[0], []string{"timestamptz"}, []string{Uint32ToString(pgtype.TimestamptzOID)})
+		testDataRowValues(t, messages[1], []string{"2024-01-01 13:30:00+05:30"})
 	})
-}
 
-func TestHandleParseQuery(t *testing.T) {
-	t.Run("Handles PARSE extended query step", func(t *testing.T) {
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+	t.Run("Returns an error for an invalid time zone", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		message := &pgproto3.Parse{Query: query}
 
-		messages, preparedStatement, err := queryHandler.HandleParseQuery(message)
+		_, err := handleQuery(queryHandler, NewSession(), "SET timezone = 'Nowhere/Bogus'")
 
-		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.ParseComplete{},
-		})
+		testPgError(t, err, PG_ERROR_CODE_INVALID_PARAMETER_VALUE, "invalid value for parameter \"TimeZone\": \"Nowhere/Bogus\"")
+	})
 
-		remappedQuery := "SELECT usename, passwd FROM (VALUES ('bemidb'::text, '10'::oid, 'FALSE'::bool, 'FALSE'::bool, 'TRUE'::bool, 'FALSE'::bool, 'bemidb-encrypted'::text, NULL, NULL)) pg_shadow(usename, usesysid, usecreatedb, usesuper, userepl, usebypassrls, passwd, valuntil, useconfig) WHERE usename = $1"
-		if preparedStatement.Query != remappedQuery {
-			t.Errorf("Expected the prepared statement query to be %v, got %v", remappedQuery, preparedStatement.Query)
-		}
-		if preparedStatement.Statement == nil {
-			t.Errorf("Expected the prepared statement to have a statement")
+	t.Run("Returns command tags with row counts", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		for _, statement := range []struct{ query, tag string }{
+			{"SELECT x FROM (VALUES (1), (2), (3)) t(x)", "SELECT 3"},
+			{"SELECT * FROM public.test_table WHERE false", "SELECT 0"},
+			{"SELECT COUNT(*) FROM public.test_table", "SELECT 1"},
+			{"SET application_name = 'bemidb'", "SET"},
+			{"RESET ALL", "RESET"},
+			{"SHOW application_name", "SHOW"},
+			{"CLOSE ALL", "CLOSE CURSOR ALL"},
+		} {
+			messages, err := handleQuery(queryHandler, NewSession(), statement.query)
+			testNoError(t, err)
+			testCommandCompleteTag(t, messages[len(messages)-1], statement.tag)
 		}
 	})
-}
 
-func TestHandleBindQuery(t *testing.T) {
-	t.Run("Handles BIND extended query step with text format parameter", func(t *testing.T) {
+	t.Run("Describes the source table columns", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
-		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
-		testNoError(t, err)
+		tableOid := testPgClassOid(t, queryHandler, "test_table")
 
-		bindMessage := &pgproto3.Bind{
-			Parameters:           [][]byte{[]byte("bemidb")},
-			ParameterFormatCodes: []int16{0}, // Text format
-		}
-		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		messages, err := handleQuery(queryHandler, NewSession(), "SELECT t.numeric_column, timestamp_column, 1 AS one FROM public.test_table t LIMIT 1")
 
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.BindComplete{},
-		})
-		if len(preparedStatement.Variables) != 1 {
-			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
-		}
-		if preparedStatement.Variables[0] != "bemidb" {
-			t.Errorf("Expected the prepared statement variable to be 'bemidb', got %v", preparedStatement.Variables[0])
+		fields := messages[0].(*pgproto3.RowDescription).Fields
+		for i, expected := range []pgproto3.FieldDescription{
+			{TableOID: tableOid, TableAttributeNumber: testColumnAttributeNumber("numeric_column"), DataTypeSize: -1, TypeModifier: (40<<16 | 2) + 4}, // numeric(40, 2) in the Iceberg schema
+			{TableOID: tableOid, TableAttributeNumber: testColumnAttributeNumber("timestamp_column"), DataTypeSize: 8, TypeModifier: 6},
+			{TableOID: 0, TableAttributeNumber: 0, DataTypeSize: 4, TypeModifier: -1},
+		} {
+			if fields[i].TableOID != expected.TableOID || fields[i].TableAttributeNumber != expected.TableAttributeNumber ||
+				fields[i].DataTypeSize != expected.DataTypeSize || fields[i].TypeModifier != expected.TypeModifier {
+				t.Errorf("Expected the %s field to be described as %+v, got %+v", fields[i].Name, expected, fields[i])
+			}
 		}
 	})
 
-	t.Run("Handles BIND extended query step with binary format parameter", func(t *testing.T) {
+	t.Run("Describes the source table columns of SELECT *", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		query := "SELECT c.oid FROM pg_catalog.pg_class c WHERE c.relnamespace = $1"
-		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, err := queryHandler.HandleParseQuery(parseMessage)
-		testNoError(t, err)
-
-		paramValue := int64(2200)
-		paramBytes := make([]byte, 8)
-		binary.BigEndian.PutUint64(paramBytes, uint64(paramValue))
+		tableOid := testPgClassOid(t, queryHandler, "test_table")
 
-		bindMessage := &pgproto3.Bind{
-			Parameters:           [][]byte{paramBytes},
-			ParameterFormatCodes: []int16{1}, // Binary format
-		}
-		messages, preparedStatement, err := queryHandler.HandleBindQuery(bindMessage, preparedStatement)
+		messages, err := handleQuery(queryHandler, NewSession(), "SELECT * FROM public.test_table LIMIT 1")
 
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.BindComplete{},
-		})
-		if len(preparedStatement.Variables) != 1 {
-			t.Errorf("Expected the prepared statement to have 1 variable, got %v", len(preparedStatement.Variables))
-		}
-		if preparedStatement.Variables[0] != paramValue {
-			t.Errorf("Expected the prepared statement variable to be %v, got %v", paramValue, preparedStatement.Variables[0])
+		fields := messages[0].(*pgproto3.RowDescription).Fields
+		for i, field := range fields {
+			if field.TableOID != tableOid || field.TableAttributeNumber != uint16(i+1) {
+				t.Errorf("Expected the %s field to be column %d of table %d, got column %d of table %d", field.Name, i+1, tableOid, field.TableAttributeNumber, field.TableOID)
+			}
 		}
 	})
-}
 
-func TestHandleDescribeQuery(t *testing.T) {
-	t.Run("Handles DESCRIBE extended query step", func(t *testing.T) {
+	t.Run("Describes the source table columns with pg_attribute attnums", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
-		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		message := &pgproto3.Describe{ObjectType: 'P'}
+		tableOid := testPgClassOid(t, queryHandler, "test_table")
 
-		messages, preparedStatement, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		messages, err := handleQuery(queryHandler, NewSession(), "SELECT timestamp_column FROM public.test_table LIMIT 1")
+		testNoError(t, err)
+		field := messages[0].(*pgproto3.RowDescription).Fields[0]
 
+		query := "SELECT attname FROM pg_catalog.pg_attribute WHERE attrelid = " + Uint32ToString(field.TableOID) + " AND attnum = " + strconv.Itoa(int(field.TableAttributeNumber))
+		messages, err = handleQuery(queryHandler, NewSession(), query)
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.RowDescription{},
-		})
-		testRowDescription(t, messages[0], []string{"usename", "passwd"}, []string{Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.TextOID)})
-		if preparedStatement.Rows == nil {
-			t.Errorf("Expected the prepared statement to have rows")
+		if field.TableOID != tableOid {
+			t.Errorf("Expected the table OID to be %d, got %d", tableOid, field.TableOID)
 		}
+		testDataRowValues(t, messages[1], []string{"timestamp_column"})
 	})
 
-	t.Run("Handles DESCRIBE extended query step if query is empty", func(t *testing.T) {
+	t.Run("Keeps settings per session", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		parseMessage := &pgproto3.Parse{Query: ""}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		message := &pgproto3.Describe{ObjectType: 'P'}
+		session := NewSession()
+		otherSession := NewSession()
 
-		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		messages, err := handleQuery(queryHandler, session, "SET search_path TO main")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "SET")
 
+		messages, err = handleQuery(queryHandler, session, "SHOW search_path")
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.NoData{},
-		})
+		testDataRowValues(t, messages[1], []string{`"$user", main`})
+
+		messages, err = handleQuery(queryHandler, otherSession, "SHOW search_path")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{`"$user", public`})
 	})
 
-	t.Run("Handles DESCRIBE (Statement) extended query step if there was no BIND step", func(t *testing.T) {
+	t.Run("Keeps the search_path on ignored SETs", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
-		parseMessage := &pgproto3.Parse{Query: query, ParameterOIDs: []uint32{pgtype.TextOID}}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		message := &pgproto3.Describe{ObjectType: 'S'}
+		session := NewSession()
+		handleQuery(queryHandler, session, "SET search_path TO main")
 
-		messages, _, err := queryHandler.HandleDescribeQuery(message, preparedStatement)
+		for _, query := range []string{"SET client_encoding TO 'UTF8'", "SET unknown_setting = 1", "RESET application_name"} {
+			messages, err := handleQuery(queryHandler, session, query)
+			testNoError(t, err)
+			testMessageTypes(t, messages, []pgproto3.Message{
+				&pgproto3.CommandComplete{},
+			})
+		}
 
+		messages, err := handleQuery(queryHandler, session, "SHOW search_path")
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.NoData{},
-		})
+		testDataRowValues(t, messages[1], []string{`"$user", main`})
 	})
-}
 
-func TestHandleExecuteQuery(t *testing.T) {
-	t.Run("Handles EXECUTE extended query step", func(t *testing.T) {
+	t.Run("Resets the session on DISCARD ALL", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
-		parseMessage := &pgproto3.Parse{Query: query}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
-		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
-		message := &pgproto3.Execute{}
+		session := NewSession()
+		handleQuery(queryHandler, session, "SET search_path TO main")
+		handleQuery(queryHandler, session, "SET statement_timeout = 100")
+		handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT 1")
 
-		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+		messages, err := handleQuery(queryHandler, session, "DISCARD ALL")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.DataRow{},
 			&pgproto3.CommandComplete{},
 		})
-		testDataRowValues(t, messages[0], []string{"bemidb", "bemidb-encrypted"})
+		testCommandCompleteTag(t, messages[0], "DISCARD ALL")
+		if len(session.cursors) != 0 || session.statementTimeout != 0 {
+			t.Errorf("Expected the session to be reset, got %v cursors and statement_timeout %v", len(session.cursors), session.statementTimeout)
+		}
+
+		messages, err = handleQuery(queryHandler, session, "SHOW search_path")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{`"$user", public`})
+
+		handleQuery(queryHandler, session, "BEGIN")
+		_, err = handleQuery(queryHandler, session, "DISCARD ALL")
+		testPgError(t, err, PG_ERROR_CODE_ACTIVE_SQL_TRANSACTION, "DISCARD ALL cannot run inside a transaction block")
 	})
 
-	t.Run("Handles EXECUTE extended query step if query is empty", func(t *testing.T) {
+	t.Run("Handles DECLARE CURSOR, FETCH and CLOSE", func(t *testing.T) {
 		queryHandler := initQueryHandler()
-		parseMessage := &pgproto3.Parse{Query: ""}
-		_, preparedStatement, _ := queryHandler.HandleParseQuery(parseMessage)
-		bindMessage := &pgproto3.Bind{}
-		_, preparedStatement, _ = queryHandler.HandleBindQuery(bindMessage, preparedStatement)
-		describeMessage := &pgproto3.Describe{ObjectType: 'P'}
-		_, preparedStatement, _ = queryHandler.HandleDescribeQuery(describeMessage, preparedStatement)
-		message := &pgproto3.Execute{}
-
-		messages, err := queryHandler.HandleExecuteQuery(message, preparedStatement)
+		session := NewSession()
 
+		messages, err := handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT x FROM (VALUES (1), (2), (3)) t(x) ORDER BY x")
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.EmptyQueryResponse{},
+			&pgproto3.CommandComplete{},
 		})
-	})
-}
-
-func TestHandleMultipleQueries(t *testing.T) {
-	t.Run("Handles multiple SET statements", func(t *testing.T) {
-		query := `SET client_encoding TO 'UTF8';
-SET client_min_messages TO 'warning';
-SET standard_conforming_strings = on;`
-		queryHandler := initQueryHandler()
+		testCommandCompleteTag(t, messages[0], "DECLARE CURSOR")
 
-		messages, err := queryHandler.HandleQuery(query)
+		messages, err = handleQuery(queryHandler, session, "FETCH 2 FROM c")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testRowDescription(t, messages[0], []string{"x"}, []string{Uint32ToString(pgtype.Int4OID)})
+		testDataRowValues(t, messages[1], []string{"1"})
+		testDataRowValues(t, messages[2], []string{"2"})
+		testCommandCompleteTag(t, messages[3], "FETCH 2")
 
+		messages, err = handleQuery(queryHandler, session, "FETCH ALL FROM c")
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
 			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[1], []string{"3"})
+		testCommandCompleteTag(t, messages[2], "FETCH 1")
+
+		messages, err = handleQuery(queryHandler, session, "FETCH NEXT FROM c")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
 			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[1], "FETCH 0")
+
+		messages, err = handleQuery(queryHandler, session, "CLOSE c")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
 			&pgproto3.CommandComplete{},
 		})
-		testCommandCompleteTag(t, messages[0], "SET")
-		testCommandCompleteTag(t, messages[1], "SET")
-		testCommandCompleteTag(t, messages[2], "SET")
+		testCommandCompleteTag(t, messages[0], "CLOSE CURSOR")
+
+		_, err = handleQuery(queryHandler, session, "FETCH 1 FROM c")
+		if err == nil || err.Error() != "cursor \"c\" does not exist" {
+			t.Errorf("Expected a missing cursor error, got %v", err)
+		}
 	})
 
-	t.Run("Handles mixed SET and SELECT statements", func(t *testing.T) {
-		query := `SET client_encoding TO 'UTF8';
-SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
+	t.Run("Handles MOVE for a cursor", func(t *testing.T) {
 		queryHandler := initQueryHandler()
+		session := NewSession()
+		handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT x FROM (VALUES (1), (2), (3)) t(x) ORDER BY x")
 
-		messages, err := queryHandler.HandleQuery(query)
+		messages, err := handleQuery(queryHandler, session, "MOVE FORWARD 2 IN c; FETCH 1 FROM c")
 
 		testNoError(t, err)
 		testMessageTypes(t, messages, []pgproto3.Message{
@@ -1222,99 +1298,2215 @@ SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
 			&pgproto3.DataRow{},
 			&pgproto3.CommandComplete{},
 		})
-		testCommandCompleteTag(t, messages[0], "SET")
-		testDataRowValues(t, messages[2], []string{"bemidb-encrypted"})
-		testCommandCompleteTag(t, messages[3], "SELECT 1")
+		testCommandCompleteTag(t, messages[0], "MOVE 2")
+		testDataRowValues(t, messages[2], []string{"3"})
 	})
 
-	t.Run("Handles multiple SELECT statements", func(t *testing.T) {
-		query := `SELECT 1;
-SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
+	t.Run("Runs other queries between FETCHes", func(t *testing.T) {
 		queryHandler := initQueryHandler()
+		session := NewSession()
+		session.statementTimeout = time.Second // Fails instead of waiting for the session's connection
+		handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT x FROM range(100000) t(x) ORDER BY x")
 
-		messages, err := queryHandler.HandleQuery(query)
+		messages, err := handleQuery(queryHandler, session, "FETCH 10 FROM c; SELECT 1 AS one; FETCH 1 FROM c")
 
 		testNoError(t, err)
-		testMessageTypes(t, messages, []pgproto3.Message{
-			&pgproto3.RowDescription{},
-			&pgproto3.DataRow{},
-			&pgproto3.CommandComplete{},
-			&pgproto3.RowDescription{},
-			&pgproto3.DataRow{},
-			&pgproto3.CommandComplete{},
-		})
-		testDataRowValues(t, messages[1], []string{"1"})
-		testCommandCompleteTag(t, messages[2], "SELECT 1")
-		testDataRowValues(t, messages[4], []string{"bemidb-encrypted"})
-		testCommandCompleteTag(t, messages[5], "SELECT 1")
+		testCommandCompleteTag(t, messages[11], "FETCH 10")
+		testDataRowValues(t, messages[13], []string{"1"})
+		testDataRowValues(t, messages[16], []string{"10"})
+		testCommandCompleteTag(t, messages[17], "FETCH 1")
 	})
 
-	t.Run("Handles error in any of multiple statements", func(t *testing.T) {
-		query := `SET client_encoding TO 'UTF8';
-SELECT * FROM non_existent_table;
-SET standard_conforming_strings = on;`
+	t.Run("Doesn't count rows skipped by MOVE against the result limits", func(t *testing.T) {
 		queryHandler := initQueryHandler()
+		queryHandler.config.MaxResultRows = 2
+		defer func() { queryHandler.config.MaxResultRows = 0 }()
+		session := NewSession()
+		handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT x FROM range(5) t(x)")
 
-		_, err := queryHandler.HandleQuery(query)
+		messages, err := handleQuery(queryHandler, session, "MOVE FORWARD 3 IN c; FETCH ALL FROM c")
 
-		if err == nil {
-			t.Error("Expected an error for non-existent table, got nil")
-			return
-		}
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "MOVE 3")
+		testDataRowValues(t, messages[2], []string{"3"})
+		testDataRowValues(t, messages[3], []string{"4"})
+		testCommandCompleteTag(t, messages[4], "FETCH 2")
+	})
 
-		if !strings.Contains(err.Error(), "non_existent_table") {
-			t.Errorf("Expected error message to contain 'non_existent_table', got: %s", err.Error())
+	t.Run("Keeps cursors until the end of the transaction block", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		handleQuery(queryHandler, session, "BEGIN")
+		handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT x FROM (VALUES (1), (2)) t(x) ORDER BY x")
+
+		session.closePortals() // Sync closes the protocol-level portals
+
+		messages, err := handleQuery(queryHandler, session, "FETCH 1 FROM c")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+
+		handleQuery(queryHandler, session, "COMMIT")
+		_, err = handleQuery(queryHandler, session, "FETCH 1 FROM c")
+		if err == nil || err.Error() != "cursor \"c\" does not exist" {
+			t.Errorf("Expected the cursor to be closed at the end of the transaction, got %v", err)
 		}
 	})
-}
 
-func initQueryHandler() *QueryHandler {
-	config := loadTestConfig()
-	duckdb := NewDuckdb(config)
-	icebergReader := NewIcebergReader(config)
-	return NewQueryHandler(config, duckdb, icebergReader)
-}
+	t.Run("Returns an error for a backward FETCH", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT 1")
 
-func testNoError(t *testing.T, err error) {
-	if err != nil {
-		t.Errorf("Expected no error, got %v", err)
-	}
-}
+		_, err := handleQuery(queryHandler, session, "FETCH BACKWARD 1 FROM c")
 
-func testMessageTypes(t *testing.T, messages []pgproto3.Message, expectedTypes []pgproto3.Message) {
-	if len(messages) != len(expectedTypes) {
-		t.Errorf("Expected %v messages, got %v", len(expectedTypes), len(messages))
-	}
+		if err == nil || err.Error() != "cursor can only scan forward" {
+			t.Errorf("Expected a forward-only cursor error, got %v", err)
+		}
+	})
 
-	for i, expectedType := range expectedTypes {
-		if reflect.TypeOf(messages[i]) != reflect.TypeOf(expectedType) {
-			t.Errorf("Expected the %v message to be a %v", i, expectedType)
+	t.Run("Streams rows in batches", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		var batchSizes []int
+		writer := func(messages ...pgproto3.Message) error {
+			batchSizes = append(batchSizes, len(messages))
+			return nil
 		}
-	}
-}
 
-func testRowDescription(t *testing.T, rowDescriptionMessage pgproto3.Message, expectedColumnNames []string, expectedColumnTypes []string) {
-	rowDescription := rowDescriptionMessage.(*pgproto3.RowDescription)
+		err := queryHandler.HandleQuery(NewSession(), "SELECT x FROM range(2500) t(x)", writer)
 
-	if len(rowDescription.Fields) != len(expectedColumnNames) {
-		t.Errorf("Expected %v row description fields, got %v", len(expectedColumnNames), len(rowDescription.Fields))
-	}
+		testNoError(t, err)
+		expectedBatchSizes := []int{1, STREAM_BATCH_MAX_ROWS, STREAM_BATCH_MAX_ROWS, 500, 1} // RowDescription, DataRows, CommandComplete
+		if !reflect.DeepEqual(batchSizes, expectedBatchSizes) {
+			t.Errorf("Expected the batch sizes to be %v, got %v", expectedBatchSizes, batchSizes)
+		}
+	})
 
-	for i, expectedColumnName := range expectedColumnNames {
-		if string(rowDescription.Fields[i].Name) != expectedColumnName {
-			t.Errorf("Expected the %v row description field to be %v, got %v", i, expectedColumnName, string(rowDescription.Fields[i].Name))
+	t.Run("Stops streaming if the writer fails", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		writerError := errors.New("connection closed")
+		writer := func(messages ...pgproto3.Message) error {
+			return writerError
 		}
-	}
 
-	for i, expectedColumnType := range expectedColumnTypes {
-		if Uint32ToString(rowDescription.Fields[i].DataTypeOID) != expectedColumnType {
-			t.Errorf("Expected the %v row description field data type to be %v, got %v", i, expectedColumnType, Uint32ToString(rowDescription.Fields[i].DataTypeOID))
+		err := queryHandler.HandleQuery(NewSession(), "SELECT x FROM range(2500) t(x)", writer)
+
+		if err != writerError {
+			t.Errorf("Expected the writer error, got %v", err)
 		}
-	}
-}
+	})
 
-func testDataRowValues(t *testing.T, dataRowMessage pgproto3.Message, expectedValues []string) {
-	dataRow := dataRowMessage.(*pgproto3.DataRow)
+	t.Run("Returns an error if the result exceeds the max number of rows", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.MaxResultRows = 2
+		defer func() { queryHandler.config.MaxResultRows = 0 }()
+
+		_, err := handleQuery(queryHandler, NewSession(), "SELECT x FROM (VALUES (1), (2), (3)) t(x)")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a Postgres error, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_PROGRAM_LIMIT_EXCEEDED {
+			t.Errorf("Expected the error code to be %v, got %v", PG_ERROR_CODE_PROGRAM_LIMIT_EXCEEDED, pgError.Code)
+		}
+		if pgError.Message != "query result exceeds the maximum of 2 rows" {
+			t.Errorf("Expected the error message to be about the row limit, got %v", pgError.Message)
+		}
+	})
+
+	t.Run("Returns an error if the result exceeds the max size", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.MaxResultBytes = 10
+		defer func() { queryHandler.config.MaxResultBytes = 0 }()
+
+		_, err := handleQuery(queryHandler, NewSession(), "SELECT 'a very long text value' AS value")
+
+		var pgError *PgError
+		if !errors.As(err, &pgError) {
+			t.Fatalf("Expected a Postgres error, got %v", err)
+		}
+		if pgError.Code != PG_ERROR_CODE_PROGRAM_LIMIT_EXCEEDED {
+			t.Errorf("Expected the error code to be %v, got %v", PG_ERROR_CODE_PROGRAM_LIMIT_EXCEEDED, pgError.Code)
+		}
+	})
+
+	t.Run("Handles an empty query", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), "-- ping")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.EmptyQueryResponse{},
+		})
+	})
+
+	t.Run("Cancels a running query", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		sessionRegistry := NewSessionRegistry(queryHandler.config)
+		sessionRegistry.Register(session)
+
+		time.AfterFunc(100*time.Millisecond, func() {
+			if sessionRegistry.CancelQuery(session.processId, session.secretKey+1) {
+				t.Errorf("Expected the query not to be canceled with a wrong secret key")
+			}
+			sessionRegistry.CancelQuery(session.processId, session.secretKey)
+		})
+		_, err := handleQuery(queryHandler, session, "SELECT COUNT(*) FROM range(1000000) a, range(1000000) b")
+
+		testPgError(t, err, PG_ERROR_CODE_QUERY_CANCELED, "canceling statement due to user request")
+
+		messages, err := handleQuery(queryHandler, session, "SELECT 1 AS one")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+	})
+
+	t.Run("Rejects connections over max connections with a reserved slot for the admin user", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.MaxConnections = 2
+		queryHandler.config.AdminUser = "admin"
+		defer func() { queryHandler.config.MaxConnections, queryHandler.config.AdminUser = 0, "" }()
+		sessionRegistry := NewSessionRegistry(queryHandler.config)
+
+		testNoError(t, sessionRegistry.Register(&Session{user: "analyst"}))
+		testPgError(t, sessionRegistry.Register(&Session{user: "analyst"}), PG_ERROR_CODE_TOO_MANY_CONNECTIONS, "remaining connection slots are reserved for the admin user")
+
+		admin := &Session{user: "admin"}
+		testNoError(t, sessionRegistry.Register(admin))
+		testPgError(t, sessionRegistry.Register(&Session{user: "admin"}), PG_ERROR_CODE_TOO_MANY_CONNECTIONS, "sorry, too many clients already")
+
+		sessionRegistry.Unregister(admin)
+		testNoError(t, sessionRegistry.Register(&Session{user: "admin"}))
+	})
+
+	t.Run("Queues queries over the per-user limit", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.MaxUserQueries = 1
+		queryHandler.config.AdminUser = "admin"
+		defer func() { queryHandler.config.MaxUserQueries, queryHandler.config.AdminUser = 0, "" }()
+		sessionRegistry := NewSessionRegistry(queryHandler.config)
+		session := NewSession()
+		session.user = "analyst"
+		waitingSession := NewSession()
+		waitingSession.user = "analyst"
+
+		release, err := sessionRegistry.AcquireQuerySlot(session)
+		testNoError(t, err)
+
+		acquired := make(chan func())
+		go func() {
+			waitingRelease, err := sessionRegistry.AcquireQuerySlot(waitingSession)
+			testNoError(t, err)
+			acquired <- waitingRelease
+		}()
+
+		for _, user := range []string{"admin", "viewer"} {
+			otherSession := NewSession()
+			otherSession.user = user
+			otherRelease, err := sessionRegistry.AcquireQuerySlot(otherSession)
+			testNoError(t, err)
+			otherRelease()
+		}
+
+		select {
+		case <-acquired:
+			t.Fatalf("Expected the query to wait for a free slot")
+		case <-time.After(50 * time.Millisecond):
+		}
+		release()
+		waitingRelease := <-acquired
+
+		canceledSession := NewSession()
+		canceledSession.user = "analyst"
+		time.AfterFunc(50*time.Millisecond, canceledSession.CancelQuery)
+		_, err = sessionRegistry.AcquireQuerySlot(canceledSession)
+		testPgError(t, err, PG_ERROR_CODE_QUERY_CANCELED, "canceling statement due to user request")
+		waitingRelease()
+	})
+
+	t.Run("Holds the query slot while a cursor or a suspended portal is open", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		queryHandler.config.MaxUserQueries = 1
+		defer func() { queryHandler.config.MaxUserQueries = 0 }()
+		sessionRegistry := NewSessionRegistry(queryHandler.config)
+		session := NewSession()
+		session.user = "analyst"
+		testNoError(t, sessionRegistry.Register(session))
+		waitingSession := NewSession()
+		waitingSession.user = "analyst"
+		testNoError(t, sessionRegistry.Register(waitingSession))
+
+		_, err := handleQuery(queryHandler, session, "DECLARE c CURSOR FOR SELECT x FROM range(10) t(x)")
+		testNoError(t, err)
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "SELECT x FROM range(10) t(x)"})
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{}, preparedStatement)
+		var messages []pgproto3.Message
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{MaxRows: 1}, portal, collectMessages(&messages))
+		testNoError(t, err)
+
+		release, err := sessionRegistry.AcquireQuerySlot(session) // The session's own queries share its slot
+		testNoError(t, err)
+		release()
+
+		acquired := make(chan func())
+		go func() {
+			waitingRelease, err := sessionRegistry.AcquireQuerySlot(waitingSession)
+			testNoError(t, err)
+			acquired <- waitingRelease
+		}()
+
+		_, err = handleQuery(queryHandler, session, "CLOSE c")
+		testNoError(t, err)
+		select {
+		case <-acquired:
+			t.Fatalf("Expected the query to wait for the suspended portal")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		portal.Close()
+		select {
+		case waitingRelease := <-acquired:
+			waitingRelease()
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the query slot to be released when the portal is closed")
+		}
+	})
+
+	t.Run("Cancels a query that runs longer than statement_timeout", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "SET statement_timeout = 100")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "SET")
+
+		_, err = handleQuery(queryHandler, session, "SELECT COUNT(*) FROM range(1000000) a, range(1000000) b")
+
+		testPgError(t, err, PG_ERROR_CODE_QUERY_CANCELED, "canceling statement due to statement timeout")
+	})
+
+	t.Run("Sets and shows statement_timeout", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		session.defaultStatementTimeout = 30 * time.Second
+
+		for _, setting := range []struct{ query, value string }{
+			{"SET statement_timeout TO '5s'", "5s"},
+			{"SET statement_timeout = 1500", "1500ms"},
+			{"SET statement_timeout = '2 min'", "2min"},
+			{"RESET statement_timeout", "30s"},
+			{"SET statement_timeout = 0", "0"},
+		} {
+			_, err := handleQuery(queryHandler, session, setting.query)
+			testNoError(t, err)
+
+			messages, err := handleQuery(queryHandler, session, "SHOW statement_timeout")
+			testNoError(t, err)
+			testRowDescription(t, messages[0], []string{"statement_timeout"}, []string{"25"})
+			testDataRowValues(t, messages[1], []string{setting.value})
+		}
+	})
+
+	t.Run("Returns an error for an invalid statement_timeout", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		_, err := handleQuery(queryHandler, NewSession(), "SET statement_timeout = '5 lightyears'")
+
+		testPgError(t, err, PG_ERROR_CODE_INVALID_PARAMETER_VALUE, "invalid value for parameter \"statement_timeout\": \"5 lightyears\"")
+	})
+
+	t.Run("Handles BEGIN, SAVEPOINT, RELEASE and COMMIT", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		for _, statement := range []struct{ query, tag string }{
+			{"BEGIN", "BEGIN"},
+			{"SAVEPOINT s1", "SAVEPOINT"},
+			{"ROLLBACK TO SAVEPOINT s1", "ROLLBACK"},
+			{"RELEASE SAVEPOINT s1", "RELEASE"},
+			{"COMMIT", "COMMIT"},
+			{"START TRANSACTION READ ONLY", "START TRANSACTION"},
+			{"ROLLBACK", "ROLLBACK"},
+		} {
+			messages, err := handleQuery(queryHandler, session, statement.query)
+			testNoError(t, err)
+			testCommandCompleteTag(t, messages[0], statement.tag)
+
+			expectedTxStatus := byte(PG_TX_STATUS_IN_TRANSACTION)
+			if statement.tag == "COMMIT" || statement.query == "ROLLBACK" {
+				expectedTxStatus = PG_TX_STATUS_IDLE
+			}
+			if session.TxStatus() != expectedTxStatus {
+				t.Errorf("Expected the transaction status after %v to be %c, got %c", statement.query, expectedTxStatus, session.TxStatus())
+			}
+		}
+	})
+
+	t.Run("Returns warnings for BEGIN and COMMIT in a wrong transaction state", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "COMMIT")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.NoticeResponse{}, &pgproto3.CommandComplete{}})
+		if messages[0].(*pgproto3.NoticeResponse).Code != PG_ERROR_CODE_NO_ACTIVE_SQL_TRANSACTION {
+			t.Errorf("Expected a no active transaction warning, got %v", messages[0])
+		}
+
+		handleQuery(queryHandler, session, "BEGIN")
+		messages, err = handleQuery(queryHandler, session, "BEGIN")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.NoticeResponse{}, &pgproto3.CommandComplete{}})
+		if messages[0].(*pgproto3.NoticeResponse).Code != PG_ERROR_CODE_ACTIVE_SQL_TRANSACTION {
+			t.Errorf("Expected an active transaction warning, got %v", messages[0])
+		}
+
+		_, err = handleQuery(queryHandler, NewSession(), "SAVEPOINT s1")
+		testPgError(t, err, PG_ERROR_CODE_NO_ACTIVE_SQL_TRANSACTION, "SAVEPOINT can only be used in transaction blocks")
+
+		_, err = handleQuery(queryHandler, session, "ROLLBACK TO SAVEPOINT unknown")
+		testPgError(t, err, PG_ERROR_CODE_INVALID_SAVEPOINT_SPECIFICATION, "savepoint \"unknown\" does not exist")
+	})
+
+	t.Run("Ignores statements in a failed transaction until ROLLBACK", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		handleQuery(queryHandler, session, "BEGIN")
+		_, err := handleQuery(queryHandler, session, "SELECT * FROM non_existent_table")
+		if err == nil {
+			t.Fatalf("Expected an error for a non-existent table")
+		}
+		session.FailTransaction()
+		if session.TxStatus() != PG_TX_STATUS_FAILED {
+			t.Errorf("Expected the transaction status to be %c, got %c", PG_TX_STATUS_FAILED, session.TxStatus())
+		}
+
+		_, err = handleQuery(queryHandler, session, "SELECT 1")
+		testPgError(t, err, PG_ERROR_CODE_IN_FAILED_SQL_TRANSACTION, "current transaction is aborted, commands ignored until end of transaction block")
+
+		messages, err := handleQuery(queryHandler, session, "COMMIT")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "ROLLBACK")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT 1 AS one")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+	})
+
+	t.Run("Reads the same table snapshot within a transaction", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		icebergWriter := NewIcebergWriter(queryHandler.config)
+		schemaTable := IcebergSchemaTable{Schema: "public", Table: "test_table"}
+		writeRows := func(rows [][]string) {
+			loaded := false
+			icebergWriter.Write(schemaTable, TEST_PG_SCHEMA_COLUMNS, func() [][]string {
+				if loaded {
+					return [][]string{}
+				}
+				loaded = true
+				return rows
+			})
+		}
+		defer writeRows(TEST_LOADED_ROWS)
+
+		handleQuery(queryHandler, session, "BEGIN")
+		messages, err := handleQuery(queryHandler, session, "SELECT COUNT(*) AS count FROM public.test_table")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{IntToString(len(TEST_LOADED_ROWS))})
+
+		writeRows(TEST_LOADED_ROWS[:1])
+		err = queryHandler.queryRemapper.ReloadCatalog()
+		testNoError(t, err)
+
+		messages, err = handleQuery(queryHandler, session, "SELECT COUNT(*) AS count FROM public.test_table")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{IntToString(len(TEST_LOADED_ROWS))})
+
+		handleQuery(queryHandler, session, "COMMIT")
+		messages, err = handleQuery(queryHandler, session, "SELECT COUNT(*) AS count FROM public.test_table")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+	})
+}
+
+func TestHandleParseQuery(t *testing.T) {
+	t.Run("Handles PARSE extended query step", func(t *testing.T) {
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		queryHandler := initQueryHandler()
+		message := &pgproto3.Parse{Query: query}
+
+		messages, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), message)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParseComplete{},
+		})
+
+		remappedQuery := "SELECT usename, passwd FROM (VALUES ('bemidb'::text, '10'::oid, 'FALSE'::bool, 'FALSE'::bool, 'TRUE'::bool, 'FALSE'::bool, 'bemidb-encrypted'::text, NULL, NULL)) pg_shadow(usename, usesysid, usecreatedb, usesuper, userepl, usebypassrls, passwd, valuntil, useconfig) WHERE usename = $1"
+		if preparedStatement.Query != remappedQuery {
+			t.Errorf("Expected the prepared statement query to be %v, got %v", remappedQuery, preparedStatement.Query)
+		}
+		if preparedStatement.Statement == nil {
+			t.Errorf("Expected the prepared statement to have a statement")
+		}
+	})
+}
+
+func TestHandleBindQuery(t *testing.T) {
+	t.Run("Handles BIND extended query step with text format parameter", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		testNoError(t, err)
+
+		bindMessage := &pgproto3.Bind{
+			Parameters:           [][]byte{[]byte("bemidb")},
+			ParameterFormatCodes: []int16{0}, // Text format
+		}
+		messages, portal, err := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+		if len(portal.Variables) != 1 {
+			t.Errorf("Expected the portal to have 1 variable, got %v", len(portal.Variables))
+		}
+		if portal.Variables[0] != "bemidb" {
+			t.Errorf("Expected the portal variable to be 'bemidb', got %v", portal.Variables[0])
+		}
+	})
+
+	t.Run("Handles BIND extended query step with binary format parameter", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT c.oid FROM pg_catalog.pg_class c WHERE c.relnamespace = $1"
+		parseMessage := &pgproto3.Parse{Query: query, ParameterOIDs: []uint32{pgtype.Int8OID}}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		testNoError(t, err)
+
+		paramValue := int64(2200)
+		paramBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(paramBytes, uint64(paramValue))
+
+		bindMessage := &pgproto3.Bind{
+			Parameters:           [][]byte{paramBytes},
+			ParameterFormatCodes: []int16{1}, // Binary format
+		}
+		messages, portal, err := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.BindComplete{},
+		})
+		if len(portal.Variables) != 1 {
+			t.Errorf("Expected the portal to have 1 variable, got %v", len(portal.Variables))
+		}
+		if portal.Variables[0] != paramValue {
+			t.Errorf("Expected the portal variable to be %v, got %v", paramValue, portal.Variables[0])
+		}
+	})
+
+	t.Run("Keeps NULL parameters in their positions", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: "SELECT $1::text AS a, $2::text AS b"})
+		testNoError(t, err)
+
+		_, portal, err := queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{Parameters: [][]byte{nil, []byte("b")}}, preparedStatement)
+
+		testNoError(t, err)
+		if len(portal.Variables) != 2 || portal.Variables[0] != nil || portal.Variables[1] != "b" {
+			t.Errorf("Expected the portal variables to be [<nil> b], got %v", portal.Variables)
+		}
+	})
+
+	t.Run("Decodes binary parameters by the types passed in PARSE", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		typeMap := pgtype.NewMap()
+		parseMessage := &pgproto3.Parse{
+			Query:         "SELECT $1 AS a, $2 AS b, $3 AS c, $4 AS d",
+			ParameterOIDs: []uint32{pgtype.Float8OID, pgtype.TimestampOID, pgtype.UUIDOID, pgtype.NumericOID},
+		}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		testNoError(t, err)
+
+		timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		uuidBytes := [16]byte{0x58, 0xa7, 0xc8, 0x45, 0xaf, 0x77, 0x44, 0xb2, 0x8b, 0x1b, 0x5e, 0x6a, 0x1e, 0x0b, 0x2c, 0x8d}
+		numeric := pgtype.Numeric{}
+		testNoError(t, numeric.Scan("12.34"))
+		var parameters [][]byte
+		for i, value := range []interface{}{float64(1.5), timestamp, uuidBytes, numeric} {
+			parameter, err := typeMap.Encode(parseMessage.ParameterOIDs[i], pgtype.BinaryFormatCode, value, nil)
+			testNoError(t, err)
+			parameters = append(parameters, parameter)
+		}
+
+		_, portal, err := queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{Parameters: parameters, ParameterFormatCodes: []int16{1}}, preparedStatement)
+
+		testNoError(t, err)
+		if portal.Variables[0] != float64(1.5) {
+			t.Errorf("Expected the float8 variable to be 1.5, got %v", portal.Variables[0])
+		}
+		if portal.Variables[1] != timestamp {
+			t.Errorf("Expected the timestamp variable to be %v, got %v", timestamp, portal.Variables[1])
+		}
+		if portal.Variables[2] != "58a7c845-af77-44b2-8b1b-5e6a1e0b2c8d" {
+			t.Errorf("Expected the uuid variable to be 58a7c845-af77-44b2-8b1b-5e6a1e0b2c8d, got %v", portal.Variables[2])
+		}
+		if portal.Variables[3] != "12.34" {
+			t.Errorf("Expected the numeric variable to be 12.34, got %v", portal.Variables[3])
+		}
+	})
+
+	t.Run("Decodes binary parameters by the types inferred from casts", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: "SELECT $1::int2 AS a, $2::bool AS b, $3::int4[] AS c"})
+		testNoError(t, err)
+
+		typeMap := pgtype.NewMap()
+		int2Bytes, err := typeMap.Encode(pgtype.Int2OID, pgtype.BinaryFormatCode, int16(7), nil)
+		testNoError(t, err)
+		boolBytes, err := typeMap.Encode(pgtype.BoolOID, pgtype.BinaryFormatCode, true, nil)
+		testNoError(t, err)
+		arrayBytes, err := typeMap.Encode(pgtype.Int4ArrayOID, pgtype.BinaryFormatCode, []int32{1, 2}, nil)
+		testNoError(t, err)
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{int2Bytes, boolBytes, arrayBytes}, ParameterFormatCodes: []int16{1}}
+
+		_, portal, err := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+
+		testNoError(t, err)
+		if portal.Variables[0] != int16(7) || portal.Variables[1] != true || portal.Variables[2] != "[1, 2]" {
+			t.Errorf("Expected the portal variables to be [7 true [1, 2]], got %v", portal.Variables)
+		}
+		messages, err := queryHandler.HandleDescribeStatementQuery(NewSession(), preparedStatement)
+		testNoError(t, err)
+		testParameterDescription(t, messages[0], []uint32{pgtype.Int2OID, pgtype.BoolOID, pgtype.Int4ArrayOID})
+		messages, err = handleExecuteQuery(queryHandler, &pgproto3.Execute{}, portal)
+		testNoError(t, err)
+		testDataRowValues(t, messages[0], []string{"7", "true", "{1,2}"})
+	})
+
+	t.Run("Returns an error if the number of parameters doesn't match", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Name: "stmt", Query: "SELECT $1::text, $2::text"})
+		testNoError(t, err)
+
+		_, _, err = queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{Parameters: [][]byte{[]byte("a")}}, preparedStatement)
+
+		testPgError(t, err, PG_ERROR_CODE_PROTOCOL_VIOLATION, "bind message supplies 1 parameters, but prepared statement \"stmt\" requires 2")
+	})
+
+	t.Run("Returns an error if a binary parameter doesn't match its type", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: "SELECT $1 AS a", ParameterOIDs: []uint32{pgtype.Int8OID}})
+		testNoError(t, err)
+
+		_, _, err = queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{Parameters: [][]byte{{0, 1}}, ParameterFormatCodes: []int16{1}}, preparedStatement)
+
+		testPgError(t, err, PG_ERROR_CODE_INVALID_BINARY_REPRESENTATION, "invalid binary value for parameter $1: expected int8: invalid length for int8: 2")
+	})
+
+	t.Run("Returns an error if a binary parameter type can't be determined", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: "SELECT $1 AS a"})
+		testNoError(t, err)
+
+		_, _, err = queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{Parameters: [][]byte{{0, 1}}, ParameterFormatCodes: []int16{1}}, preparedStatement)
+
+		testPgError(t, err, PG_ERROR_CODE_INDETERMINATE_DATATYPE, "could not determine data type of parameter $1")
+	})
+
+	t.Run("Doesn't guess the type of a binary parameter from its length", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: "SELECT $1 AS a"})
+		testNoError(t, err)
+
+		float8Bytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(float8Bytes, math.Float64bits(1.5))
+		_, _, err = queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{Parameters: [][]byte{float8Bytes}, ParameterFormatCodes: []int16{1}}, preparedStatement)
+
+		testPgError(t, err, PG_ERROR_CODE_INDETERMINATE_DATATYPE, "could not determine data type of parameter $1")
+	})
+}
+
+func TestHandleDescribeQuery(t *testing.T) {
+	t.Run("Handles DESCRIBE (Portal) extended query step", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+
+		messages, portal, err := queryHandler.HandleDescribePortalQuery(NewSession(), portal)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+		})
+		testRowDescription(t, messages[0], []string{"usename", "passwd"}, []string{Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.TextOID)})
+		if portal.Rows == nil {
+			t.Errorf("Expected the portal to have rows")
+		}
+	})
+
+	t.Run("Handles DESCRIBE (Portal) extended query step if query is empty", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		parseMessage := &pgproto3.Parse{Query: ""}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		bindMessage := &pgproto3.Bind{}
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+
+		messages, _, err := queryHandler.HandleDescribePortalQuery(NewSession(), portal)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.NoData{},
+		})
+	})
+
+	t.Run("Handles DESCRIBE (Statement) extended query step if there was no BIND step", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query, ParameterOIDs: []uint32{pgtype.TextOID}}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+
+		messages, err := queryHandler.HandleDescribeStatementQuery(NewSession(), preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParameterDescription{},
+			&pgproto3.RowDescription{},
+		})
+		testParameterDescription(t, messages[0], []uint32{pgtype.TextOID})
+		testRowDescription(t, messages[1], []string{"usename", "passwd"}, []string{Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.TextOID)})
+	})
+
+	t.Run("Handles DESCRIBE (Statement) extended query step with unspecified parameter types", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename FROM pg_shadow WHERE usename=$1 OR usename=$2"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+
+		messages, err := queryHandler.HandleDescribeStatementQuery(NewSession(), preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParameterDescription{},
+			&pgproto3.RowDescription{},
+		})
+		testParameterDescription(t, messages[0], []uint32{pgtype.TextOID, pgtype.TextOID})
+	})
+
+	t.Run("Handles DESCRIBE (Statement) extended query step without reading the rows", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT error('read a row') AS failed FROM public.test_table"
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: query})
+		testNoError(t, err)
+
+		messages, err := queryHandler.HandleDescribeStatementQuery(NewSession(), preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParameterDescription{},
+			&pgproto3.RowDescription{},
+		})
+	})
+
+	t.Run("Handles DESCRIBE (Statement) extended query step if query is empty", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		parseMessage := &pgproto3.Parse{Query: ""}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+
+		messages, err := queryHandler.HandleDescribeStatementQuery(NewSession(), preparedStatement)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.ParameterDescription{},
+			&pgproto3.NoData{},
+		})
+	})
+}
+
+func TestHandleExecuteQuery(t *testing.T) {
+	t.Run("Handles EXECUTE extended query step", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+		_, portal, _ = queryHandler.HandleDescribePortalQuery(NewSession(), portal)
+		message := &pgproto3.Execute{}
+
+		messages, err := handleExecuteQuery(queryHandler, message, portal)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[0], []string{"bemidb", "bemidb-encrypted"})
+	})
+
+	t.Run("Handles EXECUTE extended query step for BEGIN", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		parseMessage := &pgproto3.Parse{Query: "BEGIN"}
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, parseMessage)
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{}, preparedStatement)
+		describeMessages, _, _ := queryHandler.HandleDescribePortalQuery(session, portal)
+		testMessageTypes(t, describeMessages, []pgproto3.Message{&pgproto3.NoData{}})
+
+		var messages []pgproto3.Message
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "BEGIN")
+		if session.TxStatus() != PG_TX_STATUS_IN_TRANSACTION {
+			t.Errorf("Expected the transaction status to be %c, got %c", PG_TX_STATUS_IN_TRANSACTION, session.TxStatus())
+		}
+	})
+
+	t.Run("Handles EXECUTE extended query step without DESCRIBE step", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename, passwd FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		bindMessage := &pgproto3.Bind{Parameters: [][]byte{[]byte("bemidb")}}
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+		message := &pgproto3.Execute{}
+
+		messages, err := handleExecuteQuery(queryHandler, message, portal)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[0], []string{"bemidb", "bemidb-encrypted"})
+	})
+
+	t.Run("Cancels EXECUTE extended query step that runs longer than statement_timeout", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		session.statementTimeout = 100 * time.Millisecond
+		parseMessage := &pgproto3.Parse{Query: "SELECT COUNT(*) FROM range(1000000) a, range(1000000) b"}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{}, preparedStatement)
+
+		var messages []pgproto3.Message
+		err := queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+
+		testPgError(t, err, PG_ERROR_CODE_QUERY_CANCELED, "canceling statement due to statement timeout")
+	})
+
+	t.Run("Handles EXECUTE extended query step for multiple portals of the same statement", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT usename FROM pg_shadow WHERE usename=$1"
+		parseMessage := &pgproto3.Parse{Name: "stmt", Query: query}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		_, portal1, _ := queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{DestinationPortal: "p1", PreparedStatement: "stmt", Parameters: [][]byte{[]byte("bemidb")}}, preparedStatement)
+		_, portal2, _ := queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{DestinationPortal: "p2", PreparedStatement: "stmt", Parameters: [][]byte{[]byte("unknown")}}, preparedStatement)
+
+		messages1, err := handleExecuteQuery(queryHandler, &pgproto3.Execute{Portal: "p1"}, portal1)
+		testNoError(t, err)
+		messages2, err := handleExecuteQuery(queryHandler, &pgproto3.Execute{Portal: "p2"}, portal2)
+		testNoError(t, err)
+
+		testMessageTypes(t, messages1, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testMessageTypes(t, messages2, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+		})
+	})
+
+	t.Run("Handles EXECUTE extended query step with a row limit", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT x FROM (VALUES (1), (2), (3)) t(x) ORDER BY x"
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: query})
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{}, preparedStatement)
+
+		messages, err := handleExecuteQuery(queryHandler, &pgproto3.Execute{MaxRows: 2}, portal)
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.PortalSuspended{},
+		})
+		testDataRowValues(t, messages[0], []string{"1"})
+		testDataRowValues(t, messages[1], []string{"2"})
+
+		messages, err = handleExecuteQuery(queryHandler, &pgproto3.Execute{MaxRows: 2}, portal)
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[0], []string{"3"})
+		testCommandCompleteTag(t, messages[1], "SELECT 1")
+	})
+
+	t.Run("Runs other queries between partial EXECUTE steps", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		session.statementTimeout = time.Second // Fails instead of waiting for the session's connection
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "SELECT x FROM range(100000) t(x) ORDER BY x"})
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{}, preparedStatement)
+
+		var messages []pgproto3.Message
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{MaxRows: 2}, portal, collectMessages(&messages))
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.PortalSuspended{},
+		})
+
+		messages, err = handleQuery(queryHandler, session, "SELECT 1 AS one")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+
+		messages = nil
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{MaxRows: 1}, portal, collectMessages(&messages))
+		testNoError(t, err)
+		testDataRowValues(t, messages[0], []string{"2"})
+	})
+
+	t.Run("Runs other queries while a described portal is open", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		session.statementTimeout = time.Second // Fails instead of waiting for the session's connection
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "SELECT x FROM range(100000) t(x) ORDER BY x"})
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{}, preparedStatement)
+		_, portal, err = queryHandler.HandleDescribePortalQuery(session, portal)
+		testNoError(t, err)
+
+		messages, err := handleQuery(queryHandler, session, "SELECT 1 AS one")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+
+		messages = nil
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{MaxRows: 1}, portal, collectMessages(&messages))
+		testNoError(t, err)
+		testDataRowValues(t, messages[0], []string{"0"})
+	})
+
+	t.Run("Handles EXECUTE extended query step with a row limit equal to the number of rows", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT x FROM (VALUES (1), (2)) t(x)"
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: query})
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{}, preparedStatement)
+
+		messages, err := handleExecuteQuery(queryHandler, &pgproto3.Execute{MaxRows: 2}, portal)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[2], "SELECT 2")
+	})
+
+	t.Run("Handles EXECUTE extended query step with binary result format", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT 42::int4 AS int4, 4200000000::int8 AS int8, 1.5::float8 AS float8, 12.34::numeric(10, 2) AS numeric, 'bemidb'::text AS text, " +
+			"true AS bool, '2024-01-02'::date AS date, '2024-01-02 03:04:05.123456'::timestamp AS timestamp, ARRAY[1, 2, 3] AS array, NULL::int4 AS null"
+		_, preparedStatement, err := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: query})
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), &pgproto3.Bind{ResultFormatCodes: []int16{pgtype.BinaryFormatCode}}, preparedStatement)
+
+		describeMessages, _, err := queryHandler.HandleDescribePortalQuery(NewSession(), portal)
+		testNoError(t, err)
+		for _, field := range describeMessages[0].(*pgproto3.RowDescription).Fields {
+			if field.Format != pgtype.BinaryFormatCode {
+				t.Errorf("Expected the %s field to have binary format, got %v", field.Name, field.Format)
+			}
+		}
+
+		messages, err := handleExecuteQuery(queryHandler, &pgproto3.Execute{}, portal)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		typeMap := pgtype.NewMap()
+		values := messages[0].(*pgproto3.DataRow).Values
+
+		var int4Value int32
+		testBinaryValue(t, typeMap, pgtype.Int4OID, values[0], &int4Value)
+		if int4Value != 42 {
+			t.Errorf("Expected the int4 value to be 42, got %v", int4Value)
+		}
+		var int8Value int64
+		testBinaryValue(t, typeMap, pgtype.Int8OID, values[1], &int8Value)
+		if int8Value != 4200000000 {
+			t.Errorf("Expected the int8 value to be 4200000000, got %v", int8Value)
+		}
+		var float8Value float64
+		testBinaryValue(t, typeMap, pgtype.Float8OID, values[2], &float8Value)
+		if float8Value != 1.5 {
+			t.Errorf("Expected the float8 value to be 1.5, got %v", float8Value)
+		}
+		var numericValue pgtype.Numeric
+		testBinaryValue(t, typeMap, pgtype.NumericOID, values[3], &numericValue)
+		if numericValue.Int.Int64() != 1234 || numericValue.Exp != -2 {
+			t.Errorf("Expected the numeric value to be 12.34, got %v", numericValue)
+		}
+		var textValue string
+		testBinaryValue(t, typeMap, pgtype.TextOID, values[4], &textValue)
+		if textValue != "bemidb" {
+			t.Errorf("Expected the text value to be bemidb, got %v", textValue)
+		}
+		var boolValue bool
+		testBinaryValue(t, typeMap, pgtype.BoolOID, values[5], &boolValue)
+		if !boolValue {
+			t.Errorf("Expected the bool value to be true, got %v", boolValue)
+		}
+		var dateValue time.Time
+		testBinaryValue(t, typeMap, pgtype.DateOID, values[6], &dateValue)
+		if dateValue.Format("2006-01-02") != "2024-01-02" {
+			t.Errorf("Expected the date value to be 2024-01-02, got %v", dateValue)
+		}
+		var timestampValue time.Time
+		testBinaryValue(t, typeMap, pgtype.TimestampOID, values[7], &timestampValue)
+		if timestampValue.Format("2006-01-02 15:04:05.999999") != "2024-01-02 03:04:05.123456" {
+			t.Errorf("Expected the timestamp value to be 2024-01-02 03:04:05.123456, got %v", timestampValue)
+		}
+		var arrayValue []int32
+		testBinaryValue(t, typeMap, pgtype.Int4ArrayOID, values[8], &arrayValue)
+		if !reflect.DeepEqual(arrayValue, []int32{1, 2, 3}) {
+			t.Errorf("Expected the array value to be [1 2 3], got %v", arrayValue)
+		}
+		if values[9] != nil {
+			t.Errorf("Expected the null value to be nil, got %v", values[9])
+		}
+	})
+
+	t.Run("Handles EXECUTE extended query step with mixed result formats", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		query := "SELECT 42::int4 AS binary, 42::int4 AS text"
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), &pgproto3.Parse{Query: query})
+		bindMessage := &pgproto3.Bind{ResultFormatCodes: []int16{pgtype.BinaryFormatCode, pgtype.TextFormatCode}}
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+
+		messages, err := handleExecuteQuery(queryHandler, &pgproto3.Execute{}, portal)
+
+		testNoError(t, err)
+		values := messages[0].(*pgproto3.DataRow).Values
+		var int4Value int32
+		testBinaryValue(t, pgtype.NewMap(), pgtype.Int4OID, values[0], &int4Value)
+		if int4Value != 42 {
+			t.Errorf("Expected the binary value to be 42, got %v", int4Value)
+		}
+		if string(values[1]) != "42" {
+			t.Errorf("Expected the text value to be 42, got %v", string(values[1]))
+		}
+	})
+
+	t.Run("Handles EXECUTE extended query step if query is empty", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		parseMessage := &pgproto3.Parse{Query: ""}
+		_, preparedStatement, _ := queryHandler.HandleParseQuery(NewSession(), parseMessage)
+		bindMessage := &pgproto3.Bind{}
+		_, portal, _ := queryHandler.HandleBindQuery(NewSession(), bindMessage, preparedStatement)
+		_, portal, _ = queryHandler.HandleDescribePortalQuery(NewSession(), portal)
+		message := &pgproto3.Execute{}
+
+		messages, err := handleExecuteQuery(queryHandler, message, portal)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.EmptyQueryResponse{},
+		})
+	})
+}
+
+func TestHandleMultipleQueries(t *testing.T) {
+	t.Run("Handles multiple SET statements", func(t *testing.T) {
+		query := `SET client_encoding TO 'UTF8';
+SET client_min_messages TO 'warning';
+SET standard_conforming_strings = on;`
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), query)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "SET")
+		testCommandCompleteTag(t, messages[1], "SET")
+		testCommandCompleteTag(t, messages[2], "SET")
+	})
+
+	t.Run("Handles mixed SET and SELECT statements", func(t *testing.T) {
+		query := `SET client_encoding TO 'UTF8';
+SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), query)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CommandComplete{},
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testCommandCompleteTag(t, messages[0], "SET")
+		testDataRowValues(t, messages[2], []string{"bemidb-encrypted"})
+		testCommandCompleteTag(t, messages[3], "SELECT 1")
+	})
+
+	t.Run("Handles multiple SELECT statements", func(t *testing.T) {
+		query := `SELECT 1;
+SELECT passwd FROM pg_shadow WHERE usename='bemidb';`
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), query)
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+			&pgproto3.RowDescription{},
+			&pgproto3.DataRow{},
+			&pgproto3.CommandComplete{},
+		})
+		testDataRowValues(t, messages[1], []string{"1"})
+		testCommandCompleteTag(t, messages[2], "SELECT 1")
+		testDataRowValues(t, messages[4], []string{"bemidb-encrypted"})
+		testCommandCompleteTag(t, messages[5], "SELECT 1")
+	})
+
+	t.Run("Handles error in any of multiple statements", func(t *testing.T) {
+		query := `SET client_encoding TO 'UTF8';
+SELECT * FROM non_existent_table;
+SET standard_conforming_strings = on;`
+		queryHandler := initQueryHandler()
+
+		_, err := handleQuery(queryHandler, NewSession(), query)
+
+		if err == nil {
+			t.Error("Expected an error for non-existent table, got nil")
+			return
+		}
+
+		if !strings.Contains(err.Error(), "non_existent_table") {
+			t.Errorf("Expected error message to contain 'non_existent_table', got: %s", err.Error())
+		}
+	})
+}
+
+func TestHandleViewQueries(t *testing.T) {
+	t.Run("Creates, replaces and drops a view over an Iceberg table", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestViewDefinitions(queryHandler)
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "CREATE VIEW test_view AS SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "CREATE VIEW")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT * FROM public.test_view")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2147483647"})
+
+		messages, err = handleQuery(queryHandler, session, "CREATE OR REPLACE VIEW public.test_view (value) AS SELECT int4_column FROM test_table WHERE int4_column IS NULL")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "CREATE VIEW")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT value FROM test_view")
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"value"}, []string{Uint32ToString(pgtype.Int4OID)})
+		testDataRowValues(t, messages[1], []string{""})
+
+		messages, err = handleQuery(queryHandler, session, "DROP VIEW test_view")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "DROP VIEW")
+
+		_, err = handleQuery(queryHandler, session, "SELECT * FROM test_view")
+		if err == nil {
+			t.Error("Expected an error for the dropped view, got nil")
+		}
+	})
+
+	t.Run("Returns views from the catalog with their original definitions", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestViewDefinitions(queryHandler)
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "CREATE VIEW test_view AS SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL")
+		testNoError(t, err)
+
+		messages, err := handleQuery(queryHandler, session, "SELECT * FROM pg_catalog.pg_views")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"public", "test_view", "bemidb", "SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL"})
+
+		messages, err = handleQuery(queryHandler, session, "SELECT table_schema, table_name, view_definition FROM information_schema.views")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"public", "test_view", "SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL"})
+
+		messages, err = handleQuery(queryHandler, session, "SELECT pg_catalog.pg_get_viewdef(c.oid, true) AS viewdef, c.relkind FROM pg_catalog.pg_class c WHERE c.relname = 'test_view'")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL", "v"})
+	})
+
+	t.Run("Returns views over iceberg_scan() that aren't Iceberg tables as views", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		metadataFilePath := queryHandler.icebergReader.MetadataFilePath(IcebergSchemaTable{Schema: "public", Table: "test_table"})
+		_, err := queryHandler.duckdb.ExecContext(context.Background(), "CREATE VIEW public.test_scan_view AS SELECT * FROM iceberg_scan('$path', skip_schema_inference = true)", map[string]string{"path": metadataFilePath})
+		testNoError(t, err)
+
+		messages, err := handleQuery(queryHandler, NewSession(), "SELECT relkind FROM pg_class WHERE relname = 'test_scan_view'")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"v"})
+
+		messages, err = handleQuery(queryHandler, NewSession(), "SELECT table_type FROM information_schema.tables WHERE table_name = 'test_scan_view'")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"VIEW"})
+	})
+
+	t.Run("Loads views created by another instance from the storage", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestViewDefinitions(queryHandler)
+		_, err := handleQuery(queryHandler, NewSession(), "CREATE VIEW test_view AS SELECT COUNT(*) AS count FROM test_table")
+		testNoError(t, err)
+
+		messages, err := handleQuery(initQueryHandler(), NewSession(), "SELECT count FROM test_view")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+	})
+
+	t.Run("Loads views created by another running instance on the next catalog reload", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		otherQueryHandler := initQueryHandler()
+		defer deleteTestViewDefinitions(queryHandler)
+		_, err := handleQuery(queryHandler, NewSession(), "CREATE VIEW test_view AS SELECT COUNT(*) AS count FROM test_table")
+		testNoError(t, err)
+
+		err = otherQueryHandler.queryRemapper.ReloadCatalog()
+		testNoError(t, err)
+		messages, err := handleQuery(otherQueryHandler, NewSession(), "SELECT count FROM test_view")
+
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+	})
+
+	t.Run("Returns an error if the Iceberg tables can't be read from the storage", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestViewDefinitions(queryHandler)
+		storagePath := queryHandler.config.StoragePath
+		queryHandler.config.StoragePath = "../iceberg-test-missing"
+		defer func() { queryHandler.config.StoragePath = storagePath }()
+
+		_, err := handleQuery(queryHandler, NewSession(), "CREATE VIEW test_view AS SELECT int4_column FROM test_table")
+		if err == nil {
+			t.Error("Expected an error for the missing storage, got nil")
+		}
+
+		err = queryHandler.queryRemapper.ReloadCatalog()
+		if err == nil {
+			t.Error("Expected an error for the missing storage, got nil")
+		}
+
+		messages, err := handleQuery(queryHandler, NewSession(), "SELECT COUNT(*) AS count FROM test_table")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+	})
+
+	t.Run("Returns an error for an existing view or table", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestViewDefinitions(queryHandler)
+		_, err := handleQuery(queryHandler, NewSession(), "CREATE VIEW test_view AS SELECT 1")
+		testNoError(t, err)
+
+		_, err = handleQuery(queryHandler, NewSession(), "CREATE VIEW test_view AS SELECT 2")
+		testPgError(t, err, PG_ERROR_CODE_DUPLICATE_TABLE, "relation \"test_view\" already exists")
+
+		_, err = handleQuery(queryHandler, NewSession(), "CREATE VIEW test_table AS SELECT 1")
+		testPgError(t, err, PG_ERROR_CODE_DUPLICATE_TABLE, "relation \"test_table\" already exists")
+
+		_, err = handleQuery(queryHandler, NewSession(), "DROP VIEW test_table")
+		testPgError(t, err, PG_ERROR_CODE_WRONG_OBJECT_TYPE, "\"test_table\" is not a view")
+	})
+
+	t.Run("Drops a non-existent view with IF EXISTS", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestViewDefinitions(queryHandler)
+
+		messages, err := handleQuery(queryHandler, NewSession(), "DROP VIEW IF EXISTS non_existent_view")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.NoticeResponse{}, &pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[1], "DROP VIEW")
+
+		_, err = handleQuery(queryHandler, NewSession(), "DROP VIEW non_existent_view")
+		testPgError(t, err, PG_ERROR_CODE_UNDEFINED_TABLE, "view \"non_existent_view\" does not exist")
+	})
+}
+
+func TestHandleMaterializedViewQueries(t *testing.T) {
+	t.Run("Creates, refreshes and drops a materialized view", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestMaterializedView(queryHandler, "test_matview")
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "CREATE MATERIALIZED VIEW test_matview AS SELECT COUNT(*) AS count, MAX(int4_column) AS max_int4 FROM test_table")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "SELECT 1")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT count, max_int4 FROM public.test_matview")
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"count", "max_int4"}, []string{Uint32ToString(pgtype.Int8OID), Uint32ToString(pgtype.Int4OID)})
+		testDataRowValues(t, messages[1], []string{"2", "2147483647"})
+
+		schemaTable := IcebergSchemaTable{Schema: PG_SCHEMA_PUBLIC, Table: "test_matview"}
+		metadataFilePath := queryHandler.queryRemapper.remapperTable.IcebergViewMetadataFilePath(schemaTable)
+		messages, err = handleQuery(queryHandler, session, "REFRESH MATERIALIZED VIEW test_matview")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "REFRESH MATERIALIZED VIEW")
+		if queryHandler.queryRemapper.remapperTable.IcebergViewMetadataFilePath(schemaTable) == metadataFilePath {
+			t.Errorf("Expected a new snapshot after the refresh, got %s", metadataFilePath)
+		}
+
+		messages, err = handleQuery(queryHandler, session, "SELECT count FROM test_matview")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+
+		messages, err = handleQuery(queryHandler, session, "DROP MATERIALIZED VIEW test_matview")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "DROP MATERIALIZED VIEW")
+
+		_, err = handleQuery(queryHandler, session, "SELECT * FROM test_matview")
+		if err == nil {
+			t.Error("Expected an error for the dropped materialized view, got nil")
+		}
+	})
+
+	t.Run("Returns materialized views from the catalog", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestMaterializedView(queryHandler, "test_matview")
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "CREATE MATERIALIZED VIEW test_matview (value) AS SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL")
+		testNoError(t, err)
+
+		messages, err := handleQuery(queryHandler, session, "SELECT * FROM pg_catalog.pg_matviews")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"public", "test_matview", "bemidb", "", "false", "true", "SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL"})
+
+		messages, err = handleQuery(queryHandler, session, "SELECT c.relkind, pg_catalog.pg_get_viewdef(c.oid) AS viewdef FROM pg_catalog.pg_class c WHERE c.relname = 'test_matview'")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"m", "SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL"})
+
+		messages, err = handleQuery(queryHandler, session, "SELECT COUNT(*) AS count FROM pg_catalog.pg_views WHERE viewname = 'test_matview'")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"0"})
+
+		messages, err = handleQuery(queryHandler, session, "SELECT value FROM test_matview")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2147483647"})
+	})
+
+	t.Run("Returns an error for an existing relation or a relation of another type", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestMaterializedView(queryHandler, "test_matview")
+		_, err := handleQuery(queryHandler, NewSession(), "CREATE MATERIALIZED VIEW test_matview AS SELECT 1 AS one")
+		testNoError(t, err)
+
+		_, err = handleQuery(queryHandler, NewSession(), "CREATE MATERIALIZED VIEW test_table AS SELECT 1")
+		testPgError(t, err, PG_ERROR_CODE_DUPLICATE_TABLE, "relation \"test_table\" already exists")
+
+		_, err = handleQuery(queryHandler, NewSession(), "REFRESH MATERIALIZED VIEW test_table")
+		testPgError(t, err, PG_ERROR_CODE_WRONG_OBJECT_TYPE, "\"test_table\" is not a materialized view")
+
+		_, err = handleQuery(queryHandler, NewSession(), "DROP VIEW test_matview")
+		testPgError(t, err, PG_ERROR_CODE_WRONG_OBJECT_TYPE, "\"test_matview\" is not a view")
+
+		_, err = handleQuery(queryHandler, NewSession(), "DROP MATERIALIZED VIEW non_existent_matview")
+		testPgError(t, err, PG_ERROR_CODE_UNDEFINED_TABLE, "materialized view \"non_existent_matview\" does not exist")
+
+		messages, err := handleQuery(queryHandler, NewSession(), "CREATE MATERIALIZED VIEW IF NOT EXISTS test_matview AS SELECT 2 AS two")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.NoticeResponse{}, &pgproto3.CommandComplete{}})
+	})
+}
+
+// Queries sent by ORMs and BI tools, and queries with tables, functions and type casts in every clause
+func TestHandleTempTableQueries(t *testing.T) {
+	t.Run("Creates a temporary table from a query, inserts into it and joins against it", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "CREATE TEMP TABLE test_temp AS SELECT int4_column FROM test_table WHERE int4_column IS NOT NULL")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "SELECT 1")
+
+		messages, err = handleQuery(queryHandler, session, "INSERT INTO test_temp VALUES (1), (2)")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "INSERT 0 2")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT COUNT(*) FROM test_table JOIN pg_temp.test_temp USING (int4_column)")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1"})
+
+		messages, err = handleQuery(queryHandler, session, "DROP TABLE pg_temp.test_temp")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "DROP TABLE")
+
+		_, err = handleQuery(queryHandler, session, "SELECT * FROM test_temp")
+		if err == nil {
+			t.Error("Expected an error for the dropped temporary table, got nil")
+		}
+	})
+
+	t.Run("Creates a temporary table with columns and inserts into it via the extended query protocol", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		messages, err := handleQuery(queryHandler, session, "CREATE TEMPORARY TABLE test_temp (id int4, name text)")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "CREATE TABLE")
+
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "INSERT INTO test_temp VALUES ($1, $2)"})
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{Parameters: [][]byte{[]byte("1"), []byte("one")}}, preparedStatement)
+		describeMessages, _, _ := queryHandler.HandleDescribePortalQuery(session, portal)
+		testMessageTypes(t, describeMessages, []pgproto3.Message{&pgproto3.NoData{}})
+		messages = nil
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "INSERT 0 1")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT id, name FROM test_temp")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"1", "one"})
+	})
+
+	t.Run("Lists temporary tables in the catalog under pg_temp", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "CREATE TEMP TABLE test_temp AS SELECT 1 AS id")
+		testNoError(t, err)
+
+		messages, err := handleQuery(queryHandler, session, "SELECT n.nspname, c.relpersistence FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace WHERE c.relname = 'test_temp'")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"pg_temp", "t"})
+
+		messages, err = handleQuery(queryHandler, session, "SELECT table_schema, table_type FROM information_schema.tables WHERE table_name = 'test_temp'")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"pg_temp", "LOCAL TEMPORARY"})
+
+		messages, err = handleQuery(queryHandler, NewSession(), "SELECT nspname FROM pg_catalog.pg_namespace WHERE nspname = 'pg_temp'")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.CommandComplete{}})
+	})
+
+	t.Run("Keeps temporary tables per session until DISCARD or disconnect", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "CREATE TEMP TABLE test_temp AS SELECT 1 AS id")
+		testNoError(t, err)
+
+		_, err = handleQuery(queryHandler, NewSession(), "SELECT * FROM test_temp")
+		if err == nil {
+			t.Error("Expected an error for a temporary table of another session, got nil")
+		}
+
+		messages, err := handleQuery(queryHandler, session, "DISCARD TEMP")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "DISCARD TEMP")
+		_, err = handleQuery(queryHandler, session, "SELECT * FROM test_temp")
+		if err == nil {
+			t.Error("Expected an error for a temporary table after DISCARD TEMP, got nil")
+		}
+
+		_, err = handleQuery(queryHandler, session, "CREATE TEMP TABLE test_temp AS SELECT 1 AS id")
+		testNoError(t, err)
+		session.Close()
+		_, err = handleQuery(queryHandler, session, "SELECT * FROM test_temp")
+		if err == nil {
+			t.Error("Expected an error for a temporary table after the session is closed, got nil")
+		}
+	})
+
+	t.Run("Returns an error for a permanent table in a synced schema", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		_, err := handleQuery(queryHandler, NewSession(), "CREATE TABLE test_permanent AS SELECT 1")
+
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "cannot create table in schema \"public\", which is synced from PostgreSQL")
+	})
+}
+
+func TestHandleNativeTableQueries(t *testing.T) {
+	t.Run("Creates a table, inserts into it and drops it", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestNativeTables(queryHandler)
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "CREATE TABLE test_native.test_rows (id int4 NOT NULL, name text, price numeric(10, 2), created_at timestamp)")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "CREATE TABLE")
+
+		messages, err = handleQuery(queryHandler, session, "INSERT INTO test_native.test_rows VALUES (1, 'one', 1.25, '2024-01-02 03:04:05'), (2, NULL, NULL, NULL)")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "INSERT 0 2")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT id, name, price, created_at FROM test_native.test_rows ORDER BY id")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testRowDescription(t, messages[0], []string{"id", "name", "price", "created_at"}, []string{Uint32ToString(pgtype.Int4OID), Uint32ToString(pgtype.TextOID), Uint32ToString(pgtype.NumericOID), Uint32ToString(pgtype.TimestampOID)})
+		testDataRowValues(t, messages[1], []string{"1", "one", "1.25", "2024-01-02 03:04:05"})
+		testDataRowValues(t, messages[2], []string{"2", "", "", ""})
+
+		messages, err = handleQuery(queryHandler, session, "INSERT INTO test_native.test_rows (id, name) SELECT int4_column, 'synced' FROM public.test_table WHERE int4_column IS NOT NULL")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "INSERT 0 1")
+		testNativeTableSnapshot(t, queryHandler, IcebergSchemaTable{Schema: "test_native", Table: "test_rows"}, 3, 3)
+
+		messages, err = handleQuery(queryHandler, session, "DROP TABLE test_native.test_rows")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "DROP TABLE")
+
+		_, err = handleQuery(queryHandler, session, "SELECT * FROM test_native.test_rows")
+		if err == nil {
+			t.Error("Expected an error for the dropped table, got nil")
+		}
+		if len(queryHandler.queryRemapper.remapperTable.NativeTables()) != 0 {
+			t.Errorf("Expected no native tables after the drop, got %v", queryHandler.queryRemapper.remapperTable.NativeTables())
+		}
+	})
+
+	t.Run("Creates a table from a query and inserts into it via the extended query protocol", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestNativeTables(queryHandler)
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "CREATE TABLE test_native.test_rows (id, name) AS SELECT int4_column, 'synced' FROM public.test_table WHERE int4_column IS NOT NULL")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "SELECT 1")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT id, name FROM test_native.test_rows")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testRowDescription(t, messages[0], []string{"id", "name"}, []string{Uint32ToString(pgtype.Int4OID), Uint32ToString(pgtype.TextOID)})
+		testDataRowValues(t, messages[1], []string{"2147483647", "synced"})
+
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "INSERT INTO test_native.test_rows VALUES ($1, $2)"})
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{Parameters: [][]byte{[]byte("1"), []byte("one")}}, preparedStatement)
+		describeMessages, _, _ := queryHandler.HandleDescribePortalQuery(session, portal)
+		testMessageTypes(t, describeMessages, []pgproto3.Message{&pgproto3.NoData{}})
+		messages = nil
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "INSERT 0 1")
+		testNativeTableSnapshot(t, queryHandler, IcebergSchemaTable{Schema: "test_native", Table: "test_rows"}, 2, 2)
+	})
+
+	t.Run("Loads rows with COPY FROM STDIN in the CSV and text formats", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestNativeTables(queryHandler)
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "CREATE TABLE test_native.test_rows (id int4, name text)")
+		testNoError(t, err)
+
+		session.receive = receiveCopyMessages(&pgproto3.CopyData{Data: []byte("id,name\n1,\"a, b\"\n2,")}, &pgproto3.CopyData{Data: []byte("\n3,\"\"\n")}, &pgproto3.CopyDone{})
+		messages, err := handleQuery(queryHandler, session, "COPY test_native.test_rows FROM STDIN WITH (FORMAT csv, HEADER)")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CopyInResponse{}, &pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[1], "COPY 3")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT id, name, name IS NULL FROM test_native.test_rows ORDER BY id")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.DataRow{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"1", "a, b", "false"})
+		testDataRowValues(t, messages[2], []string{"2", "", "true"})
+		testDataRowValues(t, messages[3], []string{"3", "", "false"})
+
+		_, err = handleQuery(queryHandler, session, "CREATE TABLE test_native.test_text_rows (id int4, name text)")
+		testNoError(t, err)
+		session.receive = receiveCopyMessages(&pgproto3.CopyData{Data: []byte("4\tx\\ty\n5\t\\N\n\\.\n")}, &pgproto3.CopyDone{})
+		messages, err = handleQuery(queryHandler, session, "COPY test_native.test_text_rows (id, name) FROM STDIN")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[1], "COPY 2")
+
+		messages, err = handleQuery(queryHandler, session, "SELECT id, name, name IS NULL FROM test_native.test_text_rows ORDER BY id")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"4", "x\ty", "false"})
+		testDataRowValues(t, messages[2], []string{"5", "", "true"})
+
+		session.receive = receiveCopyMessages(&pgproto3.CopyData{Data: []byte("6\n")}, &pgproto3.CopyFail{Message: "canceled by user"})
+		_, err = handleQuery(queryHandler, session, "COPY test_native.test_rows (id) FROM STDIN")
+		testPgError(t, err, PG_ERROR_CODE_QUERY_CANCELED, "COPY from stdin failed: canceled by user")
+	})
+
+	t.Run("Returns errors for unsupported tables and values", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		defer deleteTestNativeTables(queryHandler)
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "CREATE TABLE test_native.test_rows (id int4 NOT NULL)")
+		testNoError(t, err)
+
+		_, err = handleQuery(queryHandler, session, "INSERT INTO test_native.test_rows VALUES (1), (NULL)")
+		testPgError(t, err, PG_ERROR_CODE_NOT_NULL_VIOLATION, "null value in column \"id\" of relation \"test_rows\" violates not-null constraint")
+
+		_, err = handleQuery(queryHandler, session, "CREATE TABLE test_native.test_keys (id int4 PRIMARY KEY)")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "column constraints are not supported, only NOT NULL")
+
+		_, err = handleQuery(queryHandler, session, "CREATE TABLE test_native.test_rows (id int4)")
+		testPgError(t, err, PG_ERROR_CODE_DUPLICATE_TABLE, "relation \"test_rows\" already exists")
+
+		_, err = handleQuery(queryHandler, session, "COPY public.test_table FROM STDIN")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "COPY FROM STDIN is only supported for tables created with CREATE TABLE")
+
+		messages, err := handleQuery(queryHandler, session, "SELECT COUNT(*) FROM test_native.test_rows")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"0"})
+	})
+}
+
+func TestHandleCopyToQueries(t *testing.T) {
+	t.Run("Exports a query in the CSV format with a header", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), "COPY (SELECT id, name FROM (VALUES (1, 'a,b'), (2, NULL), (3, '')) t(id, name) ORDER BY id) TO STDOUT WITH (FORMAT csv, HEADER)")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{
+			&pgproto3.CopyOutResponse{},
+			&pgproto3.CopyData{},
+			&pgproto3.CopyData{},
+			&pgproto3.CopyData{},
+			&pgproto3.CopyData{},
+			&pgproto3.CopyDone{},
+			&pgproto3.CommandComplete{},
+		})
+		testCopyOutResponse(t, messages[0], 0, []uint16{0, 0})
+		testCopyData(t, messages[1:5], []string{"id,name\n", "1,\"a,b\"\n", "2,\n", "3,\"\"\n"})
+		testCommandCompleteTag(t, messages[6], "COPY 3")
+	})
+
+	t.Run("Exports a query in the text format with a delimiter and a NULL string", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), "COPY (SELECT id, name FROM (VALUES (1, E'a|b\\tc'), (2, NULL)) t(id, name) ORDER BY id) TO STDOUT WITH (DELIMITER '|', NULL 'NULL')")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CopyOutResponse{}, &pgproto3.CopyData{}, &pgproto3.CopyData{}, &pgproto3.CopyDone{}, &pgproto3.CommandComplete{}})
+		testCopyData(t, messages[1:3], []string{"1|a\\|b\\tc\n", "2|NULL\n"})
+		testCommandCompleteTag(t, messages[4], "COPY 2")
+	})
+
+	t.Run("Exports table columns in the default text format", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), "COPY public.test_table (int4_column, bool_column) TO STDOUT")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CopyOutResponse{}, &pgproto3.CopyData{}, &pgproto3.CopyData{}, &pgproto3.CopyDone{}, &pgproto3.CommandComplete{}})
+		testCopyData(t, messages[1:3], []string{"2147483647\ttrue\n", "\\N\tfalse\n"})
+		testCommandCompleteTag(t, messages[4], "COPY 2")
+	})
+
+	t.Run("Exports a query in the binary format", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), "COPY (SELECT 1::int4 AS id, NULL::text AS name) TO STDOUT (FORMAT binary)")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CopyOutResponse{}, &pgproto3.CopyData{}, &pgproto3.CopyData{}, &pgproto3.CopyData{}, &pgproto3.CopyDone{}, &pgproto3.CommandComplete{}})
+		testCopyOutResponse(t, messages[0], 1, []uint16{1, 1})
+		testCopyData(t, messages[1:4], []string{
+			"PGCOPY\n\377\r\n\000" + "\000\000\000\000" + "\000\000\000\000",
+			"\000\002" + "\000\000\000\004\000\000\000\001" + "\377\377\377\377",
+			"\377\377",
+		})
+		testCommandCompleteTag(t, messages[5], "COPY 1")
+	})
+
+	t.Run("Exports a query via the extended query protocol", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "COPY (SELECT 1 AS one) TO STDOUT"})
+		testNoError(t, err)
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{}, preparedStatement)
+		describeMessages, _, _ := queryHandler.HandleDescribePortalQuery(session, portal)
+		testMessageTypes(t, describeMessages, []pgproto3.Message{&pgproto3.NoData{}})
+		var messages []pgproto3.Message
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CopyOutResponse{}, &pgproto3.CopyData{}, &pgproto3.CopyDone{}, &pgproto3.CommandComplete{}})
+		testCopyData(t, messages[1:2], []string{"1\n"})
+		testCommandCompleteTag(t, messages[3], "COPY 1")
+	})
+
+	t.Run("Returns errors for unsupported options", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		_, err := handleQuery(queryHandler, NewSession(), "COPY (SELECT 1) TO STDOUT (FORMAT binary, HEADER)")
+		testPgError(t, err, PG_ERROR_CODE_SYNTAX_ERROR, "cannot specify HEADER in BINARY mode")
+
+		_, err = handleQuery(queryHandler, NewSession(), "COPY (SELECT 1) TO STDOUT (FORMAT csv, DELIMITER '||')")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "COPY delimiter must be a single one-byte character")
+
+		_, err = handleQuery(queryHandler, NewSession(), "COPY (SELECT 1) TO STDOUT (FORCE_QUOTE *)")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "COPY option \"force_quote\" is not supported")
+	})
+}
+
+func TestHandleExplainQueries(t *testing.T) {
+	t.Run("Returns the DuckDB plan and the scanned Iceberg data files", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), "EXPLAIN SELECT int4_column FROM public.test_table WHERE int4_column > 1")
+
+		testNoError(t, err)
+		testRowDescription(t, messages[0], []string{"QUERY PLAN"}, []string{Uint32ToString(pgtype.TextOID)})
+		planLines := testExplainPlanLines(t, messages)
+		if !strings.Contains(strings.Join(planLines, "\n"), "READ_PARQUET") {
+			t.Errorf("Expected the plan to read the Parquet files, got %v", strings.Join(planLines, "\n"))
+		}
+		testDataRowValues(t, messages[len(messages)-2], []string{"Iceberg Scan on public.test_table: 1 of 1 data files scanned, 0 pruned (2 records)"})
+		testCommandCompleteTag(t, messages[len(messages)-1], "EXPLAIN")
+	})
+
+	t.Run("Returns the DuckDB plan with the profiling information for ANALYZE", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		messages, err := handleQuery(queryHandler, NewSession(), "EXPLAIN (ANALYZE, VERBOSE false) SELECT COUNT(*) FROM test_table t1 JOIN test_table t2 ON t1.int4_column = t2.int4_column")
+
+		testNoError(t, err)
+		planLines := testExplainPlanLines(t, messages)
+		if !strings.Contains(strings.Join(planLines, "\n"), "Total Time:") {
+			t.Errorf("Expected the plan to include the total time, got %v", strings.Join(planLines, "\n"))
+		}
+		if planLines[len(planLines)-2] != "Iceberg Scan on public.test_table: 1 of 1 data files scanned, 0 pruned (2 records)" {
+			t.Errorf("Expected the plan to include the Iceberg scan, got %v", planLines[len(planLines)-2])
+		}
+		if !strings.HasPrefix(planLines[len(planLines)-1], "Execution Time: ") || !strings.HasSuffix(planLines[len(planLines)-1], " ms") {
+			t.Errorf("Expected the plan to end with the execution time, got %v", planLines[len(planLines)-1])
+		}
+	})
+
+	t.Run("Returns the DuckDB plan via the extended query protocol", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "EXPLAIN SELECT int4_column FROM public.test_table WHERE int4_column > $1::int4"})
+		testNoError(t, err)
+		_, portal, err := queryHandler.HandleBindQuery(session, &pgproto3.Bind{Parameters: [][]byte{[]byte("1")}}, preparedStatement)
+		testNoError(t, err)
+		describeMessages, _, _ := queryHandler.HandleDescribePortalQuery(session, portal)
+		testRowDescription(t, describeMessages[0], []string{"QUERY PLAN"}, []string{Uint32ToString(pgtype.TextOID)})
+		var messages []pgproto3.Message
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+
+		testNoError(t, err)
+		if _, ok := messages[0].(*pgproto3.DataRow); !ok {
+			t.Errorf("Expected the first message to be a data row, got %T", messages[0])
+		}
+		testDataRowValues(t, messages[len(messages)-2], []string{"Iceberg Scan on public.test_table: 1 of 1 data files scanned, 0 pruned (2 records)"})
+		testCommandCompleteTag(t, messages[len(messages)-1], "EXPLAIN")
+	})
+
+	t.Run("Returns errors for unsupported options and statements", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+
+		_, err := handleQuery(queryHandler, NewSession(), "EXPLAIN (FORMAT JSON) SELECT 1")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "EXPLAIN format \"json\" is not supported")
+
+		_, err = handleQuery(queryHandler, NewSession(), "EXPLAIN (PLAN true) SELECT 1")
+		testPgError(t, err, PG_ERROR_CODE_SYNTAX_ERROR, "unrecognized EXPLAIN option \"plan\"")
+
+		_, err = handleQuery(queryHandler, NewSession(), "EXPLAIN INSERT INTO public.test_table (int4_column) VALUES (1)")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "EXPLAIN only supports SELECT queries")
+	})
+}
+
+func TestHandlePreparedStatementQueries(t *testing.T) {
+	t.Run("Prepares and executes a statement with arguments", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		messages, err := handleQuery(queryHandler, session, "PREPARE find_rows (int) AS SELECT int4_column, $1 + 1 AS next FROM public.test_table WHERE int4_column > $1")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[0], "PREPARE")
+
+		messages, err = handleQuery(queryHandler, session, "EXECUTE find_rows(1)")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testRowDescription(t, messages[0], []string{"int4_column", "next"}, []string{Uint32ToString(pgtype.Int4OID), Uint32ToString(pgtype.Int4OID)})
+		testDataRowValues(t, messages[1], []string{"2147483647", "2"})
+		testCommandCompleteTag(t, messages[2], "SELECT 1")
+
+		messages, err = handleQuery(queryHandler, session, "EXECUTE find_rows('2147483647')")
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.CommandComplete{}})
+		testCommandCompleteTag(t, messages[1], "SELECT 0")
+	})
+
+	t.Run("Lists the session's prepared statements in pg_prepared_statements", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "PREPARE one AS SELECT 1")
+		testNoError(t, err)
+		_, err = handleQuery(queryHandler, session, "PREPARE concat_x (text) AS SELECT $1 || 'x'")
+		testNoError(t, err)
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Name: "parsed", Query: "SELECT $1::int4"})
+		testNoError(t, err)
+		session.preparedStatements["parsed"] = preparedStatement
+
+		messages, err := handleQuery(queryHandler, session, "SELECT name, statement, parameter_types, from_sql FROM pg_catalog.pg_prepared_statements ORDER BY prepare_time")
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.RowDescription{}, &pgproto3.DataRow{}, &pgproto3.DataRow{}, &pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[1], []string{"one", "PREPARE one AS SELECT 1", "{}", "true"})
+		testDataRowValues(t, messages[2], []string{"concat_x", "PREPARE concat_x(text) AS SELECT $1 || 'x'", "{text}", "true"})
+		testDataRowValues(t, messages[3], []string{"parsed", "SELECT $1::int4", "{int4}", "false"})
+
+		_, err = handleQuery(queryHandler, session, "DEALLOCATE PREPARE one")
+		testNoError(t, err)
+		messages, err = handleQuery(queryHandler, session, "SELECT COUNT(*) FROM pg_prepared_statements")
+		testNoError(t, err)
+		testDataRowValues(t, messages[1], []string{"2"})
+	})
+
+	t.Run("Deallocates prepared statements", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "PREPARE one AS SELECT 1")
+		testNoError(t, err)
+		_, err = handleQuery(queryHandler, session, "PREPARE two AS SELECT 2")
+		testNoError(t, err)
+
+		messages, err := handleQuery(queryHandler, session, "DEALLOCATE one")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "DEALLOCATE")
+		_, err = handleQuery(queryHandler, session, "EXECUTE one")
+		testPgError(t, err, PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME, "prepared statement \"one\" does not exist")
+
+		messages, err = handleQuery(queryHandler, session, "DEALLOCATE ALL")
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "DEALLOCATE ALL")
+		if len(session.preparedStatements) != 0 {
+			t.Errorf("Expected no prepared statements, got %v", len(session.preparedStatements))
+		}
+	})
+
+	t.Run("Prepares and executes statements via the extended query protocol", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "PREPARE add_one (int) AS SELECT $1 + 1 AS next"})
+		testNoError(t, err)
+		describeMessages, err := queryHandler.HandleDescribeStatementQuery(session, preparedStatement)
+		testNoError(t, err)
+		testParameterDescription(t, describeMessages[0], []uint32{})
+		_, portal, _ := queryHandler.HandleBindQuery(session, &pgproto3.Bind{}, preparedStatement)
+		var messages []pgproto3.Message
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+		testNoError(t, err)
+		testCommandCompleteTag(t, messages[0], "PREPARE")
+
+		_, preparedStatement, err = queryHandler.HandleParseQuery(session, &pgproto3.Parse{Query: "EXECUTE add_one($1)"})
+		testNoError(t, err)
+		_, portal, err = queryHandler.HandleBindQuery(session, &pgproto3.Bind{Parameters: [][]byte{[]byte("41")}}, preparedStatement)
+		testNoError(t, err)
+		describeMessages, _, err = queryHandler.HandleDescribePortalQuery(session, portal)
+		testNoError(t, err)
+		testRowDescription(t, describeMessages[0], []string{"next"}, []string{Uint32ToString(pgtype.Int4OID)})
+		messages = nil
+		err = queryHandler.HandleExecuteQuery(session, &pgproto3.Execute{}, portal, collectMessages(&messages))
+
+		testNoError(t, err)
+		testMessageTypes(t, messages, []pgproto3.Message{&pgproto3.DataRow{}, &pgproto3.CommandComplete{}})
+		testDataRowValues(t, messages[0], []string{"42"})
+		testCommandCompleteTag(t, messages[1], "SELECT 1")
+	})
+
+	t.Run("Returns errors for invalid prepared statements", func(t *testing.T) {
+		queryHandler := initQueryHandler()
+		session := NewSession()
+		_, err := handleQuery(queryHandler, session, "PREPARE one AS SELECT 1")
+		testNoError(t, err)
+
+		_, err = handleQuery(queryHandler, session, "PREPARE one AS SELECT 2")
+		testPgError(t, err, PG_ERROR_CODE_DUPLICATE_PREPARED_STATEMENT, "prepared statement \"one\" already exists")
+
+		_, err = handleQuery(queryHandler, session, "EXECUTE one(1)")
+		testPgError(t, err, PG_ERROR_CODE_SYNTAX_ERROR, "wrong number of parameters for prepared statement \"one\"")
+
+		_, err = handleQuery(queryHandler, session, "DEALLOCATE two")
+		testPgError(t, err, PG_ERROR_CODE_INVALID_SQL_STATEMENT_NAME, "prepared statement \"two\" does not exist")
+
+		_, err = handleQuery(queryHandler, session, "PREPARE insert_row AS INSERT INTO public.test_table (int4_column) VALUES (1)")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "PREPARE only supports SELECT queries")
+
+		_, err = handleQuery(queryHandler, session, "PREPARE unknown_type (unknown_type) AS SELECT $1")
+		testPgError(t, err, PG_ERROR_CODE_UNDEFINED_OBJECT, "type \"unknown_type\" does not exist")
+		if _, ok := session.preparedStatements["unknown_type"]; ok {
+			t.Errorf("Expected the statement with an unknown type not to be prepared")
+		}
+
+		_, preparedStatement, err := queryHandler.HandleParseQuery(session, &pgproto3.Parse{Name: "begin", Query: "BEGIN"})
+		testNoError(t, err)
+		session.preparedStatements["begin"] = preparedStatement
+		_, err = handleQuery(queryHandler, session, "EXECUTE begin")
+		testPgError(t, err, PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, "EXECUTE only supports prepared SELECT queries")
+	})
+}
+
+var ORM_AND_BI_QUERIES = []string{
+	// Prisma
+	`SELECT namespace.nspname AS namespace, table_info.relname AS table_name FROM pg_class AS table_info JOIN pg_namespace AS namespace ON namespace.oid = table_info.relnamespace WHERE table_info.relkind IN ('r', 'p') AND namespace.nspname = ANY(ARRAY['public']) ORDER BY namespace, table_name`,
+	// SQLAlchemy
+	`SELECT pg_catalog.pg_class.relname FROM pg_catalog.pg_class JOIN pg_catalog.pg_namespace ON pg_catalog.pg_namespace.oid = pg_catalog.pg_class.relnamespace WHERE pg_catalog.pg_class.relkind = ANY (ARRAY['r', 'p']) AND pg_catalog.pg_class.relpersistence != 't' AND pg_catalog.pg_namespace.nspname = 'public' ORDER BY pg_catalog.pg_class.relname`,
+	// Rails
+	`SELECT c.relname FROM pg_class c LEFT JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = ANY (current_schemas(false)) AND c.relkind IN ('r','p')`,
+	// DBeaver
+	`SELECT n.oid,n.*,d.description FROM pg_catalog.pg_namespace n LEFT OUTER JOIN pg_catalog.pg_description d ON d.objoid=n.oid AND d.objsubid=0 AND d.classoid='pg_namespace'::regclass ORDER BY nspname`,
+	// Metabase
+	`SELECT n.nspname AS schema, c.relname AS name, CASE c.relkind WHEN 'r' THEN 'TABLE' WHEN 'p' THEN 'PARTITIONED TABLE' WHEN 'v' THEN 'VIEW' WHEN 'f' THEN 'FOREIGN TABLE' WHEN 'm' THEN 'MATERIALIZED VIEW' ELSE NULL END AS type, d.description AS description, stat.n_live_tup AS estimated_row_count FROM pg_catalog.pg_class c INNER JOIN pg_catalog.pg_namespace n ON c.relnamespace = n.oid LEFT JOIN pg_catalog.pg_description d ON c.oid = d.objoid AND d.objsubid = 0 LEFT JOIN pg_stat_user_tables stat ON c.oid = stat.relid WHERE c.relnamespace = n.oid AND n.nspname !~ '^information_schema|catalog_history|pg_' AND c.relkind IN ('r', 'p', 'v', 'f', 'm') AND n.nspname IN ('public') ORDER BY type, schema, name`,
+	// Grafana
+	`SELECT quote_ident(table_name) FROM information_schema.tables WHERE table_schema = 'public' ORDER BY table_name`,
+	// psql \dt
+	`SELECT n.nspname as "Schema", c.relname as "Name", CASE c.relkind WHEN 'r' THEN 'table' WHEN 'v' THEN 'view' WHEN 'm' THEN 'materialized view' WHEN 'i' THEN 'index' WHEN 'S' THEN 'sequence' WHEN 't' THEN 'TOAST table' WHEN 'f' THEN 'foreign table' WHEN 'p' THEN 'partitioned table' WHEN 'I' THEN 'partitioned index' END as "Type", pg_catalog.pg_get_userbyid(c.relowner) as "Owner" FROM pg_catalog.pg_class c LEFT JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace LEFT JOIN pg_catalog.pg_am am ON am.oid = c.relam WHERE c.relkind IN ('r','p','') AND n.nspname <> 'pg_catalog' AND n.nspname !~ '^pg_toast' AND n.nspname <> 'information_schema' AND pg_catalog.pg_table_is_visible(c.oid) ORDER BY 1,2`,
+	// HAVING
+	`SELECT relkind, COUNT(*) AS count FROM pg_class GROUP BY relkind HAVING COUNT(*) > 0 AND pg_backend_pid() = '0'`,
+	// GROUP BY
+	`SELECT pg_get_userbyid(relowner) AS owner, COUNT(*) AS count FROM pg_class GROUP BY pg_get_userbyid(relowner)`,
+	// ORDER BY
+	`SELECT c.relname FROM pg_class c ORDER BY pg_total_relation_size(c.oid) DESC, c.relname LIMIT 1`,
+	// WINDOW
+	`SELECT relname, ROW_NUMBER() OVER (PARTITION BY relnamespace ORDER BY pg_total_relation_size(oid)) AS row_number FROM pg_class`,
+	// LIMIT
+	`SELECT relname FROM pg_class LIMIT (SELECT COUNT(*) FROM test_table)`,
+	// INTERSECT
+	`SELECT nspname FROM pg_namespace INTERSECT SELECT schema_name FROM information_schema.schemata`,
+	// EXCEPT
+	`SELECT nspname FROM pg_namespace EXCEPT SELECT 'public'`,
+	// LATERAL
+	`SELECT n.nspname, t.count FROM pg_namespace n, LATERAL (SELECT COUNT(*) AS count FROM pg_class c WHERE c.relnamespace = n.oid) t`,
+	// Multiple FROM items with a JOIN
+	`SELECT c.relname, a.attname FROM pg_namespace n, pg_class c JOIN pg_attribute a ON a.attrelid = c.oid WHERE n.oid = c.relnamespace AND n.nspname = 'public' ORDER BY a.attnum`,
+	// Function arguments
+	`SELECT COALESCE(version(), '') AS version, upper(pg_get_userbyid(10)) AS owner`,
+	// Type cast in ORDER BY
+	`SELECT relname FROM pg_class ORDER BY oid = 'test_table'::regclass DESC LIMIT 1`,
+	// Nested CTE in a subquery
+	`SELECT * FROM (SELECT (WITH t AS (SELECT int4_column FROM test_table) SELECT COUNT(*) FROM t) AS count) s`,
+	// Rails columns
+	`SELECT a.attname, format_type(a.atttypid, a.atttypmod) AS type, pg_get_expr(d.adbin, d.adrelid) AS default, a.attnotnull FROM pg_attribute a LEFT JOIN pg_attrdef d ON a.attrelid = d.adrelid AND a.attnum = d.adnum WHERE a.attrelid = '"test_table"'::regclass AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum`,
+	// Rails types
+	`SELECT t.oid, t.typname FROM pg_type t WHERE t.typname IN ('int2', 'int4', 'int8', 'oid', 'float4', 'float8', 'bool')`,
+	// Rails indexes
+	`SELECT i.relname AS index_name, ix.indisunique FROM pg_class t, pg_class i, pg_index ix WHERE t.oid = ix.indrelid AND i.oid = ix.indexrelid AND t.relname = 'test_table'`,
+}
+
+func TestHandleOrmAndBiQueries(t *testing.T) {
+	for _, query := range ORM_AND_BI_QUERIES {
+		t.Run(query, func(t *testing.T) {
+			queryHandler := initQueryHandler()
+
+			messages, err := handleQuery(queryHandler, NewSession(), query)
+
+			testNoError(t, err)
+			if len(messages) == 0 {
+				t.Fatalf("Expected messages, got none")
+			}
+			if _, ok := messages[0].(*pgproto3.RowDescription); !ok {
+				t.Errorf("Expected a RowDescription, got %T", messages[0])
+			}
+		})
+	}
+}
+
+func TestRemapNestedClauses(t *testing.T) {
+	remappedPgShadow := "(VALUES ('bemidb'::text, '10'::oid, 'FALSE'::bool, 'FALSE'::bool, 'TRUE'::bool, 'FALSE'::bool, 'bemidb-encrypted'::text, NULL, NULL)) pg_shadow(usename, usesysid, usecreatedb, usesuper, userepl, usebypassrls, passwd, valuntil, useconfig)"
+
+	for _, clause := range []struct {
+		name     string
+		query    string
+		remapped string // PG_SHADOW is replaced with the remapped pg_shadow table
+		values   []string
+	}{
+		{
+			name:     "HAVING",
+			query:    "SELECT bool_column, COUNT(*) AS count FROM public.test_table GROUP BY bool_column HAVING bool_column IN (SELECT usesuper FROM pg_shadow)",
+			remapped: "SELECT bool_column, count(*) AS count FROM public.test_table GROUP BY bool_column HAVING bool_column IN (SELECT usesuper FROM PG_SHADOW)",
+			values:   []string{"false", "1"},
+		},
+		{
+			name:     "GROUP BY",
+			query:    "SELECT COUNT(*) AS count FROM public.test_table GROUP BY (SELECT usename FROM pg_shadow)",
+			remapped: "SELECT count(*) AS count FROM public.test_table GROUP BY (SELECT usename FROM PG_SHADOW)",
+			values:   []string{"2"},
+		},
+		{
+			name:     "LATERAL",
+			query:    "SELECT s.usename FROM (SELECT 1) t, LATERAL (SELECT usename FROM pg_shadow) s",
+			remapped: "SELECT s.usename FROM (SELECT 1) t, LATERAL (SELECT usename FROM PG_SHADOW) s",
+			values:   []string{"bemidb"},
+		},
+		{
+			name:     "Scalar subquery",
+			query:    "SELECT (SELECT usename FROM pg_shadow) AS usename",
+			remapped: "SELECT (SELECT usename FROM PG_SHADOW) AS usename",
+			values:   []string{"bemidb"},
+		},
+		{
+			name:     "EXISTS subquery",
+			query:    "SELECT 1 AS one WHERE EXISTS (SELECT 1 FROM pg_shadow WHERE usename = 'bemidb')",
+			remapped: "SELECT 1 AS one WHERE EXISTS (SELECT 1 FROM PG_SHADOW WHERE usename = 'bemidb')",
+			values:   []string{"1"},
+		},
+		{
+			name:     "CTE",
+			query:    "WITH u AS (SELECT usename FROM pg_shadow) SELECT usename FROM u",
+			remapped: "WITH u AS (SELECT usename FROM PG_SHADOW) SELECT usename FROM u",
+			values:   []string{"bemidb"},
+		},
+		{
+			name:     "ORDER BY",
+			query:    "SELECT 1 AS one ORDER BY (SELECT usename FROM pg_shadow)",
+			remapped: "SELECT 1 AS one ORDER BY (SELECT usename FROM PG_SHADOW)",
+			values:   []string{"1"},
+		},
+	} {
+		t.Run(clause.name, func(t *testing.T) {
+			queryHandler := initQueryHandler()
+			queryTree, err := pgQuery.Parse(clause.query)
+			testNoError(t, err)
+
+			remappedStatements, err := queryHandler.queryRemapper.RemapStatements(queryTree.Stmts)
+			testNoError(t, err)
+			remappedQuery, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: remappedStatements})
+			testNoError(t, err)
+
+			expectedQuery := strings.ReplaceAll(clause.remapped, "PG_SHADOW", remappedPgShadow)
+			if remappedQuery != expectedQuery {
+				t.Errorf("Expected the remapped query to be %s, got %s", expectedQuery, remappedQuery)
+			}
+
+			messages, err := handleQuery(queryHandler, NewSession(), clause.query)
+			testNoError(t, err)
+			testDataRowValues(t, messages[1], clause.values)
+		})
+	}
+}
+
+// Remapped queries must deparse to SQL that parses again, whatever the shape of the query tree,
+// and system tables that are always replaced must not be left anywhere in the tree
+func FuzzRemapStatements(f *testing.F) {
+	for _, query := range ORM_AND_BI_QUERIES {
+		f.Add(query)
+	}
+	queryHandler := initQueryHandler()
+
+	f.Fuzz(func(t *testing.T, query string) {
+		queryTree, err := pgQuery.Parse(query)
+		if err != nil {
+			t.Skip()
+		}
+
+		remappedStatements, err := queryHandler.queryRemapper.RemapStatements(queryTree.Stmts)
+		if err != nil {
+			t.Skip() // Unsupported query types
+		}
+
+		remappedQuery, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: remappedStatements})
+		if err != nil {
+			t.Fatalf("Couldn't deparse the remapped query %s: %v", query, err)
+		}
+		remappedQueryTree, err := pgQuery.Parse(remappedQuery)
+		if err != nil {
+			t.Fatalf("Couldn't parse the remapped query %s: %v", remappedQuery, err)
+		}
+
+		walkQueryTree(remappedQueryTree.ProtoReflect(), func(node protoreflect.Message) {
+			rangeVar, ok := node.Interface().(*pgQuery.RangeVar)
+			if ok && (rangeVar.Schemaname == "" || rangeVar.Schemaname == PG_SCHEMA_PG_CATALOG) &&
+				(rangeVar.Relname == PG_TABLE_PG_SHADOW || rangeVar.Relname == PG_TABLE_PG_ROLES || rangeVar.Relname == PG_TABLE_PG_USER) {
+				t.Errorf("Expected %s to be remapped in %s", rangeVar.Relname, remappedQuery)
+			}
+		})
+	})
+}
+
+func initQueryHandler() *QueryHandler {
+	config := loadTestConfig()
+	duckdb := NewDuckdb(config)
+	icebergReader := NewIcebergReader(config)
+	return NewQueryHandler(config, duckdb, icebergReader)
+}
+
+func deleteTestViewDefinitions(queryHandler *QueryHandler) {
+	os.Remove(filepath.Join(queryHandler.config.StoragePath, VIEW_DEFINITIONS_FILE_NAME))
+}
+
+func deleteTestMaterializedView(queryHandler *QueryHandler, table string) {
+	deleteTestViewDefinitions(queryHandler)
+	os.RemoveAll(filepath.Join(queryHandler.config.StoragePath, PG_SCHEMA_PUBLIC, table))
+}
+
+func deleteTestNativeTables(queryHandler *QueryHandler) {
+	os.Remove(filepath.Join(queryHandler.config.StoragePath, NATIVE_TABLES_FILE_NAME))
+	os.RemoveAll(filepath.Join(queryHandler.config.StoragePath, "test_native"))
+}
+
+// Appended snapshots keep the data files of the previous ones
+func testNativeTableSnapshot(t *testing.T, queryHandler *QueryHandler, schemaTable IcebergSchemaTable, expectedTotalRecords int64, expectedTotalDataFiles int64) {
+	storage := NewStorage(queryHandler.config)
+	version, err := storage.MetadataVersion(schemaTable)
+	testNoError(t, err)
+	snapshot, err := storage.CurrentSnapshot(schemaTable, version)
+	testNoError(t, err)
+
+	if snapshot.TotalRecords != expectedTotalRecords {
+		t.Errorf("Expected %v total records, got %v", expectedTotalRecords, snapshot.TotalRecords)
+	}
+	if snapshot.TotalDataFiles != expectedTotalDataFiles {
+		t.Errorf("Expected %v total data files, got %v", expectedTotalDataFiles, snapshot.TotalDataFiles)
+	}
+	if int64(len(snapshot.ManifestListRecords)) != expectedTotalDataFiles {
+		t.Errorf("Expected %v manifest list records, got %v", expectedTotalDataFiles, len(snapshot.ManifestListRecords))
+	}
+}
+
+// Client messages of COPY FROM STDIN
+func receiveCopyMessages(messages ...pgproto3.FrontendMessage) func() (pgproto3.FrontendMessage, error) {
+	return func() (pgproto3.FrontendMessage, error) {
+		message := messages[0]
+		messages = messages[1:]
+		return message, nil
+	}
+}
+
+func handleQuery(queryHandler *QueryHandler, session *Session, query string) ([]pgproto3.Message, error) {
+	var messages []pgproto3.Message
+	err := queryHandler.HandleQuery(session, query, collectMessages(&messages))
+	return messages, err
+}
+
+func handleExecuteQuery(queryHandler *QueryHandler, message *pgproto3.Execute, portal *Portal) ([]pgproto3.Message, error) {
+	var messages []pgproto3.Message
+	err := queryHandler.HandleExecuteQuery(NewSession(), message, portal, collectMessages(&messages))
+	return messages, err
+}
+
+func collectMessages(messages *[]pgproto3.Message) MessageWriter {
+	return func(batch ...pgproto3.Message) error {
+		*messages = append(*messages, batch...)
+		return nil
+	}
+}
+
+func testNoError(t *testing.T, err error) {
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func testPgError(t *testing.T, err error, expectedCode string, expectedMessage string) {
+	var pgError *PgError
+	if !errors.As(err, &pgError) {
+		t.Fatalf("Expected a Postgres error, got %v", err)
+	}
+	if pgError.Code != expectedCode {
+		t.Errorf("Expected the error code to be %v, got %v", expectedCode, pgError.Code)
+	}
+	if pgError.Message != expectedMessage {
+		t.Errorf("Expected the error message to be %v, got %v", expectedMessage, pgError.Message)
+	}
+}
+
+func testMessageTypes(t *testing.T, messages []pgproto3.Message, expectedTypes []pgproto3.Message) {
+	if len(messages) != len(expectedTypes) {
+		t.Errorf("Expected %v messages, got %v", len(expectedTypes), len(messages))
+	}
+
+	for i, expectedType := range expectedTypes {
+		if reflect.TypeOf(messages[i]) != reflect.TypeOf(expectedType) {
+			t.Errorf("Expected the %v message to be a %v", i, expectedType)
+		}
+	}
+}
+
+func testRowDescription(t *testing.T, rowDescriptionMessage pgproto3.Message, expectedColumnNames []string, expectedColumnTypes []string) {
+	rowDescription := rowDescriptionMessage.(*pgproto3.RowDescription)
+
+	if len(rowDescription.Fields) != len(expectedColumnNames) {
+		t.Errorf("Expected %v row description fields, got %v", len(expectedColumnNames), len(rowDescription.Fields))
+	}
+
+	for i, expectedColumnName := range expectedColumnNames {
+		if string(rowDescription.Fields[i].Name) != expectedColumnName {
+			t.Errorf("Expected the %v row description field to be %v, got %v", i, expectedColumnName, string(rowDescription.Fields[i].Name))
+		}
+	}
+
+	for i, expectedColumnType := range expectedColumnTypes {
+		if Uint32ToString(rowDescription.Fields[i].DataTypeOID) != expectedColumnType {
+			t.Errorf("Expected the %v row description field data type to be %v, got %v", i, expectedColumnType, Uint32ToString(rowDescription.Fields[i].DataTypeOID))
+		}
+	}
+}
+
+func testParameterDescription(t *testing.T, parameterDescriptionMessage pgproto3.Message, expectedParameterOids []uint32) {
+	parameterDescription := parameterDescriptionMessage.(*pgproto3.ParameterDescription)
+
+	if !reflect.DeepEqual(parameterDescription.ParameterOIDs, expectedParameterOids) {
+		t.Errorf("Expected the parameter OIDs to be %v, got %v", expectedParameterOids, parameterDescription.ParameterOIDs)
+	}
+}
+
+func testBinaryValue(t *testing.T, typeMap *pgtype.Map, oid uint32, value []byte, target interface{}) {
+	err := typeMap.Scan(oid, pgtype.BinaryFormatCode, value, target)
+	if err != nil {
+		t.Errorf("Expected the binary value to be decodable as %v, got %v", oid, err)
+	}
+}
+
+func testDataRowValues(t *testing.T, dataRowMessage pgproto3.Message, expectedValues []string) {
+	dataRow := dataRowMessage.(*pgproto3.DataRow)
 
 	if len(dataRow.Values) != len(expectedValues) {
 		t.Errorf("Expected %v data row values, got %v", len(expectedValues), len(dataRow.Values))
@@ -1327,6 +3519,38 @@ func testDataRowValues(t *testing.T, dataRowMessage pgproto3.Message, expectedVa
 	}
 }
 
+func testCopyOutResponse(t *testing.T, message pgproto3.Message, expectedOverallFormat byte, expectedColumnFormatCodes []uint16) {
+	copyOutResponse := message.(*pgproto3.CopyOutResponse)
+	if copyOutResponse.OverallFormat != expectedOverallFormat {
+		t.Errorf("Expected the overall format to be %v, got %v", expectedOverallFormat, copyOutResponse.OverallFormat)
+	}
+	if !reflect.DeepEqual(copyOutResponse.ColumnFormatCodes, expectedColumnFormatCodes) {
+		t.Errorf("Expected the column format codes to be %v, got %v", expectedColumnFormatCodes, copyOutResponse.ColumnFormatCodes)
+	}
+}
+
+func testCopyData(t *testing.T, messages []pgproto3.Message, expectedData []string) {
+	for i, message := range messages {
+		copyData := message.(*pgproto3.CopyData)
+		if string(copyData.Data) != expectedData[i] {
+			t.Errorf("Expected the %v copy data to be %q, got %q", i, expectedData[i], string(copyData.Data))
+		}
+	}
+}
+
+func testExplainPlanLines(t *testing.T, messages []pgproto3.Message) []string {
+	var planLines []string
+	for _, message := range messages {
+		if dataRow, ok := message.(*pgproto3.DataRow); ok {
+			planLines = append(planLines, string(dataRow.Values[0]))
+		}
+	}
+	if len(planLines) < 2 {
+		t.Fatalf("Expected the plan to have multiple lines, got %v", planLines)
+	}
+	return planLines
+}
+
 func testCommandCompleteTag(t *testing.T, message pgproto3.Message, expectedTag string) {
 	commandComplete := message.(*pgproto3.CommandComplete)
 	if string(commandComplete.CommandTag) != expectedTag {
@@ -1334,6 +3558,24 @@ func testCommandCompleteTag(t *testing.T, message pgproto3.Message, expectedTag
 	}
 }
 
+func testPgClassOid(t *testing.T, queryHandler *QueryHandler, table string) uint32 {
+	messages, err := handleQuery(queryHandler, NewSession(), "SELECT oid FROM pg_catalog.pg_class WHERE relname = '"+table+"'")
+	testNoError(t, err)
+	oid, err := strconv.ParseUint(string(messages[1].(*pgproto3.DataRow).Values[0]), 10, 32)
+	testNoError(t, err)
+	return uint32(oid)
+}
+
+func testColumnAttributeNumber(columnName string) uint16 {
+	for _, pgSchemaColumn := range TEST_PG_SCHEMA_COLUMNS {
+		if pgSchemaColumn.ColumnName == columnName {
+			attributeNumber, _ := StringToInt(pgSchemaColumn.OrdinalPosition)
+			return uint16(attributeNumber)
+		}
+	}
+	return 0
+}
+
 func Uint32ToString(i uint32) string {
 	return strconv.FormatUint(uint64(i), 10)
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+var errInFailedTransaction = &PgError{
+	Code:    PG_ERROR_CODE_IN_FAILED_SQL_TRANSACTION,
+	Message: "current transaction is aborted, commands ignored until end of transaction block",
+}
+
+func isTransactionStatement(node *pgQuery.Node) bool {
+	return node.GetTransactionStmt() != nil
+}
+
+// Statements other than ending the transaction are rejected after an error within a transaction block
+func checkFailedTransaction(session *Session, node *pgQuery.Node) error {
+	if session.transaction == nil || !session.transaction.failed {
+		return nil
+	}
+	switch node.GetTransactionStmt().GetKind() {
+	case pgQuery.TransactionStmtKind_TRANS_STMT_COMMIT, pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK, pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK_TO:
+		return nil
+	}
+	return errInFailedTransaction
+}
+
+// BEGIN, START TRANSACTION, COMMIT, ROLLBACK, SAVEPOINT, RELEASE, ROLLBACK TO
+func (queryHandler *QueryHandler) handleTransactionQuery(session *Session, node *pgQuery.Node, writer MessageWriter) error {
+	transactionStatement := node.GetTransactionStmt()
+
+	var messages []pgproto3.Message
+	tag := commandTag(node)
+
+	switch transactionStatement.Kind {
+	case pgQuery.TransactionStmtKind_TRANS_STMT_BEGIN, pgQuery.TransactionStmtKind_TRANS_STMT_START:
+		if session.transaction != nil {
+			messages = append(messages, transactionWarning(PG_ERROR_CODE_ACTIVE_SQL_TRANSACTION, "there is already a transaction in progress"))
+		} else {
+			session.transaction = NewTransaction()
+		}
+
+	case pgQuery.TransactionStmtKind_TRANS_STMT_COMMIT, pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK:
+		if session.transaction != nil && session.transaction.failed {
+			tag = "ROLLBACK" // COMMIT of a failed transaction
+		}
+		if session.transaction == nil {
+			messages = append(messages, transactionWarning(PG_ERROR_CODE_NO_ACTIVE_SQL_TRANSACTION, "there is no transaction in progress"))
+		} else {
+			commit := transactionStatement.Kind == pgQuery.TransactionStmtKind_TRANS_STMT_COMMIT && !session.transaction.failed
+			queryHandler.endSnapshotTransaction(session, commit)
+		}
+		session.transaction = nil
+		session.closePortals()
+		session.closeCursors()
+		if transactionStatement.Chain {
+			session.transaction = NewTransaction()
+		}
+
+	case pgQuery.TransactionStmtKind_TRANS_STMT_SAVEPOINT:
+		if session.transaction == nil {
+			return noTransactionError("SAVEPOINT")
+		}
+		session.transaction.savepoints = append(session.transaction.savepoints, transactionStatement.SavepointName)
+
+	case pgQuery.TransactionStmtKind_TRANS_STMT_RELEASE, pgQuery.TransactionStmtKind_TRANS_STMT_ROLLBACK_TO:
+		if session.transaction == nil {
+			if transactionStatement.Kind == pgQuery.TransactionStmtKind_TRANS_STMT_RELEASE {
+				return noTransactionError("RELEASE SAVEPOINT")
+			}
+			return noTransactionError("ROLLBACK TO SAVEPOINT")
+		}
+
+		// The most recent savepoint with the name, later savepoints are discarded
+		index := -1
+		for i := len(session.transaction.savepoints) - 1; i >= 0; i-- {
+			if session.transaction.savepoints[i] == transactionStatement.SavepointName {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return &PgError{
+				Code:    PG_ERROR_CODE_INVALID_SAVEPOINT_SPECIFICATION,
+				Message: "savepoint \"" + transactionStatement.SavepointName + "\" does not exist",
+			}
+		}
+
+		if transactionStatement.Kind == pgQuery.TransactionStmtKind_TRANS_STMT_RELEASE {
+			session.transaction.savepoints = session.transaction.savepoints[:index]
+		} else {
+			session.transaction.savepoints = session.transaction.savepoints[:index+1]
+			if session.transaction.failed {
+				// The DuckDB transaction may have been aborted by the error, so the next query starts a new snapshot
+				queryHandler.endSnapshotTransaction(session, false)
+			}
+			session.transaction.failed = false // Reads can't be undone, so rolling back only recovers from errors
+		}
+
+	default:
+		return errors.New("unsupported transaction query: " + tag)
+	}
+
+	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte(tag)})
+	return writer(messages...)
+}
+
+// Starts a DuckDB transaction on the session's connection with the first query of a transaction block. DuckDB views
+// are versioned, so each Iceberg table is read from the same snapshot (metadata file version) until the block ends,
+// and syncs that complete in the meantime aren't visible.
+func (queryHandler *QueryHandler) snapshotTransaction(session *Session) error {
+	if session.transaction == nil || session.transaction.snapshotStarted {
+		return nil
+	}
+
+	duckdb, err := queryHandler.sessionDuckdb(session)
+	if err != nil {
+		return err
+	}
+	_, err = duckdb.ExecContext(context.Background(), "BEGIN TRANSACTION", nil)
+	if err != nil {
+		return err
+	}
+	session.transaction.snapshotStarted = true
+	return nil
+}
+
+func (queryHandler *QueryHandler) endSnapshotTransaction(session *Session, commit bool) {
+	if !session.transaction.snapshotStarted || session.duckdb == nil {
+		return
+	}
+
+	query := "ROLLBACK"
+	if commit {
+		query = "COMMIT"
+	}
+	_, err := session.duckdb.ExecContext(context.Background(), query, nil)
+	if err != nil {
+		LogWarn(queryHandler.config, "Couldn't end the DuckDB transaction:", err.Error())
+	}
+	session.transaction.snapshotStarted = false
+}
+
+func transactionWarning(code string, message string) *pgproto3.NoticeResponse {
+	return &pgproto3.NoticeResponse{Severity: "WARNING", Code: code, Message: message}
+}
+
+func noTransactionError(statementName string) error {
+	return &PgError{
+		Code:    PG_ERROR_CODE_NO_ACTIVE_SQL_TRANSACTION,
+		Message: statementName + " can only be used in transaction blocks",
+	}
+}
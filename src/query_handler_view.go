@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+func isViewStatement(node *pgQuery.Node) bool {
+	return node.GetViewStmt() != nil ||
+		node.GetCreateTableAsStmt().GetObjtype() == pgQuery.ObjectType_OBJECT_MATVIEW ||
+		node.GetRefreshMatViewStmt() != nil ||
+		node.GetDropStmt().GetRemoveType() == pgQuery.ObjectType_OBJECT_VIEW ||
+		node.GetDropStmt().GetRemoveType() == pgQuery.ObjectType_OBJECT_MATVIEW
+}
+
+// CREATE [OR REPLACE] VIEW, DROP VIEW [IF EXISTS], CREATE MATERIALIZED VIEW [IF NOT EXISTS], REFRESH MATERIALIZED VIEW,
+// DROP MATERIALIZED VIEW [IF EXISTS]. The views are shared by all sessions and instances,
+// so the changes are applied immediately, even within a transaction block.
+func (queryHandler *QueryHandler) handleViewQuery(node *pgQuery.Node, writer MessageWriter) error {
+	remapperView := queryHandler.queryRemapper.remapperView
+
+	var messages []pgproto3.Message
+	tag := commandTag(node)
+	switch {
+	case node.GetViewStmt() != nil:
+		viewStatement := node.GetViewStmt()
+		query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: viewStatement.Query}}})
+		if err != nil {
+			return err
+		}
+
+		viewDefinition := ViewDefinition{Schema: viewStatement.View.Schemaname, Name: viewStatement.View.Relname, Query: query}
+		if viewDefinition.Schema == "" {
+			viewDefinition.Schema = PG_SCHEMA_PUBLIC
+		}
+		for _, aliasNode := range viewStatement.Aliases {
+			viewDefinition.Columns = append(viewDefinition.Columns, aliasNode.GetString_().Sval)
+		}
+
+		err = remapperView.CreateView(viewDefinition, viewStatement.Replace)
+		if err != nil {
+			return err
+		}
+
+	case node.GetCreateTableAsStmt() != nil:
+		createStatement := node.GetCreateTableAsStmt()
+		query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: createStatement.Query}}})
+		if err != nil {
+			return err
+		}
+
+		viewDefinition := ViewDefinition{Schema: createStatement.Into.Rel.Schemaname, Name: createStatement.Into.Rel.Relname, Query: query, Materialized: true}
+		if viewDefinition.Schema == "" {
+			viewDefinition.Schema = PG_SCHEMA_PUBLIC
+		}
+		for _, columnNameNode := range createStatement.Into.ColNames {
+			viewDefinition.Columns = append(viewDefinition.Columns, columnNameNode.GetString_().Sval)
+		}
+
+		rowCount, created, err := remapperView.CreateMaterializedView(viewDefinition, createStatement.IfNotExists)
+		if err != nil {
+			return err
+		}
+		if created {
+			tag += " " + strconv.FormatInt(rowCount, 10)
+		} else {
+			tag = "CREATE MATERIALIZED VIEW"
+			messages = append(messages, &pgproto3.NoticeResponse{
+				Severity: "NOTICE",
+				Code:     PG_ERROR_CODE_DUPLICATE_TABLE,
+				Message:  "relation \"" + viewDefinition.Name + "\" already exists, skipping",
+			})
+		}
+
+	case node.GetRefreshMatViewStmt() != nil:
+		schemaTable := relationSchemaTable(node.GetRefreshMatViewStmt().Relation)
+		err := remapperView.RefreshMaterializedView(schemaTable)
+		if err != nil {
+			return err
+		}
+
+	case node.GetDropStmt() != nil:
+		dropStatement := node.GetDropStmt()
+		for _, objectNode := range dropStatement.Objects {
+			schemaTable := dropObjectSchemaTable(objectNode)
+			objectName := "view"
+			var dropped bool
+			var err error
+			if dropStatement.RemoveType == pgQuery.ObjectType_OBJECT_MATVIEW {
+				objectName = "materialized view"
+				dropped, err = remapperView.DropMaterializedView(schemaTable, dropStatement.MissingOk)
+			} else {
+				dropped, err = remapperView.DropView(schemaTable, dropStatement.MissingOk)
+			}
+			if err != nil {
+				return err
+			}
+			if !dropped {
+				messages = append(messages, &pgproto3.NoticeResponse{
+					Severity: "NOTICE",
+					Code:     PG_ERROR_CODE_SUCCESSFUL_COMPLETION,
+					Message:  objectName + " \"" + schemaTable.Table + "\" does not exist, skipping",
+				})
+			}
+		}
+
+	default:
+		return errors.New("unsupported view query: " + tag)
+	}
+
+	messages = append(messages, &pgproto3.CommandComplete{CommandTag: []byte(tag)})
+	return writer(messages...)
+}
@@ -8,7 +8,8 @@ import (
 )
 
 var SUPPORTED_SET_STATEMENTS = NewSet([]string{
-	"timezone", // SET SESSION timezone TO 'UTC'
+	"timezone",    // SET SESSION timezone TO 'UTC'
+	"search_path", // SET search_path TO public, custom_schema
 })
 
 var KNOWN_SET_STATEMENTS = NewSet([]string{
@@ -20,35 +21,50 @@ var KNOWN_SET_STATEMENTS = NewSet([]string{
 	"application_name",            // SET application_name = 'psql'
 	"datestyle",                   // SET datestyle TO 'ISO'
 	"session characteristics",     // SET SESSION CHARACTERISTICS AS TRANSACTION ISOLATION LEVEL READ COMMITTED
+	"statement_timeout",           // SET statement_timeout = 5000 (applied to the session by the query handler)
 })
 
 var FALLBACK_QUERY_TREE, _ = pgQuery.Parse(FALLBACK_SQL_QUERY)
-var FALLBACK_SET_QUERY_TREE, _ = pgQuery.Parse("SET schema TO public")
 
 type QueryRemapper struct {
-	parserTypeCast   *ParserTypeCast
-	remapperTable    *QueryRemapperTable
-	remapperTypeCast *QueryRemapperTypeCast
-	remapperWhere    *QueryRemapperWhere
-	remapperSelect   *QueryRemapperSelect
-	remapperShow     *QueryRemapperShow
-	icebergReader    *IcebergReader
-	duckdb           *Duckdb
-	config           *Config
+	parserTypeCast      *ParserTypeCast
+	remapperTable       *QueryRemapperTable
+	remapperTypeCast    *QueryRemapperTypeCast
+	remapperSelect      *QueryRemapperSelect
+	remapperShow        *QueryRemapperShow
+	remapperView        *QueryRemapperView
+	remapperNativeTable *QueryRemapperNativeTable
+	icebergReader       *IcebergReader
+	duckdb              *Duckdb
+	config              *Config
 }
 
 func NewQueryRemapper(config *Config, icebergReader *IcebergReader, duckdb *Duckdb) *QueryRemapper {
-	return &QueryRemapper{
+	remapper := &QueryRemapper{
 		parserTypeCast:   NewParserTypeCast(config),
 		remapperTable:    NewQueryRemapperTable(config, icebergReader, duckdb),
 		remapperTypeCast: NewQueryRemapperTypeCast(config),
-		remapperWhere:    NewQueryRemapperWhere(config),
 		remapperSelect:   NewQueryRemapperSelect(config),
 		remapperShow:     NewQueryRemapperShow(config),
 		icebergReader:    icebergReader,
 		duckdb:           duckdb,
 		config:           config,
 	}
+	remapper.remapperView = NewQueryRemapperView(config, remapper.remapperTable, duckdb, remapper.remapQueryTree)
+	remapper.remapperView.SyncViews()
+	remapper.remapperNativeTable = NewQueryRemapperNativeTable(config, remapper.remapperTable)
+	return remapper
+}
+
+// Picks up syncs and changes made by other BemiDB instances from the storage.
+// Called periodically by the server, so that queries don't read the storage.
+func (remapper *QueryRemapper) ReloadCatalog() error {
+	err := remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		return err
+	}
+	remapper.remapperView.SyncViews()
+	return nil
 }
 
 func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([]*pgQuery.RawStmt, error) {
@@ -61,7 +77,6 @@ func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([
 		LogTrace(remapper.config, "Remapping statement #"+IntToString(i+1))
 
 		node := stmt.Stmt
-
 		switch {
 		// Empty statement
 		case node == nil:
@@ -69,8 +84,7 @@ func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([
 
 		// SELECT
 		case node.GetSelectStmt() != nil:
-			remappedSelect := remapper.remapSelectStatement(stmt.Stmt.GetSelectStmt(), 1)
-			stmt.Stmt = &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: remappedSelect}}
+			stmt.Stmt = remapper.remapQueryTree(node)
 			statements[i] = stmt
 
 		// SET
@@ -85,6 +99,93 @@ func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([
 		case node.GetVariableShowStmt() != nil:
 			statements[i] = remapper.remapperShow.RemapShowStatement(stmt)
 
+		// DECLARE ... CURSOR FOR SELECT ...
+		case node.GetDeclareCursorStmt() != nil:
+			declareCursorStatement := node.GetDeclareCursorStmt()
+			if declareCursorStatement.Query.GetSelectStmt() == nil {
+				return nil, errors.New("unsupported cursor query type")
+			}
+			declareCursorStatement.Query = remapper.remapQueryTree(declareCursorStatement.Query)
+
+		// FETCH, MOVE, CLOSE (handled by the query handler)
+		case node.GetFetchStmt() != nil || node.GetClosePortalStmt() != nil:
+
+		// BEGIN, COMMIT, ROLLBACK, SAVEPOINT, etc. (handled by the query handler)
+		case node.GetTransactionStmt() != nil:
+
+		// CREATE [OR REPLACE] VIEW (handled by the query handler)
+		case node.GetViewStmt() != nil:
+			if node.GetViewStmt().View.Relpersistence == PG_RELPERSISTENCE_TEMP {
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "temporary views are not supported"}
+			}
+
+		// DROP VIEW (handled by the query handler)
+		case node.GetDropStmt() != nil && node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_VIEW:
+
+		// CREATE MATERIALIZED VIEW (handled by the query handler)
+		case node.GetCreateTableAsStmt() != nil && node.GetCreateTableAsStmt().Objtype == pgQuery.ObjectType_OBJECT_MATVIEW:
+			if node.GetCreateTableAsStmt().Into.SkipData {
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "materialized views WITH NO DATA are not supported"}
+			}
+
+		// REFRESH MATERIALIZED VIEW, DROP MATERIALIZED VIEW (handled by the query handler)
+		case node.GetRefreshMatViewStmt() != nil:
+		case node.GetDropStmt() != nil && node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_MATVIEW:
+
+		// CREATE TEMPORARY TABLE ... [AS SELECT ...] (other tables are written as Iceberg tables by the query handler)
+		case node.GetCreateStmt() != nil:
+			if remapTempTableRelation(node.GetCreateStmt().Relation) {
+				stmt.Stmt = remapper.remapQueryTree(node)
+			}
+		case node.GetCreateTableAsStmt() != nil && node.GetCreateTableAsStmt().Objtype == pgQuery.ObjectType_OBJECT_TABLE:
+			if remapTempTableRelation(node.GetCreateTableAsStmt().Into.Rel) {
+				stmt.Stmt = remapper.remapQueryTree(node)
+			}
+
+		// INSERT INTO ... VALUES / SELECT ... (tables created with CREATE TABLE are handled by the query handler)
+		case node.GetInsertStmt() != nil:
+			stmt.Stmt = remapper.remapQueryTree(node)
+
+		// DROP TABLE (tables created with CREATE TABLE are handled by the query handler)
+		case node.GetDropStmt() != nil && node.GetDropStmt().RemoveType == pgQuery.ObjectType_OBJECT_TABLE:
+			remapDropTempTables(node.GetDropStmt())
+
+		// COPY table FROM STDIN (handled by the query handler)
+		case node.GetCopyStmt() != nil && node.GetCopyStmt().IsFrom && node.GetCopyStmt().Filename == "":
+
+		// COPY (SELECT ...) TO STDOUT, COPY table TO STDOUT (handled by the query handler)
+		case node.GetCopyStmt() != nil && !node.GetCopyStmt().IsFrom && node.GetCopyStmt().Filename == "" && !node.GetCopyStmt().IsProgram:
+			copyStatement := node.GetCopyStmt()
+			remapCopyToRelation(copyStatement)
+			if copyStatement.Query.GetSelectStmt() == nil {
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "COPY TO STDOUT only supports SELECT queries"}
+			}
+			copyStatement.Query = remapper.remapQueryTree(copyStatement.Query)
+
+		// EXPLAIN [ANALYZE] SELECT ... (handled by the query handler)
+		case node.GetExplainStmt() != nil:
+			explainStatement := node.GetExplainStmt()
+			if explainStatement.Query.GetSelectStmt() == nil {
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "EXPLAIN only supports SELECT queries"}
+			}
+			explainStatement.Query = remapper.remapQueryTree(explainStatement.Query)
+
+		// PREPARE name AS SELECT ... (prepared via DuckDB by the query handler)
+		case node.GetPrepareStmt() != nil:
+			prepareStatement := node.GetPrepareStmt()
+			if prepareStatement.Query.GetSelectStmt() == nil {
+				return nil, &PgError{Code: PG_ERROR_CODE_FEATURE_NOT_SUPPORTED, Message: "PREPARE only supports SELECT queries"}
+			}
+			remapPrepareParamTypes(prepareStatement)
+			prepareStatement.Query = remapper.remapQueryTree(prepareStatement.Query)
+
+		// EXECUTE name(args) (handled by the query handler)
+		case node.GetExecuteStmt() != nil:
+			remapper.remapExecuteParams(node.GetExecuteStmt())
+
+		// DEALLOCATE [PREPARE] name, DEALLOCATE ALL (handled by the query handler)
+		case node.GetDeallocateStmt() != nil:
+
 		// Unsupported query
 		default:
 			LogDebug(remapper.config, "Query tree:", stmt, node)
@@ -97,137 +198,236 @@ func (remapper *QueryRemapper) RemapStatements(statements []*pgQuery.RawStmt) ([
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
-// SET ... (no-op)
+// SET ... (ignored SETs are handled by the query handler as a no-op)
 func (remapper *QueryRemapper) remapSetStatement(stmt *pgQuery.RawStmt) *pgQuery.RawStmt {
 	setStatement := stmt.Stmt.GetVariableSetStmt()
 
-	if SUPPORTED_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name)) {
-		return stmt
+	if strings.ToLower(setStatement.Name) == PG_VAR_SEARCH_PATH {
+		return remapper.remapSetSearchPath(stmt)
 	}
 
-	if !KNOWN_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name)) {
+	if isIgnoredSetStatement(setStatement) && !KNOWN_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name)) {
 		LogWarn(remapper.config, "Unknown SET ", setStatement.Name, ":", setStatement)
 	}
 
-	return FALLBACK_SET_QUERY_TREE.Stmts[0]
+	return stmt
 }
 
-func (remapper *QueryRemapper) remapSelectStatement(selectStatement *pgQuery.SelectStmt, indentLevel int) *pgQuery.SelectStmt {
-	// UNION
-	if selectStatement.FromClause == nil && selectStatement.Larg != nil && selectStatement.Rarg != nil {
-		remapper.traceTreeTraversal("UNION left", indentLevel)
-		leftSelectStatement := selectStatement.Larg
-		remapper.remapSelectStatement(leftSelectStatement, indentLevel+1) // self-recursion
+// SET/RESET of the settings that aren't passed to DuckDB
+func isIgnoredSetStatement(setStatement *pgQuery.VariableSetStmt) bool {
+	return !SUPPORTED_SET_STATEMENTS.Contains(strings.ToLower(setStatement.Name))
+}
 
-		remapper.traceTreeTraversal("UNION right", indentLevel)
-		rightSelectStatement := selectStatement.Rarg
-		remapper.remapSelectStatement(rightSelectStatement, indentLevel+1) // self-recursion
+// SET search_path TO "$user", public, custom -> SET search_path TO 'public,custom'
+func (remapper *QueryRemapper) remapSetSearchPath(stmt *pgQuery.RawStmt) *pgQuery.RawStmt {
+	setStatement := stmt.Stmt.GetVariableSetStmt()
+	if setStatement.Kind != pgQuery.VariableSetKind_VAR_SET_VALUE {
+		return stmt
 	}
 
-	// JOIN
-	if len(selectStatement.FromClause) > 0 && selectStatement.FromClause[0].GetJoinExpr() != nil {
-		selectStatement.FromClause[0] = remapper.remapJoinExpressions(selectStatement, selectStatement.FromClause[0], indentLevel+1) // recursive
+	var schemas []string
+	for _, arg := range setStatement.Args {
+		schema := arg.GetAConst().GetSval().GetSval()
+		if schema != "" && schema != "$user" { // DuckDB doesn't have per-user schemas
+			schemas = append(schemas, schema)
+		}
+	}
+	if len(schemas) == 0 {
+		schemas = []string{PG_SCHEMA_PUBLIC}
 	}
 
-	// WHERE
-	if selectStatement.WhereClause != nil {
-		selectStatement.WhereClause = remapper.remapTypeCastsInNode(selectStatement.WhereClause)                    // recursive
-		selectStatement = remapper.remapWhereExpressions(selectStatement, selectStatement.WhereClause, indentLevel) // recursive
+	setStatement.Args = []*pgQuery.Node{pgQuery.MakeAConstStrNode(strings.Join(schemas, ","), 0)}
+	return stmt
+}
+
+// CREATE TABLE pg_temp.table -> CREATE TEMPORARY TABLE pg_temp.table. Returns whether the table is temporary.
+func remapTempTableRelation(relation *pgQuery.RangeVar) bool {
+	if relation.Schemaname == PG_SCHEMA_PG_TEMP {
+		relation.Relpersistence = PG_RELPERSISTENCE_TEMP
 	}
+	return relation.Relpersistence == PG_RELPERSISTENCE_TEMP
+}
 
-	// WITH
-	if selectStatement.WithClause != nil {
-		remapper.traceTreeTraversal("WITH CTE's", indentLevel)
-		for _, cte := range selectStatement.WithClause.Ctes {
-			if cteSelect := cte.GetCommonTableExpr().Ctequery.GetSelectStmt(); cteSelect != nil {
-				remapper.remapSelectStatement(cteSelect, indentLevel+1) // self-recursion
-			}
+// DROP TABLE pg_temp.table -> DROP TABLE temp.main.table
+func remapDropTempTables(dropStatement *pgQuery.DropStmt) {
+	for _, objectNode := range dropStatement.Objects {
+		nameList := objectNode.GetList()
+		if len(nameList.Items) == 2 && nameList.Items[0].GetString_().Sval == PG_SCHEMA_PG_TEMP {
+			nameList.Items = []*pgQuery.Node{pgQuery.MakeStrNode("temp"), pgQuery.MakeStrNode("main"), nameList.Items[1]}
 		}
 	}
+}
 
-	// FROM
-	if len(selectStatement.FromClause) > 0 {
-		for i, fromNode := range selectStatement.FromClause {
-			if fromNode.GetRangeVar() != nil {
-				remapper.traceTreeTraversal("WHERE statements", indentLevel)
-				// FROM [TABLE]
-				remapper.traceTreeTraversal("FROM table", indentLevel)
-				selectStatement.FromClause[i] = remapper.remapperTable.RemapTable(fromNode)
-				qSchemaTable := remapper.remapperTable.NodeToQuerySchemaTable(fromNode)
-				selectStatement = remapper.remapperTable.RemapWhereClauseForTable(qSchemaTable, selectStatement)
-				selectStatement = remapper.remapperTable.RemapOrderByForTable(qSchemaTable, selectStatement)
-			} else if fromNode.GetRangeSubselect() != nil {
-				// FROM (SELECT ...)
-				remapper.traceTreeTraversal("FROM subselect", indentLevel)
-				subSelectStatement := fromNode.GetRangeSubselect().Subquery.GetSelectStmt()
-				remapper.remapSelectStatement(subSelectStatement, indentLevel+1) // self-recursion
-			} else if fromNode.GetRangeFunction() != nil {
-				// FROM PG_FUNCTION()
-				selectStatement.FromClause[i] = remapper.remapTableFunction(fromNode, indentLevel) // recursive
-			}
+// COPY table (columns) TO STDOUT -> COPY (SELECT columns FROM table) TO STDOUT
+func remapCopyToRelation(copyStatement *pgQuery.CopyStmt) {
+	if copyStatement.Relation == nil {
+		return
+	}
+
+	targetList := []*pgQuery.Node{pgQuery.MakeResTargetNodeWithVal(pgQuery.MakeColumnRefNode([]*pgQuery.Node{pgQuery.MakeAStarNode()}, 0), 0)}
+	if len(copyStatement.Attlist) > 0 {
+		targetList = nil
+		for _, columnNameNode := range copyStatement.Attlist {
+			targetList = append(targetList, pgQuery.MakeResTargetNodeWithVal(pgQuery.MakeColumnRefNode([]*pgQuery.Node{columnNameNode}, 0), 0))
 		}
 	}
 
-	// SELECT
-	selectStatement = remapper.remapSelect(selectStatement, indentLevel) // recursive
+	copyStatement.Query = &pgQuery.Node{
+		Node: &pgQuery.Node_SelectStmt{
+			SelectStmt: &pgQuery.SelectStmt{
+				TargetList: targetList,
+				FromClause: []*pgQuery.Node{{Node: &pgQuery.Node_RangeVar{RangeVar: copyStatement.Relation}}},
+			},
+		},
+	}
+	copyStatement.Relation = nil
+	copyStatement.Attlist = nil
+}
+
+// PREPARE name(int) AS SELECT $1 + 1 -> PREPARE name(int) AS SELECT $1::int + 1, so that DuckDB binds the declared types
+func remapPrepareParamTypes(prepareStatement *pgQuery.PrepareStmt) {
+	if len(prepareStatement.Argtypes) == 0 {
+		return
+	}
 
-	return selectStatement
+	prepareStatement.Query = visitQueryTree(prepareStatement.Query, func(node *pgQuery.Node) *pgQuery.Node {
+		paramRef := node.GetParamRef()
+		if paramRef == nil || int(paramRef.Number) > len(prepareStatement.Argtypes) {
+			return node
+		}
+		typeName := prepareStatement.Argtypes[paramRef.Number-1].GetTypeName()
+		return &pgQuery.Node{Node: &pgQuery.Node_TypeCast{TypeCast: &pgQuery.TypeCast{Arg: node, TypeName: typeName}}}
+	})
 }
 
-func (remapper *QueryRemapper) remapCaseExpressions(selectStatement *pgQuery.SelectStmt, indentLevel int) *pgQuery.SelectStmt {
-	for _, target := range selectStatement.TargetList {
-		if caseExpr := target.GetResTarget().Val.GetCaseExpr(); caseExpr != nil {
-
-			remapper.ensureConsistentCaseTypes(caseExpr)
-
-			for _, when := range caseExpr.Args {
-				if whenClause := when.GetCaseWhen(); whenClause != nil {
-					if whenClause.Expr != nil {
-						if aExpr := whenClause.Expr.GetAExpr(); aExpr != nil {
-							if aExpr.Kind == pgQuery.A_Expr_Kind_AEXPR_OP_ANY {
-								whenClause.Expr = remapper.remapperSelect.parserSelect.ConvertAnyToIn(aExpr)
-							}
-							if subLink := aExpr.Lexpr.GetSubLink(); subLink != nil {
-								remapper.traceTreeTraversal("CASE WHEN left", indentLevel+1)
-								subSelect := subLink.Subselect.GetSelectStmt()
-								remapper.remapSelectStatement(subSelect, indentLevel+1)
-							}
-							if subLink := aExpr.Rexpr.GetSubLink(); subLink != nil {
-								remapper.traceTreeTraversal("CASE WHEN right", indentLevel+1)
-								subSelect := subLink.Subselect.GetSelectStmt()
-								remapper.remapSelectStatement(subSelect, indentLevel+1)
-							}
-						}
-					}
+// EXECUTE name(args) -> EXECUTE name(remapped args), which are evaluated via DuckDB by the query handler
+func (remapper *QueryRemapper) remapExecuteParams(executeStatement *pgQuery.ExecuteStmt) {
+	if len(executeStatement.Params) == 0 {
+		return
+	}
 
-					if whenClause.Result != nil {
-						if subLink := whenClause.Result.GetSubLink(); subLink != nil {
-							remapper.traceTreeTraversal("CASE THEN", indentLevel+1)
-							subSelect := subLink.Subselect.GetSelectStmt()
-							remapper.remapSelectStatement(subSelect, indentLevel+1)
-						}
-						if funcCall := whenClause.Result.GetFuncCall(); funcCall != nil {
-							remapper.traceTreeTraversal("CASE THEN function", indentLevel+1)
-							whenClause.Result = remapper.remapperSelect.RemapFunctionToConstant(funcCall)
-						}
-					}
-				}
+	var targetList []*pgQuery.Node
+	for _, paramNode := range executeStatement.Params {
+		targetList = append(targetList, pgQuery.MakeResTargetNodeWithVal(paramNode, 0))
+	}
+	selectNode := remapper.remapQueryTree(&pgQuery.Node{Node: &pgQuery.Node_SelectStmt{SelectStmt: &pgQuery.SelectStmt{TargetList: targetList}}})
+
+	for i, targetNode := range selectNode.GetSelectStmt().TargetList {
+		executeStatement.Params[i] = targetNode.GetResTarget().Val
+	}
+}
+
+// Remaps tables, table functions, functions, type casts and CASE expressions in every clause of the query:
+// SELECT, FROM, JOIN, LATERAL, WHERE, GROUP BY, HAVING, WINDOW, ORDER BY, LIMIT, WITH, set operations, etc.
+func (remapper *QueryRemapper) remapQueryTree(node *pgQuery.Node) *pgQuery.Node {
+	rootSelectStatement := node.GetSelectStmt()
+
+	return visitQueryTree(node, func(node *pgQuery.Node) *pgQuery.Node {
+		switch {
+
+		// SELECT ... FROM ... (including subqueries, CTEs and set operations)
+		case node.GetSelectStmt() != nil:
+			remapper.remapSelectStatement(node.GetSelectStmt(), node.GetSelectStmt() == rootSelectStatement)
+			return node
+
+		// FROM [TABLE]
+		case node.GetRangeVar() != nil:
+			return remapper.remapperTable.RemapTable(node)
+
+		// FROM PG_FUNCTION()
+		case node.GetRangeFunction() != nil:
+			return remapper.remapTableFunction(node)
+
+		// SELECT PG_FUNCTION() AS ...
+		case node.GetResTarget() != nil:
+			return remapper.remapperSelect.RemapSelect(node)
+
+		// PG_FUNCTION()
+		case node.GetFuncCall() != nil:
+			return remapper.remapperSelect.RemapFunctionCall(node)
+
+		// ORDER BY PG_FUNCTION()
+		case node.GetSortBy() != nil:
+			remapper.remapperSelect.RemapSortBy(node.GetSortBy())
+			return node
+
+		// pg_catalog.table.column
+		case node.GetColumnRef() != nil:
+			remapper.remapperTable.RemapColumnRef(node.GetColumnRef())
+			return node
+
+		// value::type
+		case node.GetTypeCast() != nil:
+			return remapper.remapperTypeCast.RemapTypeCast(node)
+
+		// CASE WHEN ... THEN ... ELSE ... END
+		case node.GetCaseExpr() != nil:
+			remapper.remapCaseExpression(node.GetCaseExpr())
+			return node
+
+		// ARRAY(SELECT ...)
+		case node.GetSubLink() != nil:
+			remapper.remapSubLink(node.GetSubLink())
+			return node
+		}
+
+		return node
+	})
+}
+
+// Filters and ordering of pg_catalog tables in FROM and JOIN, which depend on the whole SELECT statement
+func (remapper *QueryRemapper) remapSelectStatement(selectStatement *pgQuery.SelectStmt, isRoot bool) {
+	for i, fromNode := range selectStatement.FromClause {
+		remapper.remapFromTables(selectStatement, fromNode, isRoot && i == 0)
+	}
+}
+
+func (remapper *QueryRemapper) remapFromTables(selectStatement *pgQuery.SelectStmt, fromNode *pgQuery.Node, isOutermostJoin bool) {
+	if fromNode.GetRangeVar() != nil {
+		qSchemaTable := remapper.remapperTable.NodeToQuerySchemaTable(fromNode)
+		remapper.remapperTable.RemapWhereClauseForTable(qSchemaTable, selectStatement)
+		remapper.remapperTable.RemapOrderByForTable(qSchemaTable, selectStatement)
+		return
+	}
+
+	joinExpr := fromNode.GetJoinExpr()
+	if joinExpr == nil {
+		return
+	}
+	remapper.remapFromTables(selectStatement, joinExpr.Larg, false)
+	remapper.remapFromTables(selectStatement, joinExpr.Rarg, false)
+
+	// DuckDB doesn't support non-INNER JOINs with ON clauses that reference columns from outer tables:
+	//   SELECT (
+	//     SELECT 1 AS test FROM (SELECT 1 AS inner_val) LEFT JOIN (SELECT NULL) ON inner_val = *outer_val*
+	//   ) FROM (SELECT 1 AS outer_val)
+	//   > "Non-inner join on correlated columns not supported"
+	//
+	// References:
+	// - https://github.com/duckdb/duckdb/blob/f6ae05d0a23cae549c6f612026eda27130fe1600/src/planner/joinside.cpp#L63
+	// - https://github.com/duckdb/duckdb/discussions/16012
+	if joinExpr.Jointype != pgQuery.JoinType_JOIN_INNER && !isOutermostJoin {
+		// Change the JOIN type to INNER in some cases like: ON ... = indclass[i] (sent via Postico)
+		if joinExpr.Quals.GetAExpr() != nil && joinExpr.Quals.GetAExpr().Rexpr.GetAIndirection() != nil {
+			rightIndirectionColumnRef := joinExpr.Quals.GetAExpr().Rexpr.GetAIndirection().Arg.GetColumnRef().GetFields()
+			if len(rightIndirectionColumnRef) > 0 && rightIndirectionColumnRef[0].GetString_().GetSval() == "indclass" {
+				joinExpr.Jointype = pgQuery.JoinType_JOIN_INNER
 			}
+		}
+	}
+}
 
-			if caseExpr.Defresult != nil {
-				if subLink := caseExpr.Defresult.GetSubLink(); subLink != nil {
-					remapper.traceTreeTraversal("CASE ELSE", indentLevel+1)
-					subSelect := subLink.Subselect.GetSelectStmt()
-					remapper.remapSelectStatement(subSelect, indentLevel+1)
-				}
-				if funcCall := caseExpr.Defresult.GetFuncCall(); funcCall != nil {
-					remapper.traceTreeTraversal("CASE ELSE function", indentLevel+1)
-					caseExpr.Defresult = remapper.remapperSelect.RemapFunctionToConstant(funcCall)
-				}
+// CASE WHEN ... THEN ... ELSE ... END
+func (remapper *QueryRemapper) remapCaseExpression(caseExpr *pgQuery.CaseExpr) {
+	remapper.ensureConsistentCaseTypes(caseExpr)
+
+	for _, when := range caseExpr.Args {
+		if whenClause := when.GetCaseWhen(); whenClause != nil && whenClause.Expr != nil {
+			if aExpr := whenClause.Expr.GetAExpr(); aExpr != nil && aExpr.Kind == pgQuery.A_Expr_Kind_AEXPR_OP_ANY {
+				whenClause.Expr = remapper.remapperSelect.parserSelect.ConvertAnyToIn(aExpr)
 			}
 		}
 	}
-	return selectStatement
 }
 
 func (remapper *QueryRemapper) ensureConsistentCaseTypes(caseExpr *pgQuery.CaseExpr) {
@@ -249,10 +449,21 @@ func (remapper *QueryRemapper) ensureConsistentCaseTypes(caseExpr *pgQuery.CaseE
 	}
 }
 
-// FROM PG_FUNCTION()
-func (remapper *QueryRemapper) remapTableFunction(fromNode *pgQuery.Node, indentLevel int) *pgQuery.Node {
-	remapper.traceTreeTraversal("FROM function()", indentLevel)
+// DuckDB doesn't work with ORDER BY in ARRAY subqueries:
+//
+//	SELECT ARRAY(SELECT 1 FROM pg_enum ORDER BY enumsortorder)
+//	> Referenced column "enumsortorder" not found in FROM clause!
+//
+// Remove ORDER BY from ARRAY subqueries
+func (remapper *QueryRemapper) remapSubLink(subLink *pgQuery.SubLink) {
+	subSelect := subLink.Subselect.GetSelectStmt()
+	if subLink.SubLinkType == pgQuery.SubLinkType_ARRAY_SUBLINK && subSelect != nil && subSelect.SortClause != nil {
+		subSelect.SortClause = nil
+	}
+}
 
+// FROM PG_FUNCTION()
+func (remapper *QueryRemapper) remapTableFunction(fromNode *pgQuery.Node) *pgQuery.Node {
 	fromNode = remapper.remapperTable.RemapTableFunction(fromNode)
 	if fromNode.GetRangeFunction() == nil {
 		return fromNode
@@ -264,7 +475,7 @@ func (remapper *QueryRemapper) remapTableFunction(fromNode *pgQuery.Node, indent
 			if funcCallNode == nil {
 				continue
 			}
-			remapper.remapTableFunctionArgs(funcCallNode, indentLevel+1) // recursive
+			remapper.remapTableFunctionArgs(funcCallNode)
 		}
 	}
 
@@ -272,9 +483,7 @@ func (remapper *QueryRemapper) remapTableFunction(fromNode *pgQuery.Node, indent
 }
 
 // FROM PG_FUNCTION(PG_NESTED_FUNCTION())
-func (remapper *QueryRemapper) remapTableFunctionArgs(funcCallNode *pgQuery.FuncCall, indentLevel int) *pgQuery.FuncCall {
-	remapper.traceTreeTraversal("FROM nested_function()", indentLevel)
-
+func (remapper *QueryRemapper) remapTableFunctionArgs(funcCallNode *pgQuery.FuncCall) *pgQuery.FuncCall {
 	for i, argNode := range funcCallNode.GetArgs() {
 		nestedFunctionCall := argNode.GetFuncCall()
 		if nestedFunctionCall == nil {
@@ -282,221 +491,10 @@ func (remapper *QueryRemapper) remapTableFunctionArgs(funcCallNode *pgQuery.Func
 		}
 
 		nestedFunctionCall = remapper.remapperTable.RemapNestedTableFunction(nestedFunctionCall)
-		nestedFunctionCall = remapper.remapTableFunctionArgs(nestedFunctionCall, indentLevel+1) // recursive
+		nestedFunctionCall = remapper.remapTableFunctionArgs(nestedFunctionCall) // self-recursion
 
 		funcCallNode.Args[i].Node = &pgQuery.Node_FuncCall{FuncCall: nestedFunctionCall}
 	}
 
 	return funcCallNode
 }
-
-func (remapper *QueryRemapper) remapTypeCastsInNode(node *pgQuery.Node) *pgQuery.Node {
-	if node == nil {
-		return nil
-	}
-
-	// Direct typecast
-	if node.GetTypeCast() != nil {
-		return remapper.remapperTypeCast.RemapTypeCast(node)
-	}
-
-	// Handle CASE expressions
-	if node.GetCaseExpr() != nil {
-		caseExpr := node.GetCaseExpr()
-		// Handle WHEN clauses
-		for i, when := range caseExpr.Args {
-			whenClause := when.GetCaseWhen()
-			if whenClause.Result != nil {
-				whenClause.Result = remapper.remapTypeCastsInNode(whenClause.Result) // self-recursion
-			}
-			caseExpr.Args[i] = when
-		}
-		// Handle ELSE clause
-		if caseExpr.Defresult != nil {
-			caseExpr.Defresult = remapper.remapTypeCastsInNode(caseExpr.Defresult) // self-recursion
-		}
-	}
-
-	// AND/OR expressions
-	if node.GetBoolExpr() != nil {
-		boolExpr := node.GetBoolExpr()
-		for i, arg := range boolExpr.Args {
-			boolExpr.Args[i] = remapper.remapTypeCastsInNode(arg) // self-recursion
-		}
-	}
-
-	// Comparison expressions
-	if node.GetAExpr() != nil {
-		aExpr := node.GetAExpr()
-		if aExpr.Lexpr != nil {
-			aExpr.Lexpr = remapper.remapTypeCastsInNode(aExpr.Lexpr) // self-recursion
-		}
-		if aExpr.Rexpr != nil {
-			aExpr.Rexpr = remapper.remapTypeCastsInNode(aExpr.Rexpr) // self-recursion
-		}
-	}
-
-	// IN expressions
-	if node.GetList() != nil {
-		list := node.GetList()
-		for i, item := range list.Items {
-			list.Items[i] = remapper.remapTypeCastsInNode(item) // self-recursion
-		}
-	}
-
-	return node
-}
-
-func (remapper *QueryRemapper) remapJoinExpressions(selectStatement *pgQuery.SelectStmt, node *pgQuery.Node, indentLevel int) *pgQuery.Node {
-	remapper.traceTreeTraversal("JOIN left", indentLevel)
-	leftJoinNode := node.GetJoinExpr().Larg
-	if leftJoinNode.GetJoinExpr() != nil {
-		leftJoinNode = remapper.remapJoinExpressions(selectStatement, leftJoinNode, indentLevel+1) // self-recursion
-	} else if leftJoinNode.GetRangeVar() != nil {
-		// WHERE
-		remapper.traceTreeTraversal("WHERE left", indentLevel+1)
-		qSchemaTable := remapper.remapperTable.NodeToQuerySchemaTable(leftJoinNode)
-		selectStatement = remapper.remapperTable.RemapWhereClauseForTable(qSchemaTable, selectStatement)
-		selectStatement = remapper.remapperTable.RemapOrderByForTable(qSchemaTable, selectStatement)
-		// TABLE
-		remapper.traceTreeTraversal("TABLE left", indentLevel+1)
-		leftJoinNode = remapper.remapperTable.RemapTable(leftJoinNode)
-	} else if leftJoinNode.GetRangeSubselect() != nil {
-		leftSelectStatement := leftJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
-		remapper.remapSelectStatement(leftSelectStatement, indentLevel+1) // parent-recursion
-	}
-	node.GetJoinExpr().Larg = leftJoinNode
-
-	remapper.traceTreeTraversal("JOIN right", indentLevel)
-	rightJoinNode := node.GetJoinExpr().Rarg
-	if rightJoinNode.GetJoinExpr() != nil {
-		rightJoinNode = remapper.remapJoinExpressions(selectStatement, rightJoinNode, indentLevel+1) // self-recursion
-	} else if rightJoinNode.GetRangeVar() != nil {
-		// WHERE
-		remapper.traceTreeTraversal("WHERE right", indentLevel+1)
-		qSchemaTable := remapper.remapperTable.NodeToQuerySchemaTable(rightJoinNode)
-		selectStatement = remapper.remapperTable.RemapWhereClauseForTable(qSchemaTable, selectStatement)
-		remapper.remapperTable.RemapOrderByForTable(qSchemaTable, selectStatement)
-		// TABLE
-		remapper.traceTreeTraversal("TABLE right", indentLevel+1)
-		rightJoinNode = remapper.remapperTable.RemapTable(rightJoinNode)
-	} else if rightJoinNode.GetRangeSubselect() != nil {
-		rightSelectStatement := rightJoinNode.GetRangeSubselect().Subquery.GetSelectStmt()
-		remapper.remapSelectStatement(rightSelectStatement, indentLevel+1) // parent-recursion
-	}
-	node.GetJoinExpr().Rarg = rightJoinNode
-
-	remapper.traceTreeTraversal("JOIN on", indentLevel)
-	if node.GetJoinExpr().Quals != nil {
-		node.GetJoinExpr().Quals = remapper.remapTypeCastsInNode(node.GetJoinExpr().Quals) // recursion
-
-		// DuckDB doesn't support non-INNER JOINs with ON clauses that reference columns from outer tables:
-		//   SELECT (
-		//     SELECT 1 AS test FROM (SELECT 1 AS inner_val) LEFT JOIN (SELECT NULL) ON inner_val = *outer_val*
-		//   ) FROM (SELECT 1 AS outer_val)
-		//   > "Non-inner join on correlated columns not supported"
-		//
-		// References:
-		// - https://github.com/duckdb/duckdb/blob/f6ae05d0a23cae549c6f612026eda27130fe1600/src/planner/joinside.cpp#L63
-		// - https://github.com/duckdb/duckdb/discussions/16012
-		if node.GetJoinExpr().Jointype != pgQuery.JoinType_JOIN_INNER {
-			// Change the JOIN type to INNER in some cases like: ON ... = indclass[i] (sent via Postico)
-			if indentLevel > 2 && node.GetJoinExpr().Quals.GetAExpr() != nil && node.GetJoinExpr().Quals.GetAExpr().Rexpr.GetAIndirection() != nil {
-				rightIndirectionColumnRef := node.GetJoinExpr().Quals.GetAExpr().Rexpr.GetAIndirection().Arg.GetColumnRef().Fields[0].GetString_().Sval
-				if rightIndirectionColumnRef == "indclass" {
-					node.GetJoinExpr().Jointype = pgQuery.JoinType_JOIN_INNER
-				}
-			}
-		}
-	}
-
-	return node
-}
-
-func (remapper *QueryRemapper) remapWhereExpressions(selectStatement *pgQuery.SelectStmt, node *pgQuery.Node, indentLevel int) *pgQuery.SelectStmt {
-	remapper.traceTreeTraversal("WHERE statements", indentLevel)
-
-	boolExpr := node.GetBoolExpr()
-	if boolExpr != nil {
-		for _, arg := range boolExpr.Args {
-			selectStatement = remapper.remapWhereExpressions(selectStatement, arg, indentLevel+1) // self-recursion
-		}
-	}
-
-	subLink := node.GetSubLink()
-	if subLink != nil {
-		subSelect := subLink.Subselect.GetSelectStmt()
-		remapper.remapSelectStatement(subSelect, indentLevel+1) // recursive
-	}
-
-	aExpr := node.GetAExpr()
-	if aExpr != nil {
-		if aExpr.Lexpr != nil {
-			selectStatement = remapper.remapWhereExpressions(selectStatement, aExpr.Lexpr, indentLevel+1) // self-recursion
-		}
-		if aExpr.Rexpr != nil {
-			selectStatement = remapper.remapWhereExpressions(selectStatement, aExpr.Rexpr, indentLevel+1) // self-recursion
-		}
-	}
-
-	selectStatement = remapper.remapperWhere.RemapWhereExpressions(selectStatement, node)
-
-	return selectStatement
-}
-
-// SELECT ...
-func (remapper *QueryRemapper) remapSelect(selectStatement *pgQuery.SelectStmt, indentLevel int) *pgQuery.SelectStmt {
-	remapper.traceTreeTraversal("SELECT statements", indentLevel)
-
-	// SELECT ...
-	for targetNodeIdx, targetNode := range selectStatement.TargetList {
-		if targetNode.GetResTarget().Val.GetCaseExpr() != nil {
-			// CASE
-			remapper.remapCaseExpressions(selectStatement, indentLevel) // recursive
-		} else if targetNode.GetResTarget().Val.GetSubLink() != nil {
-			// Nested SELECT
-			subLink := targetNode.GetResTarget().Val.GetSubLink()
-			subSelect := subLink.Subselect.GetSelectStmt()
-			remapper.remapSelectStatement(subSelect, indentLevel+1) // recursive
-
-			// DuckDB doesn't work with ORDER BY in ARRAY subqueries:
-			//   SELECT ARRAY(SELECT 1 FROM pg_enum ORDER BY enumsortorder)
-			//   > Referenced column "enumsortorder" not found in FROM clause!
-			//
-			// Remove ORDER BY from ARRAY subqueries
-			if subLink.SubLinkType == pgQuery.SubLinkType_ARRAY_SUBLINK && subSelect.SortClause != nil {
-				subSelect.SortClause = nil
-			}
-		} else if targetNode.GetResTarget().Val.GetCoalesceExpr() != nil {
-			// COALESCE(value1, value2, ...)
-			coalesceExpr := targetNode.GetResTarget().Val.GetCoalesceExpr()
-			for _, arg := range coalesceExpr.Args {
-				if arg.GetSubLink() != nil {
-					// Nested SELECT
-					subSelect := arg.GetSubLink().Subselect.GetSelectStmt()
-					remapper.remapSelectStatement(subSelect, indentLevel+1) // recursive
-				}
-			}
-		} else {
-			targetNode.GetResTarget().Val = remapper.remapTypeCastsInNode(targetNode.GetResTarget().Val) // recursive
-		}
-
-		targetNode = remapper.remapperSelect.RemapSelect(targetNode)
-		selectStatement.TargetList[targetNodeIdx] = targetNode
-	}
-
-	// VALUES (...)
-	if len(selectStatement.ValuesLists) > 0 {
-		for i, valuesList := range selectStatement.ValuesLists {
-			for j, value := range valuesList.GetList().Items {
-				selectStatement.ValuesLists[i].GetList().Items[j] = remapper.remapTypeCastsInNode(value) // recursive
-			}
-		}
-	}
-
-	return selectStatement
-}
-
-func (remapper *QueryRemapper) traceTreeTraversal(label string, indentLevel int) {
-	LogTrace(remapper.config, strings.Repeat(">", indentLevel), label)
-}
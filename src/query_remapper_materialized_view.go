@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+// DuckDB column types of materialized view queries -> PostgreSQL types of the Iceberg table columns.
+// Other types, e.g., VARCHAR, BLOB, INTERVAL, lists and structs, are stored as text.
+var MATERIALIZED_VIEW_COLUMN_TYPES = map[string]PgSchemaColumn{
+	"BOOLEAN":                  {DataType: "boolean", UdtName: "bool"},
+	"TINYINT":                  {DataType: "smallint", UdtName: "int2"},
+	"UTINYINT":                 {DataType: "smallint", UdtName: "int2"},
+	"SMALLINT":                 {DataType: "smallint", UdtName: "int2"},
+	"USMALLINT":                {DataType: "integer", UdtName: "int4"},
+	"INTEGER":                  {DataType: "integer", UdtName: "int4"},
+	"UINTEGER":                 {DataType: "bigint", UdtName: "int8"},
+	"BIGINT":                   {DataType: "bigint", UdtName: "int8"},
+	"UBIGINT":                  {DataType: "numeric", UdtName: "numeric", NumericPrecision: "38", NumericScale: "0"},
+	"HUGEINT":                  {DataType: "numeric", UdtName: "numeric", NumericPrecision: "38", NumericScale: "0"},
+	"UHUGEINT":                 {DataType: "numeric", UdtName: "numeric", NumericPrecision: "38", NumericScale: "0"},
+	"FLOAT":                    {DataType: "real", UdtName: "float4"},
+	"DOUBLE":                   {DataType: "double precision", UdtName: "float8"},
+	"DATE":                     {DataType: "date", UdtName: "date"},
+	"TIME":                     {DataType: "time without time zone", UdtName: "time", DatetimePrecision: "6"},
+	"TIMESTAMP":                {DataType: "timestamp without time zone", UdtName: "timestamp", DatetimePrecision: "6"},
+	"TIMESTAMP WITH TIME ZONE": {DataType: "timestamp with time zone", UdtName: "timestamptz", DatetimePrecision: "6"},
+	"UUID":                     {DataType: "uuid", UdtName: "uuid"},
+}
+
+// CREATE MATERIALIZED VIEW [IF NOT EXISTS] schema.view AS query.
+// Returns the number of written rows, and false if the view already exists and ifNotExists is set.
+func (remapper *QueryRemapperView) CreateMaterializedView(viewDefinition ViewDefinition, ifNotExists bool) (rowCount int64, created bool, err error) {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err = remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		return 0, false, err
+	}
+	remapper.syncViews()
+
+	schemaTable := viewDefinition.SchemaTable()
+	viewDefinitions := remapper.remapperTable.ViewDefinitions()
+	if remapper.remapperTable.icebergSchemaTableExists(schemaTable) || viewDefinitionIndex(viewDefinitions, schemaTable) != -1 {
+		if ifNotExists {
+			return 0, false, nil
+		}
+		return 0, false, &PgError{Code: PG_ERROR_CODE_DUPLICATE_TABLE, Message: "relation \"" + viewDefinition.Name + "\" already exists"}
+	}
+
+	rowCount, err = remapper.writeMaterializedView(viewDefinition)
+	if err != nil {
+		remapper.icebergWriter.DeleteSchemaTable(schemaTable) // Partially written files
+		return 0, false, err
+	}
+
+	viewDefinitions = append(viewDefinitions, viewDefinition)
+	err = remapper.icebergWriter.WriteViewDefinitions(viewDefinitions)
+	if err != nil {
+		remapper.icebergWriter.DeleteSchemaTable(schemaTable)
+		return 0, false, err
+	}
+
+	remapper.remapperTable.setViewDefinitions(viewDefinitions)
+	remapper.remapperTable.reloadIceberSchemaTablesAfterWrite() // Create the DuckDB view of the new Iceberg table
+	return rowCount, true, nil
+}
+
+// REFRESH MATERIALIZED VIEW schema.view -> a new snapshot of the Iceberg table
+func (remapper *QueryRemapperView) RefreshMaterializedView(schemaTable IcebergSchemaTable) error {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err := remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		return err
+	}
+	remapper.syncViews()
+
+	viewDefinitions := remapper.remapperTable.ViewDefinitions()
+	index := viewDefinitionIndex(viewDefinitions, schemaTable)
+	if index == -1 || !viewDefinitions[index].Materialized {
+		if index != -1 || remapper.remapperTable.icebergSchemaTableExists(schemaTable) {
+			return &PgError{Code: PG_ERROR_CODE_WRONG_OBJECT_TYPE, Message: "\"" + schemaTable.Table + "\" is not a materialized view"}
+		}
+		return &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + schemaTable.Table + "\" does not exist"}
+	}
+
+	_, err = remapper.writeMaterializedView(viewDefinitions[index])
+	if err != nil {
+		return err
+	}
+
+	remapper.remapperTable.reloadIceberSchemaTablesAfterWrite() // Point the DuckDB view to the new snapshot
+	return nil
+}
+
+// DROP MATERIALIZED VIEW [IF EXISTS] schema.view. Returns false if the view doesn't exist and missingOk is set.
+func (remapper *QueryRemapperView) DropMaterializedView(schemaTable IcebergSchemaTable, missingOk bool) (bool, error) {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err := remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		return false, err
+	}
+	remapper.syncViews()
+
+	viewDefinitions := remapper.remapperTable.ViewDefinitions()
+	index := viewDefinitionIndex(viewDefinitions, schemaTable)
+	if index == -1 || !viewDefinitions[index].Materialized {
+		if index != -1 || remapper.remapperTable.icebergSchemaTableExists(schemaTable) {
+			return false, &PgError{Code: PG_ERROR_CODE_WRONG_OBJECT_TYPE, Message: "\"" + schemaTable.Table + "\" is not a materialized view"}
+		}
+		if missingOk {
+			return false, nil
+		}
+		return false, &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "materialized view \"" + schemaTable.Table + "\" does not exist"}
+	}
+
+	// The definition is deleted first, so that the table isn't left protected from syncs if the deletion fails
+	viewDefinitions = slices.Delete(viewDefinitions, index, index+1)
+	err = remapper.icebergWriter.WriteViewDefinitions(viewDefinitions)
+	if err != nil {
+		return false, err
+	}
+	remapper.remapperTable.setViewDefinitions(viewDefinitions)
+
+	remapper.icebergWriter.DeleteSchemaTable(schemaTable)
+	remapper.remapperTable.reloadIceberSchemaTablesAfterWrite() // Drop the DuckDB view of the deleted Iceberg table
+	return true, nil
+}
+
+// Refreshes all materialized views, e.g., after a sync. Failed refreshes are logged and don't stop the others.
+func (remapper *QueryRemapperView) RefreshMaterializedViews() {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err := remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		LogError(remapper.config, "Couldn't refresh materialized views:", err)
+		return
+	}
+	remapper.syncViews()
+
+	for _, viewDefinition := range remapper.remapperTable.ViewDefinitions() {
+		if !viewDefinition.Materialized {
+			continue
+		}
+
+		LogInfo(remapper.config, "Refreshing materialized view "+viewDefinition.SchemaTable().String()+"...")
+		_, err := remapper.writeMaterializedView(viewDefinition)
+		if err != nil {
+			LogError(remapper.config, "Couldn't refresh materialized view", viewDefinition.SchemaTable().String()+":", err)
+		}
+	}
+
+	remapper.remapperTable.reloadIceberSchemaTablesAfterWrite()
+}
+
+// Runs the view's query in DuckDB and writes the result as a new version of the Iceberg table.
+// The writer panics on errors, e.g., on values that don't fit the column type, so they're recovered as query errors.
+func (remapper *QueryRemapperView) writeMaterializedView(viewDefinition ViewDefinition) (rowCount int64, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("couldn't write materialized view %s: %v", viewDefinition.SchemaTable().String(), recovered)
+		}
+	}()
+
+	queryTree, err := pgQuery.Parse(viewDefinition.Query)
+	if err != nil {
+		return 0, err
+	}
+	if len(queryTree.Stmts) != 1 {
+		return 0, errors.New("unsupported view query: " + viewDefinition.Query)
+	}
+	err = remapper.remapperTable.RefreshIcebergViews(queryTree.Stmts[0])
+	if err != nil {
+		return 0, err
+	}
+
+	query, err := remapper.remappedViewQuery(viewDefinition)
+	if err != nil {
+		return 0, err
+	}
+
+	pgSchemaColumns, err := remapper.materializedViewColumns(viewDefinition, query)
+	if err != nil {
+		return 0, err
+	}
+
+	// Values are converted to text by DuckDB in the formats the Parquet writer parses, e.g., 2024-01-02 03:04:05.123456
+	ctx := context.Background()
+	rows, err := remapper.duckdb.QueryContext(ctx, "SELECT COLUMNS(*)::VARCHAR FROM ("+query+")")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	loadRows := textRowsLoader(rows, viewDefinition.SchemaTable(), pgSchemaColumns)
+	remapper.icebergWriter.Write(viewDefinition.SchemaTable(), pgSchemaColumns, func() [][]string {
+		batch := loadRows()
+		rowCount += int64(len(batch))
+		return batch
+	})
+
+	return rowCount, nil
+}
+
+// Iceberg table columns from the DuckDB result columns of the view's query, renamed to the view's column names if any
+func (remapper *QueryRemapperView) materializedViewColumns(viewDefinition ViewDefinition, query string) ([]PgSchemaColumn, error) {
+	rows, err := remapper.duckdb.QueryContext(context.Background(), "SELECT column_name, column_type, \"null\" FROM (DESCRIBE "+query+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return describedColumns(rows, viewDefinition.Columns)
+}
+
+// Iceberg table columns from the (column_name, column_type, null) rows of DuckDB's DESCRIBE, renamed to columnNames if any
+func describedColumns(rows *sql.Rows, columnNames []string) ([]PgSchemaColumn, error) {
+	var pgSchemaColumns []PgSchemaColumn
+	for rows.Next() {
+		var columnName, columnType, nullable string
+		err := rows.Scan(&columnName, &columnType, &nullable)
+		if err != nil {
+			return nil, err
+		}
+
+		position := len(pgSchemaColumns)
+		if position < len(columnNames) {
+			columnName = columnNames[position]
+		}
+		pgSchemaColumn := materializedViewColumn(columnName, columnType, position+1)
+		if nullable != PG_TRUE {
+			pgSchemaColumn.IsNullable = PG_FALSE
+		}
+		pgSchemaColumns = append(pgSchemaColumns, pgSchemaColumn)
+	}
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(columnNames) > len(pgSchemaColumns) {
+		return nil, errors.New("too many column names were specified")
+	}
+	for i, pgSchemaColumn := range pgSchemaColumns {
+		for _, otherPgSchemaColumn := range pgSchemaColumns[:i] {
+			if pgSchemaColumn.ColumnName == otherPgSchemaColumn.ColumnName {
+				return nil, &PgError{Code: PG_ERROR_CODE_DUPLICATE_COLUMN, Message: "column \"" + pgSchemaColumn.ColumnName + "\" specified more than once"}
+			}
+		}
+	}
+
+	return pgSchemaColumns, nil
+}
+
+// Reads the rows of a "SELECT COLUMNS(*)::VARCHAR" query in batches for the Iceberg writer, which recovers the panics.
+// NULL values of NOT NULL columns are rejected before anything is written.
+func textRowsLoader(rows *sql.Rows, schemaTable IcebergSchemaTable, pgSchemaColumns []PgSchemaColumn) func() [][]string {
+	return func() [][]string {
+		var batch [][]string
+		for len(batch) < BATCH_SIZE && rows.Next() {
+			values := make([]sql.NullString, len(pgSchemaColumns))
+			valuePtrs := make([]interface{}, len(values))
+			for i := range values {
+				valuePtrs[i] = &values[i]
+			}
+			PanicIfError(rows.Scan(valuePtrs...))
+
+			row := make([]string, len(values))
+			for i, value := range values {
+				if value.Valid {
+					row[i] = value.String
+				} else if pgSchemaColumns[i].IsNullable == PG_TRUE {
+					row[i] = PG_NULL_STRING
+				} else {
+					panic(&PgError{
+						Code:    PG_ERROR_CODE_NOT_NULL_VIOLATION,
+						Message: "null value in column \"" + pgSchemaColumns[i].ColumnName + "\" of relation \"" + schemaTable.Table + "\" violates not-null constraint",
+					})
+				}
+			}
+			batch = append(batch, row)
+		}
+		PanicIfError(rows.Err())
+		return batch
+	}
+}
+
+func materializedViewColumn(columnName string, duckdbType string, position int) PgSchemaColumn {
+	pgSchemaColumn, ok := MATERIALIZED_VIEW_COLUMN_TYPES[duckdbType]
+	if !ok {
+		var precision, scale int
+		if _, err := fmt.Sscanf(duckdbType, "DECIMAL(%d,%d)", &precision, &scale); err == nil {
+			pgSchemaColumn = PgSchemaColumn{DataType: "numeric", UdtName: "numeric", NumericPrecision: IntToString(precision), NumericScale: IntToString(scale)}
+		} else {
+			pgSchemaColumn = PgSchemaColumn{DataType: "text", UdtName: "text"}
+		}
+	}
+
+	pgSchemaColumn.ColumnName = columnName
+	pgSchemaColumn.IsNullable = PG_TRUE
+	pgSchemaColumn.OrdinalPosition = IntToString(position)
+	pgSchemaColumn.Namespace = PG_SCHEMA_PG_CATALOG
+	return pgSchemaColumn
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Tables created with CREATE TABLE in schemas that aren't synced from PostgreSQL, e.g., reference data loaded with COPY.
+// They're registered next to the Iceberg tables, so that syncs don't delete them, and each INSERT or COPY FROM
+// appends a new snapshot to the Iceberg table.
+type QueryRemapperNativeTable struct {
+	remapperTable *QueryRemapperTable
+	icebergWriter *IcebergWriter
+	config        *Config
+	mutex         sync.Mutex
+}
+
+func NewQueryRemapperNativeTable(config *Config, remapperTable *QueryRemapperTable) *QueryRemapperNativeTable {
+	// Tables are written to schema/table, since the schema prefix only applies to synced PostgreSQL schemas
+	writerConfig := *config
+	writerConfig.Pg.SchemaPrefix = ""
+
+	return &QueryRemapperNativeTable{
+		remapperTable: remapperTable,
+		icebergWriter: NewIcebergWriter(&writerConfig),
+		config:        config,
+	}
+}
+
+// CREATE TABLE [IF NOT EXISTS] schema.table (columns) [AS query], with the rows of the query if any.
+// Returns the number of written rows, and false if the table already exists and ifNotExists is set.
+func (remapper *QueryRemapperNativeTable) CreateTable(nativeTable NativeTable, ifNotExists bool, loadRows func() [][]string) (rowCount int64, created bool, err error) {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err = remapper.remapperTable.reloadIceberSchemaTables() // Don't overwrite the tables created by other instances
+	if err != nil {
+		return 0, false, err
+	}
+
+	schemaTable := nativeTable.SchemaTable()
+	if remapper.remapperTable.icebergSchemaTableExists(schemaTable) || remapper.viewExists(schemaTable) {
+		if ifNotExists {
+			return 0, false, nil
+		}
+		return 0, false, &PgError{Code: PG_ERROR_CODE_DUPLICATE_TABLE, Message: "relation \"" + nativeTable.Name + "\" already exists"}
+	}
+	if nativeTable.Schema == PG_SCHEMA_PG_CATALOG || nativeTable.Schema == PG_SCHEMA_INFORMATION_SCHEMA || remapper.isSyncedSchema(nativeTable.Schema) {
+		return 0, false, &PgError{
+			Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+			Message: "cannot create table in schema \"" + nativeTable.Schema + "\", which is synced from PostgreSQL",
+		}
+	}
+
+	if loadRows == nil {
+		loadRows = func() [][]string { return nil }
+	}
+	rowCount, err = remapper.appendRows(nativeTable, loadRows)
+	if err != nil {
+		remapper.icebergWriter.DeleteSchemaTable(schemaTable) // Partially written files
+		return 0, false, err
+	}
+
+	nativeTables := append(remapper.remapperTable.NativeTables(), nativeTable)
+	err = remapper.icebergWriter.WriteNativeTables(nativeTables)
+	if err != nil {
+		remapper.icebergWriter.DeleteSchemaTable(schemaTable)
+		return 0, false, err
+	}
+
+	remapper.remapperTable.setNativeTables(nativeTables)
+	remapper.remapperTable.reloadIceberSchemaTablesAfterWrite() // Create the DuckDB view of the new Iceberg table
+	return rowCount, true, nil
+}
+
+// INSERT INTO schema.table and COPY schema.table FROM STDIN -> a new snapshot with the appended rows.
+// Returns the number of written rows.
+func (remapper *QueryRemapperNativeTable) AppendRows(schemaTable IcebergSchemaTable, loadRows func() [][]string) (int64, error) {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err := remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		return 0, err
+	}
+
+	nativeTable, ok := remapper.remapperTable.nativeTable(schemaTable)
+	if !ok {
+		return 0, &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "relation \"" + schemaTable.Table + "\" does not exist"}
+	}
+
+	rowCount, err := remapper.appendRows(nativeTable, loadRows)
+	if err != nil {
+		return 0, err
+	}
+
+	remapper.remapperTable.reloadIceberSchemaTablesAfterWrite() // Point the DuckDB view to the new snapshot
+	return rowCount, nil
+}
+
+// DROP TABLE [IF EXISTS] schema.table. Returns false if the table doesn't exist and missingOk is set.
+func (remapper *QueryRemapperNativeTable) DropTable(schemaTable IcebergSchemaTable, missingOk bool) (bool, error) {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err := remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		return false, err
+	}
+
+	nativeTables := remapper.remapperTable.NativeTables()
+	index := slices.IndexFunc(nativeTables, func(nativeTable NativeTable) bool { return nativeTable.SchemaTable() == schemaTable })
+	if index == -1 {
+		if remapper.remapperTable.icebergSchemaTableExists(schemaTable) {
+			return false, &PgError{
+				Code:    PG_ERROR_CODE_FEATURE_NOT_SUPPORTED,
+				Message: "cannot drop table \"" + schemaTable.Table + "\", which is synced from PostgreSQL",
+			}
+		}
+		if missingOk {
+			return false, nil
+		}
+		return false, &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "table \"" + schemaTable.Table + "\" does not exist"}
+	}
+
+	// The table is unregistered first, so that it isn't left protected from syncs if the deletion fails
+	nativeTables = slices.Delete(nativeTables, index, index+1)
+	err = remapper.icebergWriter.WriteNativeTables(nativeTables)
+	if err != nil {
+		return false, err
+	}
+	remapper.remapperTable.setNativeTables(nativeTables)
+
+	remapper.icebergWriter.DeleteSchemaTable(schemaTable)
+	remapper.remapperTable.reloadIceberSchemaTablesAfterWrite() // Drop the DuckDB view of the deleted Iceberg table
+	return true, nil
+}
+
+func (remapper *QueryRemapperNativeTable) NativeTable(schemaTable IcebergSchemaTable) (NativeTable, bool) {
+	return remapper.remapperTable.nativeTable(schemaTable)
+}
+
+// The writer panics on errors, e.g., on values that don't fit the column type, so they're recovered as query errors
+func (remapper *QueryRemapperNativeTable) appendRows(nativeTable NativeTable, loadRows func() [][]string) (rowCount int64, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			if pgError, ok := recovered.(*PgError); ok {
+				err = pgError
+			} else {
+				err = fmt.Errorf("couldn't write table %s: %v", nativeTable.SchemaTable().String(), recovered)
+			}
+		}
+	}()
+
+	rowCount = remapper.icebergWriter.Append(nativeTable.SchemaTable(), nativeTable.Columns, loadRows)
+	return rowCount, nil
+}
+
+// Schemas with Iceberg tables synced from PostgreSQL, i.e., other than materialized views and native tables
+func (remapper *QueryRemapperNativeTable) isSyncedSchema(schema string) bool {
+	for _, icebergSchemaTable := range remapper.remapperTable.icebergSchemaTables {
+		if icebergSchemaTable.Schema != schema {
+			continue
+		}
+		if _, ok := remapper.remapperTable.nativeTable(icebergSchemaTable); ok {
+			continue
+		}
+		if viewDefinition, ok := remapper.remapperTable.viewDefinition(icebergSchemaTable); ok && viewDefinition.Materialized {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (remapper *QueryRemapperNativeTable) viewExists(schemaTable IcebergSchemaTable) bool {
+	_, ok := remapper.remapperTable.viewDefinition(schemaTable)
+	return ok
+}
@@ -18,11 +18,43 @@ func NewQueryRemapperSelect(config *Config) *QueryRemapperSelect {
 	}
 }
 
-func (remapper *QueryRemapperSelect) RemapFunctionToConstant(functionCall *pgQuery.FuncCall) *pgQuery.Node {
-	return remapper.parserFunction.RemapToConstant(functionCall)
+// PG_FUNCTION() in any expression, including arguments of other functions
+func (remapper *QueryRemapperSelect) RemapFunctionCall(node *pgQuery.Node) *pgQuery.Node {
+	functionCall := node.GetFuncCall()
+
+	renamedNameFunction := remapper.remappedFunctionName(functionCall)
+	if renamedNameFunction != nil {
+		functionCall = renamedNameFunction
+	}
+
+	remappedArgsFunction := remapper.remappedFunctionArgs(functionCall)
+	if remappedArgsFunction != nil {
+		functionCall = remappedArgsFunction
+	}
+
+	constantNode := remapper.parserFunction.RemapToConstant(functionCall)
+	if constantNode != nil {
+		return constantNode
+	}
+
+	node.Node = &pgQuery.Node_FuncCall{FuncCall: functionCall}
+	return node
 }
 
-// SELECT ...
+// ORDER BY PG_FUNCTION() -> ORDER BY 'constant'::text, since DuckDB rejects ORDER BY non-integer literals
+func (remapper *QueryRemapperSelect) RemapSortBy(sortBy *pgQuery.SortBy) {
+	functionCall := sortBy.Node.GetFuncCall()
+	if functionCall == nil {
+		return
+	}
+
+	constantNode := remapper.parserFunction.RemapToConstant(functionCall)
+	if constantNode != nil {
+		sortBy.Node = remapper.parserFunction.utils.MakeTypeCastNode(constantNode, "text")
+	}
+}
+
+// SELECT ... (nested function calls are remapped by RemapFunctionCall)
 func (remapper *QueryRemapperSelect) RemapSelect(targetNode *pgQuery.Node) *pgQuery.Node {
 	// PG_FUNCTION().value
 	newTargetNode := remapper.remappedInderectionFunctionCall(targetNode)
@@ -63,8 +95,6 @@ func (remapper *QueryRemapperSelect) RemapSelect(targetNode *pgQuery.Node) *pgQu
 		remapper.parserSelect.SetDefaultTargetName(targetNode, schemaFunction.Function)
 	}
 
-	remapper.remapNestedFunctionCalls(functionCall) // recursive
-
 	return targetNode
 }
 
@@ -113,6 +143,10 @@ func (remapper *QueryRemapperSelect) remappedFunctionName(functionCall *pgQuery.
 	case schemaFunction.Function == PG_FUNCTION_ACLEXPLODE:
 		return remapper.parserFunction.RemapAclExplode(functionCall)
 
+	// pg_catalog.pg_get_viewdef(view_oid, pretty_bool) -> main.bemidb_pg_get_viewdef(view_oid)
+	case (schemaFunction.Schema == PG_SCHEMA_PG_CATALOG || schemaFunction.Schema == "") && schemaFunction.Function == PG_FUNCTION_PG_GET_VIEWDEF:
+		return remapper.parserFunction.RemapPgGetViewdef(functionCall)
+
 	default:
 		return nil
 	}
@@ -126,34 +160,5 @@ func (remapper *QueryRemapperSelect) remappedFunctionArgs(functionCall *pgQuery.
 		return remapper.parserFunction.RemoveThirdArgument(functionCall)
 	}
 
-	// pg_catalog.pg_get_viewdef(view_oid, pretty_bool) -> pg_catalog.pg_get_viewdef(view_oid)
-	if (schemaFunction.Schema == PG_SCHEMA_PG_CATALOG || schemaFunction.Schema == "") && schemaFunction.Function == PG_FUNCTION_PG_GET_VIEWDEF {
-		return remapper.parserFunction.RemoveSecondArgument(functionCall)
-	}
-
 	return nil
 }
-
-func (remapper *QueryRemapperSelect) remapNestedFunctionCalls(functionCall *pgQuery.FuncCall) *pgQuery.FuncCall {
-	nestedFunctionCalls := remapper.parserFunction.NestedFunctionCalls(functionCall)
-
-	for i, nestedFunctionCall := range nestedFunctionCalls {
-		if nestedFunctionCall == nil {
-			continue
-		}
-
-		renamedFunctionCall := remapper.remappedFunctionName(nestedFunctionCall)
-		if renamedFunctionCall != nil {
-			nestedFunctionCall = renamedFunctionCall
-		}
-
-		constantNode := remapper.parserFunction.RemapToConstant(nestedFunctionCall)
-		if constantNode != nil {
-			remapper.parserFunction.OverrideFunctionCallArg(functionCall, i, constantNode)
-		}
-
-		remapper.remapNestedFunctionCalls(nestedFunctionCall)
-	}
-
-	return functionCall
-}
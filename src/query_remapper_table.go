@@ -1,18 +1,72 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
 
 	pgQuery "github.com/pganalyze/pg_query_go/v5"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-var REDUNDANT_PG_NAMESPACE_OIDS = []int64{0, 1148, 1253, 1264, 1265, 1266, 1267}
+// Temporary table macro on each session's DuckDB connection, replaced by the query handler before it's read
+const PG_PREPARED_STATEMENTS_MACRO = "bemidb_pg_prepared_statements"
+
+// DuckDB table macros that present the DuckDB views of Iceberg tables as tables (or materialized views) in the catalog,
+// user-defined views with their original definitions from main.bemidb_pg_views() and main.bemidb_pg_matviews(),
+// and the session's temporary tables in the pg_temp schema
+var ICEBERG_CATALOG_MACROS = map[string]string{
+	"bemidb_pg_class": `SELECT * REPLACE (
+		CASE WHEN oid IN (` + MATERIALIZED_VIEW_OIDS_QUERY + `) THEN 'm' WHEN oid IN (` + ICEBERG_VIEW_OIDS_QUERY + `) THEN 'r' ELSE relkind END AS relkind
+	) FROM pg_catalog.pg_class`,
+	"bemidb_information_schema_tables": `SELECT * REPLACE (
+		CASE WHEN table_catalog = 'temp' THEN 'pg_temp' ELSE table_schema END AS table_schema,
+		CASE WHEN table_catalog <> 'temp' AND (table_schema || '.' || table_name) IN (` + ICEBERG_VIEW_NAMES_QUERY + `) THEN 'BASE TABLE' ELSE table_type END AS table_type,
+		CASE WHEN table_catalog <> 'temp' AND (table_schema || '.' || table_name) IN (` + ICEBERG_VIEW_NAMES_QUERY + `) THEN 'YES' ELSE is_insertable_into END AS is_insertable_into
+	) FROM information_schema.tables
+	WHERE (table_schema || '.' || table_name) NOT IN (SELECT schemaname || '.' || matviewname FROM main.bemidb_pg_matviews())`,
+	// Schemas without 'main' schemas and duplicate 'pg_catalog' and 'information_schema' schemas, and the temporary schema
+	// once the session has temporary tables. Temporary schemas have different oids on each session's connection.
+	"bemidb_pg_namespace": `SELECT * REPLACE (
+		CASE WHEN oid IN (` + TEMP_SCHEMA_OIDS_QUERY + `) THEN 'pg_temp' ELSE nspname END AS nspname
+	) FROM pg_catalog.pg_namespace
+	WHERE oid IN (SELECT oid FROM duckdb_schemas() WHERE database_name NOT IN ('system', 'temp') AND schema_name <> 'main')
+		OR oid IN (` + TEMP_SCHEMA_OIDS_QUERY + `)`,
+	"bemidb_information_schema_views": `SELECT views.* REPLACE (pg_views.definition AS view_definition)
+		FROM information_schema.views
+		JOIN main.bemidb_pg_views() pg_views ON pg_views.schemaname = views.table_schema AND pg_views.viewname = views.table_name`,
+}
+
+// pg_get_viewdef(view_oid) -> original definition of a user-defined (materialized) view
+const PG_GET_VIEWDEF_MACRO = `CREATE OR REPLACE MACRO main.bemidb_pg_get_viewdef(object_oid) AS (
+	SELECT pg_views.definition
+	FROM duckdb_views() views
+	JOIN (
+		SELECT schemaname, viewname, definition FROM main.bemidb_pg_views()
+		UNION ALL
+		SELECT schemaname, matviewname, definition FROM main.bemidb_pg_matviews()
+	) pg_views ON pg_views.schemaname = views.schema_name AND pg_views.viewname = views.view_name
+	WHERE views.view_oid = object_oid
+)`
+
+// The DuckDB views of Iceberg tables from main.bemidb_iceberg_tables(), other views with the same definition are still views
+const ICEBERG_VIEW_OIDS_QUERY = "SELECT views.view_oid FROM duckdb_views() views JOIN main.bemidb_iceberg_tables() iceberg_tables ON iceberg_tables.schemaname = views.schema_name AND iceberg_tables.tablename = views.view_name WHERE NOT views.temporary"
+const ICEBERG_VIEW_NAMES_QUERY = "SELECT schemaname || '.' || tablename FROM main.bemidb_iceberg_tables()"
+const TEMP_SCHEMA_OIDS_QUERY = "SELECT DISTINCT schema_oid FROM duckdb_tables() WHERE temporary"
+const MATERIALIZED_VIEW_OIDS_QUERY = "SELECT views.view_oid FROM duckdb_views() views JOIN main.bemidb_pg_matviews() pg_matviews ON pg_matviews.schemaname = views.schema_name AND pg_matviews.matviewname = views.view_name"
 
 type QueryRemapperTable struct {
 	parserTable         *ParserTable
 	parserWhere         *ParserWhere
 	parserFunction      *ParserFunction
 	icebergSchemaTables []IcebergSchemaTable
+	icebergViewPaths    map[IcebergSchemaTable]string // Metadata files read by the DuckDB views of the Iceberg tables
+	icebergViewMutex    sync.Mutex
+	viewDefinitions     []ViewDefinition // User-defined (materialized) views, created in DuckDB (or Iceberg) by QueryRemapperView
+	nativeTables        []NativeTable    // Tables created with CREATE TABLE, written as Iceberg tables by QueryRemapperNativeTable
 	icebergReader       *IcebergReader
 	duckdb              *Duckdb
 	config              *Config
@@ -20,14 +74,19 @@ type QueryRemapperTable struct {
 
 func NewQueryRemapperTable(config *Config, icebergReader *IcebergReader, duckdb *Duckdb) *QueryRemapperTable {
 	remapper := &QueryRemapperTable{
-		parserTable:    NewParserTable(config),
-		parserWhere:    NewParserWhere(config),
-		parserFunction: NewParserFunction(config),
-		icebergReader:  icebergReader,
-		duckdb:         duckdb,
-		config:         config,
-	}
-	remapper.reloadIceberSchemaTables()
+		parserTable:      NewParserTable(config),
+		parserWhere:      NewParserWhere(config),
+		parserFunction:   NewParserFunction(config),
+		icebergViewPaths: make(map[IcebergSchemaTable]string),
+		icebergReader:    icebergReader,
+		duckdb:           duckdb,
+		config:           config,
+	}
+	err := remapper.reloadIceberSchemaTables()
+	PanicIfError(err)
+	remapper.createViewDefinitionsMacro()
+	remapper.createIcebergTablesMacro()
+	remapper.createIcebergCatalogMacros()
 	return remapper
 }
 
@@ -52,10 +111,13 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 		case PG_TABLE_PG_ROLES:
 			return parser.MakePgRolesNode(remapper.config.User, qSchemaTable.Alias)
 
-		// pg_catalog.pg_class -> reload Iceberg tables
+		// pg_catalog.pg_class -> show the views of Iceberg tables as tables
 		case PG_TABLE_PG_CLASS:
-			remapper.reloadIceberSchemaTables()
-			return node
+			return parser.MakeIcebergCatalogNode(qSchemaTable, "bemidb_pg_class")
+
+		// pg_catalog.pg_namespace -> return user schemas and the session's temporary schema as pg_temp
+		case PG_TABLE_PG_NAMESPACE:
+			return parser.MakeIcebergCatalogNode(qSchemaTable, "bemidb_pg_namespace")
 
 		// pg_catalog.pg_inherits -> return nothing
 		case PG_TABLE_PG_INHERITS:
@@ -97,17 +159,21 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 		case PG_TABLE_PG_STAT_ACTIVITY:
 			return parser.MakeEmptyTableNode(PG_TABLE_PG_STAT_ACTIVITY, PG_STAT_ACTIVITY_DEFINITION, qSchemaTable.Alias)
 
-		// pg_views -> return empty table
+		// pg_views -> return user-defined views
 		case PG_TABLE_PG_VIEWS:
-			return parser.MakeEmptyTableNode(PG_TABLE_PG_VIEWS, PG_VIEWS_DEFINITION, qSchemaTable.Alias)
+			return parser.MakeIcebergCatalogNode(qSchemaTable, "bemidb_pg_views")
 
-		// pg_matviews -> return empty table
+		// pg_matviews -> return user-defined materialized views
 		case PG_TABLE_PG_MATVIEWS:
-			return parser.MakeEmptyTableNode(PG_TABLE_PG_MATVIEWS, PG_MATVIEWS_DEFINITION, qSchemaTable.Alias)
+			return parser.MakeIcebergCatalogNode(qSchemaTable, "bemidb_pg_matviews")
+
+		// pg_prepared_statements -> return the session's prepared statements
+		case PG_TABLE_PG_PREPARED_STATEMENTS:
+			return parser.MakeSessionCatalogNode(qSchemaTable, PG_PREPARED_STATEMENTS_MACRO)
 
 		// pg_stat_user_tables -> return hard-coded table info
 		case PG_TABLE_PG_STAT_USER_TABLES:
-			return parser.MakePgStatUserTablesNode(remapper.icebergSchemaTables, qSchemaTable.Alias)
+			return parser.MakePgStatUserTablesNode(remapper.IcebergSchemaTables(), qSchemaTable.Alias)
 
 		// pg_collation -> return hard-coded collation (encoding) info
 		case PG_TABLE_PG_COLLATION:
@@ -131,10 +197,13 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 	if parser.IsTableFromInformationSchema(qSchemaTable) {
 		switch qSchemaTable.Table {
 
-		// information_schema.tables -> reload Iceberg tables
+		// information_schema.tables -> show the views of Iceberg tables as tables
 		case PG_TABLE_TABLES:
-			remapper.reloadIceberSchemaTables()
-			return node
+			return parser.MakeIcebergCatalogNode(qSchemaTable, "bemidb_information_schema_tables")
+
+		// information_schema.views -> return user-defined views
+		case PG_TABLE_VIEWS:
+			return parser.MakeIcebergCatalogNode(qSchemaTable, "bemidb_information_schema_views")
 
 		// information_schema.* other system tables -> return as is
 		default:
@@ -142,19 +211,66 @@ func (remapper *QueryRemapperTable) RemapTable(node *pgQuery.Node) *pgQuery.Node
 		}
 	}
 
-	// iceberg.table -> FROM iceberg_scan('iceberg/schema/table/metadata/v1.metadata.json', skip_schema_inference = true)
-	if qSchemaTable.Schema == "" {
-		qSchemaTable.Schema = PG_SCHEMA_PUBLIC
+	// pg_temp.table -> temp.main.table
+	if qSchemaTable.Schema == PG_SCHEMA_PG_TEMP {
+		return parser.RemapTempTable(node)
 	}
-	schemaTable := qSchemaTable.ToIcebergSchemaTable()
-	if !remapper.icebergSchemaTableExists(schemaTable) {
-		remapper.reloadIceberSchemaTables()
+
+	// iceberg.table -> DuckDB view over iceberg_scan(), refreshed periodically by ReloadCatalog
+	return node
+}
+
+// Points the DuckDB views of the Iceberg tables referenced anywhere in the statement, directly or by user-defined views,
+// to the latest metadata files, e.g., to refresh a materialized view from the latest syncs
+func (remapper *QueryRemapperTable) RefreshIcebergViews(statement *pgQuery.RawStmt) error {
+	schemaTables := remapper.querySchemaTables(statement.ProtoReflect())
+
+	reloaded := false
+	expandedViews := make(map[IcebergSchemaTable]bool)
+	for i := 0; i < len(schemaTables); i++ {
+		schemaTable := schemaTables[i]
+
+		if viewDefinition, ok := remapper.viewDefinition(schemaTable); ok && !viewDefinition.Materialized {
+			if !expandedViews[schemaTable] {
+				expandedViews[schemaTable] = true
+				schemaTables = append(schemaTables, remapper.viewQuerySchemaTables(viewDefinition)...)
+			}
+			continue
+		}
+
 		if !remapper.icebergSchemaTableExists(schemaTable) {
-			return node // Let it return "Catalog Error: Table with name _ does not exist!"
+			if reloaded {
+				continue // E.g., a CTE name, let DuckDB resolve it
+			}
+			err := remapper.reloadIceberSchemaTables()
+			if err != nil {
+				return err
+			}
+			reloaded = true
+			continue
 		}
+
+		remapper.icebergViewMutex.Lock()
+		_, viewCreated := remapper.icebergViewPaths[schemaTable]
+		remapper.refreshIcebergView(schemaTable)
+		if _, ok := remapper.icebergViewPaths[schemaTable]; ok && !viewCreated {
+			remapper.createIcebergTablesMacro()
+		}
+		remapper.icebergViewMutex.Unlock()
+	}
+	return nil
+}
+
+// pg_catalog.table.column -> table.column, since remapped system tables are subqueries aliased by the table name
+func (remapper *QueryRemapperTable) RemapColumnRef(columnRef *pgQuery.ColumnRef) {
+	if len(columnRef.Fields) != 3 {
+		return
+	}
+
+	schema := columnRef.Fields[0].GetString_().GetSval()
+	if schema == PG_SCHEMA_PG_CATALOG || schema == PG_SCHEMA_INFORMATION_SCHEMA {
+		columnRef.Fields = columnRef.Fields[1:]
 	}
-	icebergPath := remapper.icebergReader.MetadataFilePath(schemaTable)
-	return parser.MakeIcebergTableNode(icebergPath, qSchemaTable)
 }
 
 // FROM [PG_FUNCTION()]
@@ -202,15 +318,6 @@ func (remapper *QueryRemapperTable) RemapWhereClauseForTable(qSchemaTable QueryS
 	if remapper.isTableFromPgCatalog(qSchemaTable) {
 		switch qSchemaTable.Table {
 
-		// FROM pg_catalog.pg_namespace -> FROM pg_catalog.pg_namespace WHERE oid NOT IN (3 'main' schema oids, 2 'pg_catalog' and 2 'information_schema' duplicate oids)
-		case PG_TABLE_PG_NAMESPACE:
-			alias := qSchemaTable.Alias
-			if alias == "" {
-				alias = PG_TABLE_PG_NAMESPACE
-			}
-			withoutDuckdbOidsWhereCondition := remapper.parserWhere.MakeNotInExpressionNode("oid", REDUNDANT_PG_NAMESPACE_OIDS, alias)
-			remapper.parserWhere.AppendWhereCondition(selectStatement, withoutDuckdbOidsWhereCondition)
-
 		// FROM pg_catalog.pg_statio_user_tables -> FROM pg_catalog.pg_statio_user_tables WHERE false
 		case PG_TABLE_PG_STATIO_USER_TABLES:
 			falseWhereCondition := remapper.parserWhere.MakeFalseConditionNode()
@@ -233,19 +340,262 @@ func (remapper *QueryRemapperTable) RemapOrderByForTable(qSchemaTable QuerySchem
 	return selectStatement
 }
 
-func (remapper *QueryRemapperTable) reloadIceberSchemaTables() {
+// Returns an error if the Iceberg tables can't be read from the storage, the DuckDB views are kept as they are
+func (remapper *QueryRemapperTable) reloadIceberSchemaTables() error {
 	icebergSchemaTables, err := remapper.icebergReader.SchemaTables()
-	PanicIfError(err)
+	if err != nil {
+		return err
+	}
+	viewDefinitions, viewDefinitionsErr := remapper.icebergReader.ViewDefinitions()
+	if viewDefinitionsErr != nil {
+		LogWarn(remapper.config, "Couldn't read view definitions:", viewDefinitionsErr)
+	}
+	nativeTables, nativeTablesErr := remapper.icebergReader.NativeTables()
+	if nativeTablesErr != nil {
+		LogWarn(remapper.config, "Couldn't read native tables:", nativeTablesErr)
+	}
 
-	ctx := context.Background()
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+
+	icebergViewSchemaTables := remapper.icebergViewSchemaTables()
 	for _, icebergSchemaTable := range icebergSchemaTables {
-		remapper.duckdb.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+icebergSchemaTable.String()+" (id INT)", nil)
+		remapper.refreshIcebergView(icebergSchemaTable)
+	}
+	for icebergSchemaTable := range remapper.icebergViewPaths {
+		if !slices.Contains(icebergSchemaTables, icebergSchemaTable) {
+			remapper.dropIcebergView(icebergSchemaTable)
+		}
+	}
+	if !slices.Equal(icebergViewSchemaTables, remapper.icebergViewSchemaTables()) {
+		remapper.createIcebergTablesMacro()
 	}
 
 	remapper.icebergSchemaTables = icebergSchemaTables
+	if viewDefinitionsErr == nil && !reflect.DeepEqual(viewDefinitions, remapper.viewDefinitions) {
+		remapper.viewDefinitions = viewDefinitions
+		remapper.createViewDefinitionsMacro()
+	}
+	if nativeTablesErr == nil {
+		remapper.nativeTables = nativeTables
+	}
+	return nil
+}
+
+// After a change is written to the storage, a failed reload is logged and retried by the next catalog reload
+func (remapper *QueryRemapperTable) reloadIceberSchemaTablesAfterWrite() {
+	err := remapper.reloadIceberSchemaTables()
+	if err != nil {
+		LogWarn(remapper.config, "Couldn't reload Iceberg tables:", err)
+	}
+}
+
+// CREATE OR REPLACE VIEW schema.table AS SELECT * FROM iceberg_scan('path', skip_schema_inference = true).
+// Sessions in a transaction block keep reading the view version from the start of their DuckDB transaction.
+func (remapper *QueryRemapperTable) refreshIcebergView(icebergSchemaTable IcebergSchemaTable) {
+	metadataFilePath := remapper.icebergReader.MetadataFilePath(icebergSchemaTable)
+	if remapper.icebergViewPaths[icebergSchemaTable] == metadataFilePath {
+		return
+	}
+
+	ctx := context.Background()
+	_, err := remapper.duckdb.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS \"$schema\"", map[string]string{"schema": icebergSchemaTable.Schema})
+	if err == nil {
+		_, err = remapper.duckdb.ExecContext(
+			ctx,
+			"CREATE OR REPLACE VIEW "+icebergSchemaTable.String()+" AS SELECT * FROM iceberg_scan('$path', skip_schema_inference = true)",
+			map[string]string{"path": metadataFilePath},
+		)
+	}
+	if err != nil {
+		LogWarn(remapper.config, "Couldn't create DuckDB view for", icebergSchemaTable.String()+":", err)
+		return
+	}
+	remapper.icebergViewPaths[icebergSchemaTable] = metadataFilePath
+}
+
+// Iceberg tables deleted by a sync
+func (remapper *QueryRemapperTable) dropIcebergView(icebergSchemaTable IcebergSchemaTable) {
+	_, err := remapper.duckdb.ExecContext(context.Background(), "DROP VIEW IF EXISTS "+icebergSchemaTable.String(), nil)
+	if err != nil {
+		LogWarn(remapper.config, "Couldn't drop DuckDB view for", icebergSchemaTable.String()+":", err)
+		return
+	}
+	delete(remapper.icebergViewPaths, icebergSchemaTable)
+}
+
+// Iceberg tables with DuckDB views, sorted by schema and table names
+func (remapper *QueryRemapperTable) icebergViewSchemaTables() []IcebergSchemaTable {
+	return slices.SortedFunc(maps.Keys(remapper.icebergViewPaths), func(a, b IcebergSchemaTable) int {
+		return cmp.Or(cmp.Compare(a.Schema, b.Schema), cmp.Compare(a.Table, b.Table))
+	})
+}
+
+// main.bemidb_iceberg_tables() -> VALUES(schemaname, tablename) of the Iceberg tables with DuckDB views
+func (remapper *QueryRemapperTable) createIcebergTablesMacro() {
+	selectStatement := remapper.parserTable.MakeIcebergTablesSelectNode(remapper.icebergViewSchemaTables())
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: selectStatement}}})
+	PanicIfError(err)
+
+	_, err = remapper.duckdb.ExecContext(context.Background(), "CREATE OR REPLACE MACRO main.bemidb_iceberg_tables() AS TABLE "+query, nil)
+	PanicIfError(err)
+}
+
+func (remapper *QueryRemapperTable) createIcebergCatalogMacros() {
+	for macroName, query := range ICEBERG_CATALOG_MACROS {
+		_, err := remapper.duckdb.ExecContext(context.Background(), "CREATE OR REPLACE MACRO main."+macroName+"() AS TABLE "+query, nil)
+		PanicIfError(err)
+	}
+	_, err := remapper.duckdb.ExecContext(context.Background(), PG_GET_VIEWDEF_MACRO, nil)
+	PanicIfError(err)
+}
+
+// main.bemidb_pg_views() -> VALUES(schemaname, viewname, viewowner, definition) of the user-defined views,
+// main.bemidb_pg_matviews() -> VALUES(schemaname, matviewname, matviewowner, ..., definition) of the materialized views
+func (remapper *QueryRemapperTable) createViewDefinitionsMacro() {
+	macroSelectStatements := map[string]*pgQuery.Node{
+		"bemidb_pg_views":    remapper.parserTable.MakePgViewsSelectNode(remapper.viewDefinitions, remapper.config.User),
+		"bemidb_pg_matviews": remapper.parserTable.MakePgMatviewsSelectNode(remapper.viewDefinitions, remapper.config.User),
+	}
+
+	for macroName, selectStatement := range macroSelectStatements {
+		query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: selectStatement}}})
+		PanicIfError(err)
+
+		_, err = remapper.duckdb.ExecContext(context.Background(), "CREATE OR REPLACE MACRO main."+macroName+"() AS TABLE "+query, nil)
+		PanicIfError(err)
+	}
+}
+
+// temp.main.bemidb_pg_prepared_statements() -> VALUES(name, statement, prepare_time, ...) of the session's prepared statements
+func (remapper *QueryRemapperTable) PgPreparedStatementsMacroQuery(rowsValues [][]string) string {
+	selectStatement := remapper.parserTable.MakePgPreparedStatementsSelectNode(rowsValues)
+	query, err := pgQuery.Deparse(&pgQuery.ParseResult{Stmts: []*pgQuery.RawStmt{{Stmt: selectStatement}}})
+	PanicIfError(err)
+	return "CREATE OR REPLACE TEMP MACRO " + PG_PREPARED_STATEMENTS_MACRO + "() AS TABLE SELECT * REPLACE (result_types::TEXT AS result_types) FROM (" + query + ")" // NULL values aren't typed
+}
+
+// User-defined (materialized) views in the order of creation
+func (remapper *QueryRemapperTable) ViewDefinitions() []ViewDefinition {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	return slices.Clone(remapper.viewDefinitions)
+}
+
+// After a user-defined (materialized) view is created, replaced or dropped
+func (remapper *QueryRemapperTable) setViewDefinitions(viewDefinitions []ViewDefinition) {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	remapper.viewDefinitions = viewDefinitions
+	remapper.createViewDefinitionsMacro()
+}
+
+func (remapper *QueryRemapperTable) viewDefinition(schemaTable IcebergSchemaTable) (ViewDefinition, bool) {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	for _, viewDefinition := range remapper.viewDefinitions {
+		if viewDefinition.SchemaTable() == schemaTable {
+			return viewDefinition, true
+		}
+	}
+	return ViewDefinition{}, false
+}
+
+// Tables created with CREATE TABLE in the order of creation
+func (remapper *QueryRemapperTable) NativeTables() []NativeTable {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	return slices.Clone(remapper.nativeTables)
+}
+
+// After a table is created or dropped
+func (remapper *QueryRemapperTable) setNativeTables(nativeTables []NativeTable) {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	remapper.nativeTables = nativeTables
+}
+
+func (remapper *QueryRemapperTable) nativeTable(schemaTable IcebergSchemaTable) (NativeTable, bool) {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	for _, nativeTable := range remapper.nativeTables {
+		if nativeTable.SchemaTable() == schemaTable {
+			return nativeTable, true
+		}
+	}
+	return NativeTable{}, false
+}
+
+// Tables (and views) referenced in the user-defined view's query
+// Iceberg tables read by the statement, including the ones read by the views it references, without duplicates
+func (remapper *QueryRemapperTable) QueryIcebergSchemaTables(statement *pgQuery.RawStmt) []IcebergSchemaTable {
+	schemaTables := remapper.querySchemaTables(statement.ProtoReflect())
+
+	var icebergSchemaTables []IcebergSchemaTable
+	expandedViews := make(map[IcebergSchemaTable]bool)
+	for i := 0; i < len(schemaTables); i++ {
+		schemaTable := schemaTables[i]
+
+		if viewDefinition, ok := remapper.viewDefinition(schemaTable); ok && !viewDefinition.Materialized {
+			if !expandedViews[schemaTable] {
+				expandedViews[schemaTable] = true
+				schemaTables = append(schemaTables, remapper.viewQuerySchemaTables(viewDefinition)...)
+			}
+			continue
+		}
+
+		if remapper.icebergSchemaTableExists(schemaTable) && !slices.Contains(icebergSchemaTables, schemaTable) {
+			icebergSchemaTables = append(icebergSchemaTables, schemaTable)
+		}
+	}
+	return icebergSchemaTables
+}
+
+func (remapper *QueryRemapperTable) viewQuerySchemaTables(viewDefinition ViewDefinition) []IcebergSchemaTable {
+	queryTree, err := pgQuery.Parse(viewDefinition.Query)
+	if err != nil {
+		return nil
+	}
+	return remapper.querySchemaTables(queryTree.ProtoReflect())
+}
+
+// schema.table referenced in the query, except system tables
+func (remapper *QueryRemapperTable) querySchemaTables(message protoreflect.Message) []IcebergSchemaTable {
+	var schemaTables []IcebergSchemaTable
+	walkQueryTree(message, func(node protoreflect.Message) {
+		rangeVar, ok := node.Interface().(*pgQuery.RangeVar)
+		if !ok {
+			return
+		}
+		qSchemaTable := QuerySchemaTable{Schema: rangeVar.Schemaname, Table: rangeVar.Relname}
+		if remapper.isTableFromPgCatalog(qSchemaTable) || remapper.parserTable.IsTableFromInformationSchema(qSchemaTable) {
+			return
+		}
+		if qSchemaTable.Schema == "" {
+			qSchemaTable.Schema = PG_SCHEMA_PUBLIC
+		}
+		schemaTables = append(schemaTables, qSchemaTable.ToIcebergSchemaTable())
+	})
+	return schemaTables
+}
+
+// Iceberg tables last reloaded from the storage
+func (remapper *QueryRemapperTable) IcebergSchemaTables() []IcebergSchemaTable {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	return slices.Clone(remapper.icebergSchemaTables)
+}
+
+// Metadata file read by the table's DuckDB view, empty if the table isn't an Iceberg table
+func (remapper *QueryRemapperTable) IcebergViewMetadataFilePath(icebergSchemaTable IcebergSchemaTable) string {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
+	return remapper.icebergViewPaths[icebergSchemaTable]
 }
 
 func (remapper *QueryRemapperTable) icebergSchemaTableExists(schemaTable IcebergSchemaTable) bool {
+	remapper.icebergViewMutex.Lock()
+	defer remapper.icebergViewMutex.Unlock()
 	for _, icebergSchemaTable := range remapper.icebergSchemaTables {
 		if icebergSchemaTable == schemaTable {
 			return true
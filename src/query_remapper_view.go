@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+)
+
+// User-defined views: definitions are stored next to the Iceberg tables, so that every BemiDB instance sees them,
+// and each view is created in DuckDB with the remapped query. Materialized views are written as Iceberg tables instead.
+type QueryRemapperView struct {
+	remapperTable  *QueryRemapperTable
+	icebergWriter  *IcebergWriter
+	duckdb         *Duckdb
+	config         *Config
+	remapQueryTree func(node *pgQuery.Node) *pgQuery.Node
+	syncedViews    map[IcebergSchemaTable]ViewDefinition // Definitions the DuckDB views were created from, except materialized views
+	mutex          sync.Mutex
+}
+
+func NewQueryRemapperView(config *Config, remapperTable *QueryRemapperTable, duckdb *Duckdb, remapQueryTree func(node *pgQuery.Node) *pgQuery.Node) *QueryRemapperView {
+	// Materialized views are written to schema/view, since the schema prefix only applies to synced PostgreSQL schemas
+	writerConfig := *config
+	writerConfig.Pg.SchemaPrefix = ""
+
+	return &QueryRemapperView{
+		remapperTable:  remapperTable,
+		icebergWriter:  NewIcebergWriter(&writerConfig),
+		duckdb:         duckdb,
+		config:         config,
+		remapQueryTree: remapQueryTree,
+		syncedViews:    make(map[IcebergSchemaTable]ViewDefinition),
+	}
+}
+
+// Creates, replaces and drops the DuckDB views to match the view definitions last read from storage,
+// e.g., after another BemiDB instance changed them. CREATE and DROP VIEW update the DuckDB views directly.
+func (remapper *QueryRemapperView) SyncViews() {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+	remapper.syncViews()
+}
+
+// CREATE [OR REPLACE] VIEW schema.view AS query
+func (remapper *QueryRemapperView) CreateView(viewDefinition ViewDefinition, replace bool) error {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err := remapper.remapperTable.reloadIceberSchemaTables() // Don't overwrite the views created by other instances
+	if err != nil {
+		return err
+	}
+	remapper.syncViews()
+
+	schemaTable := viewDefinition.SchemaTable()
+	viewDefinitions := remapper.remapperTable.ViewDefinitions()
+	index := viewDefinitionIndex(viewDefinitions, schemaTable)
+	if remapper.remapperTable.icebergSchemaTableExists(schemaTable) || (index != -1 && !replace) {
+		return &PgError{Code: PG_ERROR_CODE_DUPLICATE_TABLE, Message: "relation \"" + viewDefinition.Name + "\" already exists"}
+	}
+
+	err = remapper.createDuckdbView(viewDefinition)
+	if err != nil {
+		return err
+	}
+
+	if index == -1 {
+		viewDefinitions = append(viewDefinitions, viewDefinition)
+	} else {
+		viewDefinitions[index] = viewDefinition
+	}
+	err = remapper.icebergWriter.WriteViewDefinitions(viewDefinitions)
+	if err != nil {
+		remapper.restoreDuckdbView(schemaTable)
+		return err
+	}
+
+	remapper.remapperTable.setViewDefinitions(viewDefinitions)
+	remapper.syncedViews[schemaTable] = viewDefinition
+	return nil
+}
+
+// DROP VIEW [IF EXISTS] schema.view. Returns false if the view doesn't exist and missingOk is set.
+func (remapper *QueryRemapperView) DropView(schemaTable IcebergSchemaTable, missingOk bool) (bool, error) {
+	remapper.mutex.Lock()
+	defer remapper.mutex.Unlock()
+
+	err := remapper.remapperTable.reloadIceberSchemaTables()
+	if err != nil {
+		return false, err
+	}
+	remapper.syncViews()
+
+	viewDefinitions := remapper.remapperTable.ViewDefinitions()
+	index := viewDefinitionIndex(viewDefinitions, schemaTable)
+	if remapper.remapperTable.icebergSchemaTableExists(schemaTable) || (index != -1 && viewDefinitions[index].Materialized) {
+		return false, &PgError{Code: PG_ERROR_CODE_WRONG_OBJECT_TYPE, Message: "\"" + schemaTable.Table + "\" is not a view"}
+	}
+	if index == -1 {
+		if missingOk {
+			return false, nil
+		}
+		return false, &PgError{Code: PG_ERROR_CODE_UNDEFINED_TABLE, Message: "view \"" + schemaTable.Table + "\" does not exist"}
+	}
+
+	err = remapper.dropDuckdbView(schemaTable)
+	if err != nil {
+		return false, err
+	}
+
+	viewDefinitions = slices.Delete(viewDefinitions, index, index+1)
+	err = remapper.icebergWriter.WriteViewDefinitions(viewDefinitions)
+	if err != nil {
+		remapper.restoreDuckdbView(schemaTable)
+		return false, err
+	}
+
+	remapper.remapperTable.setViewDefinitions(viewDefinitions)
+	delete(remapper.syncedViews, schemaTable)
+	return true, nil
+}
+
+func (remapper *QueryRemapperView) syncViews() {
+	viewDefinitions := remapper.remapperTable.ViewDefinitions()
+
+	for schemaTable := range remapper.syncedViews {
+		index := viewDefinitionIndex(viewDefinitions, schemaTable)
+		if index == -1 {
+			err := remapper.dropDuckdbView(schemaTable)
+			if err != nil {
+				LogWarn(remapper.config, "Couldn't drop DuckDB view for", schemaTable.String()+":", err)
+			}
+			delete(remapper.syncedViews, schemaTable)
+		} else if viewDefinitions[index].Materialized {
+			delete(remapper.syncedViews, schemaTable) // Replaced with the DuckDB view of the Iceberg table
+		}
+	}
+
+	var pendingViewDefinitions []ViewDefinition
+	for _, viewDefinition := range viewDefinitions {
+		if !viewDefinition.Materialized && !reflect.DeepEqual(remapper.syncedViews[viewDefinition.SchemaTable()], viewDefinition) {
+			pendingViewDefinitions = append(pendingViewDefinitions, viewDefinition)
+		}
+	}
+
+	// A replaced view can depend on views created after it, so the failed views are retried while there's progress
+	for len(pendingViewDefinitions) > 0 {
+		var failedViewDefinitions []ViewDefinition
+		var errs []error
+		for _, viewDefinition := range pendingViewDefinitions {
+			err := remapper.createDuckdbView(viewDefinition)
+			if err != nil {
+				failedViewDefinitions = append(failedViewDefinitions, viewDefinition)
+				errs = append(errs, err)
+				continue
+			}
+			remapper.syncedViews[viewDefinition.SchemaTable()] = viewDefinition
+		}
+
+		if len(failedViewDefinitions) == len(pendingViewDefinitions) {
+			for i, viewDefinition := range failedViewDefinitions {
+				LogWarn(remapper.config, "Couldn't create DuckDB view for", viewDefinition.SchemaTable().String()+":", errs[i])
+				remapper.syncedViews[viewDefinition.SchemaTable()] = viewDefinition // Not retried until the definition changes
+			}
+			break
+		}
+		pendingViewDefinitions = failedViewDefinitions
+	}
+}
+
+// CREATE OR REPLACE VIEW "schema"."view" ("column", ...) AS remapped query
+func (remapper *QueryRemapperView) createDuckdbView(viewDefinition ViewDefinition) error {
+	query, err := remapper.remappedViewQuery(viewDefinition)
+	if err != nil {
+		return err
+	}
+
+	columns := ""
+	if len(viewDefinition.Columns) > 0 {
+		columns = " (\"" + strings.Join(viewDefinition.Columns, "\", \"") + "\")"
+	}
+
+	_, err = remapper.duckdb.ExecContext(
+		context.Background(),
+		"CREATE OR REPLACE VIEW "+viewDefinition.SchemaTable().String()+columns+" AS "+query,
+		nil,
+	)
+	return err
+}
+
+// The view's SELECT query remapped for DuckDB
+func (remapper *QueryRemapperView) remappedViewQuery(viewDefinition ViewDefinition) (string, error) {
+	queryTree, err := pgQuery.Parse(viewDefinition.Query)
+	if err != nil {
+		return "", err
+	}
+	if len(queryTree.Stmts) != 1 || queryTree.Stmts[0].Stmt.GetSelectStmt() == nil {
+		return "", errors.New("unsupported view query: " + viewDefinition.Query)
+	}
+
+	queryTree.Stmts[0].Stmt = remapper.remapQueryTree(queryTree.Stmts[0].Stmt)
+	return pgQuery.Deparse(queryTree)
+}
+
+func (remapper *QueryRemapperView) dropDuckdbView(schemaTable IcebergSchemaTable) error {
+	_, err := remapper.duckdb.ExecContext(context.Background(), "DROP VIEW IF EXISTS "+schemaTable.String(), nil)
+	return err
+}
+
+// Reverts the DuckDB view to the last synced definition if the change couldn't be stored
+func (remapper *QueryRemapperView) restoreDuckdbView(schemaTable IcebergSchemaTable) {
+	viewDefinition, ok := remapper.syncedViews[schemaTable]
+	if !ok {
+		remapper.dropDuckdbView(schemaTable)
+		return
+	}
+	remapper.createDuckdbView(viewDefinition)
+}
+
+func viewDefinitionIndex(viewDefinitions []ViewDefinition, schemaTable IcebergSchemaTable) int {
+	return slices.IndexFunc(viewDefinitions, func(viewDefinition ViewDefinition) bool {
+		return viewDefinition.SchemaTable() == schemaTable
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	pgQuery "github.com/pganalyze/pg_query_go/v5"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var PG_QUERY_NODE_ONEOF = (&pgQuery.Node{}).ProtoReflect().Descriptor().Oneofs().ByName("node")
+var PG_QUERY_NODE_FIELDS = pgQueryNodeFields() // Node oneof fields by their message type, e.g., pg_query.SelectStmt -> select_stmt
+
+// Visits every node in a parsed query tree
+func walkQueryTree(message protoreflect.Message, visit func(node protoreflect.Message)) {
+	visit(message)
+
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Kind() != protoreflect.MessageKind {
+			return true
+		}
+
+		if field.IsList() {
+			list := value.List()
+			for i := 0; i < list.Len(); i++ {
+				walkQueryTree(list.Get(i).Message(), visit)
+			}
+		} else if !field.IsMap() {
+			walkQueryTree(value.Message(), visit)
+		}
+		return true
+	})
+}
+
+// Visits every node in a parsed query tree, parents before children, and replaces it with the node returned by visit.
+// Replaced nodes aren't visited further, so remappers don't see their own output. Fields that hold a node type
+// directly, e.g., SelectStmt.Larg, are visited as nodes too, but replacements of a different type are ignored.
+func visitQueryTree(node *pgQuery.Node, visit func(node *pgQuery.Node) *pgQuery.Node) *pgQuery.Node {
+	remappedNode := visit(node)
+	if remappedNode != node {
+		return remappedNode
+	}
+
+	oneofField := node.ProtoReflect().WhichOneof(PG_QUERY_NODE_ONEOF)
+	if oneofField != nil {
+		visitQueryTreeFields(node.ProtoReflect().Get(oneofField).Message(), visit)
+	}
+	return node
+}
+
+func visitQueryTreeFields(message protoreflect.Message, visit func(node *pgQuery.Node) *pgQuery.Node) {
+	var fields []protoreflect.FieldDescriptor
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.Kind() == protoreflect.MessageKind && !field.IsMap() {
+			fields = append(fields, field)
+		}
+		return true
+	})
+
+	for _, field := range fields {
+		if field.IsList() {
+			list := message.Mutable(field).List()
+			for i := 0; i < list.Len(); i++ {
+				list.Set(i, visitQueryTreeValue(list.Get(i), visit))
+			}
+		} else {
+			message.Set(field, visitQueryTreeValue(message.Get(field), visit))
+		}
+	}
+}
+
+func visitQueryTreeValue(value protoreflect.Value, visit func(node *pgQuery.Node) *pgQuery.Node) protoreflect.Value {
+	message := value.Message()
+
+	if node, ok := message.Interface().(*pgQuery.Node); ok {
+		return protoreflect.ValueOfMessage(visitQueryTree(node, visit).ProtoReflect())
+	}
+
+	// E.g., *pgQuery.SelectStmt -> &pgQuery.Node{Node: &pgQuery.Node_SelectStmt{...}}
+	oneofField, ok := PG_QUERY_NODE_FIELDS[message.Descriptor().FullName()]
+	if !ok {
+		visitQueryTreeFields(message, visit)
+		return value
+	}
+
+	node := &pgQuery.Node{}
+	node.ProtoReflect().Set(oneofField, value)
+	remappedNode := visitQueryTree(node, visit)
+	if remappedNode.ProtoReflect().WhichOneof(PG_QUERY_NODE_ONEOF) != oneofField {
+		return value
+	}
+	return remappedNode.ProtoReflect().Get(oneofField)
+}
+
+func pgQueryNodeFields() map[protoreflect.FullName]protoreflect.FieldDescriptor {
+	nodeFields := make(map[protoreflect.FullName]protoreflect.FieldDescriptor)
+	fields := PG_QUERY_NODE_ONEOF.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		nodeFields[fields.Get(i).Message().FullName()] = fields.Get(i)
+	}
+	return nodeFields
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+var errQueryCanceled = errors.New("canceling statement due to user request")
+var errStatementTimeout = errors.New("canceling statement due to statement timeout")
+var errAdminShutdown = errors.New("terminating connection due to administrator command")
+
+// Per-connection state shared by the simple and extended query protocols
+type Session struct {
+	processId               uint32 // Sent in BackendKeyData to identify the session in CancelRequest
+	secretKey               uint32
+	user                    string
+	duckdb                  *Duckdb // Dedicated DuckDB connection for settings and temporary objects, opened on the first query
+	preparedStatements      map[string]*PreparedStatement
+	portals                 map[string]*Portal // Created by Bind, closed on Sync outside of a transaction block
+	cursors                 map[string]*Portal // Created by DECLARE ... CURSOR, closed by CLOSE or at the end of a transaction block
+	transaction             *Transaction       // nil outside of a transaction block
+	statementTimeout        time.Duration      // 0 means no timeout
+	defaultStatementTimeout time.Duration      // Restored by SET statement_timeout TO DEFAULT and RESET
+	timeZone                *time.Location     // Set by SET timezone to format timestamptz values, UTC if nil
+	mutex                   sync.Mutex         // Guards ctx and cancel, which are used by CancelRequest from another connection
+	ctx                     context.Context
+	cancel                  context.CancelCauseFunc
+	receive                 func() (pgproto3.FrontendMessage, error) // Reads the data of COPY FROM STDIN from the client
+	registry                *SessionRegistry                         // Set by Register, nil for sessions without query limits
+	querySlotHolders        int                                      // The running query and the open portals and cursors share one query slot
+}
+
+func NewSession() *Session {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &Session{
+		preparedStatements: make(map[string]*PreparedStatement),
+		portals:            make(map[string]*Portal),
+		cursors:            make(map[string]*Portal),
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+}
+
+func (session *Session) Close() {
+	session.closePortals()
+	session.closeCursors()
+	session.closePreparedStatements()
+	session.closeDuckdb()
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.cancel(nil)
+}
+
+// DISCARD ALL: resets the session to its initial state. Settings and temporary objects are dropped
+// with the DuckDB connection, and a new connection is opened on the next query.
+func (session *Session) Discard() {
+	session.closePortals()
+	session.closeCursors()
+	session.closePreparedStatements()
+	session.closeDuckdb()
+	session.statementTimeout = session.defaultStatementTimeout
+	session.timeZone = nil
+}
+
+func (session *Session) closePortals() {
+	for name, portal := range session.portals {
+		portal.Close()
+		delete(session.portals, name)
+	}
+}
+
+func (session *Session) closeCursors() {
+	for name, cursor := range session.cursors {
+		cursor.Close()
+		delete(session.cursors, name)
+	}
+}
+
+func (session *Session) closePreparedStatements() {
+	for name, preparedStatement := range session.preparedStatements {
+		preparedStatement.Close()
+		delete(session.preparedStatements, name)
+	}
+}
+
+func (session *Session) closeDuckdb() {
+	if session.duckdb != nil {
+		session.duckdb.Close()
+		session.duckdb = nil
+	}
+	if session.transaction != nil {
+		session.transaction.snapshotStarted = false // Rolled back with the connection
+	}
+}
+
+func (session *Session) TxStatus() byte {
+	switch {
+	case session.transaction == nil:
+		return PG_TX_STATUS_IDLE
+	case session.transaction.failed:
+		return PG_TX_STATUS_FAILED
+	default:
+		return PG_TX_STATUS_IN_TRANSACTION
+	}
+}
+
+// Marks the transaction block as failed after an error, so that other statements are rejected until it ends
+func (session *Session) FailTransaction() {
+	if session.transaction != nil {
+		session.transaction.failed = true
+	}
+}
+
+// Context for running a query, which lives until the query's portal is closed
+func (session *Session) queryContext() (context.Context, context.CancelCauseFunc) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return context.WithCancelCause(session.ctx)
+}
+
+// Query slot for a portal or a cursor whose rows stay open after the current message, released by Portal.Close
+func (session *Session) acquireQuerySlot() (release func(), err error) {
+	if session.registry == nil {
+		return func() {}, nil
+	}
+	return session.registry.AcquireQuerySlot(session)
+}
+
+// Cancels the query if the current statement doesn't finish within statement_timeout. Returns a function to stop the timer.
+func (session *Session) startStatementTimer(cancel context.CancelCauseFunc) func() bool {
+	if session.statementTimeout == 0 {
+		return func() bool { return false }
+	}
+	timer := time.AfterFunc(session.statementTimeout, func() { cancel(errStatementTimeout) })
+	return timer.Stop
+}
+
+// Cancels the running queries and the open portals. New queries use a fresh context.
+func (session *Session) CancelQuery() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.cancel(errQueryCanceled)
+	session.ctx, session.cancel = context.WithCancelCause(context.Background())
+}
+
+// Cancels the running queries on shutdown
+func (session *Session) Terminate() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.cancel(errAdminShutdown)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Transaction block started with BEGIN. Transactions are read-only, and each Iceberg table is read
+// from the same snapshot (metadata file version) throughout the transaction.
+type Transaction struct {
+	failed          bool
+	savepoints      []string
+	snapshotStarted bool // DuckDB transaction on the session's connection, started by the first query
+}
+
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Sessions of open connections by process ID to handle CancelRequest, and the connection and query limits
+type SessionRegistry struct {
+	config     *Config
+	mutex      sync.Mutex
+	sessions   map[uint32]*Session
+	querySlots map[string]chan struct{} // Per user, queries wait for a free slot in order
+}
+
+func NewSessionRegistry(config *Config) *SessionRegistry {
+	return &SessionRegistry{
+		config:     config,
+		sessions:   make(map[uint32]*Session),
+		querySlots: make(map[string]chan struct{}),
+	}
+}
+
+// Assigns a unique process ID and a random secret key to the session.
+// Returns an error if there are too many connections, the last slot is reserved for the admin user.
+func (registry *SessionRegistry) Register(session *Session) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if maxConnections := registry.config.MaxConnections; maxConnections > 0 {
+		if int64(len(registry.sessions)) >= maxConnections {
+			return &PgError{Code: PG_ERROR_CODE_TOO_MANY_CONNECTIONS, Message: "sorry, too many clients already"}
+		}
+		if registry.config.AdminUser != "" && session.user != registry.config.AdminUser && int64(len(registry.sessions)) >= maxConnections-1 {
+			return &PgError{Code: PG_ERROR_CODE_TOO_MANY_CONNECTIONS, Message: "remaining connection slots are reserved for the admin user"}
+		}
+	}
+
+	for {
+		session.processId = randomUint32()
+		if _, ok := registry.sessions[session.processId]; !ok && session.processId != 0 {
+			break
+		}
+	}
+	session.secretKey = randomUint32()
+	session.registry = registry
+	registry.sessions[session.processId] = session
+	return nil
+}
+
+func (registry *SessionRegistry) Unregister(session *Session) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.sessions[session.processId] == session {
+		delete(registry.sessions, session.processId)
+	}
+}
+
+// Returns false if there is no session with the process ID and the secret key
+func (registry *SessionRegistry) CancelQuery(processId uint32, secretKey uint32) bool {
+	registry.mutex.Lock()
+	session, ok := registry.sessions[processId]
+	registry.mutex.Unlock()
+
+	if !ok || session.secretKey != secretKey {
+		return false
+	}
+	session.CancelQuery()
+	return true
+}
+
+// Waits until the session's user has fewer than max-user-queries running queries, or the query is canceled.
+// A session holds one slot while it runs a query or has open portals or cursors, which keep their queries running.
+// Returns a function to release the slot after the query, or when the portal is closed.
+func (registry *SessionRegistry) AcquireQuerySlot(session *Session) (release func(), err error) {
+	if registry.config.MaxUserQueries == 0 || (registry.config.AdminUser != "" && session.user == registry.config.AdminUser) {
+		return func() {}, nil
+	}
+
+	registry.mutex.Lock()
+	slots, ok := registry.querySlots[session.user]
+	if !ok {
+		slots = make(chan struct{}, registry.config.MaxUserQueries)
+		registry.querySlots[session.user] = slots
+	}
+	registry.mutex.Unlock()
+
+	if session.querySlotHolders == 0 {
+		err := registry.waitForQuerySlot(session, slots)
+		if err != nil {
+			return nil, err
+		}
+	}
+	session.querySlotHolders++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			session.querySlotHolders--
+			if session.querySlotHolders == 0 {
+				<-slots
+			}
+		})
+	}, nil
+}
+
+func (registry *SessionRegistry) waitForQuerySlot(session *Session, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	LogDebug(registry.config, "Waiting for a query slot for user", session.user)
+	ctx, cancel := session.queryContext()
+	defer cancel(nil)
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return queryCanceledError(ctx, context.Cause(ctx))
+	}
+}
+
+func randomUint32() uint32 {
+	bytes := make([]byte, 4)
+	_, err := rand.Read(bytes)
+	PanicIfError(err)
+	return binary.BigEndian.Uint32(bytes)
+}
@@ -34,22 +34,64 @@ type MetadataFile struct {
 	Path    string
 }
 
+// CREATE VIEW schema.name (columns) AS query, with the original PostgreSQL query
+type ViewDefinition struct {
+	Schema       string   `json:"schema"`
+	Name         string   `json:"name"`
+	Columns      []string `json:"columns,omitempty"`
+	Query        string   `json:"query"`
+	Materialized bool     `json:"materialized,omitempty"` // Stored as an Iceberg table with the same name
+}
+
+func (viewDefinition ViewDefinition) SchemaTable() IcebergSchemaTable {
+	return IcebergSchemaTable{Schema: viewDefinition.Schema, Table: viewDefinition.Name}
+}
+
+// CREATE TABLE schema.table (columns) in a schema that isn't synced from PostgreSQL, written as an Iceberg table
+type NativeTable struct {
+	Schema  string           `json:"schema"`
+	Name    string           `json:"name"`
+	Columns []PgSchemaColumn `json:"columns"`
+}
+
+func (nativeTable NativeTable) SchemaTable() IcebergSchemaTable {
+	return IcebergSchemaTable{Schema: nativeTable.Schema, Table: nativeTable.Name}
+}
+
+// Current snapshot of a table, which is extended by appending a new snapshot with the previous manifests
+type IcebergSnapshot struct {
+	SequenceNumber      int64
+	TotalDataFiles      int64
+	TotalRecords        int64
+	TotalFilesSize      int64
+	ManifestListRecords []map[string]interface{}
+}
+
 type Storage interface {
 	// Read
 	IcebergSchemas() (icebergSchemas []string, err error)
 	IcebergSchemaTables() (icebersSchemaTables []IcebergSchemaTable, err error)
-	IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) (path string)
+	IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) (path string) // Current version from the version hint
+	IcebergSchemaFields(metadataFilePath string) (icebergSchemaFields []IcebergSchemaField, err error)
+	IcebergSnapshotSummary(metadataFilePath string) (snapshot IcebergSnapshot, err error)
+	ViewDefinitions() (viewDefinitions []ViewDefinition, err error) // In the order of creation
+	NativeTables() (nativeTables []NativeTable, err error)          // In the order of creation
 
 	// Write
+	MetadataVersion(schemaTable IcebergSchemaTable) (version int64, err error) // 0 if the table doesn't exist
+	CurrentSnapshot(schemaTable IcebergSchemaTable, version int64) (snapshot IcebergSnapshot, err error)
 	DeleteSchema(schema string) (err error)
 	DeleteSchemaTable(schemaTable IcebergSchemaTable) (err error)
-	CreateDataDir(schemaTable IcebergSchemaTable) (dataDirPath string)
-	CreateMetadataDir(schemaTable IcebergSchemaTable) (metadataDirPath string)
+	DeleteOldVersions(schemaTable IcebergSchemaTable, minVersion int64) (err error)
+	CreateDataDir(schemaTable IcebergSchemaTable, version int64) (dataDirPath string)
+	CreateMetadataDir(schemaTable IcebergSchemaTable, version int64) (metadataDirPath string)
 	CreateParquet(dataDirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (parquetFile ParquetFile, err error)
 	CreateManifest(metadataDirPath string, parquetFile ParquetFile) (manifestFile ManifestFile, err error)
-	CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile) (manifestListFile ManifestListFile, err error)
-	CreateMetadata(metadataDirPath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error)
-	CreateVersionHint(metadataDirPath string, metadataFile MetadataFile) (err error)
+	CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile, previousSnapshot IcebergSnapshot) (manifestListFile ManifestListFile, err error)
+	CreateMetadata(schemaTable IcebergSchemaTable, version int64, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile, previousSnapshot IcebergSnapshot) (metadataFile MetadataFile, err error)
+	CreateVersionHint(schemaTable IcebergSchemaTable, metadataFile MetadataFile) (err error)
+	WriteViewDefinitions(viewDefinitions []ViewDefinition) (err error)
+	WriteNativeTables(nativeTables []NativeTable) (err error)
 }
 
 func NewStorage(config *Config) Storage {
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -23,9 +24,17 @@ const (
 	PARQUET_ROW_GROUP_SIZE   = 64 * 1024 * 1024 // 64 MB
 	PARQUET_COMPRESSION_TYPE = parquet.CompressionCodec_ZSTD
 
-	VERSION_HINT_FILE_NAME = "version-hint.text"
+	VERSION_HINT_FILE_NAME     = "version-hint.text"
+	VIEW_DEFINITIONS_FILE_NAME = "views.json"  // A file in the storage root, so that it isn't listed as a schema
+	NATIVE_TABLES_FILE_NAME    = "tables.json" // Same as views.json
+
+	// Tables written before data and manifest files were grouped by version only have v1.metadata.json
+	UNVERSIONED_METADATA_VERSION = 1
 )
 
+// data/v1/, metadata/v1/, metadata/v1.metadata.json
+var VERSION_ENTRY_REGEXP = regexp.MustCompile(`^v(\d+)(\.metadata\.json)?$`)
+
 type StorageBase struct {
 	config *Config
 }
@@ -260,7 +269,8 @@ func (storage *StorageBase) WriteManifestFile(fileSystemPrefix string, filePath
 	}, nil
 }
 
-func (storage *StorageBase) WriteManifestListFile(fileSystemPrefix string, filePath string, parquetFile ParquetFile, manifestFile ManifestFile) (err error) {
+// The manifests of the previous snapshot are kept when appending, so that the new snapshot includes their data files
+func (storage *StorageBase) WriteManifestListFile(fileSystemPrefix string, filePath string, parquetFile ParquetFile, manifestFile ManifestFile, previousSnapshot IcebergSnapshot) (err error) {
 	codec, err := goavro.NewCodec(MANIFEST_LIST_SCHEMA)
 	if err != nil {
 		return fmt.Errorf("failed to create Avro codec for manifest list: %v", err)
@@ -278,10 +288,10 @@ func (storage *StorageBase) WriteManifestListFile(fileSystemPrefix string, fileP
 		"key_metadata":         nil,
 		"manifest_length":      manifestFile.Size,
 		"manifest_path":        fileSystemPrefix + manifestFile.Path,
-		"min_sequence_number":  1,
+		"min_sequence_number":  previousSnapshot.SequenceNumber + 1,
 		"partition_spec_id":    0,
 		"partitions":           map[string]interface{}{"array": []string{}},
-		"sequence_number":      1,
+		"sequence_number":      previousSnapshot.SequenceNumber + 1,
 	}
 
 	avroFile, err := os.Create(filePath)
@@ -299,7 +309,13 @@ func (storage *StorageBase) WriteManifestListFile(fileSystemPrefix string, fileP
 		return fmt.Errorf("failed to create OCF writer for manifest list: %v", err)
 	}
 
-	err = ocfWriter.Append([]interface{}{manifestListRecord})
+	manifestListRecords := []interface{}{}
+	for _, previousManifestListRecord := range previousSnapshot.ManifestListRecords {
+		manifestListRecords = append(manifestListRecords, previousManifestListRecord)
+	}
+	manifestListRecords = append(manifestListRecords, manifestListRecord)
+
+	err = ocfWriter.Append(manifestListRecords)
 	if err != nil {
 		return fmt.Errorf("failed to write manifest list record: %v", err)
 	}
@@ -307,10 +323,11 @@ func (storage *StorageBase) WriteManifestListFile(fileSystemPrefix string, fileP
 	return nil
 }
 
-func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (err error) {
+func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile, previousSnapshot IcebergSnapshot) (err error) {
 	tableUuid := uuid.New().String()
 	lastColumnID := 3
 	currentTimestampMs := time.Now().UnixNano() / int64(time.Millisecond)
+	sequenceNumber := previousSnapshot.SequenceNumber + 1
 
 	icebergSchemaFields := make([]interface{}, len(pgSchemaColumns))
 	for i, pgSchemaColumn := range pgSchemaColumns {
@@ -321,7 +338,7 @@ func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath
 		"format-version":       2,
 		"table-uuid":           tableUuid,
 		"location":             fileSystemPrefix + filePath,
-		"last-sequence-number": 1,
+		"last-sequence-number": sequenceNumber,
 		"last-updated-ms":      currentTimestampMs,
 		"last-column-id":       lastColumnID,
 		"schemas": []interface{}{
@@ -354,7 +371,7 @@ func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath
 			map[string]interface{}{
 				"schema-id":       0,
 				"snapshot-id":     manifestFile.SnapshotId,
-				"sequence-number": 1,
+				"sequence-number": sequenceNumber,
 				"timestamp-ms":    currentTimestampMs,
 				"manifest-list":   fileSystemPrefix + manifestListFile.Path,
 				"summary": map[string]interface{}{
@@ -362,12 +379,12 @@ func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath
 					"added-files-size":       strconv.FormatInt(parquetFile.Size, 10),
 					"added-records":          strconv.FormatInt(parquetFile.RecordCount, 10),
 					"operation":              "append",
-					"total-data-files":       "1",
+					"total-data-files":       strconv.FormatInt(previousSnapshot.TotalDataFiles+1, 10),
 					"total-delete-files":     "0",
 					"total-equality-deletes": "0",
-					"total-files-size":       strconv.FormatInt(parquetFile.Size, 10),
+					"total-files-size":       strconv.FormatInt(previousSnapshot.TotalFilesSize+parquetFile.Size, 10),
 					"total-position-deletes": "0",
-					"total-records":          strconv.FormatInt(parquetFile.RecordCount, 10),
+					"total-records":          strconv.FormatInt(previousSnapshot.TotalRecords+parquetFile.RecordCount, 10),
 				},
 			},
 		},
@@ -402,6 +419,81 @@ func (storage *StorageBase) WriteMetadataFile(fileSystemPrefix string, filePath
 	return nil
 }
 
+// Fields of the current schema from the metadata file content
+func (storage *StorageBase) ParseIcebergSchemaFields(metadataContent []byte) (icebergSchemaFields []IcebergSchemaField, err error) {
+	var metadata struct {
+		Schemas []struct {
+			SchemaId int                  `json:"schema-id"`
+			Fields   []IcebergSchemaField `json:"fields"`
+		} `json:"schemas"`
+		CurrentSchemaId int `json:"current-schema-id"`
+	}
+	err = json.Unmarshal(metadataContent, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metadata file: %v", err)
+	}
+
+	for _, schema := range metadata.Schemas {
+		if schema.SchemaId == metadata.CurrentSchemaId {
+			return schema.Fields, nil
+		}
+	}
+	return nil, fmt.Errorf("current schema %d not found in metadata file", metadata.CurrentSchemaId)
+}
+
+// Current snapshot from the metadata file content, and the path of its manifest list
+func (storage *StorageBase) ParseCurrentSnapshot(metadataContent []byte) (snapshot IcebergSnapshot, manifestListPath string, err error) {
+	var metadata struct {
+		CurrentSnapshotId int64 `json:"current-snapshot-id"`
+		Snapshots         []struct {
+			SnapshotId     int64             `json:"snapshot-id"`
+			SequenceNumber int64             `json:"sequence-number"`
+			ManifestList   string            `json:"manifest-list"`
+			Summary        map[string]string `json:"summary"`
+		} `json:"snapshots"`
+	}
+	err = json.Unmarshal(metadataContent, &metadata)
+	if err != nil {
+		return IcebergSnapshot{}, "", fmt.Errorf("failed to parse metadata file: %v", err)
+	}
+
+	for _, metadataSnapshot := range metadata.Snapshots {
+		if metadataSnapshot.SnapshotId != metadata.CurrentSnapshotId {
+			continue
+		}
+
+		snapshot = IcebergSnapshot{SequenceNumber: metadataSnapshot.SequenceNumber}
+		for key, total := range map[string]*int64{
+			"total-data-files": &snapshot.TotalDataFiles,
+			"total-records":    &snapshot.TotalRecords,
+			"total-files-size": &snapshot.TotalFilesSize,
+		} {
+			*total, err = strconv.ParseInt(metadataSnapshot.Summary[key], 10, 64)
+			if err != nil {
+				return IcebergSnapshot{}, "", fmt.Errorf("invalid %s in metadata file: %v", key, err)
+			}
+		}
+		return snapshot, metadataSnapshot.ManifestList, nil
+	}
+	return IcebergSnapshot{}, "", fmt.Errorf("current snapshot %d not found in metadata file", metadata.CurrentSnapshotId)
+}
+
+func (storage *StorageBase) ReadManifestListRecords(manifestListContent []byte) (manifestListRecords []map[string]interface{}, err error) {
+	ocfReader, err := goavro.NewOCFReader(bytes.NewReader(manifestListContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCF reader for manifest list: %v", err)
+	}
+
+	for ocfReader.Scan() {
+		record, err := ocfReader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest list record: %v", err)
+		}
+		manifestListRecords = append(manifestListRecords, record.(map[string]interface{}))
+	}
+	return manifestListRecords, ocfReader.Err()
+}
+
 func (storage *StorageBase) WriteVersionHintFile(filePath string, metadataFile MetadataFile) (err error) {
 	versionHintFile, err := os.Create(filePath)
 	if err != nil {
@@ -417,6 +509,94 @@ func (storage *StorageBase) WriteVersionHintFile(filePath string, metadataFile M
 	return nil
 }
 
+func (storage *StorageBase) ParseVersionHint(versionHint []byte) (version int64, err error) {
+	version, err = strconv.ParseInt(strings.TrimSpace(string(versionHint)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid version hint: %v", err)
+	}
+	return version, nil
+}
+
+func (storage *StorageBase) WriteViewDefinitionsFile(filePath string, viewDefinitions []ViewDefinition) (err error) {
+	viewDefinitionsFile, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create view definitions file: %v", err)
+	}
+	defer viewDefinitionsFile.Close()
+
+	if viewDefinitions == nil {
+		viewDefinitions = []ViewDefinition{}
+	}
+	encoder := json.NewEncoder(viewDefinitionsFile)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(viewDefinitions)
+	if err != nil {
+		return fmt.Errorf("failed to write view definitions to file: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageBase) ParseViewDefinitions(viewDefinitionsContent []byte) (viewDefinitions []ViewDefinition, err error) {
+	err = json.Unmarshal(viewDefinitionsContent, &viewDefinitions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse view definitions file: %v", err)
+	}
+	return viewDefinitions, nil
+}
+
+func (storage *StorageBase) WriteNativeTablesFile(filePath string, nativeTables []NativeTable) (err error) {
+	nativeTablesFile, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create native tables file: %v", err)
+	}
+	defer nativeTablesFile.Close()
+
+	if nativeTables == nil {
+		nativeTables = []NativeTable{}
+	}
+	encoder := json.NewEncoder(nativeTablesFile)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(nativeTables)
+	if err != nil {
+		return fmt.Errorf("failed to write native tables to file: %v", err)
+	}
+
+	return nil
+}
+
+func (storage *StorageBase) ParseNativeTables(nativeTablesContent []byte) (nativeTables []NativeTable, err error) {
+	err = json.Unmarshal(nativeTablesContent, &nativeTables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse native tables file: %v", err)
+	}
+	return nativeTables, nil
+}
+
+func (storage *StorageBase) MetadataFileName(version int64) string {
+	return fmt.Sprintf("v%d.metadata.json", version)
+}
+
+// Whether an entry in the data/ or metadata/ directory belongs to a version older than minVersion.
+// Files written before tables were versioned are referenced by the unversioned v1.metadata.json,
+// so they are deleted together with it.
+func (storage *StorageBase) IsOldVersionEntry(name string, minVersion int64) bool {
+	if name == VERSION_HINT_FILE_NAME {
+		return false
+	}
+
+	version := int64(UNVERSIONED_METADATA_VERSION)
+	match := VERSION_ENTRY_REGEXP.FindStringSubmatch(name)
+	if match != nil {
+		var err error
+		version, err = strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return false
+		}
+	}
+	return version < minVersion
+}
+
 func (storage *StorageBase) buildFieldIDMap(schemaHandler *schema.SchemaHandler) map[string]int {
 	fieldIDMap := make(map[string]int)
 	for _, schema := range schemaHandler.SchemaElements {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/xitongsys/parquet-go-source/local"
@@ -21,7 +22,29 @@ func NewLocalStorage(config *Config) *StorageLocal {
 // Read ----------------------------------------------------------------------------------------------------------------
 
 func (storage *StorageLocal) IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) string {
-	return storage.tablePath(icebergSchemaTable, true) + "/metadata/v1.metadata.json"
+	tablePath := storage.tablePath(icebergSchemaTable, true)
+	version, err := storage.metadataVersion(tablePath)
+	if err != nil || version == 0 {
+		version = 1
+	}
+	return tablePath + "/metadata/" + storage.storageBase.MetadataFileName(version)
+}
+
+func (storage *StorageLocal) IcebergSchemaFields(metadataFilePath string) (icebergSchemaFields []IcebergSchemaField, err error) {
+	metadataContent, err := os.ReadFile(metadataFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata file: %v", err)
+	}
+	return storage.storageBase.ParseIcebergSchemaFields(metadataContent)
+}
+
+func (storage *StorageLocal) IcebergSnapshotSummary(metadataFilePath string) (snapshot IcebergSnapshot, err error) {
+	metadataContent, err := os.ReadFile(metadataFilePath)
+	if err != nil {
+		return IcebergSnapshot{}, fmt.Errorf("failed to read metadata file: %v", err)
+	}
+	snapshot, _, err = storage.storageBase.ParseCurrentSnapshot(metadataContent)
+	return snapshot, err
 }
 
 func (storage *StorageLocal) IcebergSchemas() (icebergSchemas []string, err error) {
@@ -56,6 +79,28 @@ func (storage *StorageLocal) IcebergSchemaTables() (icebergSchemaTables []Iceber
 	return icebergSchemaTables, nil
 }
 
+func (storage *StorageLocal) ViewDefinitions() (viewDefinitions []ViewDefinition, err error) {
+	viewDefinitionsContent, err := os.ReadFile(storage.absoluteIcebergPath(VIEW_DEFINITIONS_FILE_NAME))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read view definitions file: %v", err)
+	}
+	return storage.storageBase.ParseViewDefinitions(viewDefinitionsContent)
+}
+
+func (storage *StorageLocal) NativeTables() (nativeTables []NativeTable, err error) {
+	nativeTablesContent, err := os.ReadFile(storage.absoluteIcebergPath(NATIVE_TABLES_FILE_NAME))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read native tables file: %v", err)
+	}
+	return storage.storageBase.ParseNativeTables(nativeTablesContent)
+}
+
 func (storage *StorageLocal) absoluteIcebergPath(relativePaths ...string) string {
 	execPath, err := os.Getwd()
 	PanicIfError(err)
@@ -65,6 +110,32 @@ func (storage *StorageLocal) absoluteIcebergPath(relativePaths ...string) string
 
 // Write ---------------------------------------------------------------------------------------------------------------
 
+func (storage *StorageLocal) MetadataVersion(schemaTable IcebergSchemaTable) (version int64, err error) {
+	return storage.metadataVersion(storage.tablePath(schemaTable))
+}
+
+func (storage *StorageLocal) CurrentSnapshot(schemaTable IcebergSchemaTable, version int64) (snapshot IcebergSnapshot, err error) {
+	metadataContent, err := os.ReadFile(filepath.Join(storage.tablePath(schemaTable), "metadata", storage.storageBase.MetadataFileName(version)))
+	if err != nil {
+		return IcebergSnapshot{}, fmt.Errorf("failed to read metadata file: %v", err)
+	}
+	snapshot, manifestListPath, err := storage.storageBase.ParseCurrentSnapshot(metadataContent)
+	if err != nil {
+		return IcebergSnapshot{}, err
+	}
+
+	manifestListContent, err := os.ReadFile(strings.TrimPrefix(manifestListPath, storage.fileSystemPrefix()))
+	if err != nil {
+		return IcebergSnapshot{}, fmt.Errorf("failed to read manifest list file: %v", err)
+	}
+	snapshot.ManifestListRecords, err = storage.storageBase.ReadManifestListRecords(manifestListContent)
+	if err != nil {
+		return IcebergSnapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
 func (storage *StorageLocal) DeleteSchema(schema string) error {
 	schemaPath := storage.absoluteIcebergPath(schema)
 
@@ -89,17 +160,43 @@ func (storage *StorageLocal) DeleteSchemaTable(schemaTable IcebergSchemaTable) e
 	return nil
 }
 
-func (storage *StorageLocal) CreateDataDir(schemaTable IcebergSchemaTable) string {
+func (storage *StorageLocal) DeleteOldVersions(schemaTable IcebergSchemaTable, minVersion int64) error {
 	tablePath := storage.tablePath(schemaTable)
-	dataPath := filepath.Join(tablePath, "data")
+
+	for _, dirName := range []string{"data", "metadata"} {
+		dirPath := filepath.Join(tablePath, dirName)
+		entries, err := os.ReadDir(dirPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if storage.storageBase.IsOldVersionEntry(entry.Name(), minVersion) {
+				err = os.RemoveAll(filepath.Join(dirPath, entry.Name()))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (storage *StorageLocal) CreateDataDir(schemaTable IcebergSchemaTable, version int64) string {
+	tablePath := storage.tablePath(schemaTable)
+	dataPath := filepath.Join(tablePath, "data", fmt.Sprintf("v%d", version))
 	err := os.MkdirAll(dataPath, os.ModePerm)
 	PanicIfError(err)
 	return dataPath
 }
 
-func (storage *StorageLocal) CreateMetadataDir(schemaTable IcebergSchemaTable) string {
+func (storage *StorageLocal) CreateMetadataDir(schemaTable IcebergSchemaTable, version int64) string {
 	tablePath := storage.tablePath(schemaTable)
-	metadataPath := filepath.Join(tablePath, "metadata")
+	metadataPath := filepath.Join(tablePath, "metadata", fmt.Sprintf("v%d", version))
 	err := os.MkdirAll(metadataPath, os.ModePerm)
 	PanicIfError(err)
 	return metadataPath
@@ -158,11 +255,11 @@ func (storage *StorageLocal) CreateManifest(metadataDirPath string, parquetFile
 	return manifestFile, nil
 }
 
-func (storage *StorageLocal) CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile) (manifestListFile ManifestListFile, err error) {
+func (storage *StorageLocal) CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile, previousSnapshot IcebergSnapshot) (manifestListFile ManifestListFile, err error) {
 	fileName := fmt.Sprintf("snap-%d-0-%s.avro", manifestFile.SnapshotId, parquetFile.Uuid)
 	filePath := filepath.Join(metadataDirPath, fileName)
 
-	err = storage.storageBase.WriteManifestListFile(storage.fileSystemPrefix(), filePath, parquetFile, manifestFile)
+	err = storage.storageBase.WriteManifestListFile(storage.fileSystemPrefix(), filePath, parquetFile, manifestFile, previousSnapshot)
 	if err != nil {
 		return ManifestListFile{}, err
 	}
@@ -171,12 +268,11 @@ func (storage *StorageLocal) CreateManifestList(metadataDirPath string, parquetF
 	return ManifestListFile{Path: filePath}, nil
 }
 
-func (storage *StorageLocal) CreateMetadata(metadataDirPath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
-	version := int64(1)
-	fileName := fmt.Sprintf("v%d.metadata.json", version)
-	filePath := filepath.Join(metadataDirPath, fileName)
+func (storage *StorageLocal) CreateMetadata(schemaTable IcebergSchemaTable, version int64, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile, previousSnapshot IcebergSnapshot) (metadataFile MetadataFile, err error) {
+	fileName := storage.storageBase.MetadataFileName(version)
+	filePath := filepath.Join(storage.tablePath(schemaTable), "metadata", fileName)
 
-	err = storage.storageBase.WriteMetadataFile(storage.fileSystemPrefix(), filePath, pgSchemaColumns, parquetFile, manifestFile, manifestListFile)
+	err = storage.storageBase.WriteMetadataFile(storage.fileSystemPrefix(), filePath, pgSchemaColumns, parquetFile, manifestFile, manifestListFile, previousSnapshot)
 	if err != nil {
 		return MetadataFile{}, err
 	}
@@ -185,18 +281,68 @@ func (storage *StorageLocal) CreateMetadata(metadataDirPath string, pgSchemaColu
 	return MetadataFile{Version: version, Path: filePath}, nil
 }
 
-func (storage *StorageLocal) CreateVersionHint(metadataDirPath string, metadataFile MetadataFile) (err error) {
-	filePath := filepath.Join(metadataDirPath, VERSION_HINT_FILE_NAME)
+func (storage *StorageLocal) CreateVersionHint(schemaTable IcebergSchemaTable, metadataFile MetadataFile) (err error) {
+	filePath := filepath.Join(storage.tablePath(schemaTable), "metadata", VERSION_HINT_FILE_NAME)
 
-	err = storage.storageBase.WriteVersionHintFile(filePath, metadataFile)
+	// Replace the version hint atomically, so that readers never see a partially written file
+	tempFilePath := filePath + ".tmp"
+	err = storage.storageBase.WriteVersionHintFile(tempFilePath, metadataFile)
 	if err != nil {
 		return err
 	}
+	err = os.Rename(tempFilePath, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace version hint file: %v", err)
+	}
 	LogDebug(storage.config, "Version hint file created at:", filePath)
 
 	return nil
 }
 
+func (storage *StorageLocal) WriteViewDefinitions(viewDefinitions []ViewDefinition) (err error) {
+	err = os.MkdirAll(storage.absoluteIcebergPath(), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
+
+	// Replace the file atomically, so that other instances never read a partially written file
+	filePath := storage.absoluteIcebergPath(VIEW_DEFINITIONS_FILE_NAME)
+	tempFilePath := filePath + ".tmp"
+	err = storage.storageBase.WriteViewDefinitionsFile(tempFilePath, viewDefinitions)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tempFilePath, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace view definitions file: %v", err)
+	}
+	LogDebug(storage.config, "View definitions file written at:", filePath)
+
+	return nil
+}
+
+func (storage *StorageLocal) WriteNativeTables(nativeTables []NativeTable) (err error) {
+	err = os.MkdirAll(storage.absoluteIcebergPath(), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
+
+	// Replace the file atomically, so that other instances never read a partially written file
+	filePath := storage.absoluteIcebergPath(NATIVE_TABLES_FILE_NAME)
+	tempFilePath := filePath + ".tmp"
+	err = storage.storageBase.WriteNativeTablesFile(tempFilePath, nativeTables)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tempFilePath, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace native tables file: %v", err)
+	}
+	LogDebug(storage.config, "Native tables file written at:", filePath)
+
+	return nil
+}
+
 func (storage *StorageLocal) tablePath(schemaTable IcebergSchemaTable, isIcebergSchemaTable ...bool) string {
 	if len(isIcebergSchemaTable) > 0 && isIcebergSchemaTable[0] {
 		return storage.absoluteIcebergPath(schemaTable.Schema, schemaTable.Table)
@@ -204,6 +350,17 @@ func (storage *StorageLocal) tablePath(schemaTable IcebergSchemaTable, isIceberg
 	return storage.absoluteIcebergPath(storage.config.Pg.SchemaPrefix+schemaTable.Schema, schemaTable.Table)
 }
 
+func (storage *StorageLocal) metadataVersion(tablePath string) (version int64, err error) {
+	versionHint, err := os.ReadFile(filepath.Join(tablePath, "metadata", VERSION_HINT_FILE_NAME))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read version hint file: %v", err)
+	}
+	return storage.storageBase.ParseVersionHint(versionHint)
+}
+
 func (storage *StorageLocal) fileSystemPrefix() string {
 	return ""
 }
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -52,7 +54,38 @@ func NewS3Storage(config *Config) *StorageS3 {
 // Read ----------------------------------------------------------------------------------------------------------------
 
 func (storage *StorageS3) IcebergMetadataFilePath(icebergSchemaTable IcebergSchemaTable) string {
-	return storage.fullBucketPath() + storage.tablePrefix(icebergSchemaTable, true) + "metadata/v1.metadata.json"
+	tablePrefix := storage.tablePrefix(icebergSchemaTable, true)
+	version, err := storage.metadataVersion(tablePrefix)
+	if err != nil || version == 0 {
+		version = 1
+	}
+	return storage.fullBucketPath() + tablePrefix + "metadata/" + storage.storageBase.MetadataFileName(version)
+}
+
+func (storage *StorageS3) IcebergSchemaFields(metadataFilePath string) (icebergSchemaFields []IcebergSchemaField, err error) {
+	getResponse, err := storage.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(strings.TrimPrefix(metadataFilePath, storage.fullBucketPath())),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata file: %v", err)
+	}
+	defer getResponse.Body.Close()
+
+	metadataContent, err := io.ReadAll(getResponse.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata file: %v", err)
+	}
+	return storage.storageBase.ParseIcebergSchemaFields(metadataContent)
+}
+
+func (storage *StorageS3) IcebergSnapshotSummary(metadataFilePath string) (snapshot IcebergSnapshot, err error) {
+	metadataContent, err := storage.readObject(strings.TrimPrefix(metadataFilePath, storage.fullBucketPath()))
+	if err != nil {
+		return IcebergSnapshot{}, fmt.Errorf("failed to read metadata file: %v", err)
+	}
+	snapshot, _, err = storage.storageBase.ParseCurrentSnapshot(metadataContent)
+	return snapshot, err
 }
 
 func (storage *StorageS3) IcebergSchemas() (icebergSchemas []string, err error) {
@@ -93,25 +126,133 @@ func (storage *StorageS3) IcebergSchemaTables() (icebergSchemaTables []IcebergSc
 	return icebergSchemaTables, nil
 }
 
+func (storage *StorageS3) ViewDefinitions() (viewDefinitions []ViewDefinition, err error) {
+	getResponse, err := storage.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(storage.config.StoragePath + "/" + VIEW_DEFINITIONS_FILE_NAME),
+	})
+	var noSuchKeyErr *types.NoSuchKey
+	if errors.As(err, &noSuchKeyErr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get view definitions file: %v", err)
+	}
+	defer getResponse.Body.Close()
+
+	viewDefinitionsContent, err := io.ReadAll(getResponse.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read view definitions file: %v", err)
+	}
+	return storage.storageBase.ParseViewDefinitions(viewDefinitionsContent)
+}
+
+func (storage *StorageS3) NativeTables() (nativeTables []NativeTable, err error) {
+	getResponse, err := storage.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(storage.config.StoragePath + "/" + NATIVE_TABLES_FILE_NAME),
+	})
+	var noSuchKeyErr *types.NoSuchKey
+	if errors.As(err, &noSuchKeyErr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get native tables file: %v", err)
+	}
+	defer getResponse.Body.Close()
+
+	nativeTablesContent, err := io.ReadAll(getResponse.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read native tables file: %v", err)
+	}
+	return storage.storageBase.ParseNativeTables(nativeTablesContent)
+}
+
 // Write ---------------------------------------------------------------------------------------------------------------
 
 func (storage *StorageS3) DeleteSchema(schema string) (err error) {
 	return storage.deleteNestedObjects(storage.config.StoragePath + "/" + schema + "/")
 }
 
+func (storage *StorageS3) MetadataVersion(schemaTable IcebergSchemaTable) (version int64, err error) {
+	return storage.metadataVersion(storage.tablePrefix(schemaTable))
+}
+
+func (storage *StorageS3) CurrentSnapshot(schemaTable IcebergSchemaTable, version int64) (snapshot IcebergSnapshot, err error) {
+	metadataContent, err := storage.readObject(storage.tablePrefix(schemaTable) + "metadata/" + storage.storageBase.MetadataFileName(version))
+	if err != nil {
+		return IcebergSnapshot{}, fmt.Errorf("failed to read metadata file: %v", err)
+	}
+	snapshot, manifestListPath, err := storage.storageBase.ParseCurrentSnapshot(metadataContent)
+	if err != nil {
+		return IcebergSnapshot{}, err
+	}
+
+	manifestListContent, err := storage.readObject(strings.TrimPrefix(manifestListPath, storage.fullBucketPath()))
+	if err != nil {
+		return IcebergSnapshot{}, fmt.Errorf("failed to read manifest list file: %v", err)
+	}
+	snapshot.ManifestListRecords, err = storage.storageBase.ReadManifestListRecords(manifestListContent)
+	if err != nil {
+		return IcebergSnapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
 func (storage *StorageS3) DeleteSchemaTable(schemaTable IcebergSchemaTable) (err error) {
 	tablePrefix := storage.tablePrefix(schemaTable)
 	return storage.deleteNestedObjects(tablePrefix)
 }
 
-func (storage *StorageS3) CreateDataDir(schemaTable IcebergSchemaTable) (dataDirPath string) {
+func (storage *StorageS3) DeleteOldVersions(schemaTable IcebergSchemaTable, minVersion int64) (err error) {
+	ctx := context.Background()
 	tablePrefix := storage.tablePrefix(schemaTable)
-	return tablePrefix + "data"
+
+	var objectsToDelete []types.ObjectIdentifier
+	for _, dirName := range []string{"data", "metadata"} {
+		dirPrefix := tablePrefix + dirName + "/"
+		listResponse, err := storage.s3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(storage.config.Aws.S3Bucket),
+			Prefix: aws.String(dirPrefix),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %v", err)
+		}
+
+		for _, obj := range listResponse.Contents {
+			entryName := strings.Split(strings.TrimPrefix(*obj.Key, dirPrefix), "/")[0]
+			if storage.storageBase.IsOldVersionEntry(entryName, minVersion) {
+				LogDebug(storage.config, "Object to delete:", *obj.Key)
+				objectsToDelete = append(objectsToDelete, types.ObjectIdentifier{Key: obj.Key})
+			}
+		}
+	}
+
+	if len(objectsToDelete) > 0 {
+		_, err = storage.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(storage.config.Aws.S3Bucket),
+			Delete: &types.Delete{
+				Objects: objectsToDelete,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete objects: %v", err)
+		}
+	}
+
+	return nil
 }
 
-func (storage *StorageS3) CreateMetadataDir(schemaTable IcebergSchemaTable) (metadataDirPath string) {
+func (storage *StorageS3) CreateDataDir(schemaTable IcebergSchemaTable, version int64) (dataDirPath string) {
 	tablePrefix := storage.tablePrefix(schemaTable)
-	return tablePrefix + "metadata"
+	return tablePrefix + fmt.Sprintf("data/v%d", version)
+}
+
+func (storage *StorageS3) CreateMetadataDir(schemaTable IcebergSchemaTable, version int64) (metadataDirPath string) {
+	tablePrefix := storage.tablePrefix(schemaTable)
+	return tablePrefix + fmt.Sprintf("metadata/v%d", version)
 }
 
 func (storage *StorageS3) CreateParquet(dataDirPath string, pgSchemaColumns []PgSchemaColumn, loadRows func() [][]string) (parquetFile ParquetFile, err error) {
@@ -183,7 +324,7 @@ func (storage *StorageS3) CreateManifest(metadataDirPath string, parquetFile Par
 	return manifestFile, nil
 }
 
-func (storage *StorageS3) CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile) (manifestListFile ManifestListFile, err error) {
+func (storage *StorageS3) CreateManifestList(metadataDirPath string, parquetFile ParquetFile, manifestFile ManifestFile, previousSnapshot IcebergSnapshot) (manifestListFile ManifestListFile, err error) {
 	fileName := fmt.Sprintf("snap-%d-0-%s.avro", manifestFile.SnapshotId, parquetFile.Uuid)
 	filePath := metadataDirPath + "/" + fileName
 
@@ -193,7 +334,7 @@ func (storage *StorageS3) CreateManifestList(metadataDirPath string, parquetFile
 	}
 	defer DeleteTemporaryFile(tempFile)
 
-	err = storage.storageBase.WriteManifestListFile(storage.fullBucketPath(), tempFile.Name(), parquetFile, manifestFile)
+	err = storage.storageBase.WriteManifestListFile(storage.fullBucketPath(), tempFile.Name(), parquetFile, manifestFile, previousSnapshot)
 	if err != nil {
 		return ManifestListFile{}, err
 	}
@@ -207,10 +348,9 @@ func (storage *StorageS3) CreateManifestList(metadataDirPath string, parquetFile
 	return ManifestListFile{Path: filePath}, nil
 }
 
-func (storage *StorageS3) CreateMetadata(metadataDirPath string, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile) (metadataFile MetadataFile, err error) {
-	version := int64(1)
-	fileName := fmt.Sprintf("v%d.metadata.json", version)
-	filePath := metadataDirPath + "/" + fileName
+func (storage *StorageS3) CreateMetadata(schemaTable IcebergSchemaTable, version int64, pgSchemaColumns []PgSchemaColumn, parquetFile ParquetFile, manifestFile ManifestFile, manifestListFile ManifestListFile, previousSnapshot IcebergSnapshot) (metadataFile MetadataFile, err error) {
+	fileName := storage.storageBase.MetadataFileName(version)
+	filePath := storage.tablePrefix(schemaTable) + "metadata/" + fileName
 
 	tempFile, err := CreateTemporaryFile("manifest")
 	if err != nil {
@@ -218,7 +358,7 @@ func (storage *StorageS3) CreateMetadata(metadataDirPath string, pgSchemaColumns
 	}
 	defer DeleteTemporaryFile(tempFile)
 
-	err = storage.storageBase.WriteMetadataFile(storage.fullBucketPath(), tempFile.Name(), pgSchemaColumns, parquetFile, manifestFile, manifestListFile)
+	err = storage.storageBase.WriteMetadataFile(storage.fullBucketPath(), tempFile.Name(), pgSchemaColumns, parquetFile, manifestFile, manifestListFile, previousSnapshot)
 	if err != nil {
 		return MetadataFile{}, err
 	}
@@ -232,8 +372,8 @@ func (storage *StorageS3) CreateMetadata(metadataDirPath string, pgSchemaColumns
 	return MetadataFile{Version: version, Path: filePath}, nil
 }
 
-func (storage *StorageS3) CreateVersionHint(metadataDirPath string, metadataFile MetadataFile) (err error) {
-	filePath := metadataDirPath + "/" + VERSION_HINT_FILE_NAME
+func (storage *StorageS3) CreateVersionHint(schemaTable IcebergSchemaTable, metadataFile MetadataFile) (err error) {
+	filePath := storage.tablePrefix(schemaTable) + "metadata/" + VERSION_HINT_FILE_NAME
 
 	tempFile, err := CreateTemporaryFile("manifest")
 	if err != nil {
@@ -255,6 +395,65 @@ func (storage *StorageS3) CreateVersionHint(metadataDirPath string, metadataFile
 	return nil
 }
 
+func (storage *StorageS3) WriteViewDefinitions(viewDefinitions []ViewDefinition) (err error) {
+	filePath := storage.config.StoragePath + "/" + VIEW_DEFINITIONS_FILE_NAME
+
+	tempFile, err := CreateTemporaryFile("views")
+	if err != nil {
+		return err
+	}
+	defer DeleteTemporaryFile(tempFile)
+
+	err = storage.storageBase.WriteViewDefinitionsFile(tempFile.Name(), viewDefinitions)
+	if err != nil {
+		return err
+	}
+
+	err = storage.uploadFile(filePath, tempFile)
+	if err != nil {
+		return err
+	}
+	LogDebug(storage.config, "View definitions file written at:", filePath)
+
+	return nil
+}
+
+func (storage *StorageS3) WriteNativeTables(nativeTables []NativeTable) (err error) {
+	filePath := storage.config.StoragePath + "/" + NATIVE_TABLES_FILE_NAME
+
+	tempFile, err := CreateTemporaryFile("tables")
+	if err != nil {
+		return err
+	}
+	defer DeleteTemporaryFile(tempFile)
+
+	err = storage.storageBase.WriteNativeTablesFile(tempFile.Name(), nativeTables)
+	if err != nil {
+		return err
+	}
+
+	err = storage.uploadFile(filePath, tempFile)
+	if err != nil {
+		return err
+	}
+	LogDebug(storage.config, "Native tables file written at:", filePath)
+
+	return nil
+}
+
+func (storage *StorageS3) readObject(key string) (content []byte, err error) {
+	getResponse, err := storage.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer getResponse.Body.Close()
+
+	return io.ReadAll(getResponse.Body)
+}
+
 func (storage *StorageS3) uploadFile(filePath string, file *os.File) (err error) {
 	uploader := manager.NewUploader(storage.s3Client)
 
@@ -278,6 +477,27 @@ func (storage *StorageS3) tablePrefix(schemaTable IcebergSchemaTable, isIcebergS
 	return storage.config.StoragePath + "/" + storage.config.Pg.SchemaPrefix + schemaTable.Schema + "/" + schemaTable.Table + "/"
 }
 
+func (storage *StorageS3) metadataVersion(tablePrefix string) (version int64, err error) {
+	getResponse, err := storage.s3Client.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(storage.config.Aws.S3Bucket),
+		Key:    aws.String(tablePrefix + "metadata/" + VERSION_HINT_FILE_NAME),
+	})
+	var noSuchKeyErr *types.NoSuchKey
+	if errors.As(err, &noSuchKeyErr) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get version hint file: %v", err)
+	}
+	defer getResponse.Body.Close()
+
+	versionHint, err := io.ReadAll(getResponse.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read version hint file: %v", err)
+	}
+	return storage.storageBase.ParseVersionHint(versionHint)
+}
+
 func (storage *StorageS3) fullBucketPath() string {
 	return "s3://" + storage.config.Aws.S3Bucket + "/"
 }
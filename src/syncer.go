@@ -43,7 +43,8 @@ func NewSyncer(config *Config) *Syncer {
 	return &Syncer{config: config, icebergWriter: icebergWriter, icebergReader: icebergReader}
 }
 
-func (syncer *Syncer) SyncFromPostgres() {
+// Stops between tables once shutdownCtx is canceled, so that the table being synced is completed
+func (syncer *Syncer) SyncFromPostgres(shutdownCtx context.Context) {
 	ctx := context.Background()
 	databaseUrl := syncer.urlEncodePassword(syncer.config.Pg.DatabaseUrl)
 	syncer.sendTelemetry(databaseUrl)
@@ -55,10 +56,21 @@ func (syncer *Syncer) SyncFromPostgres() {
 	_, err = conn.Exec(ctx, "BEGIN TRANSACTION ISOLATION LEVEL SERIALIZABLE READ ONLY DEFERRABLE")
 	PanicIfError(err)
 
+	nativeTables, err := syncer.icebergReader.NativeTables()
+	PanicIfError(err)
+
 	pgSchemaTables := []PgSchemaTable{}
 	for _, schema := range syncer.listPgSchemas(conn) {
 		for _, pgSchemaTable := range syncer.listPgSchemaTables(conn, schema) {
+			if shutdownCtx.Err() != nil {
+				LogInfo(syncer.config, "Sync interrupted, skipping the remaining tables")
+				return // Old tables aren't deleted since not all tables have been listed
+			}
 			if syncer.shouldSyncTable(pgSchemaTable) {
+				if syncer.isNativeTable(nativeTables, pgSchemaTable) {
+					LogWarn(syncer.config, "Skipping", pgSchemaTable.String(), "which conflicts with a table created with CREATE TABLE")
+					continue
+				}
 				pgSchemaTables = append(pgSchemaTables, pgSchemaTable)
 				syncer.syncFromPgTable(conn, pgSchemaTable)
 			}
@@ -68,6 +80,10 @@ func (syncer *Syncer) SyncFromPostgres() {
 	if syncer.config.Pg.SchemaPrefix == "" {
 		syncer.deleteOldIcebergSchemaTables(pgSchemaTables)
 	}
+
+	if syncer.config.Pg.RefreshMaterializedViews {
+		syncer.refreshMaterializedViews()
+	}
 }
 
 // Example:
@@ -127,6 +143,16 @@ func (syncer *Syncer) shouldSyncTable(schemaTable PgSchemaTable) bool {
 	return true
 }
 
+// Tables created with CREATE TABLE are never overwritten by syncs
+func (syncer *Syncer) isNativeTable(nativeTables []NativeTable, pgSchemaTable PgSchemaTable) bool {
+	for _, nativeTable := range nativeTables {
+		if nativeTable.Schema == syncer.config.Pg.SchemaPrefix+pgSchemaTable.Schema && nativeTable.Name == pgSchemaTable.Table {
+			return true
+		}
+	}
+	return false
+}
+
 func (syncer *Syncer) listPgSchemas(conn *pgx.Conn) []string {
 	var schemas []string
 
@@ -289,6 +315,7 @@ func (syncer *Syncer) exportPgTableToCsv(conn *pgx.Conn, pgSchemaTable PgSchemaT
 	return os.Open(tempFile.Name())
 }
 
+// Materialized views and tables created with CREATE TABLE are Iceberg tables without PostgreSQL tables, so they're kept
 func (syncer *Syncer) deleteOldIcebergSchemaTables(pgSchemaTables []PgSchemaTable) {
 	var prefixedPgSchemaTables []PgSchemaTable
 	for _, pgSchemaTable := range pgSchemaTables {
@@ -298,6 +325,19 @@ func (syncer *Syncer) deleteOldIcebergSchemaTables(pgSchemaTables []PgSchemaTabl
 		)
 	}
 
+	viewDefinitions, err := syncer.icebergReader.ViewDefinitions()
+	PanicIfError(err)
+	for _, viewDefinition := range viewDefinitions {
+		if viewDefinition.Materialized {
+			prefixedPgSchemaTables = append(prefixedPgSchemaTables, PgSchemaTable{Schema: viewDefinition.Schema, Table: viewDefinition.Name})
+		}
+	}
+	nativeTables, err := syncer.icebergReader.NativeTables()
+	PanicIfError(err)
+	for _, nativeTable := range nativeTables {
+		prefixedPgSchemaTables = append(prefixedPgSchemaTables, PgSchemaTable{Schema: nativeTable.Schema, Table: nativeTable.Name})
+	}
+
 	icebergSchemas, err := syncer.icebergReader.Schemas()
 	PanicIfError(err)
 
@@ -335,6 +375,15 @@ func (syncer *Syncer) deleteOldIcebergSchemaTables(pgSchemaTables []PgSchemaTabl
 	}
 }
 
+// Runs the materialized view queries on the synced Iceberg tables and writes new snapshots
+func (syncer *Syncer) refreshMaterializedViews() {
+	duckdb := NewDuckdb(syncer.config)
+	defer duckdb.Close()
+
+	queryRemapper := NewQueryRemapper(syncer.config, syncer.icebergReader, duckdb)
+	queryRemapper.remapperView.RefreshMaterializedViews()
+}
+
 func (syncer *Syncer) isLocalHost(hostname string) bool {
 	switch hostname {
 	case "localhost", "127.0.0.1", "::1", "0.0.0.0":